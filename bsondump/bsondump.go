@@ -29,6 +29,15 @@ type BSONDump struct {
 	Out io.WriteCloser
 
 	BSONSource *db.BSONSource
+
+	// JSONSource is the input of FromJSON, which reads JSON rather than BSON.
+	JSONSource io.Reader
+
+	// Filter, if set, selects and projects the documents that are displayed.
+	Filter *Filter
+
+	// JSONFormat is the flavor of Extended JSON that JSON writes and FromJSON reads.
+	JSONFormat json.Format
 }
 
 type ReadNopCloser struct {
@@ -70,14 +79,14 @@ func (bdo *BSONDumpOptions) GetBSONReader() (io.ReadCloser, error) {
 	return ReadNopCloser{os.Stdin}, nil
 }
 
-func formatJSON(doc *bson.Raw, pretty bool) ([]byte, error) {
+func formatJSON(doc *bson.Raw, pretty bool, format json.Format) ([]byte, error) {
 	decodedDoc := bson.D{}
 	err := bson.Unmarshal(doc.Data, &decodedDoc)
 	if err != nil {
 		return nil, err
 	}
 
-	extendedDoc, err := bsonutil.ConvertBSONValueToJSON(decodedDoc)
+	extendedDoc, err := bsonutil.ConvertBSONValueToExtendedJSON(decodedDoc, format)
 	if err != nil {
 		return nil, fmt.Errorf("error converting BSON to extended JSON: %v", err)
 	}
@@ -109,7 +118,20 @@ func (bd *BSONDump) JSON() (int, error) {
 
 	var result bson.Raw
 	for decodedStream.Next(&result) {
-		if bytes, err := formatJSON(&result, bd.BSONDumpOptions.Pretty); err != nil {
+		selected, err := bd.selectDocument(result.Data, numFound)
+		if err != nil {
+			if bd.BSONDumpOptions.ObjCheck {
+				return numFound, err
+			}
+			numFound++
+			continue
+		}
+		if selected == nil {
+			continue
+		}
+		result.Data = selected
+
+		if bytes, err := formatJSON(&result, bd.BSONDumpOptions.Pretty, bd.JSONFormat); err != nil {
 			log.Logvf(log.Always, "unable to dump document %v: %v", numFound+1, err)
 
 			//if objcheck is turned on, stop now. otherwise keep on dumpin'
@@ -159,7 +181,17 @@ func (bd *BSONDump) Debug() (int, error) {
 				return numFound, fmt.Errorf("failed to validate bson during objcheck: %v", err)
 			}
 		}
-		err := printBSON(result, 0, bd.Out)
+		selected, err := bd.selectDocument(result.Data, numFound)
+		if err != nil {
+			numFound++
+			continue
+		}
+		if selected == nil {
+			continue
+		}
+		result.Data = selected
+
+		err = printBSON(result, 0, bd.Out)
 		if err != nil {
 			log.Logvf(log.Always, "encountered error debugging BSON data: %v", err)
 		}
@@ -176,6 +208,19 @@ func (bd *BSONDump) Debug() (int, error) {
 	return numFound, nil
 }
 
+// selectDocument applies the Filter, if any, to the document in data, returning
+// the document to display, or nil if it should be skipped.
+func (bd *BSONDump) selectDocument(data []byte, numFound int) ([]byte, error) {
+	if bd.Filter == nil {
+		return data, nil
+	}
+	selected, err := bd.Filter.Select(data)
+	if err != nil {
+		log.Logvf(log.Always, "unable to filter document %v: %v", numFound+1, err)
+	}
+	return selected, err
+}
+
 func printBSON(raw bson.Raw, indentLevel int, out io.Writer) error {
 	indent := strings.Repeat("\t", indentLevel)
 	fmt.Fprintf(out, "%v--- new object ---\n", indent)
@@ -0,0 +1,508 @@
+package bsondump
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mongodb/mongo-tools/common/bsonutil"
+	"github.com/mongodb/mongo-tools/common/json"
+	"github.com/mongodb/mongo-tools/common/util"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// Filter selects the documents bsondump outputs with a query, and projects them
+// onto a list of fields, without the help of a server. It supports a subset of
+// the query language: equality, $eq, $ne, $gt, $gte, $lt, $lte, $in, $nin,
+// $exists, $regex, $not, and $and, $or and $nor, on dotted paths that descend
+// into arrays the way the server does.
+type Filter struct {
+	query  bson.D
+	fields [][]string
+}
+
+// NewFilter parses query, a document in extended JSON, and fields, a comma
+// separated list of field paths. It returns nil if both are empty.
+func NewFilter(query, fields string) (*Filter, error) {
+	if query == "" && fields == "" {
+		return nil, nil
+	}
+	filter := &Filter{}
+	if query != "" {
+		parsed, err := json.UnmarshalBsonD([]byte(query))
+		if err != nil {
+			return nil, fmt.Errorf("filter '%v' is not valid JSON: %v", query, err)
+		}
+		filter.query, err = bsonutil.GetExtendedBsonD(parsed)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing filter '%v': %v", query, err)
+		}
+		// every operator is evaluated against every document, so matching an
+		// empty document catches unsupported operators before the first one
+		if _, err = matchDocument(bson.D{}, filter.query); err != nil {
+			return nil, fmt.Errorf("error parsing filter '%v': %v", query, err)
+		}
+	}
+	for _, field := range strings.Split(fields, ",") {
+		field = strings.TrimSpace(field)
+		if field != "" {
+			filter.fields = append(filter.fields, strings.Split(field, "."))
+		}
+	}
+	if len(filter.fields) > 0 {
+		// like the server, projections include _id
+		filter.fields = append(filter.fields, []string{"_id"})
+	}
+	return filter, nil
+}
+
+// Select returns the BSON document in data if it matches the filter's query,
+// projected onto the filter's fields. It returns nil if the document doesn't match.
+func (filter *Filter) Select(data []byte) ([]byte, error) {
+	doc := bson.D{}
+	if err := bson.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	matched, err := matchDocument(doc, filter.query)
+	if err != nil || !matched {
+		return nil, err
+	}
+	if len(filter.fields) == 0 {
+		return data, nil
+	}
+	return bson.Marshal(projectDocument(doc, filter.fields))
+}
+
+// asDocument returns value as a bson.D, if it is a document.
+func asDocument(value interface{}) (bson.D, bool) {
+	switch v := value.(type) {
+	case bson.D:
+		return v, true
+	case bson.M:
+		return mapToD(v), true
+	case map[string]interface{}:
+		return mapToD(v), true
+	}
+	return nil, false
+}
+
+func mapToD(m map[string]interface{}) bson.D {
+	doc := bson.D{}
+	for key, value := range m {
+		doc = append(doc, bson.DocElem{Name: key, Value: value})
+	}
+	return doc
+}
+
+// isOperatorDocument returns true if value is a document of query operators,
+// such as {$gt: 1}, rather than a document to compare against.
+func isOperatorDocument(value interface{}) bool {
+	doc, ok := asDocument(value)
+	return ok && len(doc) > 0 && strings.HasPrefix(doc[0].Name, "$")
+}
+
+func matchDocument(doc bson.D, query bson.D) (bool, error) {
+	allMatched := true
+	for _, elem := range query {
+		var matched bool
+		var err error
+		switch elem.Name {
+		case "$and", "$or", "$nor":
+			matched, err = matchLogical(doc, elem.Name, elem.Value)
+		default:
+			if strings.HasPrefix(elem.Name, "$") {
+				return false, fmt.Errorf("unsupported top level operator %v", elem.Name)
+			}
+			matched, err = matchCondition(lookup(doc, strings.Split(elem.Name, ".")), elem.Value)
+		}
+		if err != nil {
+			return false, err
+		}
+		allMatched = allMatched && matched
+	}
+	return allMatched, nil
+}
+
+func matchLogical(doc bson.D, operator string, value interface{}) (bool, error) {
+	clauses, ok := value.([]interface{})
+	if !ok || len(clauses) == 0 {
+		return false, fmt.Errorf("%v must be a non-empty array", operator)
+	}
+	// evaluate every clause, so that errors are found whatever the document
+	matches := 0
+	for _, clause := range clauses {
+		query, ok := asDocument(clause)
+		if !ok {
+			return false, fmt.Errorf("%v must be an array of documents", operator)
+		}
+		matched, err := matchDocument(doc, query)
+		if err != nil {
+			return false, err
+		}
+		if matched {
+			matches++
+		}
+	}
+	switch operator {
+	case "$and":
+		return matches == len(clauses), nil
+	case "$or":
+		return matches > 0, nil
+	}
+	return matches == 0, nil
+}
+
+// lookup returns the values found at path in value. Arrays along the way are
+// descended into, so that {"a.b": 1} matches {a: [{b: 1}]}, and numeric path
+// components also index into them.
+func lookup(value interface{}, path []string) []interface{} {
+	if len(path) == 0 {
+		return []interface{}{value}
+	}
+	if doc, ok := asDocument(value); ok {
+		for _, elem := range doc {
+			if elem.Name == path[0] {
+				return lookup(elem.Value, path[1:])
+			}
+		}
+		return nil
+	}
+	array, ok := value.([]interface{})
+	if !ok {
+		return nil
+	}
+	var found []interface{}
+	if index, err := strconv.Atoi(path[0]); err == nil && index >= 0 && index < len(array) {
+		found = append(found, lookup(array[index], path[1:])...)
+	}
+	for _, elem := range array {
+		if _, ok := asDocument(elem); ok {
+			found = append(found, lookup(elem, path)...)
+		}
+	}
+	return found
+}
+
+// candidates returns the values to compare against a condition: the values that
+// were found, and the elements of those that are arrays.
+func candidates(found []interface{}) []interface{} {
+	var values []interface{}
+	for _, value := range found {
+		values = append(values, value)
+		if array, ok := value.([]interface{}); ok {
+			values = append(values, array...)
+		}
+	}
+	return values
+}
+
+func matchCondition(found []interface{}, condition interface{}) (bool, error) {
+	if !isOperatorDocument(condition) {
+		return matchEquality(found, condition)
+	}
+	operators, _ := asDocument(condition)
+	// evaluate every operator, so that errors are found whatever the document
+	allMatched := true
+	for _, elem := range operators {
+		var matched bool
+		var err error
+		switch elem.Name {
+		case "$eq":
+			matched, err = matchEquality(found, elem.Value)
+		case "$ne":
+			matched, err = matchEquality(found, elem.Value)
+			matched = !matched
+		case "$gt", "$gte", "$lt", "$lte":
+			matched = matchComparison(found, elem.Name, elem.Value)
+		case "$in", "$nin":
+			values, ok := elem.Value.([]interface{})
+			if !ok {
+				return false, fmt.Errorf("%v needs an array", elem.Name)
+			}
+			matched, err = matchIn(found, values)
+			if elem.Name == "$nin" {
+				matched = !matched
+			}
+		case "$exists":
+			matched = len(found) > 0 == util.IsTruthy(elem.Value)
+		case "$regex":
+			matched, err = matchRegexOperator(found, elem.Value, operators)
+		case "$options":
+			if !hasOperator(operators, "$regex") {
+				return false, fmt.Errorf("$options needs a $regex")
+			}
+			matched = true
+		case "$not":
+			if _, ok := elem.Value.(bson.RegEx); !ok && !isOperatorDocument(elem.Value) {
+				return false, fmt.Errorf("$not needs a regex or a document of operators")
+			}
+			matched, err = matchCondition(found, elem.Value)
+			matched = !matched
+		default:
+			return false, fmt.Errorf("unsupported operator %v", elem.Name)
+		}
+		if err != nil {
+			return false, err
+		}
+		allMatched = allMatched && matched
+	}
+	return allMatched, nil
+}
+
+func hasOperator(operators bson.D, name string) bool {
+	for _, elem := range operators {
+		if elem.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func matchEquality(found []interface{}, value interface{}) (bool, error) {
+	if regex, ok := value.(bson.RegEx); ok {
+		return matchRegex(found, regex)
+	}
+	if value == nil && len(found) == 0 {
+		// null matches missing fields
+		return true, nil
+	}
+	for _, candidate := range candidates(found) {
+		if equalValues(candidate, value) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func matchComparison(found []interface{}, operator string, value interface{}) bool {
+	for _, candidate := range candidates(found) {
+		order, ok := compareValues(candidate, value)
+		if !ok {
+			continue
+		}
+		switch {
+		case operator == "$gt" && order > 0,
+			operator == "$gte" && order >= 0,
+			operator == "$lt" && order < 0,
+			operator == "$lte" && order <= 0:
+			return true
+		}
+	}
+	return false
+}
+
+func matchIn(found []interface{}, values []interface{}) (bool, error) {
+	for _, value := range values {
+		if isOperatorDocument(value) {
+			return false, fmt.Errorf("cannot use operators inside $in")
+		}
+		matched, err := matchEquality(found, value)
+		if err != nil || matched {
+			return matched, err
+		}
+	}
+	return false, nil
+}
+
+func matchRegexOperator(found []interface{}, value interface{}, operators bson.D) (bool, error) {
+	regex := bson.RegEx{}
+	switch v := value.(type) {
+	case string:
+		regex.Pattern = v
+	case bson.RegEx:
+		regex = v
+	default:
+		return false, fmt.Errorf("$regex has to be a string")
+	}
+	for _, elem := range operators {
+		if elem.Name == "$options" {
+			options, ok := elem.Value.(string)
+			if !ok {
+				return false, fmt.Errorf("$options has to be a string")
+			}
+			regex.Options = options
+		}
+	}
+	return matchRegex(found, regex)
+}
+
+// matchRegex matches the strings among found against regex.
+func matchRegex(found []interface{}, regex bson.RegEx) (bool, error) {
+	flags := ""
+	for _, option := range regex.Options {
+		switch option {
+		case 'i', 'm', 's':
+			flags += string(option)
+		case 'g':
+		default:
+			return false, fmt.Errorf("unsupported regular expression option '%c'", option)
+		}
+	}
+	pattern := regex.Pattern
+	if flags != "" {
+		pattern = "(?" + flags + ")" + pattern
+	}
+	compiled, err := regexp.Compile(pattern)
+	if err != nil {
+		return false, fmt.Errorf("invalid regular expression '%v': %v", regex.Pattern, err)
+	}
+	for _, candidate := range candidates(found) {
+		switch v := candidate.(type) {
+		case string:
+			if compiled.MatchString(v) {
+				return true, nil
+			}
+		case bson.RegEx:
+			if v == regex {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+func isNumber(value interface{}) bool {
+	switch value.(type) {
+	case int, int32, int64, float64:
+		return true
+	}
+	return false
+}
+
+// compareValues orders a and b, returning false if they are of types that the
+// server wouldn't compare with each other in a query.
+func compareValues(a, b interface{}) (int, bool) {
+	if isNumber(a) && isNumber(b) {
+		x, _ := util.ToFloat64(a)
+		y, _ := util.ToFloat64(b)
+		return compareFloats(x, y), true
+	}
+	switch x := a.(type) {
+	case nil:
+		return 0, b == nil
+	case string:
+		if y, ok := b.(string); ok {
+			return strings.Compare(x, y), true
+		}
+	case bson.ObjectId:
+		if y, ok := b.(bson.ObjectId); ok {
+			return strings.Compare(string(x), string(y)), true
+		}
+	case time.Time:
+		if y, ok := b.(time.Time); ok {
+			switch {
+			case x.Before(y):
+				return -1, true
+			case x.After(y):
+				return 1, true
+			}
+			return 0, true
+		}
+	case bson.MongoTimestamp:
+		if y, ok := b.(bson.MongoTimestamp); ok {
+			return compareFloats(float64(uint64(x)), float64(uint64(y))), true
+		}
+	case bool:
+		if y, ok := b.(bool); ok {
+			switch {
+			case x == y:
+				return 0, true
+			case y:
+				return -1, true
+			}
+			return 1, true
+		}
+	}
+	return 0, false
+}
+
+func compareFloats(x, y float64) int {
+	switch {
+	case x < y:
+		return -1
+	case x > y:
+		return 1
+	}
+	return 0
+}
+
+func equalValues(a, b interface{}) bool {
+	if order, ok := compareValues(a, b); ok {
+		return order == 0
+	}
+	if x, ok := asDocument(a); ok {
+		y, ok := asDocument(b)
+		if !ok || len(x) != len(y) {
+			return false
+		}
+		for i := range x {
+			if x[i].Name != y[i].Name || !equalValues(x[i].Value, y[i].Value) {
+				return false
+			}
+		}
+		return true
+	}
+	if x, ok := a.([]interface{}); ok {
+		y, ok := b.([]interface{})
+		if !ok || len(x) != len(y) {
+			return false
+		}
+		for i := range x {
+			if !equalValues(x[i], y[i]) {
+				return false
+			}
+		}
+		return true
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+// projectDocument keeps the fields of doc that are at, or lead to, one of paths,
+// in their original order.
+func projectDocument(doc bson.D, paths [][]string) bson.D {
+	projected := bson.D{}
+	for _, elem := range doc {
+		var rest [][]string
+		whole := false
+		for _, path := range paths {
+			if path[0] != elem.Name {
+				continue
+			}
+			if len(path) == 1 {
+				whole = true
+				break
+			}
+			rest = append(rest, path[1:])
+		}
+		if whole {
+			projected = append(projected, elem)
+		} else if rest != nil {
+			if value, ok := projectValue(elem.Value, rest); ok {
+				projected = append(projected, bson.DocElem{Name: elem.Name, Value: value})
+			}
+		}
+	}
+	return projected
+}
+
+// projectValue projects the documents in value onto paths. Values that aren't
+// documents or arrays don't have the fields, and are left out.
+func projectValue(value interface{}, paths [][]string) (interface{}, bool) {
+	if doc, ok := asDocument(value); ok {
+		return projectDocument(doc, paths), true
+	}
+	array, ok := value.([]interface{})
+	if !ok {
+		return nil, false
+	}
+	projected := []interface{}{}
+	for _, elem := range array {
+		if value, ok := projectValue(elem, paths); ok {
+			projected = append(projected, value)
+		}
+	}
+	return projected, true
+}
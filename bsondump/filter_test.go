@@ -0,0 +1,119 @@
+package bsondump
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func selectDocument(filter *Filter, doc bson.D) bson.D {
+	data, err := bson.Marshal(doc)
+	So(err, ShouldBeNil)
+	selected, err := filter.Select(data)
+	So(err, ShouldBeNil)
+	if selected == nil {
+		return nil
+	}
+	result := bson.D{}
+	So(bson.Unmarshal(selected, &result), ShouldBeNil)
+	return result
+}
+
+func matches(query string, doc bson.D) bool {
+	filter, err := NewFilter(query, "")
+	So(err, ShouldBeNil)
+	return selectDocument(filter, doc) != nil
+}
+
+func TestFilter(t *testing.T) {
+	doc := bson.D{
+		{"_id", 1},
+		{"name", "Ada Lovelace"},
+		{"age", 36.5},
+		{"tags", []interface{}{"math", "poetry"}},
+		{"address", bson.D{{"city", "London"}, {"zip", "W1"}}},
+		{"children", []interface{}{
+			bson.D{{"name", "Byron"}, {"age", 12}},
+			bson.D{{"name", "Anne"}, {"age", 10}},
+		}},
+	}
+
+	Convey("With a document to filter", t, func() {
+		Convey("no query and no fields is no filter", func() {
+			filter, err := NewFilter("", "")
+			So(err, ShouldBeNil)
+			So(filter, ShouldBeNil)
+		})
+
+		Convey("equality matches fields, dotted paths, and array elements", func() {
+			So(matches(`{"name": "Ada Lovelace"}`, doc), ShouldBeTrue)
+			So(matches(`{"name": "Ada"}`, doc), ShouldBeFalse)
+			So(matches(`{"address.city": "London"}`, doc), ShouldBeTrue)
+			So(matches(`{"tags": "poetry"}`, doc), ShouldBeTrue)
+			So(matches(`{"tags": ["math", "poetry"]}`, doc), ShouldBeTrue)
+			So(matches(`{"children.name": "Anne"}`, doc), ShouldBeTrue)
+			So(matches(`{"children.1.name": "Anne"}`, doc), ShouldBeTrue)
+			So(matches(`{"children.0.name": "Anne"}`, doc), ShouldBeFalse)
+			So(matches(`{"missing": null}`, doc), ShouldBeTrue)
+			So(matches(`{"name": "Ada Lovelace", "age": 1}`, doc), ShouldBeFalse)
+		})
+
+		Convey("comparisons only compare values of comparable types", func() {
+			So(matches(`{"age": {"$gt": 36}}`, doc), ShouldBeTrue)
+			So(matches(`{"age": {"$gte": 36.5, "$lt": 40}}`, doc), ShouldBeTrue)
+			So(matches(`{"age": {"$lte": 36}}`, doc), ShouldBeFalse)
+			So(matches(`{"age": {"$gt": "a"}}`, doc), ShouldBeFalse)
+			So(matches(`{"children.age": {"$lt": 11}}`, doc), ShouldBeTrue)
+			So(matches(`{"_id": {"$ne": 2}}`, doc), ShouldBeTrue)
+			So(matches(`{"_id": {"$eq": NumberLong(1)}}`, doc), ShouldBeTrue)
+		})
+
+		Convey("$in, $nin and $exists", func() {
+			So(matches(`{"tags": {"$in": ["art", "math"]}}`, doc), ShouldBeTrue)
+			So(matches(`{"tags": {"$nin": ["art", "math"]}}`, doc), ShouldBeFalse)
+			So(matches(`{"address.zip": {"$exists": true}}`, doc), ShouldBeTrue)
+			So(matches(`{"address.street": {"$exists": true}}`, doc), ShouldBeFalse)
+			So(matches(`{"address.street": {"$exists": false}}`, doc), ShouldBeTrue)
+		})
+
+		Convey("regular expressions", func() {
+			So(matches(`{"name": {"$regex": "^ada", "$options": "i"}}`, doc), ShouldBeTrue)
+			So(matches(`{"name": {"$regex": "^ada"}}`, doc), ShouldBeFalse)
+			So(matches(`{"name": /Love/}`, doc), ShouldBeTrue)
+			So(matches(`{"tags": {"$in": [/^po/]}}`, doc), ShouldBeTrue)
+			So(matches(`{"name": {"$not": /Love/}}`, doc), ShouldBeFalse)
+		})
+
+		Convey("$and, $or and $nor", func() {
+			So(matches(`{"$or": [{"age": 1}, {"name": /Ada/}]}`, doc), ShouldBeTrue)
+			So(matches(`{"$and": [{"age": 1}, {"name": /Ada/}]}`, doc), ShouldBeFalse)
+			So(matches(`{"$nor": [{"age": 1}, {"tags": "art"}]}`, doc), ShouldBeTrue)
+		})
+
+		Convey("unsupported operators and bad JSON are errors", func() {
+			for _, query := range []string{
+				`{"name": {"$where": "true"}}`,
+				`{"$text": {"$search": "x"}}`,
+				`{"$or": {}}`,
+				`{"age": {"$gt": 1, "$in": 2}}`,
+				`{"name": /(/}`,
+				`{"name": `,
+			} {
+				_, err := NewFilter(query, "")
+				So(err, ShouldNotBeNil)
+			}
+		})
+
+		Convey("fields project the document, keeping _id and the original order", func() {
+			filter, err := NewFilter(`{"tags": "math"}`, "children.name, address.city,age")
+			So(err, ShouldBeNil)
+			So(selectDocument(filter, doc), ShouldResemble, bson.D{
+				{"_id", 1},
+				{"age", 36.5},
+				{"address", bson.D{{"city", "London"}}},
+				{"children", []interface{}{bson.D{{"name", "Byron"}}, bson.D{{"name", "Anne"}}}},
+			})
+		})
+	})
+}
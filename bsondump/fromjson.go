@@ -0,0 +1,135 @@
+package bsondump
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+
+	"github.com/mongodb/mongo-tools/common/bsonutil"
+	"github.com/mongodb/mongo-tools/common/json"
+)
+
+// jsonSource reads Extended JSON documents, in shell or strict mode or in
+// Extended JSON v2, that are either one after the other or the elements of a
+// single array.
+type jsonSource struct {
+	decoder *json.Decoder
+	// isArray is set once the opening bracket of an array has been read.
+	isArray bool
+	// numRead is the number of documents read so far.
+	numRead int
+}
+
+// newJSONSource returns a jsonSource that reads the given format. Only the
+// legacy format accepts shell mode values, like NumberLong(1).
+func newJSONSource(in io.Reader, format json.Format) *jsonSource {
+	decoder := json.NewDecoder(in)
+	if format == json.CanonicalFormat || format == json.RelaxedFormat {
+		decoder.DisallowShellMode()
+	}
+	return &jsonSource{decoder: decoder}
+}
+
+// peekByte returns the next byte of the input that isn't whitespace, without
+// consuming it. It returns io.EOF at the end of the input.
+func (js *jsonSource) peekByte() (byte, error) {
+	for {
+		for len(js.decoder.Buf) > 0 {
+			switch c := js.decoder.Buf[0]; c {
+			case ' ', '\t', '\r', '\n':
+				js.decoder.Buf = js.decoder.Buf[1:]
+			default:
+				return c, nil
+			}
+		}
+		buf := make([]byte, 4096)
+		n, err := js.decoder.R.Read(buf)
+		js.decoder.Buf = append(js.decoder.Buf, buf[:n]...)
+		if n == 0 && err != nil {
+			return 0, err
+		}
+	}
+}
+
+// next returns the next document of the input as BSON, or io.EOF once all of
+// them have been read.
+func (js *jsonSource) next() ([]byte, error) {
+	c, err := js.peekByte()
+	if err != nil {
+		if err == io.EOF && js.isArray {
+			return nil, fmt.Errorf("bad JSON array format - found no closing bracket ']' in input source")
+		}
+		return nil, err
+	}
+	if js.numRead == 0 && !js.isArray && c == json.ArrayStart {
+		js.isArray = true
+		js.decoder.Buf = js.decoder.Buf[1:]
+		return js.next()
+	}
+	if js.isArray {
+		if c == json.ArrayEnd {
+			js.decoder.Buf = js.decoder.Buf[1:]
+			if c, err = js.peekByte(); err != io.EOF {
+				if err == nil {
+					err = fmt.Errorf("bad JSON array format - found '%c' after ']' in input source", c)
+				}
+				return nil, err
+			}
+			return nil, io.EOF
+		}
+		if js.numRead > 0 {
+			if c != json.ArraySep {
+				return nil, fmt.Errorf("bad JSON array format - found '%c' instead of ',' or ']' after document #%v", c, js.numRead)
+			}
+			js.decoder.Buf = js.decoder.Buf[1:]
+		}
+	}
+
+	raw, err := js.decoder.ScanObject()
+	if err != nil {
+		return nil, fmt.Errorf("error reading document #%v: %v", js.numRead+1, err)
+	}
+	js.numRead++
+	data, err := bsonutil.ConvertJSONToBSON(raw)
+	if err != nil {
+		return nil, fmt.Errorf("error converting document #%v to BSON: %v", js.numRead, err)
+	}
+	return data, nil
+}
+
+// FromJSON reads Extended JSON documents from JSONSource, either one per line or
+// the elements of an array, and writes them to the output as BSON.
+// It returns the number of documents written and a non-nil error if one is
+// encountered before the end of the input is reached.
+func (bd *BSONDump) FromJSON() (int, error) {
+	numFound := 0
+
+	if bd.JSONSource == nil {
+		panic("Tried to call FromJSON() before opening file")
+	}
+
+	out := bufio.NewWriter(bd.Out)
+	source := newJSONSource(bd.JSONSource, bd.JSONFormat)
+	for {
+		data, err := source.next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return numFound, err
+		}
+
+		selected, err := bd.selectDocument(data, source.numRead-1)
+		if err != nil {
+			return numFound, err
+		}
+		if selected == nil {
+			continue
+		}
+		if _, err = out.Write(selected); err != nil {
+			return numFound, err
+		}
+		numFound++
+	}
+	return numFound, out.Flush()
+}
@@ -0,0 +1,131 @@
+package bsondump
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/mongodb/mongo-tools/common/db"
+	"github.com/mongodb/mongo-tools/common/json"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func convertFromJSON(input string) ([]bson.D, error) {
+	out := &bytes.Buffer{}
+	bd := &BSONDump{
+		BSONDumpOptions: &BSONDumpOptions{FromJSON: true},
+		JSONSource:      strings.NewReader(input),
+		Out:             WriteNopCloser{out},
+	}
+	numFound, err := bd.FromJSON()
+	if err != nil {
+		return nil, err
+	}
+	docs := []bson.D{}
+	source := db.NewBufferlessBSONSource(ioutil.NopCloser(out))
+	for data := source.LoadNext(); data != nil; data = source.LoadNext() {
+		doc := bson.D{}
+		So(bson.Unmarshal(data, &doc), ShouldBeNil)
+		docs = append(docs, doc)
+	}
+	So(source.Err(), ShouldBeNil)
+	So(len(docs), ShouldEqual, numFound)
+	return docs, nil
+}
+
+func TestFromJSON(t *testing.T) {
+	Convey("Converting Extended JSON to BSON", t, func() {
+		Convey("reproduces the BSON file the JSON was dumped from", func() {
+			original, err := ioutil.ReadFile("testdata/sample.bson")
+			So(err, ShouldBeNil)
+			in, err := os.Open("testdata/sample.json")
+			So(err, ShouldBeNil)
+			defer in.Close()
+			out := &bytes.Buffer{}
+			bd := &BSONDump{
+				BSONDumpOptions: &BSONDumpOptions{FromJSON: true},
+				JSONSource:      in,
+				Out:             WriteNopCloser{out},
+			}
+			numFound, err := bd.FromJSON()
+			So(err, ShouldBeNil)
+			So(numFound, ShouldEqual, 4)
+			So(out.Bytes(), ShouldResemble, original)
+		})
+
+		Convey("round-trips the BSON file through canonical Extended JSON", func() {
+			original, err := ioutil.ReadFile("testdata/sample.bson")
+			So(err, ShouldBeNil)
+			canonical := &bytes.Buffer{}
+			bd := &BSONDump{
+				BSONDumpOptions: &BSONDumpOptions{},
+				BSONSource:      db.NewBSONSource(ioutil.NopCloser(bytes.NewReader(original))),
+				Out:             WriteNopCloser{canonical},
+				JSONFormat:      json.CanonicalFormat,
+			}
+			_, err = bd.JSON()
+			So(err, ShouldBeNil)
+			So(canonical.String(), ShouldContainSubstring, `"$numberDouble"`)
+
+			out := &bytes.Buffer{}
+			bd = &BSONDump{
+				BSONDumpOptions: &BSONDumpOptions{FromJSON: true},
+				JSONSource:      canonical,
+				Out:             WriteNopCloser{out},
+				JSONFormat:      json.CanonicalFormat,
+			}
+			numFound, err := bd.FromJSON()
+			So(err, ShouldBeNil)
+			So(numFound, ShouldEqual, 4)
+			So(out.Bytes(), ShouldResemble, original)
+		})
+
+		Convey("rejects shell mode when reading Extended JSON v2", func() {
+			bd := &BSONDump{
+				BSONDumpOptions: &BSONDumpOptions{FromJSON: true},
+				JSONSource:      strings.NewReader(`{"a": NumberLong(1)}`),
+				Out:             WriteNopCloser{&bytes.Buffer{}},
+				JSONFormat:      json.RelaxedFormat,
+			}
+			_, err := bd.FromJSON()
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("reads documents in an array, in shell or strict mode", func() {
+			docs, err := convertFromJSON(`[ {"a": NumberLong(1)},
+				{"a": {"$numberLong": "2"}} , {b: ObjectId("546651e74bf6e4cb017c5312")} ]`)
+			So(err, ShouldBeNil)
+			So(docs, ShouldResemble, []bson.D{
+				{{"a", int64(1)}},
+				{{"a", int64(2)}},
+				{{"b", bson.ObjectIdHex("546651e74bf6e4cb017c5312")}},
+			})
+
+			docs, err = convertFromJSON(" [ ] ")
+			So(err, ShouldBeNil)
+			So(docs, ShouldBeEmpty)
+		})
+
+		Convey("keeps the order of fields", func() {
+			docs, err := convertFromJSON("{\"z\": 1, \"a\": {\"y\": 2, \"b\": 3}}\n")
+			So(err, ShouldBeNil)
+			So(docs, ShouldResemble, []bson.D{{{"z", 1}, {"a", bson.D{{"y", 2}, {"b", 3}}}}})
+		})
+
+		Convey("fails on malformed input", func() {
+			for _, input := range []string{
+				`[{"a": 1} {"a": 2}]`,
+				`[{"a": 1}`,
+				`[{"a": 1}] {"a": 2}`,
+				`{"a": 1} 5`,
+				`{"a": {"$oid": "not an id"}}`,
+			} {
+				_, err := convertFromJSON(input)
+				So(err, ShouldNotBeNil)
+			}
+		})
+	})
+}
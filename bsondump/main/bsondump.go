@@ -4,6 +4,7 @@ package main
 import (
 	"github.com/mongodb/mongo-tools/bsondump"
 	"github.com/mongodb/mongo-tools/common/db"
+	"github.com/mongodb/mongo-tools/common/json"
 	"github.com/mongodb/mongo-tools/common/log"
 	"github.com/mongodb/mongo-tools/common/options"
 	"github.com/mongodb/mongo-tools/common/signals"
@@ -53,9 +54,42 @@ func main() {
 		bsonDumpOpts.BSONFileName = args[0]
 	}
 
+	if bsonDumpOpts.Salvage {
+		if bsonDumpOpts.OutFileName == "" {
+			log.Logvf(log.Always, "--salvage requires --outFile, to write the recovered documents to")
+			os.Exit(util.ExitBadOptions)
+		}
+		if bsonDumpOpts.OutFileName == bsonDumpOpts.BSONFileName {
+			log.Logvf(log.Always, "--salvage has to write the recovered documents to a new file")
+			os.Exit(util.ExitBadOptions)
+		}
+		if bsonDumpOpts.Type != "json" {
+			log.Logvf(log.Always, "cannot use --type with --salvage, which writes BSON")
+			os.Exit(util.ExitBadOptions)
+		}
+	}
+
+	if bsonDumpOpts.FromJSON {
+		if bsonDumpOpts.Salvage {
+			log.Logvf(log.Always, "cannot use --salvage with --fromJSON")
+			os.Exit(util.ExitBadOptions)
+		}
+		if bsonDumpOpts.Type != "json" {
+			log.Logvf(log.Always, "cannot use --type with --fromJSON, which writes BSON")
+			os.Exit(util.ExitBadOptions)
+		}
+	}
+
+	jsonFormat, err := json.ParseFormat(bsonDumpOpts.JSONFormat)
+	if err != nil {
+		log.Logvf(log.Always, "error parsing --jsonFormat: %v", err)
+		os.Exit(util.ExitBadOptions)
+	}
+
 	dumper := bsondump.BSONDump{
 		ToolOptions:     opts,
 		BSONDumpOptions: bsonDumpOpts,
+		JSONFormat:      jsonFormat,
 	}
 
 	reader, err := bsonDumpOpts.GetBSONReader()
@@ -63,8 +97,15 @@ func main() {
 		log.Logvf(log.Always, "Getting BSON Reader Failed: %v", err)
 		os.Exit(util.ExitError)
 	}
-	dumper.BSONSource = db.NewBSONSource(reader)
-	defer dumper.BSONSource.Close()
+	defer reader.Close()
+	switch {
+	case bsonDumpOpts.FromJSON:
+		dumper.JSONSource = reader
+	case bsonDumpOpts.Salvage:
+		dumper.BSONSource = db.NewSalvagingBSONSource(reader)
+	default:
+		dumper.BSONSource = db.NewBSONSource(reader)
+	}
 
 	writer, err := bsonDumpOpts.GetWriter()
 	if err != nil {
@@ -76,15 +117,28 @@ func main() {
 
 	log.Logvf(log.DebugLow, "running bsondump with --objcheck: %v", bsonDumpOpts.ObjCheck)
 
-	if len(bsonDumpOpts.Type) != 0 && bsonDumpOpts.Type != "debug" && bsonDumpOpts.Type != "json" {
-		log.Logvf(log.Always, "Unsupported output type '%v'. Must be either 'debug' or 'json'", bsonDumpOpts.Type)
+	if len(bsonDumpOpts.Type) != 0 && bsonDumpOpts.Type != "debug" && bsonDumpOpts.Type != "json" && bsonDumpOpts.Type != "stats" {
+		log.Logvf(log.Always, "Unsupported output type '%v'. Must be 'debug', 'json' or 'stats'", bsonDumpOpts.Type)
+		os.Exit(util.ExitBadOptions)
+	}
+
+	dumper.Filter, err = bsondump.NewFilter(bsonDumpOpts.Filter, bsonDumpOpts.Fields)
+	if err != nil {
+		log.Logvf(log.Always, "error parsing --filter or --fields: %v", err)
 		os.Exit(util.ExitBadOptions)
 	}
 
 	var numFound int
-	if bsonDumpOpts.Type == "debug" {
+	switch {
+	case bsonDumpOpts.FromJSON:
+		numFound, err = dumper.FromJSON()
+	case bsonDumpOpts.Salvage:
+		numFound, err = dumper.Salvage()
+	case bsonDumpOpts.Type == "debug":
 		numFound, err = dumper.Debug()
-	} else {
+	case bsonDumpOpts.Type == "stats":
+		numFound, err = dumper.Stats()
+	default:
 		numFound, err = dumper.JSON()
 	}
 
@@ -8,16 +8,31 @@ See http://docs.mongodb.org/manual/reference/program/bsondump/ for more informat
 
 type BSONDumpOptions struct {
 	// Format to display the BSON data file
-	Type string `long:"type" value-name:"<type>" default:"json" default-mask:"-" description:"type of output: debug, json (default 'json')"`
+	Type string `long:"type" value-name:"<type>" default:"json" default-mask:"-" description:"type of output: debug, json, stats (default 'json')"`
 
 	// Validate each BSON document before displaying
 	ObjCheck bool `long:"objcheck" description:"validate BSON during processing"`
 
+	// Skip over damaged documents, and write the ones that are recovered to OutFileName
+	Salvage bool `long:"salvage" description:"skip over damaged parts of the BSON file, writing the documents that are recovered as BSON to --outFile, and report what was skipped"`
+
+	// Convert Extended JSON to BSON instead of BSON to JSON
+	FromJSON bool `long:"fromJSON" description:"read Extended JSON documents, one per line or in an array, and write them as BSON"`
+
+	// Flavor of Extended JSON to write, or to read with FromJSON
+	JSONFormat string `long:"jsonFormat" value-name:"<format>" default:"legacy" default-mask:"-" description:"Extended JSON format to write, or with --fromJSON to read: canonical, relaxed or legacy (default 'legacy')"`
+
 	// Display JSON data with indents
 	Pretty bool `long:"pretty" description:"output JSON formatted to be human-readable"`
 
+	// Query that documents have to match to be displayed
+	Filter string `long:"filter" value-name:"<json>" description:"query filter, as a JSON string, that documents must match to be displayed, e.g., '{x:{$gt:1}}'"`
+
+	// Fields to project documents onto before displaying them
+	Fields string `long:"fields" value-name:"<field>[,<field>]*" description:"comma separated list of field names to display, e.g. --fields \"name,age.min\"; _id is always included"`
+
 	// Path to input BSON file
-	BSONFileName string `long:"bsonFile" description:"path to BSON file to dump to JSON; default is stdin"`
+	BSONFileName string `long:"bsonFile" description:"path to BSON file to dump to JSON, or JSON file to convert with --fromJSON; default is stdin"`
 
 	// Path to output file
 	OutFileName string `long:"outFile" description:"path to output file to dump BSON to; default is stdout"`
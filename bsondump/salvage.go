@@ -0,0 +1,70 @@
+package bsondump
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/mongodb/mongo-tools/common/db"
+	"github.com/mongodb/mongo-tools/common/log"
+	"github.com/mongodb/mongo-tools/common/text"
+)
+
+// Salvage iterates through the BSON file, which has to be read by a salvaging
+// db.BSONSource, and writes the documents it recovers to the output as BSON.
+// It then logs a report of the damaged ranges that were skipped.
+// It returns the number of documents recovered and a non-nil error if one is
+// encountered before the end of the file is reached.
+func (bd *BSONDump) Salvage() (int, error) {
+	numFound := 0
+
+	if bd.BSONSource == nil {
+		panic("Tried to call Salvage() before opening file")
+	}
+
+	for {
+		doc := bd.BSONSource.LoadNext()
+		if doc == nil {
+			break
+		}
+
+		selected, err := bd.selectDocument(doc, numFound)
+		if err != nil {
+			return numFound, err
+		}
+		if selected == nil {
+			continue
+		}
+		if _, err = bd.Out.Write(selected); err != nil {
+			return numFound, err
+		}
+		numFound++
+	}
+
+	if err := bd.BSONSource.Err(); err != nil {
+		return numFound, err
+	}
+	log.Logvf(log.Always, "salvage report:\n%v", formatDamagedRanges(bd.BSONSource.DamagedRanges()))
+	return numFound, nil
+}
+
+// formatDamagedRanges formats the ranges skipped while salvaging for humans.
+func formatDamagedRanges(damagedRanges []db.DamagedRange) string {
+	buf := &bytes.Buffer{}
+	if len(damagedRanges) == 0 {
+		fmt.Fprintf(buf, "no damage found in BSON file\n")
+		return buf.String()
+	}
+	skipped := int64(0)
+	grid := &text.GridWriter{ColumnPadding: 2}
+	grid.WriteCells("start", "end", "bytes", "error")
+	grid.EndRow()
+	for _, damage := range damagedRanges {
+		grid.WriteCells(fmt.Sprintf("%v", damage.Start), fmt.Sprintf("%v", damage.End),
+			fmt.Sprintf("%v", damage.End-damage.Start), fmt.Sprintf("%v", damage.Err))
+		grid.EndRow()
+		skipped += damage.End - damage.Start
+	}
+	fmt.Fprintf(buf, "%v damaged range(s) skipped in BSON file, %v bytes in total:\n", len(damagedRanges), skipped)
+	grid.Flush(buf)
+	return buf.String()
+}
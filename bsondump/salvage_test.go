@@ -0,0 +1,48 @@
+package bsondump
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+
+	"github.com/mongodb/mongo-tools/common/db"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func TestSalvage(t *testing.T) {
+	Convey("With a BSON file with a damaged document", t, func() {
+		in := &bytes.Buffer{}
+		var docs [][]byte
+		for i := 0; i < 3; i++ {
+			data, err := bson.Marshal(bson.M{"_id": i})
+			So(err, ShouldBeNil)
+			docs = append(docs, data)
+		}
+		in.Write(docs[0])
+		in.Write([]byte{0, 0, 0, 0})
+		in.Write(docs[1][4:])
+		in.Write(docs[2])
+
+		Convey("salvaging writes the recovered documents as BSON", func() {
+			out := &bytes.Buffer{}
+			bd := &BSONDump{
+				BSONDumpOptions: &BSONDumpOptions{Salvage: true},
+				BSONSource:      db.NewSalvagingBSONSource(ioutil.NopCloser(in)),
+				Out:             WriteNopCloser{out},
+			}
+			numFound, err := bd.Salvage()
+			So(err, ShouldBeNil)
+			So(numFound, ShouldEqual, 2)
+			So(out.Bytes(), ShouldResemble, append(append([]byte{}, docs[0]...), docs[2]...))
+
+			report := formatDamagedRanges(bd.BSONSource.DamagedRanges())
+			So(report, ShouldContainSubstring, "1 damaged range(s)")
+			So(report, ShouldContainSubstring, "invalid BSONSize: 0 bytes")
+		})
+	})
+
+	Convey("An undamaged file has an empty report", t, func() {
+		So(formatDamagedRanges(nil), ShouldContainSubstring, "no damage found")
+	})
+}
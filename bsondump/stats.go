@@ -0,0 +1,385 @@
+package bsondump
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/mongodb/mongo-tools/common/bsonutil"
+	"github.com/mongodb/mongo-tools/common/json"
+	"github.com/mongodb/mongo-tools/common/log"
+	"github.com/mongodb/mongo-tools/common/text"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// numLargestDocuments is how many of the largest documents Statistics lists.
+const numLargestDocuments = 10
+
+// minSizeBucket is the upper bound, as a power of two, of the first bucket of the
+// size histogram; smaller documents all go in that bucket.
+const minSizeBucket = 7
+
+// typeNames maps BSON element types to the names the server uses for them in $type.
+var typeNames = map[byte]string{
+	0x01: "double",
+	0x02: "string",
+	0x03: "object",
+	0x04: "array",
+	0x05: "binData",
+	0x06: "undefined",
+	0x07: "objectId",
+	0x08: "bool",
+	0x09: "date",
+	0x0A: "null",
+	0x0B: "regex",
+	0x0C: "dbPointer",
+	0x0D: "javascript",
+	0x0E: "symbol",
+	0x0F: "javascriptWithScope",
+	0x10: "int",
+	0x11: "timestamp",
+	0x12: "long",
+	0x13: "decimal",
+	0x7F: "maxKey",
+	0xFF: "minKey",
+}
+
+// opTypeNames maps the op field of oplog entries to the kind of operation.
+var opTypeNames = map[string]string{
+	"i": "insert",
+	"u": "update",
+	"d": "delete",
+	"c": "command",
+	"n": "no-op",
+}
+
+// DocumentSize is the size of a document, and its _id in extended JSON.
+type DocumentSize struct {
+	ID   string
+	Size int
+}
+
+// Statistics summarizes the documents of a BSON file, for answering questions
+// about the size and the shape of the data in it.
+type Statistics struct {
+	Documents int
+	TotalSize int64
+
+	// SizeHistogram counts documents by size. Bucket n holds the documents of
+	// less than 2^n bytes, that don't fit in bucket n-1.
+	SizeHistogram map[uint]int
+
+	// Largest lists the largest documents, largest first.
+	Largest []DocumentSize
+
+	// Depths counts documents by how deeply they nest objects and arrays; a
+	// document without any has a depth of 1.
+	Depths map[int]int
+
+	// FieldTypes counts the types of the values found at each field path.
+	// Elements of arrays are counted under the array's path followed by ".[]".
+	FieldTypes map[string]map[string]int
+
+	// OplogEntries counts the documents that are oplog entries, and OpTypes
+	// and Namespaces count those by operation and by namespace.
+	OplogEntries int
+	OpTypes      map[string]int
+	Namespaces   map[string]int
+}
+
+// NewStatistics returns empty Statistics.
+func NewStatistics() *Statistics {
+	return &Statistics{
+		SizeHistogram: map[uint]int{},
+		Depths:        map[int]int{},
+		FieldTypes:    map[string]map[string]int{},
+		OpTypes:       map[string]int{},
+		Namespaces:    map[string]int{},
+	}
+}
+
+// Add counts the BSON document in data.
+func (stats *Statistics) Add(data []byte) error {
+	var elems bson.RawD
+	if err := bson.Unmarshal(data, &elems); err != nil {
+		return err
+	}
+	depth, err := stats.addFields("", elems)
+	if err != nil {
+		return err
+	}
+
+	stats.Documents++
+	stats.TotalSize += int64(len(data))
+	stats.Depths[depth]++
+	bucket := uint(minSizeBucket)
+	for len(data) >= 1<<bucket {
+		bucket++
+	}
+	stats.SizeHistogram[bucket]++
+	stats.addLargest(data)
+	stats.addOplogEntry(data)
+	return nil
+}
+
+// addFields counts the types of elems, which are found at path, and returns how
+// deeply they nest.
+func (stats *Statistics) addFields(path string, elems bson.RawD) (int, error) {
+	depth := 1
+	for _, elem := range elems {
+		fieldPath := elem.Name
+		if path != "" {
+			fieldPath = path + "." + elem.Name
+		}
+		elemDepth, err := stats.addValue(fieldPath, elem.Value)
+		if err != nil {
+			return 0, err
+		}
+		if elemDepth+1 > depth {
+			depth = elemDepth + 1
+		}
+	}
+	return depth, nil
+}
+
+// addValue counts the type of value, which is found at path, and returns how
+// deeply it nests.
+func (stats *Statistics) addValue(path string, value bson.Raw) (int, error) {
+	typeName, ok := typeNames[value.Kind]
+	if !ok {
+		typeName = fmt.Sprintf("unknown (%v)", value.Kind)
+	}
+	if stats.FieldTypes[path] == nil {
+		stats.FieldTypes[path] = map[string]int{}
+	}
+	stats.FieldTypes[path][typeName]++
+
+	if value.Kind != 0x03 && value.Kind != 0x04 {
+		return 0, nil
+	}
+	var elems bson.RawD
+	if err := bson.Unmarshal(value.Data, &elems); err != nil {
+		return 0, err
+	}
+	if value.Kind == 0x03 {
+		return stats.addFields(path, elems)
+	}
+	depth := 1
+	for _, elem := range elems {
+		elemDepth, err := stats.addValue(path+".[]", elem.Value)
+		if err != nil {
+			return 0, err
+		}
+		if elemDepth+1 > depth {
+			depth = elemDepth + 1
+		}
+	}
+	return depth, nil
+}
+
+// addLargest keeps track of the document in data if it is one of the largest.
+func (stats *Statistics) addLargest(data []byte) {
+	if len(stats.Largest) == numLargestDocuments && len(data) <= stats.Largest[numLargestDocuments-1].Size {
+		return
+	}
+	document := DocumentSize{ID: "-", Size: len(data)}
+	id := struct {
+		ID interface{} `bson:"_id"`
+	}{}
+	if err := bson.Unmarshal(data, &id); err == nil && id.ID != nil {
+		document.ID = formatValue(id.ID)
+	}
+	index := sort.Search(len(stats.Largest), func(i int) bool {
+		return stats.Largest[i].Size < document.Size
+	})
+	stats.Largest = append(stats.Largest, DocumentSize{})
+	copy(stats.Largest[index+1:], stats.Largest[index:])
+	stats.Largest[index] = document
+	if len(stats.Largest) > numLargestDocuments {
+		stats.Largest = stats.Largest[:numLargestDocuments]
+	}
+}
+
+// addOplogEntry counts the document in data by operation and namespace, if it
+// is an oplog entry.
+func (stats *Statistics) addOplogEntry(data []byte) {
+	entry := struct {
+		Timestamp bson.MongoTimestamp `bson:"ts"`
+		Operation string              `bson:"op"`
+		Namespace string              `bson:"ns"`
+	}{}
+	if err := bson.Unmarshal(data, &entry); err != nil || entry.Timestamp == 0 || entry.Operation == "" {
+		return
+	}
+	stats.OplogEntries++
+	operation, ok := opTypeNames[entry.Operation]
+	if !ok {
+		operation = entry.Operation
+	}
+	stats.OpTypes[operation]++
+	if entry.Namespace == "" {
+		// no-ops don't have a namespace
+		entry.Namespace = "-"
+	}
+	stats.Namespaces[entry.Namespace]++
+}
+
+// formatValue returns value in extended JSON.
+func formatValue(value interface{}) string {
+	extended, err := bsonutil.ConvertBSONValueToJSON(value)
+	if err != nil {
+		return fmt.Sprintf("%v", value)
+	}
+	formatted, err := json.Marshal(extended)
+	if err != nil {
+		return fmt.Sprintf("%v", value)
+	}
+	return string(formatted)
+}
+
+// formatBucketBound returns 2^bucket bytes as a round amount.
+func formatBucketBound(bucket uint) string {
+	units := []string{"B", "KB", "MB", "GB"}
+	unit := 0
+	for bucket >= 10 && unit < len(units)-1 {
+		bucket -= 10
+		unit++
+	}
+	return fmt.Sprintf("%v%v", 1<<bucket, units[unit])
+}
+
+func sortedKeys(counts map[string]int) []string {
+	keys := make([]string, 0, len(counts))
+	for key := range counts {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Print writes the statistics to out.
+func (stats *Statistics) Print(out io.Writer) {
+	fmt.Fprintf(out, "documents: %v\n", stats.Documents)
+	fmt.Fprintf(out, "total size: %v\n", text.FormatByteAmount(stats.TotalSize))
+	if stats.Documents == 0 {
+		return
+	}
+	fmt.Fprintf(out, "average size: %v\n", text.FormatByteAmount(stats.TotalSize/int64(stats.Documents)))
+
+	fmt.Fprintf(out, "\ndocument sizes:\n")
+	grid := &text.GridWriter{ColumnPadding: 2}
+	buckets := []int{}
+	for bucket := range stats.SizeHistogram {
+		buckets = append(buckets, int(bucket))
+	}
+	sort.Ints(buckets)
+	for _, bucket := range buckets {
+		lower := "0B"
+		if bucket > minSizeBucket {
+			lower = formatBucketBound(uint(bucket - 1))
+		}
+		grid.WriteCells(fmt.Sprintf("%v - %v", lower, formatBucketBound(uint(bucket))),
+			fmt.Sprintf("%v", stats.SizeHistogram[uint(bucket)]))
+		grid.EndRow()
+	}
+	grid.Flush(out)
+
+	fmt.Fprintf(out, "\nlargest documents:\n")
+	grid = &text.GridWriter{ColumnPadding: 2}
+	for _, document := range stats.Largest {
+		grid.WriteCells(text.FormatByteAmount(int64(document.Size)), document.ID)
+		grid.EndRow()
+	}
+	grid.Flush(out)
+
+	fmt.Fprintf(out, "\nnesting depths:\n")
+	grid = &text.GridWriter{ColumnPadding: 2}
+	depths := []int{}
+	for depth := range stats.Depths {
+		depths = append(depths, depth)
+	}
+	sort.Ints(depths)
+	for _, depth := range depths {
+		grid.WriteCells(fmt.Sprintf("%v", depth), fmt.Sprintf("%v", stats.Depths[depth]))
+		grid.EndRow()
+	}
+	grid.Flush(out)
+
+	fmt.Fprintf(out, "\nfield types:\n")
+	grid = &text.GridWriter{ColumnPadding: 2}
+	paths := make([]string, 0, len(stats.FieldTypes))
+	for path := range stats.FieldTypes {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		types := []string{}
+		for _, typeName := range sortedKeys(stats.FieldTypes[path]) {
+			types = append(types, fmt.Sprintf("%v: %v", typeName, stats.FieldTypes[path][typeName]))
+		}
+		grid.WriteCells(path, strings.Join(types, ", "))
+		grid.EndRow()
+	}
+	grid.Flush(out)
+
+	if stats.OplogEntries == 0 {
+		return
+	}
+	fmt.Fprintf(out, "\noplog entries: %v\n", stats.OplogEntries)
+	fmt.Fprintf(out, "\noperations:\n")
+	grid = &text.GridWriter{ColumnPadding: 2}
+	for _, operation := range sortedKeys(stats.OpTypes) {
+		grid.WriteCells(operation, fmt.Sprintf("%v", stats.OpTypes[operation]))
+		grid.EndRow()
+	}
+	grid.Flush(out)
+
+	fmt.Fprintf(out, "\nnamespaces:\n")
+	grid = &text.GridWriter{ColumnPadding: 2}
+	for _, namespace := range sortedKeys(stats.Namespaces) {
+		grid.WriteCells(namespace, fmt.Sprintf("%v", stats.Namespaces[namespace]))
+		grid.EndRow()
+	}
+	grid.Flush(out)
+}
+
+// Stats iterates through the BSON file and prints a summary of the documents
+// it finds, rather than the documents themselves.
+// It returns the number of documents processed and a non-nil error if one is
+// encountered before the end of the file is reached.
+func (bd *BSONDump) Stats() (int, error) {
+	numFound := 0
+
+	if bd.BSONSource == nil {
+		panic("Tried to call Stats() before opening file")
+	}
+
+	stats := NewStatistics()
+	for {
+		doc := bd.BSONSource.LoadNext()
+		if doc == nil {
+			break
+		}
+
+		selected, err := bd.selectDocument(doc, numFound)
+		if err == nil && selected == nil {
+			continue
+		}
+		if err == nil {
+			if err = stats.Add(selected); err != nil {
+				log.Logvf(log.Always, "unable to read document %v: %v", numFound+1, err)
+			}
+		}
+		if err != nil && bd.BSONDumpOptions.ObjCheck {
+			return numFound, err
+		}
+		numFound++
+	}
+
+	if err := bd.BSONSource.Err(); err != nil {
+		return numFound, err
+	}
+	stats.Print(bd.Out)
+	return numFound, nil
+}
@@ -0,0 +1,70 @@
+package bsondump
+
+import (
+	"bytes"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func addDocument(stats *Statistics, doc interface{}) {
+	data, err := bson.Marshal(doc)
+	So(err, ShouldBeNil)
+	So(stats.Add(data), ShouldBeNil)
+}
+
+func TestStatistics(t *testing.T) {
+	Convey("With statistics of a few documents", t, func() {
+		stats := NewStatistics()
+		addDocument(stats, bson.D{{"_id", 1}, {"a", "x"}})
+		addDocument(stats, bson.D{{"_id", 2}, {"a", 1}, {"b", bson.D{{"c", []interface{}{1, bson.D{{"d", true}}}}}}})
+		addDocument(stats, bson.D{{"_id", 3}, {"a", string(make([]byte, 300))}})
+
+		Convey("documents are counted by size and depth", func() {
+			So(stats.Documents, ShouldEqual, 3)
+			So(stats.SizeHistogram[minSizeBucket], ShouldEqual, 2)
+			So(stats.SizeHistogram[minSizeBucket+2], ShouldEqual, 1)
+			So(stats.Depths, ShouldResemble, map[int]int{1: 2, 4: 1})
+		})
+
+		Convey("the largest documents come first, with their _id", func() {
+			So(len(stats.Largest), ShouldEqual, 3)
+			So(stats.Largest[0].ID, ShouldEqual, "3")
+			So(stats.Largest[0].Size, ShouldBeGreaterThan, 300)
+			So(stats.Largest[1].ID, ShouldEqual, "2")
+		})
+
+		Convey("field types are counted by path, with array elements under .[]", func() {
+			So(stats.FieldTypes["a"], ShouldResemble, map[string]int{"string": 2, "int": 1})
+			So(stats.FieldTypes["b.c"], ShouldResemble, map[string]int{"array": 1})
+			So(stats.FieldTypes["b.c.[]"], ShouldResemble, map[string]int{"int": 1, "object": 1})
+			So(stats.FieldTypes["b.c.[].d"], ShouldResemble, map[string]int{"bool": 1})
+		})
+
+		Convey("documents that aren't oplog entries have no oplog statistics", func() {
+			So(stats.OplogEntries, ShouldEqual, 0)
+			out := &bytes.Buffer{}
+			stats.Print(out)
+			So(out.String(), ShouldContainSubstring, "documents: 3")
+			So(out.String(), ShouldNotContainSubstring, "oplog entries")
+		})
+	})
+
+	Convey("With statistics of oplog entries", t, func() {
+		stats := NewStatistics()
+		for _, op := range []string{"i", "i", "u", "c"} {
+			addDocument(stats, bson.D{{"ts", bson.MongoTimestamp(1 << 32)}, {"op", op}, {"ns", "test.c" + op}})
+		}
+		addDocument(stats, bson.D{{"ts", bson.MongoTimestamp(1 << 32)}, {"op", "n"}, {"ns", ""}})
+
+		Convey("entries are counted by operation and namespace", func() {
+			So(stats.OplogEntries, ShouldEqual, 5)
+			So(stats.OpTypes, ShouldResemble, map[string]int{"insert": 2, "update": 1, "command": 1, "no-op": 1})
+			So(stats.Namespaces, ShouldResemble, map[string]int{"test.ci": 2, "test.cu": 1, "test.cc": 1, "-": 1})
+			out := &bytes.Buffer{}
+			stats.Print(out)
+			So(out.String(), ShouldContainSubstring, "oplog entries: 5")
+		})
+	})
+}
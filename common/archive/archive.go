@@ -10,6 +10,8 @@ type NamespaceHeader struct {
 	Collection string `bson:"collection"`
 	EOF        bool   `bson:"EOF"`
 	CRC        int64  `bson:"CRC"`
+	// Incomplete is set on the EOF header of a namespace whose dump was interrupted
+	Incomplete bool `bson:"incomplete,omitempty"`
 }
 
 // CollectionMetadata is a data structure that, as BSON, is found in the prelude of the archive.
@@ -30,6 +32,39 @@ type Header struct {
 	ToolVersion           string `bson:"tool_version"`
 }
 
+// TableOfContentsHeader is a data structure that, as BSON, is found as the header of the
+// last block of archives written to seekable outputs. The body of that block is made of
+// NamespaceBlocks documents followed by a single TableOfContentsTrailer.
+type TableOfContentsHeader struct {
+	TableOfContents bool `bson:"table_of_contents"`
+	IncompleteDump  bool `bson:"incomplete_dump,omitempty"`
+}
+
+// IncompleteDumpHeader is a data structure that, as BSON, is found as the header of an
+// empty block at the end of archives whose dump was interrupted, before any table of
+// contents. Namespaces of such archives that have no EOF header were never dumped.
+type IncompleteDumpHeader struct {
+	IncompleteDump bool `bson:"incomplete_dump"`
+}
+
+// NamespaceBlocks is a data structure that, as BSON, is found in the table of contents.
+// It lists the offsets, from the start of the archive, of blocks belonging to a namespace.
+// A namespace with many blocks may have its offsets spread over several NamespaceBlocks,
+// and the first of them holds the number of documents of the namespace.
+type NamespaceBlocks struct {
+	Database   string  `bson:"db"`
+	Collection string  `bson:"collection"`
+	Offsets    []int64 `bson:"offsets"`
+	Documents  *int64  `bson:"documents,omitempty"`
+}
+
+// TableOfContentsTrailer is a data structure that, as BSON, is the last document of the
+// table of contents. It has a fixed size, so that the table of contents can be found by
+// seeking back from the end of the archive.
+type TableOfContentsTrailer struct {
+	Offset int64 `bson:"table_of_contents_offset"`
+}
+
 const minBSONSize = 4 + 1 // an empty BSON document should be exactly five bytes long
 
 var terminator int32 = -1
@@ -6,6 +6,7 @@ import (
 	"hash"
 	"hash/crc64"
 	"io"
+	"sort"
 	"sync"
 	"sync/atomic"
 
@@ -33,12 +34,56 @@ type Demultiplexer struct {
 	buf                [db.MaxBSONSize]byte
 	NamespaceChan      chan string
 	NamespaceErrorChan chan error
+	// TableOfContents, when set, is used to read only the blocks of
+	// namespaces that aren't muted. In must then be an io.Seeker.
+	TableOfContents *TableOfContents
+	// readingTableOfContents is true while the parser is inside the
+	// table of contents block at the end of the archive
+	readingTableOfContents bool
+	// Salvage, when set, makes the demultiplexer skip over the corrupted parts
+	// of the archive instead of failing, recording what was skipped in the report.
+	// CRC mismatches and unfinished namespaces are then logged instead of failing.
+	Salvage *SalvageReport
+	// incompleteDump is set when the archive was written by an interrupted dump,
+	// in which case namespaces without an EOF header are finished without error.
+	incompleteDump bool
+	// partialNamespaces are the namespaces whose dump was interrupted
+	partialNamespaces []string
+	// finishedNamespaces are the namespaces whose EOF header was read
+	finishedNamespaces map[string]bool
+	// ended is set once the end of the archive was reached, after which
+	// outs opened for namespaces that never appeared are finished right away
+	ended      bool
+	endedMutex sync.Mutex
+}
+
+// IncompleteDump returns true if the archive was written by an interrupted dump.
+// It is only meaningful once the demultiplexer has finished.
+func (demux *Demultiplexer) IncompleteDump() bool {
+	return demux.incompleteDump
+}
+
+// PartialNamespaces returns the namespaces that were only partially dumped.
+func (demux *Demultiplexer) PartialNamespaces() []string {
+	return demux.partialNamespaces
+}
+
+// Finished returns true if the EOF header of the namespace was read.
+func (demux *Demultiplexer) Finished(namespace string) bool {
+	return demux.finishedNamespaces[namespace]
 }
 
 // Run creates and runs a parser with the Demultiplexer as a consumer
 func (demux *Demultiplexer) Run() error {
 	parser := Parser{In: demux.In}
-	err := parser.ReadAllBlocks(demux)
+	var err error
+	if demux.Salvage != nil {
+		err = parser.SalvageAllBlocks(demux, demux.Salvage)
+	} else if demux.TableOfContents != nil {
+		err = demux.readIndexedBlocks(&parser)
+	} else {
+		err = parser.ReadAllBlocks(demux)
+	}
 	if len(demux.outs) > 0 {
 		log.Logvf(log.Always, "demux finishing when there are still outs (%v)", len(demux.outs))
 	}
@@ -46,6 +91,61 @@ func (demux *Demultiplexer) Run() error {
 	return err
 }
 
+// int64Slice attaches the methods of sort.Interface to []int64
+type int64Slice []int64
+
+func (s int64Slice) Len() int           { return len(s) }
+func (s int64Slice) Less(i, j int) bool { return s[i] < s[j] }
+func (s int64Slice) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+
+// readIndexedBlocks uses the table of contents to seek straight to the blocks of
+// the namespaces that aren't muted, in archive order, skipping everything else.
+func (demux *Demultiplexer) readIndexedBlocks(parser *Parser) error {
+	seeker, ok := demux.In.(io.Seeker)
+	if !ok {
+		return newError("archive with a table of contents is not seekable")
+	}
+	demux.incompleteDump = demux.TableOfContents.IncompleteDump
+	muted := map[string]bool{}
+	for ns, out := range demux.outs {
+		if _, ok := out.(*MutedCollection); ok {
+			muted[ns] = true
+			// muted namespaces are never read, so they will never see their EOF
+			delete(demux.outs, ns)
+			delete(demux.lengths, ns)
+		}
+	}
+	offsets := int64Slice{}
+	for _, ns := range demux.TableOfContents.Namespaces() {
+		if muted[ns] {
+			log.Logvf(log.DebugLow, "demux skipping blocks of namespace %v", ns)
+			continue
+		}
+		offsets = append(offsets, demux.TableOfContents.Offsets(ns)...)
+	}
+	sort.Sort(offsets)
+	log.Logvf(log.DebugLow, "demux reading %v blocks using the archive table of contents", len(offsets))
+
+	for _, offset := range offsets {
+		_, err := seeker.Seek(offset, io.SeekStart)
+		if err != nil {
+			return newWrappedError("seeking to block", err)
+		}
+		err = parser.ReadBlock(demux)
+		if err == io.EOF {
+			return newError(fmt.Sprintf("table of contents points past the end of the archive (%v)", offset))
+		}
+		if err != nil {
+			return err
+		}
+	}
+	err := demux.End()
+	if err != nil {
+		return newParserWrappedError("ParserConsumer.End", err)
+	}
+	return nil
+}
+
 type demuxError struct {
 	Err error
 	Msg string
@@ -85,8 +185,25 @@ func (demux *Demultiplexer) HeaderBSON(buf []byte) error {
 	}
 	log.Logvf(log.DebugHigh, "demux namespaceHeader: %v", colHeader)
 	if colHeader.Collection == "" {
+		tocHeader := TableOfContentsHeader{}
+		if bson.Unmarshal(buf, &tocHeader) == nil && tocHeader.TableOfContents {
+			// the table of contents is only useful to readers that can seek
+			demux.currentNamespace = ""
+			demux.readingTableOfContents = true
+			demux.incompleteDump = demux.incompleteDump || tocHeader.IncompleteDump
+			return nil
+		}
+		incompleteHeader := IncompleteDumpHeader{}
+		if bson.Unmarshal(buf, &incompleteHeader) == nil && incompleteHeader.IncompleteDump {
+			log.Logv(log.DebugLow, "demux found the marker of an interrupted dump")
+			demux.currentNamespace = ""
+			demux.readingTableOfContents = false
+			demux.incompleteDump = true
+			return nil
+		}
 		return newError("collection header is missing a Collection")
 	}
+	demux.readingTableOfContents = false
 	demux.currentNamespace = colHeader.Database + "." + colHeader.Collection
 	if _, ok := demux.outs[demux.currentNamespace]; !ok {
 		if demux.NamespaceChan != nil {
@@ -105,17 +222,25 @@ func (demux *Demultiplexer) HeaderBSON(buf []byte) error {
 		}
 	}
 	if colHeader.EOF {
+		if receiver, ok := demux.outs[demux.currentNamespace].(*RegularCollectionReceiver); ok {
+			// set before closing, so that the reader sees it once it reaches the end
+			receiver.incomplete = colHeader.Incomplete
+		}
 		demux.outs[demux.currentNamespace].Close()
 		length := int64(demux.lengths[demux.currentNamespace])
 		crcUInt64, ok := demux.outs[demux.currentNamespace].Sum64()
 		if ok {
 			crc := int64(crcUInt64)
 			if crc != colHeader.CRC {
-				return fmt.Errorf("CRC mismatch for namespace %v, %v!=%v",
-					demux.currentNamespace,
-					crc,
-					colHeader.CRC,
-				)
+				if demux.Salvage == nil {
+					return fmt.Errorf("CRC mismatch for namespace %v, %v!=%v",
+						demux.currentNamespace,
+						crc,
+						colHeader.CRC,
+					)
+				}
+				log.Logvf(log.Always, "CRC mismatch for namespace %v, %v!=%v; some of its documents were damaged",
+					demux.currentNamespace, crc, colHeader.CRC)
 			}
 			log.Logvf(log.DebugHigh,
 				"demux checksum for namespace %v is correct (%v), %v bytes",
@@ -125,6 +250,14 @@ func (demux *Demultiplexer) HeaderBSON(buf []byte) error {
 				"demux checksum for namespace %v was not calculated.",
 				demux.currentNamespace)
 		}
+		if colHeader.Incomplete {
+			log.Logvf(log.DebugLow, "demux namespace %v was only partially dumped", demux.currentNamespace)
+			demux.partialNamespaces = append(demux.partialNamespaces, demux.currentNamespace)
+		}
+		if demux.finishedNamespaces == nil {
+			demux.finishedNamespaces = make(map[string]bool)
+		}
+		demux.finishedNamespaces[demux.currentNamespace] = true
 		delete(demux.outs, demux.currentNamespace)
 		delete(demux.lengths, demux.currentNamespace)
 		// in case we get a BSONBody with this block,
@@ -137,12 +270,29 @@ func (demux *Demultiplexer) HeaderBSON(buf []byte) error {
 // End is part of the ParserConsumer interface and receives the end of archive notification.
 func (demux *Demultiplexer) End() error {
 	log.Logvf(log.DebugHigh, "demux End")
+	demux.endedMutex.Lock()
+	defer demux.endedMutex.Unlock()
+	demux.ended = true
 	if len(demux.outs) != 0 {
 		openNss := []string{}
 		for ns := range demux.outs {
 			openNss = append(openNss, ns)
 		}
-		return newError(fmt.Sprintf("archive finished but contained files were unfinished (%v)", openNss))
+		switch {
+		case demux.incompleteDump:
+			// the dump was interrupted before it got to these namespaces
+			log.Logvf(log.DebugLow, "archive of an interrupted dump has no data for %v", openNss)
+		case demux.Salvage != nil:
+			// the EOF blocks of these namespaces were lost, finish them with what was recovered
+			log.Logvf(log.Always, "archive finished but contained files were unfinished (%v)", openNss)
+		default:
+			return newError(fmt.Sprintf("archive finished but contained files were unfinished (%v)", openNss))
+		}
+		for _, ns := range openNss {
+			demux.outs[ns].Close()
+			delete(demux.outs, ns)
+			delete(demux.lengths, ns)
+		}
 	}
 
 	if demux.NamespaceChan != nil {
@@ -154,6 +304,9 @@ func (demux *Demultiplexer) End() error {
 // BodyBSON is part of the ParserConsumer interface and receives BSON bodies from the parser.
 // Its main role is to dispatch the body to the Read() function of the current DemuxOut.
 func (demux *Demultiplexer) BodyBSON(buf []byte) error {
+	if demux.readingTableOfContents {
+		return nil
+	}
 	if demux.currentNamespace == "" {
 		return newError("collection data without a collection header")
 	}
@@ -175,6 +328,16 @@ func (demux *Demultiplexer) Open(ns string, out DemuxOut) {
 	// I think that we don't need to lock outs, but I suspect that if the implementation changes
 	// we may need to lock when outs is accessed
 	log.Logvf(log.DebugHigh, "demux Open")
+	demux.endedMutex.Lock()
+	defer demux.endedMutex.Unlock()
+	if demux.ended {
+		// the archive had no data for this namespace, such as the oplog of an
+		// interrupted dump. The out is closed in the background, because closing
+		// a RegularCollectionReceiver waits for its reader.
+		log.Logvf(log.DebugLow, "demux finished before namespace %v was opened", ns)
+		go out.Close()
+		return
+	}
 	if demux.outs == nil {
 		demux.outs = make(map[string]DemuxOut)
 		demux.lengths = make(map[string]int64)
@@ -196,12 +359,19 @@ type RegularCollectionReceiver struct {
 	hash             hash.Hash64
 	closeOnce        sync.Once
 	openOnce         sync.Once
+	incomplete       bool
 }
 
 func (receiver *RegularCollectionReceiver) Sum64() (uint64, bool) {
 	return receiver.hash.Sum64(), true
 }
 
+// Incomplete returns true if the EOF header of the namespace says that its dump
+// was interrupted. It is only meaningful once Read has returned io.EOF.
+func (receiver *RegularCollectionReceiver) Incomplete() bool {
+	return receiver.incomplete
+}
+
 // Read() runs in the restoring goroutine
 func (receiver *RegularCollectionReceiver) Read(r []byte) (int, error) {
 	if receiver.partialReadBuf != nil && len(receiver.partialReadBuf) > 0 {
@@ -30,6 +30,18 @@ type Multiplexer struct {
 	ins              []*MuxIn
 	selectCases      []reflect.SelectCase
 	currentNamespace string
+	// TableOfContents makes the archive end with a table of contents when Out
+	// is seekable. Readers of archives from before tables of contents reject
+	// the archive, so it must be asked for.
+	TableOfContents bool
+	// toc records where each namespace's blocks start, when Out is seekable
+	toc        *TableOfContents
+	tocChecked bool
+	// incomplete is set when a namespace was only partially written, and
+	// interrupted by MarkIncomplete, so that the archive ends with an
+	// incomplete dump marker
+	incomplete  bool
+	interrupted bool
 }
 
 type notifier interface {
@@ -60,6 +72,13 @@ func NewMultiplexer(out io.WriteCloser, shutdownInputs notifier) *Multiplexer {
 	return mux
 }
 
+// MarkIncomplete records that the dump was interrupted, so that some of the
+// namespaces of the prelude may be missing from the archive. It must be called
+// before the Control chan is closed.
+func (mux *Multiplexer) MarkIncomplete() {
+	mux.interrupted = true
+}
+
 // Run multiplexes until it receives an EOF on its Control chan.
 func (mux *Multiplexer) Run() {
 	var err, completionErr error
@@ -69,6 +88,14 @@ func (mux *Multiplexer) Run() {
 		if index == 0 { //Control index
 			if EOF {
 				log.Logvf(log.DebugLow, "Mux finish")
+				incomplete := mux.incomplete || mux.interrupted
+				if completionErr == nil && incomplete {
+					completionErr = mux.formatIncompleteDump()
+				}
+				if completionErr == nil && mux.toc != nil {
+					mux.toc.IncompleteDump = incomplete
+					completionErr = mux.formatTableOfContents()
+				}
 				mux.Out.Close()
 				if completionErr != nil {
 					mux.Completed <- completionErr
@@ -154,6 +181,7 @@ func (mux *Multiplexer) formatBody(in *MuxIn, bsonBytes []byte) error {
 				return io.ErrShortWrite
 			}
 		}
+		mux.recordBlock(in.Intent.Namespace())
 		header, err := bson.Marshal(NamespaceHeader{
 			Database:   in.Intent.DB,
 			Collection: in.Intent.C,
@@ -189,11 +217,19 @@ func (mux *Multiplexer) formatEOF(index int, in *MuxIn) error {
 			return io.ErrShortWrite
 		}
 	}
+	mux.recordBlock(in.Intent.Namespace())
+	if mux.toc != nil {
+		mux.toc.SetDocuments(in.Intent.Namespace(), in.documents)
+	}
+	if in.Incomplete {
+		mux.incomplete = true
+	}
 	eofHeader, err := bson.Marshal(NamespaceHeader{
 		Database:   in.Intent.DB,
 		Collection: in.Intent.C,
 		EOF:        true,
 		CRC:        int64(in.hash.Sum64()),
+		Incomplete: in.Incomplete,
 	})
 	if err != nil {
 		return err
@@ -215,6 +251,66 @@ func (mux *Multiplexer) formatEOF(index int, in *MuxIn) error {
 	return nil
 }
 
+// formatIncompleteDump writes the empty block that marks the archive of an interrupted dump
+func (mux *Multiplexer) formatIncompleteDump() error {
+	if mux.currentNamespace != "" {
+		if err := writeFull(mux.Out, terminatorBytes); err != nil {
+			return err
+		}
+		mux.currentNamespace = ""
+	}
+	log.Logvf(log.DebugLow, "Mux marking the archive as incomplete")
+	header, err := bson.Marshal(IncompleteDumpHeader{IncompleteDump: true})
+	if err != nil {
+		return err
+	}
+	if err = writeFull(mux.Out, header); err != nil {
+		return err
+	}
+	return writeFull(mux.Out, terminatorBytes)
+}
+
+// recordBlock adds the current position of Out to the table of contents, as
+// the start of a block for namespace. The table of contents is only kept
+// when it is asked for, and Out is seekable.
+func (mux *Multiplexer) recordBlock(namespace string) {
+	if !mux.TableOfContents {
+		return
+	}
+	seeker, ok := mux.Out.(io.Seeker)
+	if !mux.tocChecked {
+		mux.tocChecked = true
+		if ok {
+			mux.toc = NewTableOfContents()
+		}
+	}
+	if !ok || mux.toc == nil {
+		return
+	}
+	offset, err := seeker.Seek(0, io.SeekCurrent)
+	if err != nil {
+		// pipes and terminals can't seek, so the archive is a plain stream
+		log.Logvf(log.DebugLow, "Mux not writing a table of contents: %v", err)
+		mux.toc = nil
+		return
+	}
+	mux.toc.Add(namespace, offset)
+}
+
+// formatTableOfContents writes the table of contents block at the end of the archive
+func (mux *Multiplexer) formatTableOfContents() error {
+	seeker, ok := mux.Out.(io.Seeker)
+	if !ok {
+		return nil
+	}
+	offset, err := seeker.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	log.Logvf(log.DebugLow, "Mux writing table of contents for %v namespaces", len(mux.toc.Namespaces()))
+	return mux.toc.Write(mux.Out, offset)
+}
+
 // MuxIn is an implementation of the intents.file interface.
 // They live in the intents, and are potentially owned by different threads than
 // the thread owning the Multiplexer.
@@ -225,8 +321,12 @@ type MuxIn struct {
 	writeCloseFinishedChan chan struct{}
 	buf                    []byte
 	hash                   hash.Hash64
+	documents              int64
 	Intent                 *intents.Intent
 	Mux                    *Multiplexer
+	// Incomplete is set before Close when the namespace was only partially
+	// written, so that its EOF header says so
+	Incomplete bool
 }
 
 // Read does nothing for MuxIns
@@ -311,5 +411,6 @@ func (muxIn *MuxIn) Write(buf []byte) (int, error) {
 		}
 	}
 	muxIn.hash.Write(buf)
+	muxIn.documents++
 	return len(buf), nil
 }
@@ -2,9 +2,11 @@ package archive
 
 import (
 	"bytes"
+	"fmt"
 	"hash"
 	"hash/crc32"
 	"io"
+	"io/ioutil"
 	"os"
 	"testing"
 
@@ -227,3 +229,238 @@ func makeOuts(testIntents []*intents.Intent, demux *Demultiplexer, outChecksum m
 		}()
 	}
 }
+
+func TestTableOfContentsMux(t *testing.T) {
+	Convey("with 10000 docs in each of four collections multiplexed into a file", t, func() {
+		file, err := ioutil.TempFile("", "archive_toc_test")
+		So(err, ShouldBeNil)
+		defer os.Remove(file.Name())
+
+		mux := NewMultiplexer(file, new(testNotifier))
+		mux.TableOfContents = true
+		muxIns := map[string]*MuxIn{}
+		inChecksum := map[string]hash.Hash{}
+		inLengths := map[string]*int{}
+
+		errChan := make(chan error)
+		makeIns(testIntents, mux, inChecksum, muxIns, inLengths, errChan)
+		go mux.Run()
+		for range testIntents {
+			So(<-errChan, ShouldBeNil)
+		}
+		close(mux.Control)
+		So(<-mux.Completed, ShouldBeNil)
+
+		in, err := os.Open(file.Name())
+		So(err, ShouldBeNil)
+		defer in.Close()
+
+		Convey("the archive should have a table of contents for every namespace", func() {
+			toc, err := ReadTableOfContents(in)
+			So(err, ShouldBeNil)
+			So(toc, ShouldNotBeNil)
+			So(len(toc.Namespaces()), ShouldEqual, len(testIntents))
+			for _, dbc := range testIntents {
+				// every namespace has at least one data block and an EOF block
+				So(len(toc.Offsets(dbc.Namespace())), ShouldBeGreaterThan, 1)
+				documents, ok := toc.Documents(dbc.Namespace())
+				So(ok, ShouldBeTrue)
+				So(documents, ShouldEqual, 10000)
+			}
+			pos, err := in.Seek(0, io.SeekCurrent)
+			So(err, ShouldBeNil)
+			So(pos, ShouldEqual, 0)
+
+			Convey("and muted namespaces should be skipped when demultiplexing", func() {
+				demux := &Demultiplexer{In: in, TableOfContents: toc}
+				muted := testIntents[1]
+				demux.Open(muted.Namespace(), &MutedCollection{Intent: muted, Demux: demux})
+
+				selected := []*intents.Intent{testIntents[0], testIntents[2], testIntents[3]}
+				outChecksum := map[string]hash.Hash{}
+				outLengths := map[string]*int{}
+				demuxOuts := map[string]*RegularCollectionReceiver{}
+				readErrChan := make(chan error)
+				makeOuts(selected, demux, outChecksum, demuxOuts, outLengths, readErrChan)
+
+				So(demux.Run(), ShouldBeNil)
+				for range selected {
+					So(<-readErrChan, ShouldBeNil)
+				}
+				for _, dbc := range selected {
+					ns := dbc.Namespace()
+					So(*inLengths[ns], ShouldEqual, *outLengths[ns])
+					So(inChecksum[ns].Sum([]byte{}), ShouldResemble, outChecksum[ns].Sum([]byte{}))
+				}
+			})
+
+			Convey("and the whole archive should still demultiplex as a stream", func() {
+				demux := &Demultiplexer{In: in}
+				outChecksum := map[string]hash.Hash{}
+				outLengths := map[string]*int{}
+				demuxOuts := map[string]*RegularCollectionReceiver{}
+				readErrChan := make(chan error)
+				makeOuts(testIntents, demux, outChecksum, demuxOuts, outLengths, readErrChan)
+
+				So(demux.Run(), ShouldBeNil)
+				for range testIntents {
+					So(<-readErrChan, ShouldBeNil)
+				}
+			})
+		})
+	})
+}
+
+// legacyHeaderConsumer checks the headers of an archive the way the
+// demultiplexer did before tables of contents, which rejected any header
+// without a collection.
+type legacyHeaderConsumer struct{}
+
+func (legacyHeaderConsumer) HeaderBSON(data []byte) error {
+	colHeader := NamespaceHeader{}
+	if err := bson.Unmarshal(data, &colHeader); err != nil {
+		return err
+	}
+	if colHeader.Collection == "" {
+		return fmt.Errorf("collection header is missing a Collection")
+	}
+	return nil
+}
+
+func (legacyHeaderConsumer) BodyBSON(data []byte) error { return nil }
+
+func (legacyHeaderConsumer) End() error { return nil }
+
+func TestTableOfContentsOptIn(t *testing.T) {
+	Convey("with docs multiplexed into a file", t, func() {
+		writeArchive := func(tableOfContents bool) *os.File {
+			file, err := ioutil.TempFile("", "archive_toc_opt_in_test")
+			So(err, ShouldBeNil)
+			mux := NewMultiplexer(file, new(testNotifier))
+			mux.TableOfContents = tableOfContents
+			errChan := make(chan error)
+			makeIns(testIntents, mux, map[string]hash.Hash{}, map[string]*MuxIn{}, map[string]*int{}, errChan)
+			go mux.Run()
+			for range testIntents {
+				So(<-errChan, ShouldBeNil)
+			}
+			close(mux.Control)
+			So(<-mux.Completed, ShouldBeNil)
+			in, err := os.Open(file.Name())
+			So(err, ShouldBeNil)
+			return in
+		}
+
+		Convey("by default the archive should pass the header checks of older readers", func() {
+			in := writeArchive(false)
+			defer os.Remove(in.Name())
+			defer in.Close()
+			toc, err := ReadTableOfContents(in)
+			So(err, ShouldBeNil)
+			So(toc, ShouldBeNil)
+			parser := Parser{In: in}
+			So(parser.ReadAllBlocks(legacyHeaderConsumer{}), ShouldBeNil)
+		})
+
+		Convey("with a table of contents the archive should fail them", func() {
+			in := writeArchive(true)
+			defer os.Remove(in.Name())
+			defer in.Close()
+			toc, err := ReadTableOfContents(in)
+			So(err, ShouldBeNil)
+			So(toc, ShouldNotBeNil)
+			parser := Parser{In: in}
+			So(parser.ReadAllBlocks(legacyHeaderConsumer{}), ShouldNotBeNil)
+		})
+	})
+}
+
+func TestIncompleteDumpMux(t *testing.T) {
+	Convey("with an interrupted dump multiplexed into a file", t, func() {
+		file, err := ioutil.TempFile("", "archive_incomplete_test")
+		So(err, ShouldBeNil)
+		defer os.Remove(file.Name())
+
+		mux := NewMultiplexer(file, new(testNotifier))
+		mux.TableOfContents = true
+		go mux.Run()
+
+		// the first two namespaces are complete
+		complete := testIntents[:2]
+		errChan := make(chan error)
+		makeIns(complete, mux, map[string]hash.Hash{}, map[string]*MuxIn{}, map[string]*int{}, errChan)
+		for range complete {
+			So(<-errChan, ShouldBeNil)
+		}
+		// the third one was interrupted
+		partial := testIntents[2]
+		muxIn := &MuxIn{Intent: partial, Mux: mux}
+		So(muxIn.Open(), ShouldBeNil)
+		for i := 0; i < 10; i++ {
+			bsonBytes, _ := bson.Marshal(testDoc{Bar: i, Baz: partial.Namespace()})
+			_, err = muxIn.Write(bsonBytes)
+			So(err, ShouldBeNil)
+		}
+		muxIn.Incomplete = true
+		So(muxIn.Close(), ShouldBeNil)
+		// and the fourth one was never started
+		missing := testIntents[3]
+
+		mux.MarkIncomplete()
+		close(mux.Control)
+		So(<-mux.Completed, ShouldBeNil)
+
+		in, err := os.Open(file.Name())
+		So(err, ShouldBeNil)
+		defer in.Close()
+
+		Convey("the verifier should report the partial namespace", func() {
+			verifier := NewVerifier()
+			So((&Parser{In: in}).ReadAllBlocks(verifier), ShouldBeNil)
+			So(verifier.IncompleteDump(), ShouldBeTrue)
+			for _, dbc := range complete {
+				So(verifier.Stats(dbc.Namespace()).Verified(), ShouldBeTrue)
+			}
+			stats := verifier.Stats(partial.Namespace())
+			So(stats.Documents, ShouldEqual, 10)
+			So(stats.Incomplete, ShouldBeTrue)
+			So(stats.Verified(), ShouldBeFalse)
+			So(verifier.Stats(missing.Namespace()), ShouldBeNil)
+		})
+
+		Convey("the table of contents should record that the dump is incomplete", func() {
+			toc, err := ReadTableOfContents(in)
+			So(err, ShouldBeNil)
+			So(toc, ShouldNotBeNil)
+			So(toc.IncompleteDump, ShouldBeTrue)
+		})
+
+		Convey("the demultiplexer should finish the namespaces that were never dumped", func() {
+			demux := &Demultiplexer{In: in}
+			outChecksum := map[string]hash.Hash{}
+			outLengths := map[string]*int{}
+			demuxOuts := map[string]*RegularCollectionReceiver{}
+			readErrChan := make(chan error)
+			makeOuts(testIntents, demux, outChecksum, demuxOuts, outLengths, readErrChan)
+
+			So(demux.Run(), ShouldBeNil)
+			for range testIntents {
+				So(<-readErrChan, ShouldBeNil)
+			}
+			So(demux.IncompleteDump(), ShouldBeTrue)
+			So(demux.PartialNamespaces(), ShouldResemble, []string{partial.Namespace()})
+			So(demux.Finished(complete[0].Namespace()), ShouldBeTrue)
+			So(demux.Finished(missing.Namespace()), ShouldBeFalse)
+			So(*outLengths[missing.Namespace()], ShouldEqual, 0)
+			So(demuxOuts[partial.Namespace()].Incomplete(), ShouldBeTrue)
+			So(demuxOuts[complete[0].Namespace()].Incomplete(), ShouldBeFalse)
+
+			Convey("and namespaces opened afterwards should be empty", func() {
+				late := &RegularCollectionReceiver{Intent: missing, Demux: demux, Origin: "late.namespace"}
+				So(late.Open(), ShouldBeNil)
+				_, err := late.Read(make([]byte, db.MaxBSONSize))
+				So(err, ShouldEqual, io.EOF)
+			})
+		})
+	})
+}
@@ -0,0 +1,386 @@
+package archive
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/mongodb/mongo-tools/common/db"
+	"github.com/mongodb/mongo-tools/common/text"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// salvage.go implements a corruption-tolerant variant of Parser.ReadAllBlocks.
+// When it finds something that isn't a valid BSON document or terminator where
+// one is expected, it scans forward one byte at a time until it can resynchronise
+// on either:
+//   a valid namespace header, which starts a new block
+//   a valid BSON document, which continues the current block, as long as no
+//   terminator was skipped (otherwise the document may belong to another namespace)
+// Every skipped range is recorded in a SalvageReport.
+
+// DamagedRange is a range of an archive that was skipped while salvaging it.
+type DamagedRange struct {
+	Start int64
+	End   int64
+	// Namespace is the namespace of the block the damage was found in,
+	// or "" if it was found where a block header was expected.
+	Namespace string
+	Err       error
+}
+
+// SalvagedNamespace is what was recovered from the blocks of a single namespace.
+type SalvagedNamespace struct {
+	Namespace    string
+	Documents    int64
+	Bytes        int64
+	DamagedBytes int64
+}
+
+// EstimatedDocumentsLost estimates the number of documents of the namespace that
+// were in damaged ranges, based on the average size of the recovered documents.
+func (sn *SalvagedNamespace) EstimatedDocumentsLost() int64 {
+	if sn.DamagedBytes == 0 {
+		return 0
+	}
+	if sn.Documents == 0 {
+		return 1
+	}
+	average := sn.Bytes / sn.Documents
+	lost := (sn.DamagedBytes + average - 1) / average
+	if lost < 1 {
+		lost = 1
+	}
+	return lost
+}
+
+// SalvageReport records what Parser.SalvageAllBlocks skipped and recovered.
+type SalvageReport struct {
+	// Offset is the position in the archive at which salvaging starts. It is
+	// set by the caller, so that damaged ranges are reported as archive offsets.
+	Offset        int64
+	DamagedRanges []DamagedRange
+
+	namespaces []string
+	salvaged   map[string]*SalvagedNamespace
+}
+
+// Namespaces returns the namespaces that had at least one block header recovered,
+// in the order in which they were found.
+func (report *SalvageReport) Namespaces() []string {
+	return report.namespaces
+}
+
+// Namespace returns what was recovered of namespace, or nil if none of its block
+// headers were recovered.
+func (report *SalvageReport) Namespace(namespace string) *SalvagedNamespace {
+	return report.salvaged[namespace]
+}
+
+func (report *SalvageReport) namespace(namespace string) *SalvagedNamespace {
+	if report.salvaged == nil {
+		report.salvaged = make(map[string]*SalvagedNamespace)
+	}
+	sn, ok := report.salvaged[namespace]
+	if !ok {
+		sn = &SalvagedNamespace{Namespace: namespace}
+		report.salvaged[namespace] = sn
+		report.namespaces = append(report.namespaces, namespace)
+	}
+	return sn
+}
+
+// String formats the report for humans.
+func (report *SalvageReport) String() string {
+	buf := &bytes.Buffer{}
+	if len(report.DamagedRanges) == 0 {
+		fmt.Fprintf(buf, "no damage found in archive\n")
+		return buf.String()
+	}
+	fmt.Fprintf(buf, "%v damaged range(s) skipped in archive:\n", len(report.DamagedRanges))
+	grid := &text.GridWriter{ColumnPadding: 2}
+	grid.WriteCells("start", "end", "namespace", "error")
+	grid.EndRow()
+	for _, damage := range report.DamagedRanges {
+		namespace := strings.TrimPrefix(damage.Namespace, ".")
+		if namespace == "" {
+			namespace = "(unknown)"
+		}
+		grid.WriteCells(fmt.Sprintf("%v", damage.Start), fmt.Sprintf("%v", damage.End),
+			namespace, fmt.Sprintf("%v", damage.Err))
+		grid.EndRow()
+	}
+	grid.Flush(buf)
+
+	fmt.Fprintf(buf, "\nrecovered namespaces:\n")
+	grid = &text.GridWriter{ColumnPadding: 2}
+	grid.WriteCells("namespace", "documents", "bytes", "damaged bytes", "documents lost (estimate)")
+	grid.EndRow()
+	for _, namespace := range report.namespaces {
+		sn := report.salvaged[namespace]
+		grid.WriteCells(strings.TrimPrefix(namespace, "."), fmt.Sprintf("%v", sn.Documents), fmt.Sprintf("%v", sn.Bytes),
+			fmt.Sprintf("%v", sn.DamagedBytes), fmt.Sprintf("%v", sn.EstimatedDocumentsLost()))
+		grid.EndRow()
+	}
+	grid.Flush(buf)
+	return buf.String()
+}
+
+// salvager holds the state of Parser.SalvageAllBlocks.
+type salvager struct {
+	in       *bufio.Reader
+	offset   int64
+	report   *SalvageReport
+	inBlock  bool
+	current  *SalvagedNamespace
+	consumer ParserConsumer
+}
+
+// SalvageAllBlocks reads all of the blocks of the archive like ReadAllBlocks, but skips
+// over the parts of the archive that are corrupted instead of failing, recording them in
+// report. Errors returned by the consumer are still fatal.
+func (parse *Parser) SalvageAllBlocks(consumer ParserConsumer, report *SalvageReport) error {
+	s := &salvager{
+		// large enough to peek at a terminator followed by the largest valid document
+		in:       bufio.NewReaderSize(parse.In, db.MaxBSONSize+8),
+		offset:   report.Offset,
+		report:   report,
+		consumer: consumer,
+	}
+	for {
+		buf, err := s.in.Peek(4)
+		if err == io.EOF && len(buf) == 0 {
+			if s.inBlock {
+				s.damage(s.offset, s.current, newParserError("archive ends in the middle of a block"))
+			}
+			if err = consumer.End(); err != nil {
+				return newParserWrappedError("ParserConsumer.End", err)
+			}
+			return nil
+		}
+		if err != nil && err != io.EOF {
+			return newParserWrappedError("I/O error reading length or terminator", err)
+		}
+		if len(buf) < 4 {
+			s.resync(newParserError("archive ends with a partial length or terminator"))
+			continue
+		}
+		if bytes.Equal(buf, terminatorBytes) {
+			if !s.inBlock {
+				s.resync(newParserError("consecutive terminators / headerless blocks are not allowed"))
+				continue
+			}
+			s.discard(4)
+			s.inBlock = false
+			continue
+		}
+		doc, err := s.peekBSON(0)
+		if err != nil {
+			s.resync(err)
+			continue
+		}
+		if !s.inBlock {
+			if !isBlockHeader(doc) {
+				s.resync(newParserError("expected a block header"))
+				continue
+			}
+			if err = s.header(doc); err != nil {
+				return err
+			}
+			continue
+		}
+		if err = s.body(doc); err != nil {
+			return err
+		}
+	}
+}
+
+// header passes a block header to the consumer, and starts a new block.
+func (s *salvager) header(doc []byte) error {
+	if err := s.consumer.HeaderBSON(doc); err != nil {
+		return newParserWrappedError("ParserConsumer.HeaderBSON()", err)
+	}
+	colHeader := NamespaceHeader{}
+	if bson.Unmarshal(doc, &colHeader) == nil && colHeader.Collection != "" {
+		s.current = s.report.namespace(colHeader.Database + "." + colHeader.Collection)
+	} else {
+		// the table of contents
+		s.current = nil
+	}
+	s.inBlock = true
+	s.discard(len(doc))
+	return nil
+}
+
+// body passes a body document to the consumer.
+func (s *salvager) body(doc []byte) error {
+	if err := s.consumer.BodyBSON(doc); err != nil {
+		return newParserWrappedError("ParserConsumer.BodyBSON()", err)
+	}
+	if s.current != nil {
+		s.current.Documents++
+		s.current.Bytes += int64(len(doc))
+	}
+	s.discard(len(doc))
+	return nil
+}
+
+// resync skips forward until the salvager can continue reading, and records the
+// skipped range as damaged.
+func (s *salvager) resync(cause error) {
+	start := s.offset
+	current := s.current
+	if !s.inBlock {
+		current = nil
+	}
+	skippedTerminator := false
+	s.discard(1)
+	for {
+		buf, _ := s.in.Peek(4)
+		if len(buf) < 4 {
+			// the damage extends to the end of the archive
+			s.discard(len(buf))
+			s.damage(start, current, cause)
+			s.inBlock = false
+			s.current = nil
+			return
+		}
+		if bytes.Equal(buf, terminatorBytes) {
+			skippedTerminator = true
+			if doc, err := s.peekBSON(4); err == nil && isBlockHeader(doc) {
+				s.discard(4)
+				s.inBlock = false
+				break
+			}
+		} else if doc, err := s.peekBSON(0); err == nil {
+			if isBlockHeader(doc) {
+				s.inBlock = false
+				break
+			}
+			if s.inBlock && !skippedTerminator && s.followedByBSONOrTerminator(len(doc)) {
+				break
+			}
+		}
+		s.discard(1)
+	}
+	s.damage(start, current, cause)
+	if !s.inBlock {
+		s.current = nil
+	}
+}
+
+// damage records the range from start to the current offset as damaged. current
+// is the namespace of the block the damage was found in, if any.
+func (s *salvager) damage(start int64, current *SalvagedNamespace, cause error) {
+	damage := DamagedRange{
+		Start: start,
+		End:   s.offset,
+		Err:   cause,
+	}
+	if current != nil {
+		damage.Namespace = current.Namespace
+		current.DamagedBytes += s.offset - start
+	}
+	s.report.DamagedRanges = append(s.report.DamagedRanges, damage)
+}
+
+// peekBSON returns the valid BSON document found at skip bytes after the
+// current offset, without consuming it.
+func (s *salvager) peekBSON(skip int) ([]byte, error) {
+	buf, err := s.in.Peek(skip + 4)
+	if err != nil {
+		return nil, newParserWrappedError("read bson length", err)
+	}
+	size := int32(
+		(uint32(buf[skip+0]) << 0) |
+			(uint32(buf[skip+1]) << 8) |
+			(uint32(buf[skip+2]) << 16) |
+			(uint32(buf[skip+3]) << 24),
+	)
+	if size < minBSONSize || size > db.MaxBSONSize {
+		return nil, newParserError(fmt.Sprintf("%v is neither a valid bson length nor a archive terminator", size))
+	}
+	buf, err = s.in.Peek(skip + int(size))
+	if err != nil {
+		return nil, newParserWrappedError("read bson", err)
+	}
+	doc := buf[skip:]
+	if doc[size-1] != 0x00 {
+		return nil, newParserError(fmt.Sprintf("bson (size: %v, byte: %d) doesn't end with a null byte", size, doc[size-1]))
+	}
+	if err = bson.Unmarshal(doc, &bson.D{}); err != nil {
+		return nil, newParserWrappedError("invalid bson", err)
+	}
+	return doc, nil
+}
+
+// followedByBSONOrTerminator checks that the document of the given size at the
+// current offset is followed by the end of the archive, a terminator or another
+// valid document. This makes resynchronising on garbage that happens to look
+// like a BSON document less likely.
+func (s *salvager) followedByBSONOrTerminator(size int) bool {
+	buf, _ := s.in.Peek(size + 4)
+	if len(buf) == size {
+		return true
+	}
+	if len(buf) < size+4 {
+		return false
+	}
+	if bytes.Equal(buf[size:], terminatorBytes) {
+		return true
+	}
+	_, err := s.peekBSON(size)
+	return err == nil
+}
+
+// discard consumes n bytes.
+func (s *salvager) discard(n int) {
+	discarded, _ := s.in.Discard(n)
+	s.offset += int64(discarded)
+}
+
+// isBlockHeader returns true if doc looks like a namespace header, the header
+// of the table of contents or the incomplete dump marker.
+func isBlockHeader(doc []byte) bool {
+	fields := bson.D{}
+	if bson.Unmarshal(doc, &fields) != nil || len(fields) == 0 {
+		return false
+	}
+	hasCollection := false
+	for _, field := range fields {
+		switch field.Name {
+		case "collection":
+			collection, ok := field.Value.(string)
+			if !ok || collection == "" {
+				return false
+			}
+			hasCollection = true
+		case "db":
+			if _, ok := field.Value.(string); !ok {
+				return false
+			}
+		case "EOF", "CRC", "incomplete":
+		case "table_of_contents", "incomplete_dump":
+			return isMarkerHeader(fields)
+		default:
+			return false
+		}
+	}
+	return hasCollection
+}
+
+// isMarkerHeader returns true if fields are those of the header of the table of
+// contents or of the incomplete dump marker.
+func isMarkerHeader(fields bson.D) bool {
+	for _, field := range fields {
+		if field.Name != "table_of_contents" && field.Name != "incomplete_dump" {
+			return false
+		}
+		if field.Value != true {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,93 @@
+package archive
+
+import (
+	"bytes"
+	"hash"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func TestSalvage(t *testing.T) {
+	Convey("with 10000 docs in each of four collections multiplexed into a buffer", t, func() {
+		buf := &closingBuffer{bytes.Buffer{}}
+		mux := NewMultiplexer(buf, new(testNotifier))
+		muxIns := map[string]*MuxIn{}
+		inChecksum := map[string]hash.Hash{}
+		inLengths := map[string]*int{}
+
+		errChan := make(chan error)
+		makeIns(testIntents, mux, inChecksum, muxIns, inLengths, errChan)
+		go mux.Run()
+		for range testIntents {
+			So(<-errChan, ShouldBeNil)
+		}
+		close(mux.Control)
+		So(<-mux.Completed, ShouldBeNil)
+		data := buf.Bytes()
+
+		Convey("an intact archive should be salvaged without damage", func() {
+			verifier := NewVerifier()
+			report := &SalvageReport{Offset: 100}
+			parser := Parser{In: bytes.NewReader(data)}
+			So(parser.SalvageAllBlocks(verifier, report), ShouldBeNil)
+			So(report.DamagedRanges, ShouldBeEmpty)
+			for _, dbc := range testIntents {
+				So(verifier.Stats(dbc.Namespace()).Verified(), ShouldBeTrue)
+				So(report.Namespace(dbc.Namespace()).Documents, ShouldEqual, 10000)
+			}
+		})
+
+		Convey("a document with a damaged length should be skipped", func() {
+			// the length of the document right after the first foo.bar header
+			header, err := bson.Marshal(NamespaceHeader{Database: "foo", Collection: "bar"})
+			So(err, ShouldBeNil)
+			i := bytes.Index(data, header)
+			So(i, ShouldBeGreaterThanOrEqualTo, 0)
+			data[i+len(header)] = 0xFF
+
+			verifier := NewVerifier()
+			report := &SalvageReport{Offset: 100}
+			parser := Parser{In: bytes.NewReader(data)}
+			So(parser.SalvageAllBlocks(verifier, report), ShouldBeNil)
+			So(len(report.DamagedRanges), ShouldEqual, 1)
+			damage := report.DamagedRanges[0]
+			So(damage.Namespace, ShouldEqual, "foo.bar")
+			So(damage.Start, ShouldEqual, 100+i+len(header))
+
+			foobar := report.Namespace("foo.bar")
+			So(foobar.Documents, ShouldEqual, 9999)
+			So(foobar.EstimatedDocumentsLost(), ShouldEqual, 1)
+			So(verifier.Stats("foo.bar").Verified(), ShouldBeFalse)
+			for _, dbc := range testIntents[1:] {
+				So(verifier.Stats(dbc.Namespace()).Verified(), ShouldBeTrue)
+				So(report.Namespace(dbc.Namespace()).Documents, ShouldEqual, 10000)
+			}
+		})
+
+		Convey("a block with a damaged header should be skipped", func() {
+			header, err := bson.Marshal(NamespaceHeader{Database: "ding", Collection: "bats"})
+			So(err, ShouldBeNil)
+			i := bytes.Index(data, header)
+			So(i, ShouldBeGreaterThanOrEqualTo, 0)
+			// turn the db field into an invalid BSON type
+			data[i+4] = 0x7F
+
+			verifier := NewVerifier()
+			report := &SalvageReport{}
+			parser := Parser{In: bytes.NewReader(data)}
+			So(parser.SalvageAllBlocks(verifier, report), ShouldBeNil)
+			So(len(report.DamagedRanges), ShouldEqual, 1)
+			So(report.DamagedRanges[0].Namespace, ShouldEqual, "")
+			So(report.DamagedRanges[0].Start, ShouldEqual, i)
+
+			So(verifier.Stats("ding.bats").Verified(), ShouldBeFalse)
+			So(report.Namespace("ding.bats").Documents, ShouldBeLessThan, 10000)
+			for _, dbc := range []int{0, 2, 3} {
+				ns := testIntents[dbc].Namespace()
+				So(verifier.Stats(ns).Verified(), ShouldBeTrue)
+			}
+		})
+	})
+}
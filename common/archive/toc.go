@@ -0,0 +1,233 @@
+package archive
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+
+	"github.com/mongodb/mongo-tools/common"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// maxOffsetsPerNamespaceBlocks bounds the number of offsets written in a single
+// NamespaceBlocks document, keeping it well below the maximum BSON size
+const maxOffsetsPerNamespaceBlocks = 100000
+
+// TableOfContents maps namespaces to the offsets of their blocks in an archive.
+// It lets readers of seekable archives skip the blocks of namespaces they don't need.
+type TableOfContents struct {
+	// IncompleteDump records that the dump that wrote the archive was interrupted
+	IncompleteDump bool
+
+	namespaces []string
+	offsets    map[string][]int64
+	documents  map[string]int64
+}
+
+// NewTableOfContents creates an empty TableOfContents.
+func NewTableOfContents() *TableOfContents {
+	return &TableOfContents{
+		offsets:   make(map[string][]int64),
+		documents: make(map[string]int64),
+	}
+}
+
+// Add records that a block belonging to namespace starts at offset.
+func (toc *TableOfContents) Add(namespace string, offset int64) {
+	if _, ok := toc.offsets[namespace]; !ok {
+		toc.namespaces = append(toc.namespaces, namespace)
+	}
+	toc.offsets[namespace] = append(toc.offsets[namespace], offset)
+}
+
+// Namespaces returns the namespaces in the table of contents, in the order in
+// which their first block appears in the archive.
+func (toc *TableOfContents) Namespaces() []string {
+	return toc.namespaces
+}
+
+// Offsets returns the offsets of the blocks belonging to namespace, in increasing order.
+func (toc *TableOfContents) Offsets(namespace string) []int64 {
+	return toc.offsets[namespace]
+}
+
+// SetDocuments records the number of documents of a namespace, once all of
+// its blocks are written.
+func (toc *TableOfContents) SetDocuments(namespace string, documents int64) {
+	toc.documents[namespace] = documents
+}
+
+// Documents returns the number of documents of a namespace, and false if it
+// isn't recorded, as in archives from before the counts were recorded.
+func (toc *TableOfContents) Documents(namespace string) (int64, bool) {
+	documents, ok := toc.documents[namespace]
+	return documents, ok
+}
+
+// Write writes the table of contents as an archive block, starting at offset.
+func (toc *TableOfContents) Write(out io.Writer, offset int64) error {
+	header, err := bson.Marshal(TableOfContentsHeader{
+		TableOfContents: true,
+		IncompleteDump:  toc.IncompleteDump,
+	})
+	if err != nil {
+		return err
+	}
+	if err = writeFull(out, header); err != nil {
+		return err
+	}
+	for _, namespace := range toc.namespaces {
+		db, collection := common.SplitNamespace(namespace)
+		offsets := toc.offsets[namespace]
+		var documents *int64
+		if n, ok := toc.documents[namespace]; ok {
+			documents = &n
+		}
+		for len(offsets) > 0 {
+			n := len(offsets)
+			if n > maxOffsetsPerNamespaceBlocks {
+				n = maxOffsetsPerNamespaceBlocks
+			}
+			blocks, err := bson.Marshal(NamespaceBlocks{
+				Database:   db,
+				Collection: collection,
+				Offsets:    offsets[:n],
+				Documents:  documents,
+			})
+			if err != nil {
+				return err
+			}
+			if err = writeFull(out, blocks); err != nil {
+				return err
+			}
+			offsets = offsets[n:]
+			documents = nil
+		}
+	}
+	trailer, err := bson.Marshal(TableOfContentsTrailer{Offset: offset})
+	if err != nil {
+		return err
+	}
+	if err = writeFull(out, trailer); err != nil {
+		return err
+	}
+	return writeFull(out, terminatorBytes)
+}
+
+// ReadTableOfContents reads the table of contents found at the end of an archive.
+// It returns nil if the archive doesn't have one. The position of in is restored
+// before returning.
+func ReadTableOfContents(in io.ReadSeeker) (toc *TableOfContents, err error) {
+	start, err := in.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_, seekErr := in.Seek(start, io.SeekStart)
+		if err == nil {
+			err = seekErr
+		}
+	}()
+
+	// the archive ends with the fixed-size trailer document and a terminator
+	emptyTrailer, err := bson.Marshal(TableOfContentsTrailer{})
+	if err != nil {
+		return nil, err
+	}
+	trailerLength := int64(len(emptyTrailer))
+	end, err := in.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, err
+	}
+	if end-start < trailerLength+int64(len(terminatorBytes)) {
+		return nil, nil
+	}
+	if _, err = in.Seek(end-trailerLength-int64(len(terminatorBytes)), io.SeekStart); err != nil {
+		return nil, err
+	}
+	buf := make([]byte, trailerLength+int64(len(terminatorBytes)))
+	if _, err = io.ReadFull(in, buf); err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(buf[trailerLength:], terminatorBytes) {
+		return nil, nil
+	}
+	trailerDoc := bson.D{}
+	if bson.Unmarshal(buf[:trailerLength], &trailerDoc) != nil ||
+		len(trailerDoc) != 1 || trailerDoc[0].Name != "table_of_contents_offset" {
+		// the archive ends with a regular block
+		return nil, nil
+	}
+	tocOffset, ok := trailerDoc[0].Value.(int64)
+	if !ok || tocOffset < start || tocOffset >= end {
+		return nil, fmt.Errorf("table of contents offset %v is outside of the archive", trailerDoc[0].Value)
+	}
+
+	if _, err = in.Seek(tocOffset, io.SeekStart); err != nil {
+		return nil, err
+	}
+	consumer := &tableOfContentsConsumer{toc: NewTableOfContents()}
+	parser := Parser{In: in}
+	if err = parser.ReadBlock(consumer); err != nil {
+		return nil, fmt.Errorf("error reading archive table of contents: %v", err)
+	}
+	return consumer.toc, nil
+}
+
+// tableOfContentsConsumer wraps a TableOfContents, and implements ParserConsumer.
+type tableOfContentsConsumer struct {
+	toc *TableOfContents
+}
+
+// HeaderBSON is part of the ParserConsumer interface, it checks the table of contents header.
+func (tc *tableOfContentsConsumer) HeaderBSON(data []byte) error {
+	header := TableOfContentsHeader{}
+	err := bson.Unmarshal(data, &header)
+	if err != nil {
+		return err
+	}
+	if !header.TableOfContents {
+		return fmt.Errorf("table of contents header is missing")
+	}
+	tc.toc.IncompleteDump = header.IncompleteDump
+	return nil
+}
+
+// BodyBSON is part of the ParserConsumer interface, it unmarshals NamespaceBlocks.
+func (tc *tableOfContentsConsumer) BodyBSON(data []byte) error {
+	blocks := NamespaceBlocks{}
+	err := bson.Unmarshal(data, &blocks)
+	if err != nil {
+		return err
+	}
+	if blocks.Collection == "" {
+		// the trailer
+		return nil
+	}
+	namespace := blocks.Database + "." + blocks.Collection
+	for _, offset := range blocks.Offsets {
+		tc.toc.Add(namespace, offset)
+	}
+	if blocks.Documents != nil {
+		tc.toc.SetDocuments(namespace, *blocks.Documents)
+	}
+	return nil
+}
+
+// End is part of the ParserConsumer interface.
+func (tc *tableOfContentsConsumer) End() error {
+	return nil
+}
+
+// writeFull writes all of buf to out, returning io.ErrShortWrite if out
+// accepted fewer bytes.
+func writeFull(out io.Writer, buf []byte) error {
+	l, err := out.Write(buf)
+	if err != nil {
+		return err
+	}
+	if l != len(buf) {
+		return io.ErrShortWrite
+	}
+	return nil
+}
@@ -0,0 +1,132 @@
+package archive
+
+import (
+	"fmt"
+	"hash"
+	"hash/crc64"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+// NamespaceStats is what a Verifier found in the body of an archive for a single namespace.
+type NamespaceStats struct {
+	Namespace   string
+	Documents   int64
+	Bytes       int64
+	CRC         int64 // computed from the documents read
+	ExpectedCRC int64 // recorded in the namespace's EOF header
+	EOF         bool  // whether an EOF header was found for the namespace
+	Incomplete  bool  // whether the EOF header says the namespace was only partially dumped
+
+	hash hash.Hash64
+}
+
+// Verified returns true if an EOF header was found for the namespace, the namespace
+// was completely dumped, and its CRC matches the CRC of the documents read.
+func (stats *NamespaceStats) Verified() bool {
+	return stats.EOF && !stats.Incomplete && stats.CRC == stats.ExpectedCRC
+}
+
+// Verifier implements ParserConsumer. It reads the body of an archive without
+// restoring it, counting the documents and bytes of every namespace and computing
+// their CRCs, so that they can be checked against the CRCs recorded by mongodump.
+type Verifier struct {
+	namespaces             []string
+	stats                  map[string]*NamespaceStats
+	current                *NamespaceStats
+	readingTableOfContents bool
+	incompleteDump         bool
+}
+
+// NewVerifier creates a Verifier.
+func NewVerifier() *Verifier {
+	return &Verifier{
+		stats: make(map[string]*NamespaceStats),
+	}
+}
+
+// Namespaces returns the namespaces found in the body of the archive, in the
+// order in which their first block appears. Like the Demultiplexer, namespaces
+// are named database.collection, so the oplog is ".oplog".
+func (verifier *Verifier) Namespaces() []string {
+	return verifier.namespaces
+}
+
+// Stats returns the NamespaceStats of the given namespace, or nil if no block
+// of that namespace was found in the archive.
+func (verifier *Verifier) Stats(namespace string) *NamespaceStats {
+	return verifier.stats[namespace]
+}
+
+// IncompleteDump returns true if the archive is marked as written by an interrupted dump.
+func (verifier *Verifier) IncompleteDump() bool {
+	return verifier.incompleteDump
+}
+
+// HeaderBSON is part of the ParserConsumer interface, it unmarshals NamespaceHeaders.
+func (verifier *Verifier) HeaderBSON(data []byte) error {
+	verifier.readingTableOfContents = false
+	colHeader := NamespaceHeader{}
+	err := bson.Unmarshal(data, &colHeader)
+	if err != nil {
+		return newWrappedError("header bson doesn't unmarshal as a collection header", err)
+	}
+	if colHeader.Collection == "" {
+		tocHeader := TableOfContentsHeader{}
+		if bson.Unmarshal(data, &tocHeader) == nil && tocHeader.TableOfContents {
+			verifier.readingTableOfContents = true
+			verifier.incompleteDump = verifier.incompleteDump || tocHeader.IncompleteDump
+			return nil
+		}
+		incompleteHeader := IncompleteDumpHeader{}
+		if bson.Unmarshal(data, &incompleteHeader) == nil && incompleteHeader.IncompleteDump {
+			verifier.incompleteDump = true
+			verifier.current = nil
+			return nil
+		}
+		return newError("collection header is missing a Collection")
+	}
+	namespace := colHeader.Database + "." + colHeader.Collection
+	stats, ok := verifier.stats[namespace]
+	if !ok {
+		stats = &NamespaceStats{
+			Namespace: namespace,
+			hash:      crc64.New(crc64.MakeTable(crc64.ECMA)),
+		}
+		verifier.stats[namespace] = stats
+		verifier.namespaces = append(verifier.namespaces, namespace)
+	}
+	if stats.EOF {
+		return newError(fmt.Sprintf("namespace %v has blocks after its EOF", namespace))
+	}
+	if colHeader.EOF {
+		stats.EOF = true
+		stats.Incomplete = colHeader.Incomplete
+		stats.ExpectedCRC = colHeader.CRC
+		stats.CRC = int64(stats.hash.Sum64())
+		verifier.current = nil
+		return nil
+	}
+	verifier.current = stats
+	return nil
+}
+
+// BodyBSON is part of the ParserConsumer interface, it accounts for the documents
+// of the current namespace.
+func (verifier *Verifier) BodyBSON(data []byte) error {
+	if verifier.readingTableOfContents {
+		return nil
+	}
+	if verifier.current == nil {
+		return newError("collection data without a collection header")
+	}
+	verifier.current.Documents++
+	verifier.current.Bytes += int64(len(data))
+	verifier.current.hash.Write(data)
+	return nil
+}
+
+// End is part of the ParserConsumer interface.
+func (verifier *Verifier) End() error {
+	return nil
+}
@@ -0,0 +1,57 @@
+package archive
+
+import (
+	"bytes"
+	"hash"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestVerifier(t *testing.T) {
+	Convey("with 10000 docs in each of four collections multiplexed into a buffer", t, func() {
+		buf := &closingBuffer{bytes.Buffer{}}
+		mux := NewMultiplexer(buf, new(testNotifier))
+		muxIns := map[string]*MuxIn{}
+		inChecksum := map[string]hash.Hash{}
+		inLengths := map[string]*int{}
+
+		errChan := make(chan error)
+		makeIns(testIntents, mux, inChecksum, muxIns, inLengths, errChan)
+		go mux.Run()
+		for range testIntents {
+			So(<-errChan, ShouldBeNil)
+		}
+		close(mux.Control)
+		So(<-mux.Completed, ShouldBeNil)
+
+		Convey("the verifier should count the documents of every namespace and match their CRCs", func() {
+			verifier := NewVerifier()
+			parser := Parser{In: bytes.NewReader(buf.Bytes())}
+			So(parser.ReadAllBlocks(verifier), ShouldBeNil)
+			So(len(verifier.Namespaces()), ShouldEqual, len(testIntents))
+			for _, dbc := range testIntents {
+				stats := verifier.Stats(dbc.Namespace())
+				So(stats, ShouldNotBeNil)
+				So(stats.Documents, ShouldEqual, 10000)
+				So(stats.Bytes, ShouldEqual, *inLengths[dbc.Namespace()])
+				So(stats.Verified(), ShouldBeTrue)
+			}
+		})
+
+		Convey("the verifier should detect a corrupted document", func() {
+			data := buf.Bytes()
+			// the last document of foo.bar has "foo.bar" as its Baz field
+			i := bytes.LastIndex(data, []byte("foo.bar"))
+			So(i, ShouldBeGreaterThan, 0)
+			data[i+len("foo.bar")-1] = 'z'
+
+			verifier := NewVerifier()
+			parser := Parser{In: bytes.NewReader(data)}
+			So(parser.ReadAllBlocks(verifier), ShouldBeNil)
+			So(verifier.Stats("foo.bar").EOF, ShouldBeTrue)
+			So(verifier.Stats("foo.bar").Verified(), ShouldBeFalse)
+			So(verifier.Stats("ding.bats").Verified(), ShouldBeTrue)
+		})
+	})
+}
@@ -0,0 +1,276 @@
+package archive
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+)
+
+// volume.go splits an archive into volumes of a bounded size, and joins them back
+// into a single stream. Every volume starts with a fixed size VolumeHeader, that
+// records the volume's place in the archive and how much of the archive it holds.
+// Volumes are written to files named <path>.001, <path>.002 and so on, and can be
+// read back from those files, or from a single stream of all of the volumes in order.
+
+// VolumeMagicNumber is four bytes that are found at the beginning of every volume of
+// a multi-volume archive, in place of the MagicNumber of single file archives.
+const VolumeMagicNumber uint32 = 0x8199e26e
+
+// VolumeHeaderSize is the size of a VolumeHeader, as it is written to a volume.
+const VolumeHeaderSize = 4 + 16 + 4 + 8 + 1
+
+// VolumeHeader is found at the beginning of every volume of a multi-volume archive.
+type VolumeHeader struct {
+	// ArchiveID is generated for every multi-volume archive, so that volumes of
+	// different archives can't be mixed up.
+	ArchiveID [16]byte
+	// Index is the position of the volume in the archive, starting at 1.
+	Index uint32
+	// Length is the number of bytes of the archive that follow the header.
+	Length int64
+	// Last is set on the last volume of the archive.
+	Last bool
+}
+
+func (header *VolumeHeader) marshal() []byte {
+	buf := &bytes.Buffer{}
+	binary.Write(buf, binary.LittleEndian, VolumeMagicNumber)
+	buf.Write(header.ArchiveID[:])
+	binary.Write(buf, binary.LittleEndian, header.Index)
+	binary.Write(buf, binary.LittleEndian, header.Length)
+	if header.Last {
+		buf.WriteByte(1)
+	} else {
+		buf.WriteByte(0)
+	}
+	return buf.Bytes()
+}
+
+// readVolumeHeader reads a VolumeHeader, returning io.EOF if in is at its end.
+func readVolumeHeader(in io.Reader) (*VolumeHeader, error) {
+	buf := make([]byte, VolumeHeaderSize)
+	_, err := io.ReadFull(in, buf)
+	if err == io.EOF {
+		return nil, err
+	}
+	if err != nil {
+		return nil, newWrappedError("I/O failure reading volume header", err)
+	}
+	if binary.LittleEndian.Uint32(buf) != VolumeMagicNumber {
+		return nil, newError("stream or file does not appear to be an archive volume")
+	}
+	header := &VolumeHeader{}
+	copy(header.ArchiveID[:], buf[4:20])
+	header.Index = binary.LittleEndian.Uint32(buf[20:24])
+	header.Length = int64(binary.LittleEndian.Uint64(buf[24:32]))
+	header.Last = buf[32] == 1
+	return header, nil
+}
+
+// IsVolume returns true if buf starts with the VolumeMagicNumber.
+func IsVolume(buf []byte) bool {
+	return len(buf) >= 4 && binary.LittleEndian.Uint32(buf) == VolumeMagicNumber
+}
+
+// VolumePath returns the path of the volume with the given index of the archive at path.
+func VolumePath(path string, index uint32) string {
+	return fmt.Sprintf("%v.%03d", path, index)
+}
+
+// VolumeWriter is an io.WriteCloser that writes an archive to volumes of at most
+// VolumeSize bytes. The header of each volume is rewritten once the volume is full,
+// so volumes can only be written to files.
+type VolumeWriter struct {
+	Path       string
+	VolumeSize int64
+
+	header *VolumeHeader
+	file   *os.File
+}
+
+// NewVolumeWriter creates the first volume of an archive at path.
+func NewVolumeWriter(path string, volumeSize int64) (*VolumeWriter, error) {
+	if volumeSize <= VolumeHeaderSize {
+		return nil, newError(fmt.Sprintf("volume size must be larger than %v bytes", VolumeHeaderSize))
+	}
+	vw := &VolumeWriter{
+		Path:       path,
+		VolumeSize: volumeSize,
+		header:     &VolumeHeader{},
+	}
+	if _, err := rand.Read(vw.header.ArchiveID[:]); err != nil {
+		return nil, newWrappedError("generating archive id", err)
+	}
+	if err := vw.openVolume(); err != nil {
+		return nil, err
+	}
+	return vw, nil
+}
+
+// openVolume creates the next volume, with a provisional header.
+func (vw *VolumeWriter) openVolume() error {
+	vw.header.Index++
+	vw.header.Length = 0
+	file, err := os.Create(VolumePath(vw.Path, vw.header.Index))
+	if err != nil {
+		return err
+	}
+	vw.file = file
+	_, err = vw.file.Write(vw.header.marshal())
+	return err
+}
+
+// closeVolume writes the final header of the current volume and closes it.
+func (vw *VolumeWriter) closeVolume() error {
+	_, err := vw.file.WriteAt(vw.header.marshal(), 0)
+	if closeErr := vw.file.Close(); err == nil {
+		err = closeErr
+	}
+	vw.file = nil
+	return err
+}
+
+// Write is part of the io.Writer interface. It starts a new volume whenever the
+// current one is full.
+func (vw *VolumeWriter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		room := vw.VolumeSize - VolumeHeaderSize - vw.header.Length
+		if room == 0 {
+			if err := vw.closeVolume(); err != nil {
+				return written, err
+			}
+			if err := vw.openVolume(); err != nil {
+				return written, err
+			}
+			continue
+		}
+		chunk := p
+		if int64(len(chunk)) > room {
+			chunk = chunk[:room]
+		}
+		n, err := vw.file.Write(chunk)
+		written += n
+		vw.header.Length += int64(n)
+		if err != nil {
+			return written, err
+		}
+		p = p[n:]
+	}
+	return written, nil
+}
+
+// Close is part of the io.Closer interface. It marks the current volume as the
+// last one of the archive.
+func (vw *VolumeWriter) Close() error {
+	if vw.file == nil {
+		return nil
+	}
+	vw.header.Last = true
+	return vw.closeVolume()
+}
+
+// VolumeReader is an io.ReadCloser that reads the archive held by a sequence of
+// volumes, checking that they belong to the same archive, are in order, and that
+// none of them are missing or truncated.
+type VolumeReader struct {
+	// open opens the volume with the given index, or is nil if the volumes
+	// are read one after the other from in.
+	open func(index uint32) (io.ReadCloser, error)
+
+	in        io.ReadCloser
+	first     *VolumeHeader
+	current   *VolumeHeader
+	remaining int64
+}
+
+// NewVolumeReader reads the volumes of an archive from a single stream, in which
+// they follow each other in order.
+func NewVolumeReader(in io.ReadCloser) *VolumeReader {
+	return &VolumeReader{in: in}
+}
+
+// OpenVolumes reads the volumes of the archive at path from their files.
+func OpenVolumes(path string) (*VolumeReader, error) {
+	vr := &VolumeReader{
+		open: func(index uint32) (io.ReadCloser, error) {
+			file, err := os.Open(VolumePath(path, index))
+			if os.IsNotExist(err) {
+				return nil, newError(fmt.Sprintf("volume %v of archive '%v' is missing", index, path))
+			}
+			return file, err
+		},
+	}
+	var err error
+	vr.in, err = vr.open(1)
+	if err != nil {
+		return nil, err
+	}
+	return vr, nil
+}
+
+// nextVolume moves on to the next volume, reading and checking its header.
+func (vr *VolumeReader) nextVolume() error {
+	index := uint32(1)
+	if vr.current != nil {
+		index = vr.current.Index + 1
+		if vr.open != nil {
+			vr.in.Close()
+			in, err := vr.open(index)
+			if err != nil {
+				return err
+			}
+			vr.in = in
+		}
+	}
+	header, err := readVolumeHeader(vr.in)
+	if err == io.EOF {
+		return newError(fmt.Sprintf("volume %v of archive is missing", index))
+	}
+	if err != nil {
+		return err
+	}
+	if vr.first == nil {
+		vr.first = header
+	} else if header.ArchiveID != vr.first.ArchiveID {
+		return newError(fmt.Sprintf("volume %v belongs to a different archive", index))
+	}
+	if header.Index != index {
+		return newError(fmt.Sprintf("expected volume %v of archive, found volume %v", index, header.Index))
+	}
+	vr.current = header
+	vr.remaining = header.Length
+	return nil
+}
+
+// Read is part of the io.Reader interface.
+func (vr *VolumeReader) Read(p []byte) (int, error) {
+	for vr.current == nil || vr.remaining == 0 {
+		if vr.current != nil && vr.current.Last {
+			return 0, io.EOF
+		}
+		if err := vr.nextVolume(); err != nil {
+			return 0, err
+		}
+	}
+	if int64(len(p)) > vr.remaining {
+		p = p[:vr.remaining]
+	}
+	n, err := vr.in.Read(p)
+	vr.remaining -= int64(n)
+	if err == io.EOF {
+		if vr.remaining > 0 {
+			return n, newError(fmt.Sprintf("volume %v of archive is truncated", vr.current.Index))
+		}
+		err = nil
+	}
+	return n, err
+}
+
+// Close is part of the io.Closer interface.
+func (vr *VolumeReader) Close() error {
+	return vr.in.Close()
+}
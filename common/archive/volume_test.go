@@ -0,0 +1,136 @@
+package archive
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func writeVolumes(path string, volumeSize int64, data []byte) {
+	vw, err := NewVolumeWriter(path, volumeSize)
+	So(err, ShouldBeNil)
+	// write in uneven chunks, so that writes straddle volumes
+	for len(data) > 0 {
+		n := 77
+		if n > len(data) {
+			n = len(data)
+		}
+		written, err := vw.Write(data[:n])
+		So(err, ShouldBeNil)
+		So(written, ShouldEqual, n)
+		data = data[n:]
+	}
+	So(vw.Close(), ShouldBeNil)
+}
+
+func TestVolumes(t *testing.T) {
+	Convey("With an archive written to volumes of 100 bytes", t, func() {
+		tmp, err := ioutil.TempDir("", "archive_volumes")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(tmp)
+		path := filepath.Join(tmp, "x.archive")
+
+		data := make([]byte, 1000)
+		for i := range data {
+			data[i] = byte(i)
+		}
+		writeVolumes(path, 100, data)
+
+		payload := 100 - VolumeHeaderSize
+		volumes := (len(data) + payload - 1) / payload
+		for index := 1; index <= volumes; index++ {
+			stat, err := os.Stat(VolumePath(path, uint32(index)))
+			So(err, ShouldBeNil)
+			So(stat.Size(), ShouldBeLessThanOrEqualTo, 100)
+		}
+		_, err = os.Stat(VolumePath(path, uint32(volumes+1)))
+		So(os.IsNotExist(err), ShouldBeTrue)
+
+		Convey("the volumes can be read back from their files", func() {
+			vr, err := OpenVolumes(path)
+			So(err, ShouldBeNil)
+			read, err := ioutil.ReadAll(vr)
+			So(err, ShouldBeNil)
+			So(read, ShouldResemble, data)
+			So(vr.Close(), ShouldBeNil)
+		})
+
+		Convey("the volumes can be read back from a single stream", func() {
+			stream := &bytes.Buffer{}
+			for index := 1; index <= volumes; index++ {
+				volume, err := ioutil.ReadFile(VolumePath(path, uint32(index)))
+				So(err, ShouldBeNil)
+				stream.Write(volume)
+			}
+			So(IsVolume(stream.Bytes()), ShouldBeTrue)
+			read, err := ioutil.ReadAll(NewVolumeReader(ioutil.NopCloser(stream)))
+			So(err, ShouldBeNil)
+			So(read, ShouldResemble, data)
+		})
+
+		Convey("a missing volume is an error", func() {
+			So(os.Remove(VolumePath(path, 3)), ShouldBeNil)
+			vr, err := OpenVolumes(path)
+			So(err, ShouldBeNil)
+			_, err = ioutil.ReadAll(vr)
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "volume 3")
+		})
+
+		Convey("a missing last volume is an error", func() {
+			So(os.Remove(VolumePath(path, uint32(volumes))), ShouldBeNil)
+			vr, err := OpenVolumes(path)
+			So(err, ShouldBeNil)
+			_, err = ioutil.ReadAll(vr)
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("volumes out of order are an error", func() {
+			stream := &bytes.Buffer{}
+			for _, index := range []uint32{1, 3, 2} {
+				volume, err := ioutil.ReadFile(VolumePath(path, index))
+				So(err, ShouldBeNil)
+				stream.Write(volume)
+			}
+			_, err := ioutil.ReadAll(NewVolumeReader(ioutil.NopCloser(stream)))
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "expected volume 2")
+		})
+
+		Convey("volumes of another archive are an error", func() {
+			other := filepath.Join(tmp, "y.archive")
+			writeVolumes(other, 100, data)
+			So(os.Rename(VolumePath(other, 2), VolumePath(path, 2)), ShouldBeNil)
+			vr, err := OpenVolumes(path)
+			So(err, ShouldBeNil)
+			_, err = ioutil.ReadAll(vr)
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "different archive")
+		})
+
+		Convey("a truncated volume is an error", func() {
+			So(os.Truncate(VolumePath(path, 2), 50), ShouldBeNil)
+			vr, err := OpenVolumes(path)
+			So(err, ShouldBeNil)
+			_, err = ioutil.ReadAll(vr)
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "truncated")
+		})
+	})
+
+	Convey("Volumes must be larger than their header", t, func() {
+		_, err := NewVolumeWriter(filepath.Join(os.TempDir(), "never.archive"), VolumeHeaderSize)
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("Reading an empty stream of volumes is an error", t, func() {
+		_, err := NewVolumeReader(ioutil.NopCloser(&bytes.Buffer{})).Read(make([]byte, 10))
+		So(err, ShouldNotBeNil)
+		So(err, ShouldNotEqual, io.EOF)
+	})
+}
@@ -10,6 +10,7 @@ import (
 	"github.com/mongodb/mongo-tools/common/util"
 	"gopkg.in/mgo.v2"
 	"gopkg.in/mgo.v2/bson"
+	"math"
 	"strconv"
 	"time"
 )
@@ -217,6 +218,84 @@ func ParseSpecialKeys(special interface{}) (interface{}, error) {
 			}
 		}
 
+		if jsonValue, ok := doc["$numberDouble"]; ok {
+			switch v := jsonValue.(type) {
+			case string:
+				return parseNumberDouble(v)
+			default:
+				return nil, errors.New("expected $numberDouble field to have string value")
+			}
+		}
+
+		if jsonValue, ok := doc["$binary"]; ok {
+			binDoc, err := getSubdocument("$binary", jsonValue)
+			if err != nil {
+				return nil, err
+			}
+			data, ok := binDoc["base64"].(string)
+			if !ok {
+				return nil, errors.New("expected $binary to have 'base64' string field")
+			}
+			subType, ok := binDoc["subType"].(string)
+			if !ok {
+				return nil, errors.New("expected $binary to have 'subType' string field")
+			}
+			bytes, err := base64.StdEncoding.DecodeString(data)
+			if err != nil {
+				return nil, err
+			}
+			kind, err := strconv.ParseUint(subType, 16, 8)
+			if err != nil || len(subType) > 2 {
+				return nil, errors.New("expected single byte (as hexadecimal string) for $binary 'subType' field")
+			}
+			return bson.Binary{Kind: byte(kind), Data: bytes}, nil
+		}
+
+		if jsonValue, ok := doc["$regularExpression"]; ok {
+			regexDoc, err := getSubdocument("$regularExpression", jsonValue)
+			if err != nil {
+				return nil, err
+			}
+			pattern, ok := regexDoc["pattern"].(string)
+			if !ok {
+				return nil, errors.New("expected $regularExpression to have 'pattern' string field")
+			}
+			options, ok := regexDoc["options"].(string)
+			if !ok {
+				return nil, errors.New("expected $regularExpression to have 'options' string field")
+			}
+			return bson.RegEx{Pattern: pattern, Options: options}, nil
+		}
+
+		if jsonValue, ok := doc["$dbPointer"]; ok {
+			pointerDoc, err := getSubdocument("$dbPointer", jsonValue)
+			if err != nil {
+				return nil, err
+			}
+			namespace, ok := pointerDoc["$ref"].(string)
+			if !ok {
+				return nil, errors.New("expected $dbPointer to have '$ref' string field")
+			}
+			id, err := ParseJSONValue(pointerDoc["$id"])
+			if err != nil {
+				return nil, fmt.Errorf("error parsing $dbPointer $id field: %v", err)
+			}
+			oid, ok := id.(bson.ObjectId)
+			if !ok {
+				return nil, errors.New("expected $dbPointer to have an ObjectId '$id' field")
+			}
+			return bson.DBPointer{Namespace: namespace, Id: oid}, nil
+		}
+
+		if jsonValue, ok := doc["$symbol"]; ok {
+			switch v := jsonValue.(type) {
+			case string:
+				return bson.Symbol(v), nil
+			default:
+				return nil, errors.New("expected $symbol field to have string value")
+			}
+		}
+
 		if _, ok := doc["$undefined"]; ok {
 			return bson.Undefined, nil
 		}
@@ -414,3 +493,29 @@ func parseNumberLongField(jsonValue interface{}) (int64, error) {
 		return 0, errors.New("expected $numberLong field to have string value")
 	}
 }
+
+// parseNumberDouble parses the string value of a $numberDouble field, which
+// is a number, Infinity, -Infinity or NaN.
+func parseNumberDouble(s string) (float64, error) {
+	switch s {
+	case "Infinity":
+		return math.Inf(1), nil
+	case "-Infinity":
+		return math.Inf(-1), nil
+	case "NaN":
+		return math.NaN(), nil
+	}
+	return strconv.ParseFloat(s, 64)
+}
+
+// getSubdocument returns the document that is the value of the field key of an
+// extended JSON value.
+func getSubdocument(key string, jsonValue interface{}) (map[string]interface{}, error) {
+	switch v := jsonValue.(type) {
+	case map[string]interface{}:
+		return v, nil
+	case bson.D:
+		return v.Map(), nil
+	}
+	return nil, fmt.Errorf("expected %v key to have internal document", key)
+}
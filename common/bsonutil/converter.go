@@ -8,6 +8,10 @@ import (
 	"github.com/mongodb/mongo-tools/common/util"
 	"gopkg.in/mgo.v2"
 	"gopkg.in/mgo.v2/bson"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -386,3 +390,186 @@ func GetBSONValueAsJSON(x interface{}) (interface{}, error) {
 
 	return nil, fmt.Errorf("conversion of BSON value '%v' of type '%T' not supported", x, x)
 }
+
+// ConvertBSONValueToExtendedJSON walks through a document or an array and
+// converts any BSON value to its representation in the given Extended JSON
+// format. Unlike ConvertBSONValueToJSON, it does not mutate its argument.
+func ConvertBSONValueToExtendedJSON(x interface{}, format json.Format) (interface{}, error) {
+	if format == "" || format == json.LegacyFormat {
+		return GetBSONValueAsJSON(x)
+	}
+	canonical := format == json.CanonicalFormat
+
+	switch v := x.(type) {
+	case nil:
+		return nil, nil
+	case bool:
+		return v, nil
+	case string:
+		return v, nil
+
+	case *bson.M: // document
+		return ConvertBSONValueToExtendedJSON(*v, format)
+	case bson.M: // document
+		out := bson.M{}
+		for key, value := range v {
+			jsonValue, err := ConvertBSONValueToExtendedJSON(value, format)
+			if err != nil {
+				return nil, err
+			}
+			out[key] = jsonValue
+		}
+		return out, nil
+	case map[string]interface{}:
+		return ConvertBSONValueToExtendedJSON(bson.M(v), format)
+	case bson.D:
+		out := MarshalD{}
+		for _, value := range v {
+			jsonValue, err := ConvertBSONValueToExtendedJSON(value.Value, format)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, bson.DocElem{Name: value.Name, Value: jsonValue})
+		}
+		return out, nil
+	case MarshalD:
+		return ConvertBSONValueToExtendedJSON(bson.D(v), format)
+	case []interface{}: // array
+		out := []interface{}{}
+		for _, value := range v {
+			jsonValue, err := ConvertBSONValueToExtendedJSON(value, format)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, jsonValue)
+		}
+		return out, nil
+
+	case int: // NumberInt, as decoded by mgo
+		return ConvertBSONValueToExtendedJSON(int32(v), format)
+	case int32: // NumberInt
+		if !canonical {
+			return v, nil
+		}
+		return extendedValue("$numberInt", strconv.FormatInt(int64(v), 10)), nil
+	case int64: // NumberLong
+		if !canonical {
+			return v, nil
+		}
+		return extendedValue("$numberLong", strconv.FormatInt(v, 10)), nil
+	case float32:
+		return ConvertBSONValueToExtendedJSON(float64(v), format)
+	case float64:
+		if !canonical && !math.IsInf(v, 0) && !math.IsNaN(v) {
+			return json.NumberFloat(v), nil
+		}
+		return extendedValue("$numberDouble", formatCanonicalDouble(v)), nil
+	case bson.Decimal128:
+		return extendedValue("$numberDecimal", v.String()), nil
+
+	case bson.ObjectId: // ObjectId
+		return extendedValue("$oid", v.Hex()), nil
+
+	case time.Time: // Date
+		if !canonical && v.Year() >= 1970 && v.Year() <= 9999 {
+			return extendedValue("$date", v.UTC().Format(json.JSON_DATE_FORMAT)), nil
+		}
+		millis := v.Unix()*1000 + int64(v.Nanosecond()/1e6)
+		return extendedValue("$date", extendedValue("$numberLong", strconv.FormatInt(millis, 10))), nil
+
+	case []byte: // BinData (with generic type)
+		return ConvertBSONValueToExtendedJSON(bson.Binary{Kind: 0x00, Data: v}, format)
+	case bson.Binary: // BinData
+		return extendedValue("$binary", MarshalD{
+			{"base64", base64.StdEncoding.EncodeToString(v.Data)},
+			{"subType", fmt.Sprintf("%02x", v.Kind)},
+		}), nil
+
+	case mgo.DBRef: // DBRef
+		id, err := ConvertBSONValueToExtendedJSON(v.Id, format)
+		if err != nil {
+			return nil, err
+		}
+		ref := MarshalD{{"$ref", v.Collection}, {"$id", id}}
+		if v.Database != "" {
+			ref = append(ref, bson.DocElem{Name: "$db", Value: v.Database})
+		}
+		return ref, nil
+
+	case bson.DBPointer: // DBPointer
+		return extendedValue("$dbPointer", MarshalD{
+			{"$ref", v.Namespace},
+			{"$id", extendedValue("$oid", v.Id.Hex())},
+		}), nil
+
+	case bson.RegEx: // RegExp
+		options := []byte(v.Options)
+		sort.Slice(options, func(i, j int) bool { return options[i] < options[j] })
+		return extendedValue("$regularExpression", MarshalD{
+			{"pattern", v.Pattern},
+			{"options", string(options)},
+		}), nil
+
+	case bson.MongoTimestamp: // Timestamp
+		timestamp := int64(v)
+		return extendedValue("$timestamp", MarshalD{
+			{"t", uint32(timestamp >> 32)},
+			{"i", uint32(timestamp)},
+		}), nil
+
+	case bson.JavaScript: // JavaScript
+		if v.Scope == nil {
+			return extendedValue("$code", v.Code), nil
+		}
+		scope, err := ConvertBSONValueToExtendedJSON(v.Scope, format)
+		if err != nil {
+			return nil, err
+		}
+		return MarshalD{{"$code", v.Code}, {"$scope", scope}}, nil
+
+	case bson.Symbol: // Symbol
+		return extendedValue("$symbol", string(v)), nil
+
+	default:
+		switch x {
+		case bson.MinKey: // MinKey
+			return extendedValue("$minKey", 1), nil
+
+		case bson.MaxKey: // MaxKey
+			return extendedValue("$maxKey", 1), nil
+
+		case bson.Undefined: // undefined
+			return extendedValue("$undefined", true), nil
+		}
+	}
+
+	return nil, fmt.Errorf("conversion of BSON value '%v' of type '%T' not supported", x, x)
+}
+
+// extendedValue returns the single field document that wraps value in Extended JSON.
+func extendedValue(key string, value interface{}) MarshalD {
+	return MarshalD{{key, value}}
+}
+
+// formatCanonicalDouble formats f the way canonical Extended JSON writes
+// $numberDouble values: as the shortest representation that parses back to f,
+// always with a fractional part or an exponent.
+func formatCanonicalDouble(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "Infinity"
+	case math.IsInf(f, -1):
+		return "-Infinity"
+	case math.IsNaN(f):
+		return "NaN"
+	}
+	s := strconv.FormatFloat(f, 'G', -1, 64)
+	exponent := strings.IndexByte(s, 'E')
+	if exponent == -1 {
+		exponent = len(s)
+	}
+	if strings.IndexByte(s[:exponent], '.') == -1 {
+		s = s[:exponent] + ".0" + s[exponent:]
+	}
+	return s
+}
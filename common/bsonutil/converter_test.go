@@ -8,6 +8,7 @@ import (
 	. "github.com/smartystreets/goconvey/convey"
 	"gopkg.in/mgo.v2"
 	"gopkg.in/mgo.v2/bson"
+	"math"
 	"testing"
 	"time"
 )
@@ -343,3 +344,90 @@ func TestJSCodeBSONToJSON(t *testing.T) {
 		})
 	})
 }
+
+func marshalExtendedJSON(x interface{}, format json.Format) string {
+	extended, err := ConvertBSONValueToExtendedJSON(x, format)
+	So(err, ShouldBeNil)
+	out, err := json.Marshal(extended)
+	So(err, ShouldBeNil)
+	return string(out)
+}
+
+func TestExtendedJSONFormats(t *testing.T) {
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("Converting BSON to Extended JSON v2", t, func() {
+		date := time.Unix(1500000000, 123e6)
+
+		Convey("canonical mode wraps every number and date", func() {
+			So(marshalExtendedJSON(bson.D{{"a", int32(1)}}, json.CanonicalFormat), ShouldEqual, `{"a":{"$numberInt":"1"}}`)
+			So(marshalExtendedJSON(bson.D{{"a", 1}}, json.CanonicalFormat), ShouldEqual, `{"a":{"$numberInt":"1"}}`)
+			So(marshalExtendedJSON(int64(1), json.CanonicalFormat), ShouldEqual, `{"$numberLong":"1"}`)
+			So(marshalExtendedJSON(1.0, json.CanonicalFormat), ShouldEqual, `{"$numberDouble":"1.0"}`)
+			So(marshalExtendedJSON(-1.5e300, json.CanonicalFormat), ShouldEqual, `{"$numberDouble":"-1.5E+300"}`)
+			So(marshalExtendedJSON(1e21, json.CanonicalFormat), ShouldEqual, `{"$numberDouble":"1.0E+21"}`)
+			So(marshalExtendedJSON(math.Inf(-1), json.CanonicalFormat), ShouldEqual, `{"$numberDouble":"-Infinity"}`)
+			So(marshalExtendedJSON(date, json.CanonicalFormat), ShouldEqual, `{"$date":{"$numberLong":"1500000000123"}}`)
+			So(marshalExtendedJSON(bson.Binary{0x80, []byte("hi")}, json.CanonicalFormat), ShouldEqual,
+				`{"$binary":{"base64":"aGk=","subType":"80"}}`)
+			So(marshalExtendedJSON(bson.RegEx{"^a", "mi"}, json.CanonicalFormat), ShouldEqual,
+				`{"$regularExpression":{"pattern":"^a","options":"im"}}`)
+		})
+
+		Convey("relaxed mode writes plain numbers and ISO dates where it can", func() {
+			So(marshalExtendedJSON(bson.D{{"a", int32(1)}, {"b", int64(2)}, {"c", 1.0}}, json.RelaxedFormat), ShouldEqual,
+				`{"a":1,"b":2,"c":1.0}`)
+			So(marshalExtendedJSON(math.NaN(), json.RelaxedFormat), ShouldEqual, `{"$numberDouble":"NaN"}`)
+			So(marshalExtendedJSON(date, json.RelaxedFormat), ShouldEqual, `{"$date":"2017-07-14T02:40:00.123Z"}`)
+			So(marshalExtendedJSON(time.Unix(-1, 0), json.RelaxedFormat), ShouldEqual, `{"$date":{"$numberLong":"-1000"}}`)
+		})
+
+		Convey("legacy mode is the same as ConvertBSONValueToJSON", func() {
+			doc := bson.D{{"a", int64(1)}, {"b", date}}
+			legacy, err := ConvertBSONValueToJSON(bson.D{{"a", int64(1)}, {"b", date}})
+			So(err, ShouldBeNil)
+			out, err := json.Marshal(legacy)
+			So(err, ShouldBeNil)
+			So(marshalExtendedJSON(doc, json.LegacyFormat), ShouldEqual, string(out))
+		})
+
+		Convey("every type makes the round trip in canonical mode", func() {
+			doc := bson.D{
+				{"int", int32(-7)},
+				{"long", int64(1) << 40},
+				{"double", 0.1},
+				{"inf", math.Inf(1)},
+				{"decimal", bson.Decimal128{}},
+				{"string", "str"},
+				{"oid", bson.ObjectIdHex("5a934e000102030405000000")},
+				{"date", date},
+				{"oldDate", time.Unix(-86400, 0)},
+				{"binary", bson.Binary{0x04, []byte{1, 2, 3}}},
+				{"regex", bson.RegEx{"^x", "i"}},
+				{"timestamp", bson.MongoTimestamp(5<<32 | 6)},
+				{"code", bson.JavaScript{"f()", nil}},
+				{"codeWithScope", bson.JavaScript{"f(x)", bson.D{{"x", int32(1)}}}},
+				{"symbol", bson.Symbol("sym")},
+				{"dbPointer", bson.DBPointer{"db.c", bson.ObjectIdHex("5a934e000102030405000000")}},
+				{"dbRef", mgo.DBRef{"c", int32(1), "db"}},
+				{"minKey", bson.MinKey},
+				{"maxKey", bson.MaxKey},
+				{"undefined", bson.Undefined},
+				{"null", nil},
+				{"array", []interface{}{int32(1), bson.D{{"y", false}}}},
+				{"object", bson.D{{"z", int64(-1)}}},
+			}
+			out := marshalExtendedJSON(doc, json.CanonicalFormat)
+			parsed, err := json.UnmarshalBsonD([]byte(out))
+			So(err, ShouldBeNil)
+			parsed, err = GetExtendedBsonD(parsed)
+			So(err, ShouldBeNil)
+
+			expected, err := bson.Marshal(doc)
+			So(err, ShouldBeNil)
+			actual, err := bson.Marshal(parsed)
+			So(err, ShouldBeNil)
+			So(actual, ShouldResemble, expected)
+		})
+	})
+}
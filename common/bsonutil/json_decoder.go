@@ -0,0 +1,597 @@
+package bsonutil
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+	"strconv"
+	"unicode"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"github.com/mongodb/mongo-tools/common/json"
+	"github.com/mongodb/mongo-tools/common/util"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// ConvertJSONToBSON converts a JSON document to a BSON document. It goes
+// straight from the JSON text to BSON bytes, without building maps of
+// interface{} values first, so it is much faster than unmarshaling the document
+// and calling GetExtendedBsonD on it, but it gives the same result.
+//
+// Strict mode JSON, along with the extended types written as documents like
+// { "$oid": "..." }, is converted directly. Documents that use shell mode
+// syntax, like NumberLong(1) or unquoted keys, and malformed documents, are
+// handed to the json package and GetExtendedBsonD instead, which also report
+// the errors.
+func ConvertJSONToBSON(data []byte) ([]byte, error) {
+	d := jsonToBSONDecoder{data: data, out: make([]byte, 0, len(data))}
+	if err := d.topLevelDocument(); err == nil {
+		return d.out, nil
+	} else if err != errUnsupportedJSON {
+		return nil, err
+	}
+
+	document, err := json.UnmarshalBsonD(data)
+	if err != nil {
+		return nil, err
+	}
+	document, err = GetExtendedBsonD(document)
+	if err != nil {
+		return nil, err
+	}
+	return bson.Marshal(document)
+}
+
+// errUnsupportedJSON means that a jsonToBSONDecoder cannot convert its input
+// itself, and that it has to be handed to the slower, more lenient, decoder.
+var errUnsupportedJSON = errors.New("unsupported JSON")
+
+// BSON element types written by the jsonToBSONDecoder.
+const (
+	bsonDouble     = 0x01
+	bsonString     = 0x02
+	bsonDocument   = 0x03
+	bsonArray      = 0x04
+	bsonObjectId   = 0x07
+	bsonBoolean    = 0x08
+	bsonDateTime   = 0x09
+	bsonNull       = 0x0A
+	bsonJavaScript = 0x0D
+	bsonSymbol     = 0x0E
+	bsonInt32      = 0x10
+	bsonInt64      = 0x12
+	bsonUndefined  = 0x06
+	bsonMaxKey     = 0x7F
+	bsonMinKey     = 0xFF
+)
+
+// jsonToBSONDecoder converts JSON text to BSON. It appends the BSON to out as
+// it reads data, and only ever looks back at what it has written to replace the
+// documents that stand for extended types.
+type jsonToBSONDecoder struct {
+	data []byte
+	pos  int
+	out  []byte
+}
+
+// topLevelDocument converts data, which must hold exactly one document.
+func (d *jsonToBSONDecoder) topLevelDocument() error {
+	d.skipSpace()
+	if d.pos == len(d.data) || d.data[d.pos] != '{' {
+		return errUnsupportedJSON
+	}
+	// the top-level document is never an extended type
+	if _, _, err := d.document(); err != nil {
+		return err
+	}
+	d.skipSpace()
+	if d.pos != len(d.data) {
+		return errUnsupportedJSON
+	}
+	return nil
+}
+
+func (d *jsonToBSONDecoder) skipSpace() {
+	for d.pos < len(d.data) {
+		switch d.data[d.pos] {
+		case ' ', '\t', '\r', '\n':
+			d.pos++
+		default:
+			return
+		}
+	}
+}
+
+// consume skips whitespace and then the byte c, which must come next.
+func (d *jsonToBSONDecoder) consume(c byte) error {
+	d.skipSpace()
+	if d.pos == len(d.data) || d.data[d.pos] != c {
+		return errUnsupportedJSON
+	}
+	d.pos++
+	return nil
+}
+
+// value converts the JSON value at the current position and appends it to out.
+// It returns the BSON type of the value.
+func (d *jsonToBSONDecoder) value() (byte, error) {
+	d.skipSpace()
+	if d.pos == len(d.data) {
+		return 0, errUnsupportedJSON
+	}
+	switch c := d.data[d.pos]; {
+	case c == '{':
+		return d.extendedDocument()
+	case c == '[':
+		return bsonArray, d.array()
+	case c == '"':
+		s, err := d.string()
+		if err != nil {
+			return 0, err
+		}
+		d.appendString(s)
+		return bsonString, nil
+	case c == '-' || '0' <= c && c <= '9':
+		return d.number()
+	case d.literal("true"):
+		d.out = append(d.out, 1)
+		return bsonBoolean, nil
+	case d.literal("false"):
+		d.out = append(d.out, 0)
+		return bsonBoolean, nil
+	case d.literal("null"):
+		return bsonNull, nil
+	}
+	return 0, errUnsupportedJSON
+}
+
+// literal consumes the given literal if it comes next, and isn't just the
+// beginning of a longer identifier.
+func (d *jsonToBSONDecoder) literal(s string) bool {
+	end := d.pos + len(s)
+	if end > len(d.data) || string(d.data[d.pos:end]) != s {
+		return false
+	}
+	if end < len(d.data) && isIdentifierByte(d.data[end]) {
+		return false
+	}
+	d.pos = end
+	return true
+}
+
+func isIdentifierByte(c byte) bool {
+	return c == '_' || c == '$' || '0' <= c && c <= '9' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z'
+}
+
+// document converts the JSON object at the current position to a BSON
+// document. It returns the number of fields of the object and whether any of
+// their names start with '$'.
+func (d *jsonToBSONDecoder) document() (numFields int, hasDollarKey bool, err error) {
+	d.pos++ // '{'
+	start := d.beginDocument()
+	d.skipSpace()
+	if d.pos < len(d.data) && d.data[d.pos] == '}' {
+		d.pos++
+		d.endDocument(start)
+		return 0, false, nil
+	}
+	for {
+		d.skipSpace()
+		if d.pos == len(d.data) || d.data[d.pos] != '"' {
+			// unquoted and single quoted keys are shell mode
+			return 0, false, errUnsupportedJSON
+		}
+		key, err := d.string()
+		if err != nil {
+			return 0, false, err
+		}
+		if len(key) > 0 && key[0] == '$' {
+			hasDollarKey = true
+		}
+		if err = d.consume(':'); err != nil {
+			return 0, false, err
+		}
+		if err = d.element(key); err != nil {
+			return 0, false, err
+		}
+		numFields++
+
+		d.skipSpace()
+		if d.pos == len(d.data) {
+			return 0, false, errUnsupportedJSON
+		}
+		d.pos++
+		switch d.data[d.pos-1] {
+		case ',':
+			continue
+		case '}':
+			d.endDocument(start)
+			return numFields, hasDollarKey, nil
+		}
+		return 0, false, errUnsupportedJSON
+	}
+}
+
+// extendedDocument converts the JSON object at the current position, which may
+// stand for an extended type rather than a document, and returns the BSON type
+// it was converted to.
+func (d *jsonToBSONDecoder) extendedDocument() (byte, error) {
+	textStart, start := d.pos, len(d.out)
+	numFields, hasDollarKey, err := d.document()
+	if err != nil || !hasDollarKey {
+		return bsonDocument, err
+	}
+
+	if numFields == 1 {
+		if kind, ok := d.convertExtendedValue(start); ok {
+			return kind, nil
+		}
+	}
+
+	// let ParseSpecialKeys, which knows all of the extended types, decide what
+	// the document stands for
+	document, err := json.UnmarshalBsonD(d.data[textStart:d.pos])
+	if err != nil {
+		return 0, err
+	}
+	value, err := ParseSpecialKeys(document)
+	if err != nil {
+		return 0, err
+	}
+	d.out = d.out[:start]
+	return d.appendValue(value)
+}
+
+// convertExtendedValue replaces the document with a single field that was just
+// written at start with the extended type it stands for, if it is one of the
+// common ones that the decoder converts itself. Otherwise it leaves the
+// document as it is and returns false.
+func (d *jsonToBSONDecoder) convertExtendedValue(start int) (byte, bool) {
+	// the field starts after the document's length
+	kind := d.out[start+4]
+	nameEnd := start + 5
+	for d.out[nameEnd] != 0 {
+		nameEnd++
+	}
+	name := string(d.out[start+5 : nameEnd])
+	valueBytes := d.out[nameEnd+1 : len(d.out)-1]
+	var s string
+	if kind == bsonString {
+		s = string(valueBytes[4 : len(valueBytes)-1])
+	}
+
+	switch {
+	case name == "$undefined":
+		d.out = d.out[:start]
+		return bsonUndefined, true
+	case name == "$minKey":
+		d.out = d.out[:start]
+		return bsonMinKey, true
+	case name == "$maxKey":
+		d.out = d.out[:start]
+		return bsonMaxKey, true
+
+	case name == "$date" && (kind == bsonInt32 || kind == bsonInt64 || kind == bsonDouble):
+		var millis int64
+		switch kind {
+		case bsonInt32:
+			millis = int64(int32(binary.LittleEndian.Uint32(valueBytes)))
+		case bsonInt64:
+			millis = int64(binary.LittleEndian.Uint64(valueBytes))
+		case bsonDouble:
+			millis = int64(math.Float64frombits(binary.LittleEndian.Uint64(valueBytes)))
+		}
+		d.out = appendInt64(d.out[:start], millis)
+		return bsonDateTime, true
+
+	case kind != bsonString:
+		return 0, false
+
+	case name == "$oid":
+		if !bson.IsObjectIdHex(s) {
+			return 0, false
+		}
+		d.out = append(d.out[:start], bson.ObjectIdHex(s)...)
+		return bsonObjectId, true
+	case name == "$numberInt":
+		n, err := strconv.ParseInt(s, 0, 32)
+		if err != nil {
+			return 0, false
+		}
+		d.out = appendInt32(d.out[:start], int32(n))
+		return bsonInt32, true
+	case name == "$numberLong":
+		n, err := strconv.ParseInt(s, 0, 64)
+		if err != nil {
+			return 0, false
+		}
+		d.out = appendInt64(d.out[:start], n)
+		return bsonInt64, true
+	case name == "$numberDouble":
+		f, err := parseNumberDouble(s)
+		if err != nil {
+			return 0, false
+		}
+		d.out = appendInt64(d.out[:start], int64(math.Float64bits(f)))
+		return bsonDouble, true
+	case name == "$date":
+		date, err := util.FormatDate(s)
+		if err != nil {
+			return 0, false
+		}
+		d.out = d.out[:start]
+		kind, err := d.appendValue(date)
+		return kind, err == nil
+	case name == "$code":
+		d.out = append(d.out[:start], valueBytes...)
+		return bsonJavaScript, true
+	case name == "$symbol":
+		d.out = append(d.out[:start], valueBytes...)
+		return bsonSymbol, true
+	}
+	return 0, false
+}
+
+// array converts the JSON array at the current position to a BSON array.
+func (d *jsonToBSONDecoder) array() error {
+	d.pos++ // '['
+	start := d.beginDocument()
+	d.skipSpace()
+	if d.pos < len(d.data) && d.data[d.pos] == ']' {
+		d.pos++
+		d.endDocument(start)
+		return nil
+	}
+	var name []byte
+	for i := 0; ; i++ {
+		name = strconv.AppendInt(name[:0], int64(i), 10)
+		if err := d.element(name); err != nil {
+			return err
+		}
+		d.skipSpace()
+		if d.pos == len(d.data) {
+			return errUnsupportedJSON
+		}
+		d.pos++
+		switch d.data[d.pos-1] {
+		case ',':
+			continue
+		case ']':
+			d.endDocument(start)
+			return nil
+		}
+		return errUnsupportedJSON
+	}
+}
+
+// element converts the JSON value at the current position to a BSON element
+// with the given name.
+func (d *jsonToBSONDecoder) element(name []byte) error {
+	for i := 0; i < len(name); i++ {
+		if name[i] == 0 {
+			return errUnsupportedJSON
+		}
+	}
+	start := len(d.out)
+	d.out = append(d.out, 0)
+	d.out = append(d.out, name...)
+	d.out = append(d.out, 0)
+	kind, err := d.value()
+	if err != nil {
+		return err
+	}
+	d.out[start] = kind
+	return nil
+}
+
+// beginDocument reserves the space for the length of a document and returns
+// where the document starts.
+func (d *jsonToBSONDecoder) beginDocument() int {
+	start := len(d.out)
+	d.out = append(d.out, 0, 0, 0, 0)
+	return start
+}
+
+// endDocument terminates the document that starts at start and fills in its length.
+func (d *jsonToBSONDecoder) endDocument(start int) {
+	d.out = append(d.out, 0)
+	binary.LittleEndian.PutUint32(d.out[start:], uint32(len(d.out)-start))
+}
+
+// appendValue appends value, which can be any value that mgo marshals, to out,
+// and returns its BSON type.
+func (d *jsonToBSONDecoder) appendValue(value interface{}) (byte, error) {
+	element, err := bson.Marshal(bson.D{{"", value}})
+	if err != nil {
+		return 0, err
+	}
+	// skip the length of the document, the type and the empty name, and leave
+	// out the document's terminating null
+	d.out = append(d.out, element[6:len(element)-1]...)
+	return element[4], nil
+}
+
+func (d *jsonToBSONDecoder) appendString(s []byte) {
+	d.out = appendInt32(d.out, int32(len(s)+1))
+	d.out = append(d.out, s...)
+	d.out = append(d.out, 0)
+}
+
+func appendInt32(out []byte, n int32) []byte {
+	return append(out, byte(n), byte(n>>8), byte(n>>16), byte(n>>24))
+}
+
+func appendInt64(out []byte, n int64) []byte {
+	return append(out,
+		byte(n), byte(n>>8), byte(n>>16), byte(n>>24),
+		byte(n>>32), byte(n>>40), byte(n>>48), byte(n>>56))
+}
+
+// number converts the JSON number at the current position the way the json
+// package does: to an int32 if it fits, else to an int64 if it fits, else to a
+// double.
+func (d *jsonToBSONDecoder) number() (byte, error) {
+	start := d.pos
+	if d.data[d.pos] == '-' {
+		d.pos++
+	}
+	intStart := d.pos
+	if !d.digits() {
+		return 0, errUnsupportedJSON
+	}
+	if d.data[intStart] == '0' && d.pos-intStart > 1 {
+		// leading zeros are shell mode, for octal numbers
+		return 0, errUnsupportedJSON
+	}
+	if d.pos < len(d.data) && d.data[d.pos] == '.' {
+		d.pos++
+		if !d.digits() {
+			return 0, errUnsupportedJSON
+		}
+	}
+	if d.pos < len(d.data) && (d.data[d.pos] == 'e' || d.data[d.pos] == 'E') {
+		d.pos++
+		if d.pos < len(d.data) && (d.data[d.pos] == '+' || d.data[d.pos] == '-') {
+			d.pos++
+		}
+		if !d.digits() {
+			return 0, errUnsupportedJSON
+		}
+	}
+	if d.pos < len(d.data) && isIdentifierByte(d.data[d.pos]) {
+		// as in hexadecimal numbers, which are shell mode
+		return 0, errUnsupportedJSON
+	}
+
+	s := string(d.data[start:d.pos])
+	if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+		if n <= math.MaxInt32 && n >= math.MinInt32 {
+			d.out = appendInt32(d.out, int32(n))
+			return bsonInt32, nil
+		}
+		d.out = appendInt64(d.out, n)
+		return bsonInt64, nil
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, errUnsupportedJSON
+	}
+	d.out = appendInt64(d.out, int64(math.Float64bits(f)))
+	return bsonDouble, nil
+}
+
+// digits consumes a run of decimal digits, and returns false if there are none.
+func (d *jsonToBSONDecoder) digits() bool {
+	start := d.pos
+	for d.pos < len(d.data) && '0' <= d.data[d.pos] && d.data[d.pos] <= '9' {
+		d.pos++
+	}
+	return d.pos > start
+}
+
+// string reads the double quoted JSON string at the current position. The
+// string is a slice of data when it doesn't need unquoting.
+func (d *jsonToBSONDecoder) string() ([]byte, error) {
+	d.pos++ // '"'
+	start := d.pos
+	for d.pos < len(d.data) {
+		c := d.data[d.pos]
+		switch {
+		case c == '"':
+			d.pos++
+			return d.data[start : d.pos-1], nil
+		case c == '\\' || c >= utf8.RuneSelf:
+			d.pos = start
+			return d.unquote()
+		case c < ' ':
+			return nil, errUnsupportedJSON
+		}
+		d.pos++
+	}
+	return nil, errUnsupportedJSON
+}
+
+// unquote reads the rest of a JSON string that has escape sequences or
+// non-ASCII characters in it. Like the json package, it replaces invalid UTF-8
+// and unpaired surrogates with the Unicode replacement character.
+func (d *jsonToBSONDecoder) unquote() ([]byte, error) {
+	var b []byte
+	for d.pos < len(d.data) {
+		switch c := d.data[d.pos]; {
+		case c == '"':
+			d.pos++
+			return b, nil
+		case c < ' ':
+			return nil, errUnsupportedJSON
+		case c < utf8.RuneSelf && c != '\\':
+			b = append(b, c)
+			d.pos++
+		case c >= utf8.RuneSelf:
+			r, size := utf8.DecodeRune(d.data[d.pos:])
+			b = append(b, string(r)...)
+			d.pos += size
+		default: // escape sequence
+			if d.pos+1 == len(d.data) {
+				return nil, errUnsupportedJSON
+			}
+			d.pos += 2
+			switch e := d.data[d.pos-1]; e {
+			case '"', '\\', '/', '\'':
+				b = append(b, e)
+			case 'b':
+				b = append(b, '\b')
+			case 'f':
+				b = append(b, '\f')
+			case 'n':
+				b = append(b, '\n')
+			case 'r':
+				b = append(b, '\r')
+			case 't':
+				b = append(b, '\t')
+			case 'u':
+				r := d.hex4()
+				if r < 0 {
+					return nil, errUnsupportedJSON
+				}
+				if utf16.IsSurrogate(r) {
+					r = d.lowSurrogate(r)
+				}
+				b = append(b, string(r)...)
+			default:
+				return nil, errUnsupportedJSON
+			}
+		}
+	}
+	return nil, errUnsupportedJSON
+}
+
+// lowSurrogate reads the escape sequence of the low surrogate that follows the
+// high surrogate high, and returns the code point of the pair. If there isn't a
+// valid pair, it leaves the escape sequence and returns the replacement character.
+func (d *jsonToBSONDecoder) lowSurrogate(high rune) rune {
+	if d.pos+1 >= len(d.data) || d.data[d.pos] != '\\' || d.data[d.pos+1] != 'u' {
+		return unicode.ReplacementChar
+	}
+	pos := d.pos
+	d.pos += 2
+	if r := utf16.DecodeRune(high, d.hex4()); r != unicode.ReplacementChar {
+		return r
+	}
+	d.pos = pos
+	return unicode.ReplacementChar
+}
+
+// hex4 reads the four hexadecimal digits of a \u escape sequence, and returns
+// -1 if they aren't valid.
+func (d *jsonToBSONDecoder) hex4() rune {
+	if d.pos+4 > len(d.data) {
+		return -1
+	}
+	r, err := strconv.ParseUint(string(d.data[d.pos:d.pos+4]), 16, 16)
+	if err != nil {
+		return -1
+	}
+	d.pos += 4
+	return rune(r)
+}
@@ -0,0 +1,102 @@
+package bsonutil
+
+import (
+	"testing"
+
+	"github.com/mongodb/mongo-tools/common/json"
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// convertJSONSlowly converts a JSON document to BSON the way the tools did
+// before ConvertJSONToBSON.
+func convertJSONSlowly(data []byte) ([]byte, error) {
+	document, err := json.UnmarshalBsonD(data)
+	if err != nil {
+		return nil, err
+	}
+	document, err = GetExtendedBsonD(document)
+	if err != nil {
+		return nil, err
+	}
+	return bson.Marshal(document)
+}
+
+func TestConvertJSONToBSON(t *testing.T) {
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("Converting JSON straight to BSON", t, func() {
+		Convey("gives the same BSON as unmarshaling the JSON first", func() {
+			for _, doc := range []string{
+				`{}`,
+				` { "a" : 1 , "b":[ ] , "c" : { } } `,
+				`{"int": 2147483647, "long": 2147483648, "neg": -2147483649, "zero": -0, "big": 92233720368547758070}`,
+				`{"double": 1.5, "exp": 1e3, "negexp": -2.5E-3, "intish": 2.0}`,
+				`{"t": true, "f": false, "n": null}`,
+				`{"s": "plain", "esc": "a\"b\\c\/d\b\f\n\r\t", "u": "é中", "pair": "😀", "lone": "\ud83dx", "utf8": "héllo"}`,
+				`{"nested": {"a": [1, [2, {"b": "c"}], {"d": null}]}, "z": 1, "a": 2}`,
+				`{"dup": 1, "dup": 2}`,
+				`{"_id": {"$oid": "5a934e000102030405000000"}, "l": {"$numberLong": "9000000000"}, "i": {"$numberInt": "7"}}`,
+				`{"d": {"$numberDouble": "-Infinity"}, "dec": {"$numberDecimal": "1.5"}}`,
+				`{"date": {"$date": "2017-07-14T02:40:00.123Z"}, "ms": {"$date": {"$numberLong": "-1000"}}, "n": {"$date": 0}}`,
+				`{"code": {"$code": "f()"}, "scope": {"$code": "f()", "$scope": {"x": 1}}, "sym": {"$symbol": "s"}}`,
+				`{"min": {"$minKey": 1}, "max": {"$maxKey": 1}, "u": {"$undefined": true}}`,
+				`{"bin": {"$binary": "aGk=", "$type": "02"}, "bin2": {"$binary": {"base64": "aGk=", "subType": "80"}}}`,
+				`{"re": {"$regex": "^a", "$options": "i"}, "re2": {"$regularExpression": {"pattern": "b", "options": "m"}}}`,
+				`{"ts": {"$timestamp": {"t": 1, "i": 2}}, "ref": {"$ref": "c", "$id": {"$oid": "5a934e000102030405000000"}}}`,
+				`{"ptr": {"$dbPointer": {"$ref": "db.c", "$id": {"$oid": "5a934e000102030405000000"}}}}`,
+				`{"op": {"$set": {"a": {"$numberLong": "1"}}}, "notspecial": {"$foo": 1, "b": 2}}`,
+				`{"a": [{"$oid": "5a934e000102030405000000"}, {"$numberInt": "0x10"}]}`,
+				`{a: 1, 'b': NumberLong(5), "c": ObjectId("5a934e000102030405000000"), "d": /x/i, "e": 0x10, "f": new Date(0)}`,
+				`{"a": 1, "b": undefined, "c": Infinity}`,
+			} {
+				expected, err := convertJSONSlowly([]byte(doc))
+				So(err, ShouldBeNil)
+				actual, err := ConvertJSONToBSON([]byte(doc))
+				So(err, ShouldBeNil)
+				So(actual, ShouldResemble, expected)
+			}
+		})
+
+		Convey("only hands shell mode documents to the json package", func() {
+			for _, doc := range []string{
+				`{"a": [1, 2.5, "x", true, null, {"b": {}}]}`,
+				`{"s": "\u00e9\ud83d\ude00", "u": "中"}`,
+				`{"_id": {"$oid": "5a934e000102030405000000"}, "d": {"$date": {"$numberLong": "0"}}}`,
+			} {
+				d := jsonToBSONDecoder{data: []byte(doc)}
+				So(d.topLevelDocument(), ShouldBeNil)
+			}
+			for _, doc := range []string{
+				`{a: 1}`,
+				`{"a": 'b'}`,
+				`{"a": NumberInt(1)}`,
+				`{"a": 0x1}`,
+			} {
+				d := jsonToBSONDecoder{data: []byte(doc)}
+				So(d.topLevelDocument(), ShouldEqual, errUnsupportedJSON)
+			}
+		})
+
+		Convey("fails on the documents that unmarshaling the JSON fails on", func() {
+			for _, doc := range []string{
+				`{"a": 1`,
+				`{"a": 1,}`,
+				`{"a": 1} x`,
+				`[1, 2]`,
+				`{"a": {"$oid": "not an id"}}`,
+				`{"a": {"$numberLong": 1}}`,
+				`{"a": {"$date": {"$numberLong": "x"}}}`,
+				`{"a": "\q"}`,
+				`{"a": 1e400}`,
+				`{"a": 010}`,
+			} {
+				_, err := convertJSONSlowly([]byte(doc))
+				So(err, ShouldNotBeNil)
+				_, err = ConvertJSONToBSON([]byte(doc))
+				So(err, ShouldNotBeNil)
+			}
+		})
+	})
+}
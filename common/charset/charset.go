@@ -0,0 +1,294 @@
+// Package charset transcodes text between UTF-8 and the other character
+// encodings that the tools read and write.
+package charset
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// Encoding is a character encoding.
+type Encoding int
+
+const (
+	UTF8 Encoding = iota
+	// UTF16 is UTF-16 with a byte order mark. Input without one is read as
+	// little-endian, and output is written little-endian.
+	UTF16
+	UTF16LE
+	UTF16BE
+	// Latin1 is ISO-8859-1.
+	Latin1
+	Windows1252
+)
+
+var encodingNames = map[Encoding]string{
+	UTF8:        "utf-8",
+	UTF16:       "utf-16",
+	UTF16LE:     "utf-16le",
+	UTF16BE:     "utf-16be",
+	Latin1:      "latin1",
+	Windows1252: "windows-1252",
+}
+
+// encodingAliases maps the other names an encoding is known by to it.
+var encodingAliases = map[string]Encoding{
+	"utf8":       UTF8,
+	"utf16":      UTF16,
+	"utf16le":    UTF16LE,
+	"utf16be":    UTF16BE,
+	"latin-1":    Latin1,
+	"iso-8859-1": Latin1,
+	"iso8859-1":  Latin1,
+	"cp1252":     Windows1252,
+}
+
+func (e Encoding) String() string {
+	if name, ok := encodingNames[e]; ok {
+		return name
+	}
+	return fmt.Sprintf("Encoding(%d)", int(e))
+}
+
+// Lookup returns the encoding with the given name, which is case-insensitive.
+// An empty name is UTF-8.
+func Lookup(name string) (Encoding, error) {
+	name = strings.ToLower(name)
+	if name == "" {
+		return UTF8, nil
+	}
+	for e, encodingName := range encodingNames {
+		if name == encodingName {
+			return e, nil
+		}
+	}
+	if e, ok := encodingAliases[name]; ok {
+		return e, nil
+	}
+	return UTF8, fmt.Errorf("unsupported encoding '%v', must be one of utf-8, utf-16, utf-16le, "+
+		"utf-16be, latin1 or windows-1252", name)
+}
+
+// windows1252High maps the bytes 0x80 to 0x9F of Windows-1252, where it
+// differs from Latin-1. The five bytes that Windows-1252 leaves undefined map
+// to the control characters with the same code, as in web browsers.
+var windows1252High = [32]rune{
+	'€', 0x81, '‚', 'ƒ', '„', '…', '†', '‡', 'ˆ', '‰', 'Š', '‹', 'Œ', 0x8D, 'Ž', 0x8F,
+	0x90, '‘', '’', '“', '”', '•', '–', '—', '˜', '™', 'š', '›', 'œ', 0x9D, 'ž', 'Ÿ',
+}
+
+// NewDecoder returns a reader that transcodes the text read from r in the
+// encoding to UTF-8. Invalid input is replaced by U+FFFD.
+func (e Encoding) NewDecoder(r io.Reader) io.Reader {
+	if e == UTF8 {
+		return r
+	}
+	return &decoder{encoding: e, r: r, bigEndian: e == UTF16BE}
+}
+
+// Encoder is a writer that transcodes UTF-8 text to an encoding.
+type Encoder interface {
+	io.Writer
+	// Flush reports an error if the text written ends part way through a
+	// UTF-8 character.
+	Flush() error
+}
+
+// NewEncoder returns an Encoder that transcodes the UTF-8 text written to it
+// to the encoding and writes it to w. Writing a character that the encoding
+// can't represent fails.
+func (e Encoding) NewEncoder(w io.Writer) Encoder {
+	if e == UTF8 {
+		return utf8Encoder{w}
+	}
+	return &encoder{encoding: e, w: w}
+}
+
+// utf8Encoder writes UTF-8 text unchanged.
+type utf8Encoder struct {
+	io.Writer
+}
+
+func (utf8Encoder) Flush() error {
+	return nil
+}
+
+type decoder struct {
+	encoding  Encoding
+	r         io.Reader
+	bigEndian bool
+	// src holds the bytes read that haven't been decoded, and dst the
+	// decoded bytes that haven't been returned
+	src, dst   []byte
+	buf        [4096]byte
+	err        error
+	checkedBOM bool
+}
+
+func (d *decoder) Read(p []byte) (int, error) {
+	for len(d.dst) == 0 {
+		if d.err != nil {
+			return 0, d.err
+		}
+		n, err := d.r.Read(d.buf[:])
+		d.src = append(d.src, d.buf[:n]...)
+		d.err = err
+		d.decode(err != nil)
+	}
+	n := copy(p, d.dst)
+	d.dst = d.dst[n:]
+	return n, nil
+}
+
+// decode decodes as much of src as it can. Incomplete characters at the end
+// of src are kept, unless the input is done.
+func (d *decoder) decode(final bool) {
+	d.dst = d.dst[:0]
+	i := 0
+	switch d.encoding {
+	case Latin1, Windows1252:
+		for ; i < len(d.src); i++ {
+			r := rune(d.src[i])
+			if d.encoding == Windows1252 && r >= 0x80 && r < 0xA0 {
+				r = windows1252High[r-0x80]
+			}
+			d.dst = appendRune(d.dst, r)
+		}
+	default:
+		if d.encoding == UTF16 && !d.checkedBOM {
+			if len(d.src) < 2 && !final {
+				return
+			}
+			d.checkedBOM = true
+			if len(d.src) >= 2 && d.src[0] == 0xFE && d.src[1] == 0xFF {
+				d.bigEndian = true
+				i = 2
+			} else if len(d.src) >= 2 && d.src[0] == 0xFF && d.src[1] == 0xFE {
+				i = 2
+			}
+		}
+		for len(d.src)-i >= 2 {
+			r1 := d.unit(i)
+			if !utf16.IsSurrogate(r1) {
+				d.dst = appendRune(d.dst, r1)
+				i += 2
+				continue
+			}
+			if len(d.src)-i < 4 {
+				if !final {
+					break
+				}
+				d.dst = appendRune(d.dst, utf8.RuneError)
+				i += 2
+				continue
+			}
+			r := utf16.DecodeRune(r1, d.unit(i+2))
+			if r == utf8.RuneError {
+				// an unpaired surrogate
+				d.dst = appendRune(d.dst, r)
+				i += 2
+				continue
+			}
+			d.dst = appendRune(d.dst, r)
+			i += 4
+		}
+		if final && i < len(d.src) {
+			d.dst = appendRune(d.dst, utf8.RuneError)
+			i = len(d.src)
+		}
+	}
+	d.src = append(d.src[:0], d.src[i:]...)
+}
+
+// unit returns the UTF-16 code unit at offset i of src.
+func (d *decoder) unit(i int) rune {
+	if d.bigEndian {
+		return rune(d.src[i])<<8 | rune(d.src[i+1])
+	}
+	return rune(d.src[i+1])<<8 | rune(d.src[i])
+}
+
+func appendRune(b []byte, r rune) []byte {
+	var buf [utf8.UTFMax]byte
+	n := utf8.EncodeRune(buf[:], r)
+	return append(b, buf[:n]...)
+}
+
+type encoder struct {
+	encoding Encoding
+	w        io.Writer
+	// pending holds the start of a UTF-8 character split across writes
+	pending  []byte
+	wroteBOM bool
+	buf      []byte
+}
+
+func (e *encoder) Write(p []byte) (int, error) {
+	src := p
+	if len(e.pending) > 0 {
+		src = append(append([]byte{}, e.pending...), p...)
+	}
+	out := e.buf[:0]
+	if e.encoding == UTF16 && !e.wroteBOM {
+		out = append(out, 0xFF, 0xFE)
+		e.wroteBOM = true
+	}
+	i := 0
+	for i < len(src) && utf8.FullRune(src[i:]) {
+		r, size := utf8.DecodeRune(src[i:])
+		i += size
+		switch e.encoding {
+		case Latin1, Windows1252:
+			b, ok := e.singleByte(r)
+			if !ok {
+				return 0, fmt.Errorf("character %q can't be encoded in %v", r, e.encoding)
+			}
+			out = append(out, b)
+		default:
+			units := []uint16{uint16(r)}
+			if r >= 0x10000 {
+				r1, r2 := utf16.EncodeRune(r)
+				units = []uint16{uint16(r1), uint16(r2)}
+			}
+			for _, u := range units {
+				if e.encoding == UTF16BE {
+					out = append(out, byte(u>>8), byte(u))
+				} else {
+					out = append(out, byte(u), byte(u>>8))
+				}
+			}
+		}
+	}
+	e.pending = append(e.pending[:0], src[i:]...)
+	e.buf = out
+	if _, err := e.w.Write(out); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (e *encoder) Flush() error {
+	if len(e.pending) > 0 {
+		return fmt.Errorf("text ends with an incomplete UTF-8 character %q", e.pending)
+	}
+	return nil
+}
+
+// singleByte returns the byte a character is encoded as in Latin-1 or
+// Windows-1252.
+func (e *encoder) singleByte(r rune) (byte, bool) {
+	if e.encoding == Latin1 && r < 0x100 || r < 0x80 || r >= 0xA0 && r < 0x100 {
+		return byte(r), true
+	}
+	if e.encoding == Windows1252 {
+		for i, high := range windows1252High {
+			if high == r {
+				return byte(0x80 + i), true
+			}
+		}
+	}
+	return 0, false
+}
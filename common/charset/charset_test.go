@@ -0,0 +1,120 @@
+package charset
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+	"testing/iotest"
+
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func decode(e Encoding, input []byte) string {
+	// read a byte at a time, so that characters are split across reads
+	out, err := ioutil.ReadAll(e.NewDecoder(iotest.OneByteReader(bytes.NewReader(input))))
+	So(err, ShouldBeNil)
+	return string(out)
+}
+
+func encode(e Encoding, input string) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	w := e.NewEncoder(buf)
+	// write a byte at a time, so that characters are split across writes
+	for i := 0; i < len(input); i++ {
+		if _, err := w.Write([]byte{input[i]}); err != nil {
+			return nil, err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func TestLookup(t *testing.T) {
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("Encodings should be looked up by name and alias", t, func() {
+		for name, expected := range map[string]Encoding{
+			"":             UTF8,
+			"UTF-8":        UTF8,
+			"utf16":        UTF16,
+			"UTF-16LE":     UTF16LE,
+			"utf-16be":     UTF16BE,
+			"ISO-8859-1":   Latin1,
+			"latin1":       Latin1,
+			"cp1252":       Windows1252,
+			"windows-1252": Windows1252,
+		} {
+			e, err := Lookup(name)
+			So(err, ShouldBeNil)
+			So(e, ShouldEqual, expected)
+		}
+		_, err := Lookup("ebcdic")
+		So(err, ShouldNotBeNil)
+		So(Windows1252.String(), ShouldEqual, "windows-1252")
+	})
+}
+
+func TestTranscoding(t *testing.T) {
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("Single byte encodings should be transcoded", t, func() {
+		So(decode(Latin1, []byte{'a', 0xE9, 0x80}), ShouldEqual, "aé\u0080")
+		So(decode(Windows1252, []byte{'a', 0xE9, 0x80, 0x81}), ShouldEqual, "aé€\u0081")
+
+		out, err := encode(Latin1, "aé")
+		So(err, ShouldBeNil)
+		So(out, ShouldResemble, []byte{'a', 0xE9})
+		out, err = encode(Windows1252, "é€\u0081")
+		So(err, ShouldBeNil)
+		So(out, ShouldResemble, []byte{0xE9, 0x80, 0x81})
+
+		_, err = encode(Latin1, "€")
+		So(err, ShouldNotBeNil)
+		_, err = encode(Windows1252, "\u0080")
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("UTF-16 should be transcoded", t, func() {
+		text := "a€😀"
+		le := []byte{'a', 0, 0xAC, 0x20, 0x3D, 0xD8, 0x00, 0xDE}
+		be := []byte{0, 'a', 0x20, 0xAC, 0xD8, 0x3D, 0xDE, 0x00}
+
+		So(decode(UTF16LE, le), ShouldEqual, text)
+		So(decode(UTF16BE, be), ShouldEqual, text)
+		So(decode(UTF16, le), ShouldEqual, text)
+		So(decode(UTF16, append([]byte{0xFF, 0xFE}, le...)), ShouldEqual, text)
+		So(decode(UTF16, append([]byte{0xFE, 0xFF}, be...)), ShouldEqual, text)
+
+		out, err := encode(UTF16LE, text)
+		So(err, ShouldBeNil)
+		So(out, ShouldResemble, le)
+		out, err = encode(UTF16BE, text)
+		So(err, ShouldBeNil)
+		So(out, ShouldResemble, be)
+		out, err = encode(UTF16, text)
+		So(err, ShouldBeNil)
+		So(out, ShouldResemble, append([]byte{0xFF, 0xFE}, le...))
+
+		Convey("and invalid UTF-16 should be replaced", func() {
+			So(decode(UTF16LE, []byte{0x3D, 0xD8, 'a', 0}), ShouldEqual, "�a")
+			So(decode(UTF16LE, []byte{'a', 0, 0x3D, 0xD8}), ShouldEqual, "a�")
+			So(decode(UTF16LE, []byte{'a', 0, 'b'}), ShouldEqual, "a�")
+		})
+
+		Convey("and text ending part way through a character should be an error", func() {
+			_, err := encode(UTF16LE, "a\xF0\x9F")
+			So(err, ShouldNotBeNil)
+		})
+	})
+
+	Convey("UTF-8 should be passed through", t, func() {
+		r := bytes.NewReader(nil)
+		So(UTF8.NewDecoder(r), ShouldEqual, r)
+		out, err := encode(UTF8, "aé")
+		So(err, ShouldBeNil)
+		So(string(out), ShouldEqual, "aé")
+	})
+}
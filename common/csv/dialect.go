@@ -0,0 +1,81 @@
+package csv
+
+import (
+	"fmt"
+	"unicode/utf8"
+)
+
+// Dialect is the delimiter, quote, escape and comment characters of CSV data.
+// Escape and Comment are 0 if they aren't used.
+type Dialect struct {
+	Comma, Quote, Escape, Comment rune
+}
+
+// DefaultDialect delimits fields with commas and quotes them with double
+// quotes, which are escaped by doubling them.
+var DefaultDialect = Dialect{Comma: ',', Quote: '"'}
+
+// ParseDialect returns the dialect set by the values of the --delimiter,
+// --quoteChar, --escapeChar and --comment options, which keep the characters
+// of the DefaultDialect when they are empty.
+func ParseDialect(delimiter, quoteChar, escapeChar, comment string) (Dialect, error) {
+	d := DefaultDialect
+	chars := []struct {
+		option string
+		value  string
+		char   *rune
+	}{
+		{"delimiter", delimiter, &d.Comma},
+		{"quoteChar", quoteChar, &d.Quote},
+		{"escapeChar", escapeChar, &d.Escape},
+		{"comment", comment, &d.Comment},
+	}
+	for _, c := range chars {
+		if c.value == "" {
+			continue
+		}
+		var err error
+		if *c.char, err = ParseChar(c.value); err != nil {
+			return d, fmt.Errorf("invalid --%v argument: %v", c.option, err)
+		}
+	}
+	for i, c := range chars {
+		for _, other := range chars[i+1:] {
+			// an escape character equal to the quote escapes quotes by
+			// doubling them, which is the default
+			if *c.char != 0 && *c.char == *other.char && !(c.option == "quoteChar" && other.option == "escapeChar") {
+				return d, fmt.Errorf("--%v and --%v can not be the same character", c.option, other.option)
+			}
+		}
+	}
+	return d, nil
+}
+
+// ParseChar returns the character named by the value of a delimiter, quote,
+// escape or comment option, which must be a single character other than a
+// newline, or \t for a tab.
+func ParseChar(value string) (rune, error) {
+	if value == `\t` {
+		return '\t', nil
+	}
+	r, size := utf8.DecodeRuneInString(value)
+	if size == 0 || size != len(value) || r == utf8.RuneError {
+		return 0, fmt.Errorf("'%v' is not a single character", value)
+	}
+	if r == '\n' || r == '\r' {
+		return 0, fmt.Errorf("a newline can not be used")
+	}
+	return r, nil
+}
+
+// SetDialect sets the delimiter, quote, escape and comment characters that
+// the Reader reads.
+func (r *Reader) SetDialect(d Dialect) {
+	r.Comma, r.Quote, r.Escape, r.Comment = d.Comma, d.Quote, d.Escape, d.Comment
+}
+
+// SetDialect sets the delimiter, quote and escape characters that the Writer
+// writes. Comments are never written.
+func (w *Writer) SetDialect(d Dialect) {
+	w.Comma, w.Quote, w.Escape = d.Comma, d.Quote, d.Escape
+}
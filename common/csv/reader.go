@@ -47,6 +47,16 @@
 //
 //	{`Multi-line
 //	field`, `comma is ,`}
+//
+// The delimiter and quote characters can be changed, and an escape character
+// can be set that makes the character after it literal, inside or outside of
+// a quoted-field.
+//
+//	"the \"word\" is true",a\,b
+//
+// with the escape character \ results in
+//
+//	{`the "word" is true`, `a,b`}
 package csv
 
 import (
@@ -56,6 +66,7 @@ import (
 	"fmt"
 	"io"
 	"unicode"
+	"unicode/utf8"
 )
 
 // A ParseError is returned for parsing errors.
@@ -86,6 +97,13 @@ var (
 //
 // Comma is the field delimiter.  It defaults to ','.
 //
+// Quote is the character that quoted-fields start and stop with.  It defaults
+// to '"'.
+//
+// Escape, if not 0, is the escape character. The character after it is part
+// of the field, whatever it is. An Escape equal to Quote escapes quotes by
+// doubling them, which is the default.
+//
 // Comment, if not 0, is the comment character. Lines beginning with the
 // Comment character are ignored.
 //
@@ -101,21 +119,26 @@ var (
 // If TrimLeadingSpace is true, leading white space in a field is ignored.
 type Reader struct {
 	Comma            rune // field delimiter (set to ',' by NewReader)
+	Quote            rune // quote character (set to '"' by NewReader)
+	Escape           rune // escape character
 	Comment          rune // comment character for start of line
 	FieldsPerRecord  int  // number of expected fields per record
 	LazyQuotes       bool // allow lazy quotes
 	TrailingComma    bool // ignored; here for backwards compatibility
 	TrimLeadingSpace bool // trim leading space
 	line             int
+	recordLine       int
 	column           int
 	r                *bufio.Reader
 	field            bytes.Buffer
+	raw              bytes.Buffer
 }
 
 // NewReader returns a new Reader that reads from r.
 func NewReader(r io.Reader) *Reader {
 	return &Reader{
 		Comma: ',',
+		Quote: '"',
 		r:     bufio.NewReader(r),
 	}
 }
@@ -153,6 +176,18 @@ func (r *Reader) Read() (record []string, err error) {
 	return record, nil
 }
 
+// RecordLine returns the line on which the record most recently returned by
+// Read starts. The first line is 1.
+func (r *Reader) RecordLine() int {
+	return r.recordLine
+}
+
+// RecordText returns the raw text of the record most recently returned by
+// Read, as it was read and without its line ending.
+func (r *Reader) RecordText() string {
+	return string(bytes.TrimSuffix(bytes.TrimSuffix(r.raw.Bytes(), []byte{'\n'}), []byte{'\r'}))
+}
+
 // ReadAll reads all the remaining records from r.
 // Each record is a slice of fields.
 // A successful call returns err == nil, not err == EOF. Because ReadAll is
@@ -173,9 +208,20 @@ func (r *Reader) ReadAll() (records [][]string, err error) {
 
 // readRune reads one rune from r, folding \r\n to \n and keeping track
 // of how far into the line we have read.  r.column will point to the start
-// of this rune, not the end of this rune.
+// of this rune, not the end of this rune.  The bytes read are kept as the raw
+// text of the record.
 func (r *Reader) readRune() (rune, error) {
-	r1, _, err := r.r.ReadRune()
+	r1, size, err := r.r.ReadRune()
+	if err == nil {
+		if r1 == utf8.RuneError && size == 1 {
+			// keep the invalid byte rather than its replacement
+			r.r.UnreadRune()
+			b, _ := r.r.ReadByte()
+			r.raw.WriteByte(b)
+		} else {
+			r.raw.WriteRune(r1)
+		}
+	}
 
 	// Handle \r\n here.  We make the simplifying assumption that
 	// anytime \r is followed by \n that it can be folded to \n.
@@ -186,6 +232,8 @@ func (r *Reader) readRune() (rune, error) {
 			if r1 != '\n' {
 				r.r.UnreadRune()
 				r1 = '\r'
+			} else {
+				r.raw.WriteByte('\n')
 			}
 		}
 	}
@@ -212,7 +260,9 @@ func (r *Reader) parseRecord() (fields []string, err error) {
 	// number (lines start at 1, not 0) and set column to -1
 	// so as we increment in readRune it points to the character we read.
 	r.line++
+	r.recordLine = r.line
 	r.column = -1
+	r.raw.Reset()
 
 	// Peek at the first rune.  If it is an error we are done.
 	// If we are support comments and it is the comment character
@@ -242,6 +292,12 @@ func (r *Reader) parseRecord() (fields []string, err error) {
 	}
 }
 
+// escapes returns whether r1 is an escape character other than a doubled
+// quote.
+func (r *Reader) escapes(r1 rune) bool {
+	return r.Escape != 0 && r.Escape != r.Quote && r1 == r.Escape
+}
+
 // parseField parses the next field in the record.  The read field is
 // located in r.field.  Delim is the first character not part of the field
 // (r.Comma or '\n').
@@ -273,11 +329,21 @@ func (r *Reader) parseField() (haveField bool, delim rune, err error) {
 		}
 		return true, r1, nil
 
-	case '"':
+	case r.Quote:
 		// quoted field
 	Quoted:
 		for {
 			r1, err = r.readRune()
+			if err == nil && r.escapes(r1) {
+				if r1, err = r.readRune(); err == nil {
+					if r1 == '\n' {
+						r.line++
+						r.column = -1
+					}
+					r.field.WriteRune(r1)
+					continue
+				}
+			}
 			if err != nil {
 				if err == io.EOF {
 					if r.LazyQuotes {
@@ -288,7 +354,7 @@ func (r *Reader) parseField() (haveField bool, delim rune, err error) {
 				return false, 0, err
 			}
 			switch r1 {
-			case '"':
+			case r.Quote:
 				r1, err = r.readRune()
 				if err == nil && r.TrimLeadingSpace && r1 != '\n' && unicode.IsSpace(r1) {
 					for err == nil && r.TrimLeadingSpace && r1 != '\n' && unicode.IsSpace(r1) {
@@ -298,7 +364,7 @@ func (r *Reader) parseField() (haveField bool, delim rune, err error) {
 					// which evaluates to 'foo"bar'
 					// so we explicitly test for the case that the trimed whitespace isn't
 					// followed by a '"'
-					if err == nil && r1 == '"' {
+					if err == nil && r1 == r.Quote {
 						r.column--
 						return false, 0, r.error(ErrQuote)
 					}
@@ -309,13 +375,13 @@ func (r *Reader) parseField() (haveField bool, delim rune, err error) {
 				if r1 == '\n' {
 					return true, r1, nil
 				}
-				if r1 != '"' {
+				if r1 != r.Quote {
 					if !r.LazyQuotes {
 						r.column--
 						return false, 0, r.error(ErrQuote)
 					}
 					// accept the bare quote
-					r.field.WriteRune('"')
+					r.field.WriteRune(r.Quote)
 				}
 			case '\n':
 				r.line++
@@ -327,8 +393,22 @@ func (r *Reader) parseField() (haveField bool, delim rune, err error) {
 	default:
 		// unquoted field
 		for {
-			// only write sections of whitespace if it's followed by non-whitespace
-			if unicode.IsSpace(r1) {
+			if r.escapes(r1) {
+				if r1, err = r.readRune(); err != nil {
+					if err != io.EOF {
+						return false, 0, err
+					}
+					// an escape character at the end of the input is literal
+					r1 = r.Escape
+				} else if r1 == '\n' {
+					r.line++
+					r.column = -1
+				}
+				r.field.WriteString(ws.String())
+				ws.Reset()
+				r.field.WriteRune(r1)
+			} else if unicode.IsSpace(r1) {
+				// only write sections of whitespace if it's followed by non-whitespace
 				ws.WriteRune(r1)
 			} else {
 				r.field.WriteString(ws.String())
@@ -342,7 +422,7 @@ func (r *Reader) parseField() (haveField bool, delim rune, err error) {
 			if r1 == '\n' {
 				return true, r1, nil
 			}
-			if !r.LazyQuotes && r1 == '"' {
+			if !r.LazyQuotes && r1 == r.Quote {
 				return false, 0, r.error(ErrBareQuote)
 			}
 		}
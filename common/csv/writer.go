@@ -0,0 +1,157 @@
+// Copyright 2011 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package csv
+
+import (
+	"bufio"
+	"io"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// A Writer writes records to a CSV encoded file.
+//
+// As returned by NewWriter, a Writer writes records terminated by a
+// newline and uses ',' as the field delimiter and '"' as the quote
+// character.  The exported fields can be changed to customize the details
+// before the first call to Write or WriteAll.
+//
+// Comma is the field delimiter.
+//
+// Quote is the character that quoted-fields start and stop with.
+//
+// Escape, if not 0 or Quote, is written before the quote and escape
+// characters in quoted-fields, instead of doubling the quotes.
+//
+// If UseCRLF is true, the Writer ends each record with \r\n instead of \n.
+type Writer struct {
+	Comma   rune // Field delimiter (set to ',' by NewWriter)
+	Quote   rune // Quote character (set to '"' by NewWriter)
+	Escape  rune // Escape character
+	UseCRLF bool // True to use \r\n as the line terminator
+	w       *bufio.Writer
+}
+
+// NewWriter returns a new Writer that writes to w.
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{
+		Comma: ',',
+		Quote: '"',
+		w:     bufio.NewWriter(w),
+	}
+}
+
+// Write writes a single CSV record to w along with any necessary quoting.
+// A record is a slice of strings with each string being one field.
+func (w *Writer) Write(record []string) (err error) {
+	for n, field := range record {
+		if n > 0 {
+			if _, err = w.w.WriteRune(w.Comma); err != nil {
+				return
+			}
+		}
+
+		// If we don't have to have a quoted field then just
+		// write out the field and continue to the next field.
+		if !w.fieldNeedsQuotes(field) {
+			if _, err = w.w.WriteString(field); err != nil {
+				return
+			}
+			continue
+		}
+		if _, err = w.w.WriteRune(w.Quote); err != nil {
+			return
+		}
+
+		for _, r1 := range field {
+			switch {
+			case r1 == w.Quote || w.escapes() && r1 == w.Escape:
+				if w.escapes() {
+					_, err = w.w.WriteRune(w.Escape)
+				} else {
+					_, err = w.w.WriteRune(w.Quote)
+				}
+				if err == nil {
+					_, err = w.w.WriteRune(r1)
+				}
+			case r1 == '\r':
+				if !w.UseCRLF {
+					err = w.w.WriteByte('\r')
+				}
+			case r1 == '\n':
+				if w.UseCRLF {
+					_, err = w.w.WriteString("\r\n")
+				} else {
+					err = w.w.WriteByte('\n')
+				}
+			default:
+				_, err = w.w.WriteRune(r1)
+			}
+			if err != nil {
+				return
+			}
+		}
+
+		if _, err = w.w.WriteRune(w.Quote); err != nil {
+			return
+		}
+	}
+	if w.UseCRLF {
+		_, err = w.w.WriteString("\r\n")
+	} else {
+		err = w.w.WriteByte('\n')
+	}
+	return
+}
+
+// Flush writes any buffered data to the underlying io.Writer.
+// To check if an error occurred during the Flush, call Error.
+func (w *Writer) Flush() {
+	w.w.Flush()
+}
+
+// Error reports any error that has occurred during a previous Write or Flush.
+func (w *Writer) Error() error {
+	_, err := w.w.Write(nil)
+	return err
+}
+
+// WriteAll writes multiple CSV records to w using Write and then calls Flush.
+func (w *Writer) WriteAll(records [][]string) (err error) {
+	for _, record := range records {
+		err = w.Write(record)
+		if err != nil {
+			return err
+		}
+	}
+	return w.w.Flush()
+}
+
+// escapes returns whether quotes are escaped with an escape character rather
+// than doubled.
+func (w *Writer) escapes() bool {
+	return w.Escape != 0 && w.Escape != w.Quote
+}
+
+// fieldNeedsQuotes returns true if our field must be enclosed in quotes.
+// Fields with a Comma, fields with a quote, escape or newline, and
+// fields which start with a space must be enclosed in quotes.
+// Empty fields are not quoted.
+func (w *Writer) fieldNeedsQuotes(field string) bool {
+	if field == "" {
+		return false
+	}
+	if strings.ContainsRune(field, w.Comma) || strings.ContainsRune(field, w.Quote) ||
+		strings.ContainsAny(field, "\r\n") {
+		return true
+	}
+	if w.escapes() && strings.ContainsRune(field, w.Escape) {
+		return true
+	}
+
+	r1, _ := utf8.DecodeRuneInString(field)
+	return unicode.IsSpace(r1)
+}
@@ -0,0 +1,151 @@
+package db
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+// A salvaging BSONSource doesn't stop at the first damaged document. It scans
+// forward one byte at a time until it finds a valid document, that is followed by
+// another valid document or by the end of the stream, and carries on from there.
+// Every skipped range is recorded as a DamagedRange.
+
+// DamagedRange is a range of a BSON stream that was skipped while salvaging it.
+type DamagedRange struct {
+	Start int64
+	End   int64
+	Err   error
+}
+
+// bsonSalvager holds the state of a salvaging BSONSource.
+type bsonSalvager struct {
+	in            *bufio.Reader
+	offset        int64
+	damagedRanges []DamagedRange
+}
+
+// NewSalvagingBSONSource creates a BSONSource that skips over damaged parts of
+// the stream instead of failing, and records them in DamagedRanges.
+func NewSalvagingBSONSource(in io.ReadCloser) *BSONSource {
+	// the buffer is large enough to peek at two documents of the maximum size
+	reader := bufio.NewReaderSize(in, 2*MaxBSONSize)
+	return &BSONSource{
+		reusableBuf: make([]byte, MaxBSONSize),
+		Stream:      in,
+		salvager:    &bsonSalvager{in: reader},
+	}
+}
+
+// DamagedRanges returns the ranges of the stream that were skipped so far by a
+// salvaging BSONSource.
+func (bs *BSONSource) DamagedRanges() []DamagedRange {
+	if bs.salvager == nil {
+		return nil
+	}
+	return bs.salvager.damagedRanges
+}
+
+// loadNext is LoadNext for a salvaging BSONSource.
+func (s *bsonSalvager) loadNext(into []byte) ([]byte, error) {
+	doc, err := s.peekBSON(0)
+	if err == io.EOF {
+		return nil, nil
+	}
+	if err != nil {
+		if !s.resync(err) {
+			return nil, nil
+		}
+		// peek again, as looking past the document may have moved it in the buffer
+		if doc, err = s.peekBSON(0); err != nil {
+			return nil, err
+		}
+	}
+	if len(doc) > cap(into) {
+		into = make([]byte, len(doc))
+	}
+	into = into[:len(doc)]
+	copy(into, doc)
+	s.discard(len(doc))
+	return into, nil
+}
+
+// resync skips forward to the next document it can read and records the skipped
+// range as damaged. It returns false if the damage extends to the end of the stream.
+func (s *bsonSalvager) resync(cause error) bool {
+	start := s.offset
+	s.discard(1)
+	for {
+		doc, err := s.peekBSON(0)
+		if err == nil && s.followedByBSONOrEOF(len(doc)) {
+			s.damage(start, cause)
+			return true
+		}
+		if buf, _ := s.in.Peek(4); len(buf) < 4 {
+			// the damage extends to the end of the stream
+			s.discard(len(buf))
+			s.damage(start, cause)
+			return false
+		}
+		s.discard(1)
+	}
+}
+
+// damage records the range from start to the current offset as damaged.
+func (s *bsonSalvager) damage(start int64, cause error) {
+	s.damagedRanges = append(s.damagedRanges, DamagedRange{
+		Start: start,
+		End:   s.offset,
+		Err:   cause,
+	})
+}
+
+// peekBSON returns the valid BSON document found at skip bytes after the current
+// offset, without consuming it. It returns io.EOF if the stream ends at skip bytes.
+func (s *bsonSalvager) peekBSON(skip int) ([]byte, error) {
+	buf, err := s.in.Peek(skip + 4)
+	if len(buf) == skip && err == io.EOF {
+		return nil, io.EOF
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid bson: %v", err)
+	}
+	bsonSize := int32(
+		(uint32(buf[skip+0]) << 0) |
+			(uint32(buf[skip+1]) << 8) |
+			(uint32(buf[skip+2]) << 16) |
+			(uint32(buf[skip+3]) << 24),
+	)
+	if bsonSize > MaxBSONSize || bsonSize < 5 {
+		return nil, fmt.Errorf("invalid BSONSize: %v bytes", bsonSize)
+	}
+	buf, err = s.in.Peek(skip + int(bsonSize))
+	if err != nil {
+		return nil, fmt.Errorf("invalid bson: %v", err)
+	}
+	doc := buf[skip:]
+	if doc[bsonSize-1] != 0x00 {
+		return nil, fmt.Errorf("invalid bson: document of %v bytes doesn't end with a null byte", bsonSize)
+	}
+	if err = bson.Unmarshal(doc, &bson.D{}); err != nil {
+		return nil, fmt.Errorf("invalid bson: %v", err)
+	}
+	return doc, nil
+}
+
+// followedByBSONOrEOF checks that the document of the given size at the current
+// offset is followed by the end of the stream or by another valid document. This
+// makes resynchronising on garbage that happens to look like a BSON document
+// less likely.
+func (s *bsonSalvager) followedByBSONOrEOF(size int) bool {
+	_, err := s.peekBSON(size)
+	return err == nil || err == io.EOF
+}
+
+// discard consumes n bytes.
+func (s *bsonSalvager) discard(n int) {
+	discarded, _ := s.in.Discard(n)
+	s.offset += int64(discarded)
+}
@@ -12,6 +12,9 @@ type BSONSource struct {
 	reusableBuf []byte
 	Stream      io.ReadCloser
 	err         error
+
+	// salvager is set if the BSONSource skips over damaged documents.
+	salvager *bsonSalvager
 }
 
 // DecodedBSONSource reads documents from the underlying io.ReadCloser, Stream which
@@ -30,12 +33,12 @@ type RawDocSource interface {
 
 // NewBSONSource creates a BSONSource with a reusable I/O buffer
 func NewBSONSource(in io.ReadCloser) *BSONSource {
-	return &BSONSource{make([]byte, MaxBSONSize), in, nil}
+	return &BSONSource{make([]byte, MaxBSONSize), in, nil, nil}
 }
 
 // NewBufferlessBSONSource creates a BSONSource without a reusable I/O buffer
 func NewBufferlessBSONSource(in io.ReadCloser) *BSONSource {
-	return &BSONSource{nil, in, nil}
+	return &BSONSource{nil, in, nil, nil}
 }
 
 // Close closes the BSONSource, rendering it unusable for I/O.
@@ -75,7 +78,8 @@ func (dbs *DecodedBSONSource) Next(result interface{}) bool {
 // BSONSource was created with NewBSONSource then each returned []byte will be
 // a slice of a single reused I/O buffer. If the BSONSource was created with
 // NewBufferlessBSONSource then each returend []byte will be individually
-// allocated
+// allocated. If the BSONSource was created with NewSalvagingBSONSource then
+// damaged documents are skipped rather than ending the stream with an error.
 func (bs *BSONSource) LoadNext() []byte {
 	var into []byte
 	if bs.reusableBuf == nil {
@@ -83,6 +87,10 @@ func (bs *BSONSource) LoadNext() []byte {
 	} else {
 		into = bs.reusableBuf
 	}
+	if bs.salvager != nil {
+		into, bs.err = bs.salvager.loadNext(into)
+		return into
+	}
 	// read the bson object size (a 4 byte integer)
 	_, err := io.ReadAtLeast(bs.Stream, into[0:4], 4)
 	if err != nil {
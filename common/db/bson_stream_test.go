@@ -39,3 +39,60 @@ func TestBufferlessBSONSource(t *testing.T) {
 		})
 	})
 }
+
+func TestSalvagingBSONSource(t *testing.T) {
+	Convey("with a buffer of bson documents, some of them damaged", t, func() {
+		var docs [][]byte
+		for i := 0; i < 5; i++ {
+			data, err := bson.Marshal(bson.M{"_id": i, "x": "some value"})
+			So(err, ShouldBeNil)
+			docs = append(docs, data)
+		}
+		readIDs := func(source *BSONSource) []interface{} {
+			ids := []interface{}{}
+			for doc := source.LoadNext(); doc != nil; doc = source.LoadNext() {
+				result := bson.M{}
+				So(bson.Unmarshal(doc, &result), ShouldBeNil)
+				ids = append(ids, result["_id"])
+			}
+			So(source.Err(), ShouldBeNil)
+			return ids
+		}
+
+		Convey("a salvaging BSONSource skips the damage and reports it", func() {
+			buf := &bytes.Buffer{}
+			buf.Write(docs[0])
+			// damage the length of the second document
+			damagedStart := buf.Len()
+			buf.Write([]byte{0xff, 0xff, 0xff, 0x7f})
+			buf.Write(docs[1][4:])
+			damagedEnd := buf.Len()
+			buf.Write(docs[2])
+			buf.Write(docs[3])
+			// insert garbage before the last document
+			buf.Write([]byte("garbage"))
+			buf.Write(docs[4])
+
+			source := NewSalvagingBSONSource(ioutil.NopCloser(buf))
+			So(readIDs(source), ShouldResemble, []interface{}{0, 2, 3, 4})
+			damaged := source.DamagedRanges()
+			So(len(damaged), ShouldEqual, 2)
+			So(damaged[0].Start, ShouldEqual, damagedStart)
+			So(damaged[0].End, ShouldEqual, damagedEnd)
+			So(damaged[1].End-damaged[1].Start, ShouldEqual, len("garbage"))
+		})
+
+		Convey("a truncated last document is reported as damage", func() {
+			buf := &bytes.Buffer{}
+			buf.Write(docs[0])
+			buf.Write(docs[1][:10])
+
+			source := NewSalvagingBSONSource(ioutil.NopCloser(buf))
+			So(readIDs(source), ShouldResemble, []interface{}{0})
+			damaged := source.DamagedRanges()
+			So(len(damaged), ShouldEqual, 1)
+			So(damaged[0].Start, ShouldEqual, len(docs[0]))
+			So(damaged[0].End, ShouldEqual, len(docs[0])+10)
+		})
+	})
+}
@@ -17,6 +17,7 @@ type BufferedBulkInserter struct {
 	docLimit        int
 	byteCount       int
 	docCount        int
+	flushes         int
 	unordered       bool
 }
 
@@ -51,19 +52,72 @@ func (bb *BufferedBulkInserter) resetBulk() {
 // Insert adds a document to the buffer for bulk insertion. If the buffer is
 // full, the bulk insert is made, returning any error that occurs.
 func (bb *BufferedBulkInserter) Insert(doc interface{}) error {
-	rawBytes, err := bson.Marshal(doc)
-	if err != nil {
-		return fmt.Errorf("bson encoding error: %v", err)
+	raw, err := bb.buffer(doc)
+	if raw != nil {
+		bb.bulk.Insert(raw[0])
+	}
+	return err
+}
+
+// Update adds an update of the first document matching selector to the
+// buffer. The update is either a document of update operators or a
+// replacement document, which is inserted if upsert is true and no document
+// matches. If the buffer is full, the bulk write is made, returning any error
+// that occurs.
+func (bb *BufferedBulkInserter) Update(selector, update interface{}, upsert bool) error {
+	raw, err := bb.buffer(selector, update)
+	if raw == nil {
+		return err
+	}
+	if upsert {
+		bb.bulk.Upsert(raw[0], raw[1])
+	} else {
+		bb.bulk.Update(raw[0], raw[1])
+	}
+	return err
+}
+
+// Remove adds a removal of the first document matching selector to the
+// buffer. If the buffer is full, the bulk write is made, returning any error
+// that occurs.
+func (bb *BufferedBulkInserter) Remove(selector interface{}) error {
+	raw, err := bb.buffer(selector)
+	if raw != nil {
+		bb.bulk.Remove(raw[0])
+	}
+	return err
+}
+
+// buffer encodes the documents of an operation and makes room in the buffer
+// for it, flushing the buffer if it is full. The caller adds the operation to
+// the bulk unless the documents can't be encoded, in which case nothing is
+// returned but the error.
+func (bb *BufferedBulkInserter) buffer(docs ...interface{}) ([]bson.Raw, error) {
+	raw := make([]bson.Raw, len(docs))
+	size := 0
+	for i, doc := range docs {
+		rawBytes, marshalErr := bson.Marshal(doc)
+		if marshalErr != nil {
+			return nil, fmt.Errorf("bson encoding error: %v", marshalErr)
+		}
+		raw[i] = bson.Raw{Data: rawBytes}
+		size += len(rawBytes)
 	}
 	// flush if we are full
-	if bb.docCount >= bb.docLimit || bb.byteCount+len(rawBytes) > MaxBSONSize {
+	var err error
+	if bb.docCount >= bb.docLimit || bb.byteCount+size > MaxBSONSize {
 		err = bb.Flush()
 	}
-	// buffer the document
+	// buffer the operation
 	bb.docCount++
-	bb.byteCount += len(rawBytes)
-	bb.bulk.Insert(bson.Raw{Data: rawBytes})
-	return err
+	bb.byteCount += size
+	return raw, err
+}
+
+// Flushes returns the number of bulk inserts made so far, which tells callers
+// whether an Insert flushed the documents buffered before it.
+func (bb *BufferedBulkInserter) Flushes() int {
+	return bb.flushes
 }
 
 // Flush writes all buffered documents in one bulk insert then resets the buffer.
@@ -72,6 +126,7 @@ func (bb *BufferedBulkInserter) Flush() error {
 		return nil
 	}
 	defer bb.resetBulk()
+	bb.flushes++
 	if _, err := bb.bulk.Run(); err != nil {
 		return err
 	}
@@ -102,6 +102,26 @@ func TestBufferedBulkInserterInserts(t *testing.T) {
 			})
 		})
 
+		Convey("using a test collection and a doc limit of 2", func() {
+			testCol := session.DB("tools-test").C("bulk4")
+			bufBulk = NewBufferedBulkInserter(testCol, 2, false)
+			So(bufBulk, ShouldNotBeNil)
+
+			Convey("buffering inserts, updates and removals should apply them in order", func() {
+				So(bufBulk.Insert(bson.M{"_id": 1}), ShouldBeNil)
+				So(bufBulk.Insert(bson.M{"_id": 2}), ShouldBeNil)
+				So(bufBulk.Update(bson.M{"_id": 1}, bson.M{"$set": bson.M{"a": 1}}, false), ShouldBeNil)
+				So(bufBulk.Update(bson.M{"_id": 3}, bson.M{"b": 3}, true), ShouldBeNil)
+				So(bufBulk.Remove(bson.M{"_id": 2}), ShouldBeNil)
+				So(bufBulk.Flush(), ShouldBeNil)
+				So(bufBulk.Flushes(), ShouldEqual, 3)
+
+				docs := []bson.M{}
+				So(testCol.Find(nil).Sort("_id").All(&docs), ShouldBeNil)
+				So(docs, ShouldResemble, []bson.M{{"_id": 1, "a": 1}, {"_id": 3, "b": 3}})
+			})
+		})
+
 		Reset(func() {
 			session.DB("tools-test").DropDatabase()
 			session.Close()
@@ -0,0 +1,132 @@
+package db
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// FieldRange is a range of the values of a field, used to read the documents
+// of a collection in partitions. Min is inclusive and Max exclusive, and a nil
+// bound leaves the range open on that side.
+//
+// Queries only compare values of the same type, so the range without a Min
+// also holds the documents whose field is missing, null, or of another type
+// than the bounds, so that the ranges of a split hold every document once.
+type FieldRange struct {
+	Field    string
+	Min, Max interface{}
+}
+
+// Selector returns the query selector of the documents in the range.
+func (r FieldRange) Selector() bson.M {
+	switch {
+	case r.Min == nil && r.Max == nil:
+		return bson.M{}
+	case r.Min == nil:
+		return bson.M{r.Field: bson.M{"$not": bson.M{"$gte": r.Max}}}
+	case r.Max == nil:
+		return bson.M{r.Field: bson.M{"$gte": r.Min}}
+	}
+	return bson.M{r.Field: bson.M{"$gte": r.Min, "$lt": r.Max}}
+}
+
+// SplitFieldRanges splits the documents of a collection into at most n
+// ranges of the values of a field, holding about the same number of
+// documents, so that they can be read in parallel. The ranges are returned in
+// the order of the field.
+//
+// The split points are found by skipping through the documents in the order of
+// the field, so the field should be indexed: only the field is projected, so
+// that the queries are covered by its index and skip through its keys rather
+// than the documents. It must not hold arrays, and its values must be of a
+// single type, as _id usually is. Fewer ranges are returned if the field has
+// too few distinct values.
+func SplitFieldRanges(collection *mgo.Collection, field string, n int) ([]FieldRange, error) {
+	if n <= 1 {
+		return []FieldRange{{Field: field}}, nil
+	}
+	count, err := collection.Count()
+	if err != nil {
+		return nil, fmt.Errorf("error counting documents in %v: %v", collection.FullName, err)
+	}
+
+	projection := coveredProjection(field)
+	var bounds []interface{}
+	for i := 1; i < n; i++ {
+		var doc bson.M
+		err = collection.Find(nil).Select(projection).Sort(field).Skip(count * i / n).Limit(1).One(&doc)
+		if err == mgo.ErrNotFound {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error finding the values of '%v' to split %v at: %v", field, collection.FullName, err)
+		}
+		bound := fieldValue(doc, field)
+		if bound == nil {
+			// missing and null values sort first, and are in the first range
+			continue
+		}
+		if _, ok := bound.([]interface{}); ok {
+			return nil, fmt.Errorf("cannot split %v by '%v', which holds arrays", collection.FullName, field)
+		}
+		if len(bounds) > 0 {
+			if reflect.DeepEqual(bound, bounds[len(bounds)-1]) {
+				continue
+			}
+			if !sameCompareType(bound, bounds[0]) {
+				return nil, fmt.Errorf("cannot split %v by '%v', which holds values of different types", collection.FullName, field)
+			}
+		}
+		bounds = append(bounds, bound)
+	}
+
+	ranges := make([]FieldRange, 0, len(bounds)+1)
+	var min interface{}
+	for _, bound := range bounds {
+		ranges = append(ranges, FieldRange{Field: field, Min: min, Max: bound})
+		min = bound
+	}
+	return append(ranges, FieldRange{Field: field, Min: min}), nil
+}
+
+// coveredProjection returns the projection of only a field, without the _id
+// that is otherwise returned, so that a query on the field can be covered by
+// its index.
+func coveredProjection(field string) bson.M {
+	if field == "_id" {
+		return bson.M{"_id": 1}
+	}
+	return bson.M{field: 1, "_id": 0}
+}
+
+// fieldValue returns the value of a field at a dotted path in a document, or
+// nil if it is missing.
+func fieldValue(doc bson.M, field string) interface{} {
+	names := strings.Split(field, ".")
+	for _, name := range names[:len(names)-1] {
+		sub, ok := doc[name].(bson.M)
+		if !ok {
+			return nil
+		}
+		doc = sub
+	}
+	return doc[names[len(names)-1]]
+}
+
+// sameCompareType returns whether queries compare two values, which is if
+// they are of the same type, or both numbers.
+func sameCompareType(a, b interface{}) bool {
+	return isNumber(a) && isNumber(b) || reflect.TypeOf(a) == reflect.TypeOf(b)
+}
+
+func isNumber(value interface{}) bool {
+	switch value.(type) {
+	case int, int32, int64, float64, bson.Decimal128:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,91 @@
+package db
+
+import (
+	"testing"
+
+	"github.com/mongodb/mongo-tools/common/options"
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func TestFieldRangeSelector(t *testing.T) {
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("The selector of a range should match the values between its bounds", t, func() {
+		So(FieldRange{Field: "a"}.Selector(), ShouldResemble, bson.M{})
+		So(FieldRange{Field: "a", Max: 5}.Selector(), ShouldResemble,
+			bson.M{"a": bson.M{"$not": bson.M{"$gte": 5}}})
+		So(FieldRange{Field: "a", Min: 5}.Selector(), ShouldResemble,
+			bson.M{"a": bson.M{"$gte": 5}})
+		So(FieldRange{Field: "a", Min: 5, Max: 9}.Selector(), ShouldResemble,
+			bson.M{"a": bson.M{"$gte": 5, "$lt": 9}})
+	})
+
+	Convey("Values should be compared by queries if they are of the same type", t, func() {
+		So(sameCompareType(1, 2.5), ShouldBeTrue)
+		So(sameCompareType("a", "b"), ShouldBeTrue)
+		So(sameCompareType(bson.NewObjectId(), "b"), ShouldBeFalse)
+		So(sameCompareType(int64(1), "1"), ShouldBeFalse)
+	})
+
+	Convey("Only the split field should be projected", t, func() {
+		So(coveredProjection("_id"), ShouldResemble, bson.M{"_id": 1})
+		So(coveredProjection("a.b"), ShouldResemble, bson.M{"a.b": 1, "_id": 0})
+	})
+
+	Convey("Values should be found at dotted paths", t, func() {
+		doc := bson.M{"a": bson.M{"b": 1}, "c": 2}
+		So(fieldValue(doc, "a.b"), ShouldEqual, 1)
+		So(fieldValue(doc, "c"), ShouldEqual, 2)
+		So(fieldValue(doc, "c.d"), ShouldBeNil)
+		So(fieldValue(doc, "e"), ShouldBeNil)
+	})
+}
+
+func TestSplitFieldRanges(t *testing.T) {
+	testutil.VerifyTestType(t, "db")
+
+	Convey("With a collection of 100 documents", t, func() {
+		opts := options.ToolOptions{
+			Connection: &options.Connection{
+				Port: DefaultTestPort,
+			},
+			SSL:  &options.SSL{},
+			Auth: &options.Auth{},
+		}
+		provider, err := NewSessionProvider(opts)
+		So(err, ShouldBeNil)
+		session, err := provider.GetSession()
+		So(err, ShouldBeNil)
+		defer session.Close()
+
+		collection := session.DB("tools-test").C("ranges")
+		So(collection.DropCollection(), ShouldBeNil)
+		for i := 0; i < 100; i++ {
+			So(collection.Insert(bson.M{"_id": i, "mod": i % 2}), ShouldBeNil)
+		}
+		So(collection.Insert(bson.M{"_id": "last"}), ShouldBeNil)
+
+		Convey("splitting by _id should give ranges holding every document once", func() {
+			ranges, err := SplitFieldRanges(collection, "_id", 4)
+			So(err, ShouldBeNil)
+			So(len(ranges), ShouldEqual, 4)
+			total := 0
+			for _, r := range ranges {
+				n, err := collection.Find(r.Selector()).Count()
+				So(err, ShouldBeNil)
+				So(n, ShouldBeGreaterThan, 0)
+				total += n
+			}
+			So(total, ShouldEqual, 101)
+		})
+
+		Convey("splitting by a field with few values should give fewer ranges", func() {
+			So(collection.EnsureIndexKey("mod"), ShouldBeNil)
+			ranges, err := SplitFieldRanges(collection, "mod", 4)
+			So(err, ShouldBeNil)
+			So(len(ranges), ShouldEqual, 2)
+		})
+	})
+}
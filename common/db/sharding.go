@@ -0,0 +1,53 @@
+package db
+
+import (
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// ShardedCollection holds a collection's entry in the config.collections
+// collection of a sharded cluster.
+type ShardedCollection struct {
+	Key     bson.D      `bson:"key"`
+	Unique  bool        `bson:"unique"`
+	Dropped bool        `bson:"dropped"`
+	UUID    interface{} `bson:"uuid,omitempty"`
+}
+
+// Chunk holds the bounds and owning shard of a chunk in the config.chunks
+// collection of a sharded cluster.
+type Chunk struct {
+	Min   bson.D `bson:"min"`
+	Max   bson.D `bson:"max"`
+	Shard string `bson:"shard"`
+}
+
+// GetShardedCollection returns the sharding configuration of the given
+// namespace, or nil if the namespace is not sharded. The session must be
+// connected to a mongos.
+func GetShardedCollection(session *mgo.Session, namespace string) (*ShardedCollection, error) {
+	coll := &ShardedCollection{}
+	err := session.DB("config").C("collections").Find(bson.M{"_id": namespace}).One(coll)
+	if err == mgo.ErrNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if coll.Dropped {
+		return nil, nil
+	}
+	return coll, nil
+}
+
+// GetChunks returns an iterator over the chunks of the given sharded namespace,
+// ordered by their lower bound.
+func GetChunks(session *mgo.Session, namespace string, coll *ShardedCollection) *mgo.Iter {
+	// newer servers identify the chunks of a collection by its uuid
+	// rather than its namespace
+	query := bson.M{"ns": namespace}
+	if coll.UUID != nil {
+		query = bson.M{"uuid": coll.UUID}
+	}
+	return session.DB("config").C("chunks").Find(query).Sort("min").Iter()
+}
@@ -6,6 +6,32 @@ import (
 	"reflect"
 )
 
+// Format is a flavor of Extended JSON.
+type Format string
+
+const (
+	// LegacyFormat is the strict mode format the tools have always written,
+	// e.g. { "$date": "2006-01-02T15:04:05.000Z" } and plain 32-bit integers.
+	LegacyFormat Format = "legacy"
+	// CanonicalFormat is the Extended JSON v2 format that preserves the type of
+	// every value, e.g. { "$numberInt": "1" } and { "$numberDouble": "1.0" }.
+	CanonicalFormat Format = "canonical"
+	// RelaxedFormat is the Extended JSON v2 format that writes numbers, and dates
+	// between the years 1970 and 9999, in their most readable form.
+	RelaxedFormat Format = "relaxed"
+)
+
+// ParseFormat returns the Format named s. An empty s is LegacyFormat.
+func ParseFormat(s string) (Format, error) {
+	switch Format(s) {
+	case "", LegacyFormat:
+		return LegacyFormat, nil
+	case CanonicalFormat, RelaxedFormat:
+		return Format(s), nil
+	}
+	return "", fmt.Errorf("unknown Extended JSON format '%v', expected one of canonical, relaxed or legacy", s)
+}
+
 // Represents base-64 encoded binary data
 type BinData struct {
 	Type   byte
@@ -96,6 +96,10 @@ type scanner struct {
 
 	// total bytes consumed, updated by decoder.Decode
 	bytes int64
+
+	// disallowShellMode rejects the shell mode values of Extended JSON, such as
+	// constructors and regular expression literals.
+	disallowShellMode bool
 }
 
 // These values are returned by the state transition functions
@@ -245,6 +249,9 @@ func stateBeginValue(s *scanner, c int) int {
 		s.step = state1
 		return scanBeginLiteral
 	}
+	if s.disallowShellMode {
+		return s.error(c, "looking for beginning of value")
+	}
 	return stateBeginExtendedValue(s, c)
 }
 
@@ -592,7 +599,7 @@ func stateFals(s *scanner, c int) int {
 
 // stateN is the state after reading `n`.
 func stateN(s *scanner, c int) int {
-	if c == 'e' {
+	if c == 'e' && !s.disallowShellMode {
 		s.step = stateNe
 		return scanContinue
 	}
@@ -0,0 +1,44 @@
+package json
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"strings"
+	"testing"
+)
+
+func TestDisallowShellMode(t *testing.T) {
+
+	Convey("With a decoder that disallows shell mode", t, func() {
+
+		Convey("strict JSON and Extended JSON v2 can be read", func() {
+			for _, doc := range []string{
+				`{"a": null, "b": [true, false, -1.5e3]}`,
+				`{"a": {"$numberLong": "1"}, "b": {"$date": {"$numberLong": "0"}}}`,
+			} {
+				dec := NewDecoder(strings.NewReader(doc))
+				dec.DisallowShellMode()
+				_, err := dec.ScanObject()
+				So(err, ShouldBeNil)
+			}
+		})
+
+		Convey("constructors, literals and the new keyword are errors", func() {
+			for _, doc := range []string{
+				`{"a": NumberLong(1)}`,
+				`{"a": new Date(0)}`,
+				`{"a": /x/i}`,
+				`{"a": undefined}`,
+				`{"a": Infinity}`,
+			} {
+				dec := NewDecoder(strings.NewReader(doc))
+				dec.DisallowShellMode()
+				_, err := dec.ScanObject()
+				So(err, ShouldNotBeNil)
+
+				dec = NewDecoder(strings.NewReader(doc))
+				_, err = dec.ScanObject()
+				So(err, ShouldBeNil)
+			}
+		})
+	})
+}
@@ -17,6 +17,9 @@ type Decoder struct {
 	d    decodeState
 	scan scanner
 	err  error
+	// errOffset is the position in Buf at which err occurred, if it is a
+	// syntax error
+	errOffset int
 }
 
 // NewDecoder returns a new decoder that reads from r.
@@ -31,6 +34,11 @@ func NewDecoder(r io.Reader) *Decoder {
 // Number instead of as a float64.
 func (dec *Decoder) UseNumber() { dec.d.useNumber = true }
 
+// DisallowShellMode causes the Decoder to reject the shell mode values of
+// Extended JSON, such as NumberLong(1), new Date(0) or /regex/, which aren't
+// valid in Extended JSON v2.
+func (dec *Decoder) DisallowShellMode() { dec.scan.disallowShellMode = true }
+
 // Decode reads the next JSON-encoded value from its
 // input and stores it in the value pointed to by v.
 //
@@ -133,6 +141,7 @@ Input:
 			}
 			if v == scanError {
 				dec.err = dec.scan.err
+				dec.errOffset = scanp + i
 				return 0, dec.scan.err
 			}
 		}
@@ -147,6 +156,7 @@ Input:
 				}
 				if nonSpace(dec.Buf) {
 					err = io.ErrUnexpectedEOF
+					dec.errOffset = len(dec.Buf)
 				}
 			}
 			dec.err = err
@@ -169,6 +179,53 @@ Input:
 	return scanp, nil
 }
 
+// SkipLine discards the input that the last call to ScanObject or Decode
+// failed to parse, up to and including the end of the line that the syntax
+// error is on, and returns it. Decoding then resumes on the next line, so
+// that a stream of values on separate lines can be read past invalid ones.
+// Errors other than syntax errors can't be skipped and are returned.
+func (dec *Decoder) SkipLine() ([]byte, error) {
+	if _, ok := dec.err.(*SyntaxError); !ok && dec.err != io.ErrUnexpectedEOF {
+		if dec.err == nil {
+			return nil, errors.New("json: no syntax error to skip")
+		}
+		return nil, dec.err
+	}
+	end := dec.errOffset
+	if dec.err != io.ErrUnexpectedEOF {
+		var err error
+		for {
+			if i := bytes.IndexByte(dec.Buf[end:], '\n'); i >= 0 {
+				end += i + 1
+				break
+			}
+			end = len(dec.Buf)
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				dec.err = err
+				return nil, err
+			}
+			const minRead = 512
+			if cap(dec.Buf)-len(dec.Buf) < minRead {
+				newBuf := make([]byte, len(dec.Buf), 2*cap(dec.Buf)+minRead)
+				copy(newBuf, dec.Buf)
+				dec.Buf = newBuf
+			}
+			var n int
+			n, err = dec.R.Read(dec.Buf[len(dec.Buf):cap(dec.Buf)])
+			dec.Buf = dec.Buf[0 : len(dec.Buf)+n]
+		}
+	}
+	skipped := make([]byte, end)
+	copy(skipped, dec.Buf[0:end])
+	rest := copy(dec.Buf, dec.Buf[end:])
+	dec.Buf = dec.Buf[0:rest]
+	dec.err = nil
+	return skipped, nil
+}
+
 func nonSpace(b []byte) bool {
 	for _, c := range b {
 		if !isSpace(rune(c)) {
@@ -6,11 +6,13 @@ package json
 
 import (
 	"bytes"
+	"io"
 	"io/ioutil"
 	"net"
 	"reflect"
 	"strings"
 	"testing"
+	"testing/iotest"
 )
 
 // Test values for the stream test.
@@ -107,6 +109,38 @@ func TestDecoderBuffered(t *testing.T) {
 	}
 }
 
+func TestDecoderSkipLine(t *testing.T) {
+	input := "{\"a\": 1}\n{\"b\": }, \"c\"\n{\"d\": 2}\n{\"e\": "
+	// read a byte at a time, so that the rest of the line has to be read
+	d := NewDecoder(iotest.OneByteReader(strings.NewReader(input)))
+	for _, want := range []struct {
+		scanned, skipped string
+	}{
+		{scanned: `{"a": 1}`},
+		{skipped: "\n{\"b\": }, \"c\"\n"},
+		{scanned: `{"d": 2}`},
+		{skipped: "\n{\"e\": "},
+	} {
+		scanned, err := d.ScanObject()
+		if want.skipped == "" {
+			if err != nil || string(scanned) != want.scanned {
+				t.Fatalf("ScanObject = %q, %v; want %q", scanned, err, want.scanned)
+			}
+			continue
+		}
+		if err == nil {
+			t.Fatalf("ScanObject = %q; want an error", scanned)
+		}
+		skipped, err := d.SkipLine()
+		if err != nil || string(skipped) != want.skipped {
+			t.Fatalf("SkipLine = %q, %v; want %q", skipped, err, want.skipped)
+		}
+	}
+	if _, err := d.ScanObject(); err != io.EOF {
+		t.Fatalf("ScanObject error = %v; want EOF", err)
+	}
+}
+
 func nlines(s string, n int) string {
 	if n <= 0 {
 		return ""
@@ -0,0 +1,65 @@
+package parquet
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+
+	"github.com/golang/snappy"
+)
+
+// decompress decompresses the data of a page, which is size bytes long once
+// decompressed.
+func decompress(codec Codec, data []byte, size int) ([]byte, error) {
+	var decompressed []byte
+	var err error
+	switch codec {
+	case Uncompressed:
+		decompressed = data
+	case Snappy:
+		decompressed, err = snappy.Decode(make([]byte, size), data)
+	case Gzip:
+		var reader *gzip.Reader
+		if reader, err = gzip.NewReader(bytes.NewReader(data)); err == nil {
+			decompressed = make([]byte, size)
+			if _, err = io.ReadFull(reader, decompressed); err == io.ErrUnexpectedEOF {
+				err = fmt.Errorf("decompressed page is shorter than %v bytes", size)
+			}
+		}
+	case Zstd:
+		decompressed, err = zstdDecompress(data, size)
+	default:
+		return nil, fmt.Errorf("unsupported compression codec %v", codec)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error decompressing %v page: %v", codec, err)
+	}
+	if len(decompressed) != size {
+		return nil, fmt.Errorf("decompressed %v page is %v bytes long instead of %v", codec, len(decompressed), size)
+	}
+	return decompressed, nil
+}
+
+// compress compresses the data of a page.
+func compress(codec Codec, data []byte) ([]byte, error) {
+	switch codec {
+	case Uncompressed:
+		return data, nil
+	case Snappy:
+		return snappy.Encode(nil, data), nil
+	case Gzip:
+		buf := &bytes.Buffer{}
+		writer := gzip.NewWriter(buf)
+		if _, err := writer.Write(data); err != nil {
+			return nil, err
+		}
+		if err := writer.Close(); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	case Zstd:
+		return zstdCompress(data)
+	}
+	return nil, fmt.Errorf("unsupported compression codec %v", codec)
+}
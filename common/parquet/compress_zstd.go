@@ -0,0 +1,46 @@
+// +build zstd
+
+package parquet
+
+import (
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// zstdSupported is whether pages can be compressed with zstd, which requires
+// building with the zstd tag.
+const zstdSupported = true
+
+// the zstd encoder and decoder are safe for concurrent use, and expensive
+// enough to create that they are shared
+var (
+	zstdOnce    sync.Once
+	zstdEncoder *zstd.Encoder
+	zstdDecoder *zstd.Decoder
+	zstdErr     error
+)
+
+func initZstd() error {
+	zstdOnce.Do(func() {
+		if zstdEncoder, zstdErr = zstd.NewWriter(nil, zstd.WithEncoderConcurrency(1)); zstdErr != nil {
+			return
+		}
+		zstdDecoder, zstdErr = zstd.NewReader(nil, zstd.WithDecoderConcurrency(1))
+	})
+	return zstdErr
+}
+
+func zstdDecompress(data []byte, size int) ([]byte, error) {
+	if err := initZstd(); err != nil {
+		return nil, err
+	}
+	return zstdDecoder.DecodeAll(data, make([]byte, 0, size))
+}
+
+func zstdCompress(data []byte) ([]byte, error) {
+	if err := initZstd(); err != nil {
+		return nil, err
+	}
+	return zstdEncoder.EncodeAll(data, nil), nil
+}
@@ -0,0 +1,21 @@
+// +build !zstd
+
+package parquet
+
+import (
+	"errors"
+)
+
+// zstdSupported is whether pages can be compressed with zstd, which requires
+// building with the zstd tag.
+const zstdSupported = false
+
+var errZstdUnsupported = errors.New("zstd is not supported by this build, which requires building with -tags zstd")
+
+func zstdDecompress(data []byte, size int) ([]byte, error) {
+	return nil, errZstdUnsupported
+}
+
+func zstdCompress(data []byte) ([]byte, error) {
+	return nil, errZstdUnsupported
+}
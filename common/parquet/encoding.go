@@ -0,0 +1,414 @@
+package parquet
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"math/bits"
+)
+
+var errPageTruncated = errors.New("page data is truncated")
+
+// bitWidth returns the number of bits needed to hold values up to max.
+func bitWidth(max int) int {
+	return bits.Len64(uint64(max))
+}
+
+// unpackBits reads count values of width bits each, packed from the least
+// significant bit of each byte, into out.
+func unpackBits(data []byte, width int, count int, out []uint64) {
+	bitPos := 0
+	for i := 0; i < count; i++ {
+		var v uint64
+		for b := 0; b < width; {
+			take := 8 - bitPos&7
+			if take > width-b {
+				take = width - b
+			}
+			chunk := uint64(data[bitPos>>3]>>uint(bitPos&7)) & (1<<uint(take) - 1)
+			v |= chunk << uint(b)
+			b += take
+			bitPos += take
+		}
+		out[i] = v
+	}
+}
+
+// packBits appends values of width bits each to out, packed from the least
+// significant bit of each byte.
+func packBits(out []byte, values []uint64, width int) []byte {
+	start := len(out)
+	out = append(out, make([]byte, (len(values)*width+7)/8)...)
+	bitPos := 0
+	for _, v := range values {
+		for b := 0; b < width; {
+			take := 8 - bitPos&7
+			if take > width-b {
+				take = width - b
+			}
+			chunk := byte(v>>uint(b)) & (1<<uint(take) - 1)
+			out[start+bitPos>>3] |= chunk << uint(bitPos&7)
+			b += take
+			bitPos += take
+		}
+	}
+	return out
+}
+
+// decodeRLE decodes count values from the RLE/bit-packed hybrid encoding,
+// which is used for levels and dictionary indices.
+func decodeRLE(data []byte, width int, count int) ([]int32, error) {
+	if width > 32 {
+		return nil, fmt.Errorf("invalid bit width %v", width)
+	}
+	values := make([]int32, 0, count)
+	byteWidth := (width + 7) / 8
+	var unpacked []uint64
+	pos := 0
+	for len(values) < count {
+		header, n := binary.Uvarint(data[pos:])
+		if n <= 0 {
+			return nil, errPageTruncated
+		}
+		pos += n
+		remaining := count - len(values)
+		if header&1 == 0 {
+			// a run of repeated values
+			run := header >> 1
+			if pos+byteWidth > len(data) {
+				return nil, errPageTruncated
+			}
+			var v uint32
+			for i := 0; i < byteWidth; i++ {
+				v |= uint32(data[pos+i]) << uint(8*i)
+			}
+			pos += byteWidth
+			if run > uint64(remaining) {
+				run = uint64(remaining)
+			}
+			for i := uint64(0); i < run; i++ {
+				values = append(values, int32(v))
+			}
+			continue
+		}
+		// groups of 8 bit-packed values
+		groups := header >> 1
+		if groups > uint64(len(data)) {
+			return nil, errPageTruncated
+		}
+		size := int(groups) * width
+		if pos+size > len(data) {
+			// the last run may be truncated after its last value
+			size = len(data) - pos
+		}
+		n = int(groups) * 8
+		if width > 0 && size*8/width < n {
+			n = size * 8 / width
+		}
+		if n > remaining {
+			n = remaining
+		}
+		if n == 0 {
+			return nil, errPageTruncated
+		}
+		if cap(unpacked) < n {
+			unpacked = make([]uint64, n)
+		}
+		unpackBits(data[pos:], width, n, unpacked)
+		for _, v := range unpacked[:n] {
+			values = append(values, int32(v))
+		}
+		pos += size
+	}
+	return values, nil
+}
+
+// maxBitPackedGroups is the largest number of groups of 8 values that are
+// written in one bit-packed run.
+const maxBitPackedGroups = 63
+
+// encodeRLE appends values encoded with the RLE/bit-packed hybrid encoding to
+// out. Runs of at least 8 repeated values are run length encoded, and the
+// other values are bit-packed.
+func encodeRLE(out []byte, values []int32, width int) []byte {
+	byteWidth := (width + 7) / 8
+	var packed []uint64
+	flushPacked := func() {
+		for len(packed) > 0 {
+			n := len(packed)
+			if n > maxBitPackedGroups*8 {
+				n = maxBitPackedGroups * 8
+			}
+			groups := (n + 7) / 8
+			out = binary.AppendUvarint(out, uint64(groups)<<1|1)
+			group := packed[:n]
+			for len(group) < groups*8 {
+				group = append(group, 0)
+			}
+			out = packBits(out, group, width)
+			packed = packed[n:]
+		}
+		packed = nil
+	}
+	for i := 0; i < len(values); {
+		j := i + 1
+		for j < len(values) && values[j] == values[i] {
+			j++
+		}
+		// bit-packed runs can only end on a multiple of 8 values, so the run
+		// fills up the pending group first
+		fill := (8 - len(packed)%8) % 8
+		if j-i-fill >= 8 {
+			for ; fill > 0; fill-- {
+				packed = append(packed, uint64(values[i]))
+				i++
+			}
+			flushPacked()
+			out = binary.AppendUvarint(out, uint64(j-i)<<1)
+			for b := 0; b < byteWidth; b++ {
+				out = append(out, byte(uint32(values[i])>>uint(8*b)))
+			}
+			i = j
+			continue
+		}
+		for ; i < j; i++ {
+			packed = append(packed, uint64(values[i]))
+		}
+	}
+	flushPacked()
+	return out
+}
+
+// decodeLevels decodes count levels of a version 1 data page, which are
+// prefixed with their length, and returns them with the length of the data
+// they were decoded from.
+func decodeLevels(data []byte, maxLevel int, count int) ([]int32, int, error) {
+	if len(data) < 4 {
+		return nil, 0, errPageTruncated
+	}
+	length := binary.LittleEndian.Uint32(data)
+	if uint64(length) > uint64(len(data)-4) {
+		return nil, 0, errPageTruncated
+	}
+	levels, err := decodeRLE(data[4:4+length], bitWidth(maxLevel), count)
+	if err != nil {
+		return nil, 0, err
+	}
+	return levels, 4 + int(length), nil
+}
+
+// decodePlain decodes count values of the given type from the PLAIN encoding.
+func decodePlain(data []byte, t Type, typeLength int, count int) ([]interface{}, error) {
+	values := make([]interface{}, 0, count)
+	width := map[Type]int{Int32: 4, Int64: 8, Int96: 12, Float: 4, Double: 8, FixedLenByteArray: typeLength}[t]
+	if t == Boolean {
+		width = 0
+		if (count+7)/8 > len(data) {
+			return nil, errPageTruncated
+		}
+	}
+	if width > 0 && count > len(data)/width {
+		return nil, errPageTruncated
+	}
+	pos := 0
+	for i := 0; i < count; i++ {
+		switch t {
+		case Boolean:
+			values = append(values, data[i>>3]>>uint(i&7)&1 == 1)
+		case Int32:
+			values = append(values, int32(binary.LittleEndian.Uint32(data[pos:])))
+		case Int64:
+			values = append(values, int64(binary.LittleEndian.Uint64(data[pos:])))
+		case Float:
+			values = append(values, math.Float32frombits(binary.LittleEndian.Uint32(data[pos:])))
+		case Double:
+			values = append(values, math.Float64frombits(binary.LittleEndian.Uint64(data[pos:])))
+		case Int96, FixedLenByteArray:
+			values = append(values, data[pos:pos+width:pos+width])
+		case ByteArray:
+			if len(data)-pos < 4 {
+				return nil, errPageTruncated
+			}
+			length := binary.LittleEndian.Uint32(data[pos:])
+			pos += 4
+			if uint64(length) > uint64(len(data)-pos) {
+				return nil, errPageTruncated
+			}
+			end := pos + int(length)
+			values = append(values, data[pos:end:end])
+			pos = end
+		default:
+			return nil, fmt.Errorf("unknown type %v", t)
+		}
+		pos += width
+	}
+	return values, nil
+}
+
+// decodeDictionaryIndices decodes count dictionary indices, which are RLE
+// encoded after a byte holding their bit width.
+func decodeDictionaryIndices(data []byte, count int) ([]int32, error) {
+	if count == 0 {
+		return nil, nil
+	}
+	if len(data) == 0 {
+		return nil, errPageTruncated
+	}
+	return decodeRLE(data[1:], int(data[0]), count)
+}
+
+// decodeDeltaBinaryPacked decodes integers from the DELTA_BINARY_PACKED
+// encoding, returning them with the length of the data they were decoded
+// from.
+func decodeDeltaBinaryPacked(data []byte) ([]int64, int, error) {
+	pos := 0
+	readUvarint := func() (uint64, error) {
+		v, n := binary.Uvarint(data[pos:])
+		if n <= 0 {
+			return 0, errPageTruncated
+		}
+		pos += n
+		return v, nil
+	}
+	readVarint := func() (int64, error) {
+		v, err := readUvarint()
+		return int64(v>>1) ^ -int64(v&1), err
+	}
+	blockSize, err := readUvarint()
+	if err != nil {
+		return nil, 0, err
+	}
+	miniblocks, err := readUvarint()
+	if err != nil {
+		return nil, 0, err
+	}
+	total, err := readUvarint()
+	if err != nil {
+		return nil, 0, err
+	}
+	first, err := readVarint()
+	if err != nil {
+		return nil, 0, err
+	}
+	if miniblocks == 0 || blockSize == 0 || blockSize%miniblocks != 0 ||
+		(blockSize/miniblocks)%8 != 0 || blockSize > 1<<20 {
+		return nil, 0, fmt.Errorf("invalid delta encoding block size %v with %v miniblocks", blockSize, miniblocks)
+	}
+	if total == 0 {
+		return nil, pos, nil
+	}
+	perMiniblock := int(blockSize / miniblocks)
+	capacity := total
+	if capacity > 1<<16 {
+		capacity = 1 << 16
+	}
+	values := make([]int64, 1, capacity)
+	values[0] = first
+	last := first
+	unpacked := make([]uint64, perMiniblock)
+	for uint64(len(values)) < total {
+		minDelta, err := readVarint()
+		if err != nil {
+			return nil, 0, err
+		}
+		if pos+int(miniblocks) > len(data) {
+			return nil, 0, errPageTruncated
+		}
+		widths := data[pos : pos+int(miniblocks)]
+		pos += int(miniblocks)
+		for _, width := range widths {
+			if uint64(len(values)) >= total {
+				break
+			}
+			if width > 64 {
+				return nil, 0, fmt.Errorf("invalid bit width %v", width)
+			}
+			size := perMiniblock * int(width) / 8
+			if pos+size > len(data) {
+				return nil, 0, errPageTruncated
+			}
+			unpackBits(data[pos:], int(width), perMiniblock, unpacked)
+			for _, delta := range unpacked {
+				if uint64(len(values)) >= total {
+					break
+				}
+				last += minDelta + int64(delta)
+				values = append(values, last)
+			}
+			pos += size
+		}
+	}
+	return values, pos, nil
+}
+
+// decodeDeltaLengthByteArray decodes byte arrays from the
+// DELTA_LENGTH_BYTE_ARRAY encoding, returning them with the length of the data
+// they were decoded from.
+func decodeDeltaLengthByteArray(data []byte) ([][]byte, int, error) {
+	lengths, pos, err := decodeDeltaBinaryPacked(data)
+	if err != nil {
+		return nil, 0, err
+	}
+	values := make([][]byte, len(lengths))
+	for i, length := range lengths {
+		if length < 0 || length > int64(len(data)-pos) {
+			return nil, 0, errPageTruncated
+		}
+		end := pos + int(length)
+		values[i] = data[pos:end:end]
+		pos = end
+	}
+	return values, pos, nil
+}
+
+// decodeDeltaByteArray decodes byte arrays from the DELTA_BYTE_ARRAY encoding,
+// which stores the length of the prefix each value shares with the previous
+// one and the rest of the value.
+func decodeDeltaByteArray(data []byte) ([][]byte, error) {
+	prefixLengths, pos, err := decodeDeltaBinaryPacked(data)
+	if err != nil {
+		return nil, err
+	}
+	suffixes, _, err := decodeDeltaLengthByteArray(data[pos:])
+	if err != nil {
+		return nil, err
+	}
+	if len(suffixes) != len(prefixLengths) {
+		return nil, fmt.Errorf("delta byte array has %v prefixes and %v suffixes", len(prefixLengths), len(suffixes))
+	}
+	values := make([][]byte, len(suffixes))
+	var previous []byte
+	for i, suffix := range suffixes {
+		prefixLength := prefixLengths[i]
+		if prefixLength < 0 || prefixLength > int64(len(previous)) {
+			return nil, fmt.Errorf("invalid delta byte array prefix length %v", prefixLength)
+		}
+		value := make([]byte, 0, int(prefixLength)+len(suffix))
+		value = append(append(value, previous[:prefixLength]...), suffix...)
+		values[i] = value
+		previous = value
+	}
+	return values, nil
+}
+
+// decodeByteStreamSplit decodes count values from the BYTE_STREAM_SPLIT
+// encoding, which stores the n-th bytes of all the values one after the
+// other, by reassembling them and decoding them as PLAIN values.
+func decodeByteStreamSplit(data []byte, t Type, typeLength int, count int) ([]interface{}, error) {
+	width := map[Type]int{Int32: 4, Int64: 8, Float: 4, Double: 8, FixedLenByteArray: typeLength}[t]
+	if width == 0 {
+		return nil, fmt.Errorf("BYTE_STREAM_SPLIT encoding doesn't apply to type %v", t)
+	}
+	if count > len(data)/width {
+		return nil, errPageTruncated
+	}
+	stride := len(data) / width
+	plain := make([]byte, count*width)
+	for i := 0; i < count; i++ {
+		for b := 0; b < width; b++ {
+			plain[i*width+b] = data[b*stride+i]
+		}
+	}
+	return decodePlain(plain, t, typeLength, count)
+}
@@ -0,0 +1,84 @@
+package parquet
+
+import (
+	"testing"
+
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestRLEEncoding(t *testing.T) {
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("Values encoded with the RLE/bit-packed hybrid encoding", t, func() {
+		Convey("are decoded back to the same values", func() {
+			var values []int32
+			for i := 0; i < 1000; i++ {
+				values = append(values, int32(i%3))
+			}
+			for i := 0; i < 100; i++ {
+				values = append(values, 5)
+			}
+			values = append(values, 1, 2, 7, 7, 7, 7, 7, 7, 7, 7, 7, 0)
+			for _, width := range []int{3, 4, 12} {
+				decoded, err := decodeRLE(encodeRLE(nil, values, width), width, len(values))
+				So(err, ShouldBeNil)
+				So(decoded, ShouldResemble, values)
+			}
+		})
+
+		Convey("use runs for repeated values", func() {
+			values := make([]int32, 100)
+			So(encodeRLE(nil, values, 1), ShouldResemble, []byte{200, 1, 0})
+		})
+
+		Convey("are decoded from the example of the format", func() {
+			// the bit-packed values 0 to 7 with a width of 3
+			data := []byte{3, 0x88, 0xC6, 0xFA}
+			decoded, err := decodeRLE(data, 3, 8)
+			So(err, ShouldBeNil)
+			So(decoded, ShouldResemble, []int32{0, 1, 2, 3, 4, 5, 6, 7})
+		})
+
+		Convey("fail on truncated data", func() {
+			_, err := decodeRLE([]byte{200}, 1, 100)
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
+
+func TestDeltaEncodings(t *testing.T) {
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("Values encoded with the delta encodings are decoded", t, func() {
+		Convey("for constant deltas", func() {
+			data := []byte{0x80, 0x01, 0x04, 0x05, 0x02, 0x02, 0, 0, 0, 0}
+			values, n, err := decodeDeltaBinaryPacked(data)
+			So(err, ShouldBeNil)
+			So(values, ShouldResemble, []int64{1, 2, 3, 4, 5})
+			So(n, ShouldEqual, len(data))
+		})
+
+		Convey("for varying deltas", func() {
+			data := []byte{0x80, 0x01, 0x04, 0x08, 0x0E, 0x03, 0x02, 0, 0, 0,
+				0xC0, 0x3F, 0, 0, 0, 0, 0, 0}
+			values, n, err := decodeDeltaBinaryPacked(data)
+			So(err, ShouldBeNil)
+			So(values, ShouldResemble, []int64{7, 5, 3, 1, 2, 3, 4, 5})
+			So(n, ShouldEqual, len(data))
+		})
+
+		Convey("for byte arrays sharing prefixes", func() {
+			// the prefix lengths 0, 5 and 4, the suffix lengths 5, 2 and 1,
+			// and the suffixes
+			prefixLengths := []byte{0x80, 0x01, 0x04, 0x03, 0x00, 0x01, 0x03, 0, 0, 0,
+				0x06, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0}
+			suffixLengths := []byte{0x80, 0x01, 0x04, 0x03, 0x0A, 0x05, 0x02, 0, 0, 0,
+				0x08, 0, 0, 0, 0, 0, 0, 0}
+			data := append(append(prefixLengths, suffixLengths...), "applesty"...)
+			values, err := decodeDeltaByteArray(data)
+			So(err, ShouldBeNil)
+			So(values, ShouldResemble, [][]byte{[]byte("apple"), []byte("applest"), []byte("apply")})
+		})
+	})
+}
@@ -0,0 +1,701 @@
+package parquet
+
+import (
+	"fmt"
+)
+
+// The structs below hold the parts of the Thrift definitions of the Parquet
+// metadata that are read or written by this package. The numbers of their
+// fields are those of parquet.thrift.
+
+type fileMetaData struct {
+	Version   int32
+	Schema    []schemaElement
+	NumRows   int64
+	RowGroups []rowGroup
+	CreatedBy string
+}
+
+type schemaElement struct {
+	Type           *Type
+	TypeLength     int32
+	RepetitionType *Repetition
+	Name           string
+	NumChildren    int32
+	ConvertedType  *convertedType
+	Scale          int32
+	Precision      int32
+	LogicalType    *LogicalType
+}
+
+type rowGroup struct {
+	Columns       []columnChunk
+	TotalByteSize int64
+	NumRows       int64
+}
+
+type columnChunk struct {
+	FilePath   string
+	FileOffset int64
+	MetaData   *columnMetaData
+}
+
+type columnMetaData struct {
+	Type                  Type
+	Encodings             []encoding
+	PathInSchema          []string
+	Codec                 Codec
+	NumValues             int64
+	TotalUncompressedSize int64
+	TotalCompressedSize   int64
+	DataPageOffset        int64
+	DictionaryPageOffset  int64
+}
+
+type pageHeader struct {
+	Type                 pageType
+	UncompressedPageSize int32
+	CompressedPageSize   int32
+	DataPageHeader       *dataPageHeader
+	DictionaryPageHeader *dictionaryPageHeader
+	DataPageHeaderV2     *dataPageHeaderV2
+}
+
+type dataPageHeader struct {
+	NumValues               int32
+	Encoding                encoding
+	DefinitionLevelEncoding encoding
+	RepetitionLevelEncoding encoding
+}
+
+type dictionaryPageHeader struct {
+	NumValues int32
+	Encoding  encoding
+}
+
+type dataPageHeaderV2 struct {
+	NumValues                  int32
+	NumNulls                   int32
+	NumRows                    int32
+	Encoding                   encoding
+	DefinitionLevelsByteLength int32
+	RepetitionLevelsByteLength int32
+	IsCompressed               bool
+}
+
+// convertedType is the annotation that logical types replace, which is still
+// read from and written to files for compatibility with older readers.
+type convertedType int32
+
+const (
+	convertedUTF8            convertedType = 0
+	convertedMap             convertedType = 1
+	convertedMapKeyValue     convertedType = 2
+	convertedList            convertedType = 3
+	convertedEnum            convertedType = 4
+	convertedDecimal         convertedType = 5
+	convertedDate            convertedType = 6
+	convertedTimeMillis      convertedType = 7
+	convertedTimeMicros      convertedType = 8
+	convertedTimestampMillis convertedType = 9
+	convertedTimestampMicros convertedType = 10
+	convertedUint8           convertedType = 11
+	convertedUint16          convertedType = 12
+	convertedUint32          convertedType = 13
+	convertedUint64          convertedType = 14
+	convertedInt8            convertedType = 15
+	convertedInt16           convertedType = 16
+	convertedInt32           convertedType = 17
+	convertedInt64           convertedType = 18
+	convertedJSON            convertedType = 19
+	convertedBSON            convertedType = 20
+	convertedInterval        convertedType = 21
+)
+
+// logicalFromConverted returns the logical type of a converted type.
+func logicalFromConverted(c convertedType, precision, scale int32) (LogicalType, bool) {
+	switch c {
+	case convertedUTF8:
+		return LogicalType{Kind: LogicalString}, true
+	case convertedMap:
+		return LogicalType{Kind: LogicalMap}, true
+	case convertedMapKeyValue:
+		return LogicalType{Kind: LogicalMapKeyValue}, true
+	case convertedList:
+		return LogicalType{Kind: LogicalList}, true
+	case convertedEnum:
+		return LogicalType{Kind: LogicalEnum}, true
+	case convertedDecimal:
+		return LogicalType{Kind: LogicalDecimal, Precision: int(precision), Scale: int(scale)}, true
+	case convertedDate:
+		return LogicalType{Kind: LogicalDate}, true
+	case convertedTimeMillis:
+		return LogicalType{Kind: LogicalTime, Unit: Millis, AdjustedToUTC: true}, true
+	case convertedTimeMicros:
+		return LogicalType{Kind: LogicalTime, Unit: Micros, AdjustedToUTC: true}, true
+	case convertedTimestampMillis:
+		return LogicalType{Kind: LogicalTimestamp, Unit: Millis, AdjustedToUTC: true}, true
+	case convertedTimestampMicros:
+		return LogicalType{Kind: LogicalTimestamp, Unit: Micros, AdjustedToUTC: true}, true
+	case convertedUint8, convertedUint16, convertedUint32, convertedUint64:
+		return LogicalType{Kind: LogicalInteger, BitWidth: 8 << uint(c-convertedUint8)}, true
+	case convertedInt8, convertedInt16, convertedInt32, convertedInt64:
+		return LogicalType{Kind: LogicalInteger, BitWidth: 8 << uint(c-convertedInt8), Signed: true}, true
+	case convertedJSON:
+		return LogicalType{Kind: LogicalJSON}, true
+	case convertedBSON:
+		return LogicalType{Kind: LogicalBSON}, true
+	case convertedInterval:
+		return LogicalType{Kind: LogicalInterval}, true
+	}
+	return LogicalType{}, false
+}
+
+// convertedFromLogical returns the converted type of a logical type, if it
+// has one.
+func convertedFromLogical(l LogicalType) (convertedType, bool) {
+	switch l.Kind {
+	case LogicalString:
+		return convertedUTF8, true
+	case LogicalMap:
+		return convertedMap, true
+	case LogicalMapKeyValue:
+		return convertedMapKeyValue, true
+	case LogicalList:
+		return convertedList, true
+	case LogicalEnum:
+		return convertedEnum, true
+	case LogicalDecimal:
+		return convertedDecimal, true
+	case LogicalDate:
+		return convertedDate, true
+	case LogicalTime:
+		if l.AdjustedToUTC && l.Unit == Millis {
+			return convertedTimeMillis, true
+		}
+		if l.AdjustedToUTC && l.Unit == Micros {
+			return convertedTimeMicros, true
+		}
+	case LogicalTimestamp:
+		if l.AdjustedToUTC && l.Unit == Millis {
+			return convertedTimestampMillis, true
+		}
+		if l.AdjustedToUTC && l.Unit == Micros {
+			return convertedTimestampMicros, true
+		}
+	case LogicalInteger:
+		shift := convertedType(0)
+		for width := l.BitWidth; width > 8; width >>= 1 {
+			shift++
+		}
+		if l.Signed {
+			return convertedInt8 + shift, true
+		}
+		return convertedUint8 + shift, true
+	case LogicalJSON:
+		return convertedJSON, true
+	case LogicalBSON:
+		return convertedBSON, true
+	case LogicalInterval:
+		return convertedInterval, true
+	}
+	return 0, false
+}
+
+// logicalUnion maps the kinds of logical types to the ids of the fields of
+// the LogicalType union. MAP_KEY_VALUE and INTERVAL only exist as converted
+// types.
+var logicalUnion = map[LogicalKind]int16{
+	LogicalString:    1,
+	LogicalMap:       2,
+	LogicalList:      3,
+	LogicalEnum:      4,
+	LogicalDecimal:   5,
+	LogicalDate:      6,
+	LogicalTime:      7,
+	LogicalTimestamp: 8,
+	LogicalInteger:   10,
+	LogicalJSON:      12,
+	LogicalBSON:      13,
+	LogicalUUID:      14,
+}
+
+func readFileMetaData(data []byte) (*fileMetaData, error) {
+	r := &thriftReader{data: data}
+	m := &fileMetaData{}
+	r.readStruct(func(id int16, fieldType byte) {
+		switch {
+		case id == 1 && fieldType == thriftI32:
+			m.Version = r.readI32()
+		case id == 2 && fieldType == thriftList:
+			r.readList(func(elemType byte) {
+				m.Schema = append(m.Schema, r.readSchemaElement())
+			})
+		case id == 3 && fieldType == thriftI64:
+			m.NumRows = r.readI64()
+		case id == 4 && fieldType == thriftList:
+			r.readList(func(elemType byte) {
+				m.RowGroups = append(m.RowGroups, r.readRowGroup())
+			})
+		case id == 6 && fieldType == thriftBinary:
+			m.CreatedBy = r.readString()
+		default:
+			r.skip(fieldType)
+		}
+	})
+	if r.err != nil {
+		return nil, fmt.Errorf("error reading file metadata: %v", r.err)
+	}
+	return m, nil
+}
+
+func (r *thriftReader) readSchemaElement() schemaElement {
+	e := schemaElement{}
+	r.readStruct(func(id int16, fieldType byte) {
+		switch {
+		case id == 1 && fieldType == thriftI32:
+			t := Type(r.readI32())
+			e.Type = &t
+		case id == 2 && fieldType == thriftI32:
+			e.TypeLength = r.readI32()
+		case id == 3 && fieldType == thriftI32:
+			repetition := Repetition(r.readI32())
+			e.RepetitionType = &repetition
+		case id == 4 && fieldType == thriftBinary:
+			e.Name = r.readString()
+		case id == 5 && fieldType == thriftI32:
+			e.NumChildren = r.readI32()
+		case id == 6 && fieldType == thriftI32:
+			c := convertedType(r.readI32())
+			e.ConvertedType = &c
+		case id == 7 && fieldType == thriftI32:
+			e.Scale = r.readI32()
+		case id == 8 && fieldType == thriftI32:
+			e.Precision = r.readI32()
+		case id == 10 && fieldType == thriftStruct:
+			e.LogicalType = r.readLogicalType()
+		default:
+			r.skip(fieldType)
+		}
+	})
+	return e
+}
+
+// readLogicalType reads a LogicalType union, returning nil for the logical
+// types that aren't known.
+func (r *thriftReader) readLogicalType() *LogicalType {
+	var logical *LogicalType
+	r.readStruct(func(id int16, fieldType byte) {
+		if fieldType != thriftStruct {
+			r.skip(fieldType)
+			return
+		}
+		for kind, unionID := range logicalUnion {
+			if unionID == id {
+				logical = &LogicalType{Kind: kind}
+			}
+		}
+		if logical == nil {
+			r.skip(fieldType)
+			return
+		}
+		r.readStruct(func(id int16, fieldType byte) {
+			switch logical.Kind {
+			case LogicalDecimal:
+				switch {
+				case id == 1 && fieldType == thriftI32:
+					logical.Scale = int(r.readI32())
+					return
+				case id == 2 && fieldType == thriftI32:
+					logical.Precision = int(r.readI32())
+					return
+				}
+			case LogicalTime, LogicalTimestamp:
+				switch {
+				case id == 1 && (fieldType == thriftBooleanTrue || fieldType == thriftBooleanFalse):
+					logical.AdjustedToUTC = r.readBool(fieldType)
+					return
+				case id == 2 && fieldType == thriftStruct:
+					r.readStruct(func(id int16, fieldType byte) {
+						logical.Unit = TimeUnit(id - 1)
+						r.skip(fieldType)
+					})
+					return
+				}
+			case LogicalInteger:
+				switch {
+				case id == 1 && fieldType == thriftByte:
+					logical.BitWidth = int(int8(r.readByte()))
+					return
+				case id == 2 && (fieldType == thriftBooleanTrue || fieldType == thriftBooleanFalse):
+					logical.Signed = r.readBool(fieldType)
+					return
+				}
+			}
+			r.skip(fieldType)
+		})
+	})
+	return logical
+}
+
+func (r *thriftReader) readRowGroup() rowGroup {
+	g := rowGroup{}
+	r.readStruct(func(id int16, fieldType byte) {
+		switch {
+		case id == 1 && fieldType == thriftList:
+			r.readList(func(elemType byte) {
+				g.Columns = append(g.Columns, r.readColumnChunk())
+			})
+		case id == 2 && fieldType == thriftI64:
+			g.TotalByteSize = r.readI64()
+		case id == 3 && fieldType == thriftI64:
+			g.NumRows = r.readI64()
+		default:
+			r.skip(fieldType)
+		}
+	})
+	return g
+}
+
+func (r *thriftReader) readColumnChunk() columnChunk {
+	c := columnChunk{}
+	r.readStruct(func(id int16, fieldType byte) {
+		switch {
+		case id == 1 && fieldType == thriftBinary:
+			c.FilePath = r.readString()
+		case id == 2 && fieldType == thriftI64:
+			c.FileOffset = r.readI64()
+		case id == 3 && fieldType == thriftStruct:
+			c.MetaData = r.readColumnMetaData()
+		default:
+			r.skip(fieldType)
+		}
+	})
+	return c
+}
+
+func (r *thriftReader) readColumnMetaData() *columnMetaData {
+	m := &columnMetaData{}
+	r.readStruct(func(id int16, fieldType byte) {
+		switch {
+		case id == 1 && fieldType == thriftI32:
+			m.Type = Type(r.readI32())
+		case id == 2 && fieldType == thriftList:
+			r.readList(func(elemType byte) {
+				m.Encodings = append(m.Encodings, encoding(r.readI32()))
+			})
+		case id == 3 && fieldType == thriftList:
+			r.readList(func(elemType byte) {
+				m.PathInSchema = append(m.PathInSchema, r.readString())
+			})
+		case id == 4 && fieldType == thriftI32:
+			m.Codec = Codec(r.readI32())
+		case id == 5 && fieldType == thriftI64:
+			m.NumValues = r.readI64()
+		case id == 6 && fieldType == thriftI64:
+			m.TotalUncompressedSize = r.readI64()
+		case id == 7 && fieldType == thriftI64:
+			m.TotalCompressedSize = r.readI64()
+		case id == 9 && fieldType == thriftI64:
+			m.DataPageOffset = r.readI64()
+		case id == 11 && fieldType == thriftI64:
+			m.DictionaryPageOffset = r.readI64()
+		default:
+			r.skip(fieldType)
+		}
+	})
+	return m
+}
+
+// readPageHeader reads the header of a page from the beginning of data,
+// returning the header and its length.
+func readPageHeader(data []byte) (*pageHeader, int, error) {
+	r := &thriftReader{data: data}
+	h := &pageHeader{}
+	r.readStruct(func(id int16, fieldType byte) {
+		switch {
+		case id == 1 && fieldType == thriftI32:
+			h.Type = pageType(r.readI32())
+		case id == 2 && fieldType == thriftI32:
+			h.UncompressedPageSize = r.readI32()
+		case id == 3 && fieldType == thriftI32:
+			h.CompressedPageSize = r.readI32()
+		case id == 5 && fieldType == thriftStruct:
+			d := &dataPageHeader{}
+			r.readStruct(func(id int16, fieldType byte) {
+				switch {
+				case id == 1 && fieldType == thriftI32:
+					d.NumValues = r.readI32()
+				case id == 2 && fieldType == thriftI32:
+					d.Encoding = encoding(r.readI32())
+				case id == 3 && fieldType == thriftI32:
+					d.DefinitionLevelEncoding = encoding(r.readI32())
+				case id == 4 && fieldType == thriftI32:
+					d.RepetitionLevelEncoding = encoding(r.readI32())
+				default:
+					r.skip(fieldType)
+				}
+			})
+			h.DataPageHeader = d
+		case id == 7 && fieldType == thriftStruct:
+			d := &dictionaryPageHeader{}
+			r.readStruct(func(id int16, fieldType byte) {
+				switch {
+				case id == 1 && fieldType == thriftI32:
+					d.NumValues = r.readI32()
+				case id == 2 && fieldType == thriftI32:
+					d.Encoding = encoding(r.readI32())
+				default:
+					r.skip(fieldType)
+				}
+			})
+			h.DictionaryPageHeader = d
+		case id == 8 && fieldType == thriftStruct:
+			d := &dataPageHeaderV2{IsCompressed: true}
+			r.readStruct(func(id int16, fieldType byte) {
+				switch {
+				case id == 1 && fieldType == thriftI32:
+					d.NumValues = r.readI32()
+				case id == 2 && fieldType == thriftI32:
+					d.NumNulls = r.readI32()
+				case id == 3 && fieldType == thriftI32:
+					d.NumRows = r.readI32()
+				case id == 4 && fieldType == thriftI32:
+					d.Encoding = encoding(r.readI32())
+				case id == 5 && fieldType == thriftI32:
+					d.DefinitionLevelsByteLength = r.readI32()
+				case id == 6 && fieldType == thriftI32:
+					d.RepetitionLevelsByteLength = r.readI32()
+				case id == 7 && (fieldType == thriftBooleanTrue || fieldType == thriftBooleanFalse):
+					d.IsCompressed = r.readBool(fieldType)
+				default:
+					r.skip(fieldType)
+				}
+			})
+			h.DataPageHeaderV2 = d
+		default:
+			r.skip(fieldType)
+		}
+	})
+	if r.err != nil {
+		return nil, 0, fmt.Errorf("error reading page header: %v", r.err)
+	}
+	return h, r.pos, nil
+}
+
+func (m *fileMetaData) write(w *thriftWriter) {
+	w.structBegin()
+	w.i32Field(1, m.Version)
+	w.listField(2, thriftStruct, len(m.Schema))
+	for _, e := range m.Schema {
+		e.write(w)
+	}
+	w.i64Field(3, m.NumRows)
+	w.listField(4, thriftStruct, len(m.RowGroups))
+	for _, g := range m.RowGroups {
+		g.write(w)
+	}
+	if m.CreatedBy != "" {
+		w.stringField(6, m.CreatedBy)
+	}
+	w.structEnd()
+}
+
+func (e *schemaElement) write(w *thriftWriter) {
+	w.structBegin()
+	if e.Type != nil {
+		w.i32Field(1, int32(*e.Type))
+		if *e.Type == FixedLenByteArray {
+			w.i32Field(2, e.TypeLength)
+		}
+	}
+	if e.RepetitionType != nil {
+		w.i32Field(3, int32(*e.RepetitionType))
+	}
+	w.stringField(4, e.Name)
+	if e.Type == nil {
+		w.i32Field(5, e.NumChildren)
+	}
+	if e.ConvertedType != nil {
+		w.i32Field(6, int32(*e.ConvertedType))
+		if *e.ConvertedType == convertedDecimal {
+			w.i32Field(7, e.Scale)
+			w.i32Field(8, e.Precision)
+		}
+	}
+	if e.LogicalType != nil {
+		if unionID, ok := logicalUnion[e.LogicalType.Kind]; ok {
+			w.structField(10)
+			writeLogicalType(w, unionID, e.LogicalType)
+			w.structEnd()
+		}
+	}
+	w.structEnd()
+}
+
+func writeLogicalType(w *thriftWriter, unionID int16, l *LogicalType) {
+	w.structField(unionID)
+	switch l.Kind {
+	case LogicalDecimal:
+		w.i32Field(1, int32(l.Scale))
+		w.i32Field(2, int32(l.Precision))
+	case LogicalTime, LogicalTimestamp:
+		w.boolField(1, l.AdjustedToUTC)
+		w.structField(2)
+		w.structField(int16(l.Unit) + 1)
+		w.structEnd()
+		w.structEnd()
+	case LogicalInteger:
+		w.fieldHeader(1, thriftByte)
+		w.buf = append(w.buf, byte(l.BitWidth))
+		w.boolField(2, l.Signed)
+	}
+	w.structEnd()
+}
+
+func (g *rowGroup) write(w *thriftWriter) {
+	w.structBegin()
+	w.listField(1, thriftStruct, len(g.Columns))
+	for _, c := range g.Columns {
+		w.structBegin()
+		w.i64Field(2, c.FileOffset)
+		w.structField(3)
+		c.MetaData.write(w)
+		w.structEnd()
+		w.structEnd()
+	}
+	w.i64Field(2, g.TotalByteSize)
+	w.i64Field(3, g.NumRows)
+	w.structEnd()
+}
+
+// write writes the fields of the column metadata, in a struct begun by the
+// caller.
+func (m *columnMetaData) write(w *thriftWriter) {
+	w.i32Field(1, int32(m.Type))
+	w.listField(2, thriftI32, len(m.Encodings))
+	for _, e := range m.Encodings {
+		w.writeVarint(int64(e))
+	}
+	w.listField(3, thriftBinary, len(m.PathInSchema))
+	for _, name := range m.PathInSchema {
+		w.writeBinary([]byte(name))
+	}
+	w.i32Field(4, int32(m.Codec))
+	w.i64Field(5, m.NumValues)
+	w.i64Field(6, m.TotalUncompressedSize)
+	w.i64Field(7, m.TotalCompressedSize)
+	w.i64Field(9, m.DataPageOffset)
+	if m.DictionaryPageOffset > 0 {
+		w.i64Field(11, m.DictionaryPageOffset)
+	}
+}
+
+func (h *pageHeader) write(w *thriftWriter) {
+	w.structBegin()
+	w.i32Field(1, int32(h.Type))
+	w.i32Field(2, h.UncompressedPageSize)
+	w.i32Field(3, h.CompressedPageSize)
+	if d := h.DataPageHeader; d != nil {
+		w.structField(5)
+		w.i32Field(1, d.NumValues)
+		w.i32Field(2, int32(d.Encoding))
+		w.i32Field(3, int32(d.DefinitionLevelEncoding))
+		w.i32Field(4, int32(d.RepetitionLevelEncoding))
+		w.structEnd()
+	}
+	w.structEnd()
+}
+
+// schemaElements flattens a schema into the depth-first list of elements it
+// is stored as in the file metadata.
+func schemaElements(root *Node) []schemaElement {
+	var elements []schemaElement
+	var walk func(node *Node, isRoot bool)
+	walk = func(node *Node, isRoot bool) {
+		e := schemaElement{Name: node.Name}
+		if !isRoot {
+			repetition := node.Repetition
+			e.RepetitionType = &repetition
+		}
+		if node.IsLeaf() {
+			t := node.Type
+			e.Type = &t
+			e.TypeLength = int32(node.TypeLength)
+		} else {
+			e.NumChildren = int32(len(node.Children))
+		}
+		if node.Logical.Kind != NoLogicalType {
+			logical := node.Logical
+			e.LogicalType = &logical
+			if c, ok := convertedFromLogical(logical); ok {
+				e.ConvertedType = &c
+				e.Precision = int32(logical.Precision)
+				e.Scale = int32(logical.Scale)
+			}
+		}
+		elements = append(elements, e)
+		for _, child := range node.Children {
+			walk(child, false)
+		}
+	}
+	walk(root, true)
+	return elements
+}
+
+// schemaFromElements rebuilds the schema tree from the depth-first list of
+// elements stored in the file metadata.
+func schemaFromElements(elements []schemaElement) (*Schema, error) {
+	pos := 0
+	var build func(depth int) (*Node, error)
+	build = func(depth int) (*Node, error) {
+		if pos >= len(elements) {
+			return nil, fmt.Errorf("schema has fewer elements than its groups have children")
+		}
+		if depth > maxThriftDepth {
+			return nil, fmt.Errorf("schema is nested too deeply")
+		}
+		e := elements[pos]
+		pos++
+		node := &Node{Name: e.Name, TypeLength: int(e.TypeLength)}
+		if e.RepetitionType != nil {
+			node.Repetition = *e.RepetitionType
+		}
+		if e.LogicalType != nil {
+			node.Logical = *e.LogicalType
+		} else if e.ConvertedType != nil {
+			node.Logical, _ = logicalFromConverted(*e.ConvertedType, e.Precision, e.Scale)
+		}
+		if e.Type != nil && e.NumChildren == 0 {
+			node.Type = *e.Type
+			// annotations that don't apply to the type are ignored, as the
+			// values can still be read
+			if validateLeaf(node) != nil {
+				node.Logical = LogicalType{}
+			}
+			return node, nil
+		}
+		if e.NumChildren <= 0 {
+			return nil, fmt.Errorf("group '%v' has no fields", e.Name)
+		}
+		for i := int32(0); i < e.NumChildren; i++ {
+			child, err := build(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			node.Children = append(node.Children, child)
+		}
+		return node, nil
+	}
+	if len(elements) == 0 {
+		return nil, fmt.Errorf("file has no schema")
+	}
+	root, err := build(0)
+	if err != nil {
+		return nil, err
+	}
+	if pos != len(elements) {
+		return nil, fmt.Errorf("schema has more elements than its groups have children")
+	}
+	return NewSchema(root)
+}
@@ -0,0 +1,163 @@
+// Package parquet reads and writes Apache Parquet files.
+//
+// Rows are read and written as Groups, which hold the values of the fields of
+// a group in schema order. The values of the fields are:
+//
+//   - nil for missing optional fields
+//   - Group for groups and MAP groups with string keys
+//   - []interface{} for repeated fields, LIST groups and MAP groups with keys
+//     of other types, whose elements are Groups with a key and a value field
+//   - bool, int32, int64, float32, float64 and []byte for the primitive types
+//   - string for STRING, ENUM and JSON annotated byte arrays
+//   - time.Time for DATE, TIMESTAMP and INT96 values, in UTC
+//   - int32, int64 and uint64 for annotated integers, in the narrowest type
+//     that holds all of their values
+//   - Decimal for DECIMAL values and UUID for UUID values
+//
+// The reader supports the PLAIN, dictionary, RLE, DELTA_BINARY_PACKED,
+// DELTA_LENGTH_BYTE_ARRAY, DELTA_BYTE_ARRAY and BYTE_STREAM_SPLIT encodings
+// in version 1 and version 2 data pages, compressed with snappy, gzip or
+// zstd, which is only supported when building with the zstd tag. The writer
+// writes PLAIN encoded version 1 data pages.
+package parquet
+
+import (
+	"fmt"
+	"strings"
+)
+
+// magic begins and ends every Parquet file.
+const magic = "PAR1"
+
+// Type is the physical type of a column.
+type Type int32
+
+// Physical types.
+const (
+	Boolean           Type = 0
+	Int32             Type = 1
+	Int64             Type = 2
+	Int96             Type = 3
+	Float             Type = 4
+	Double            Type = 5
+	ByteArray         Type = 6
+	FixedLenByteArray Type = 7
+)
+
+var typeNames = map[Type]string{
+	Boolean:           "boolean",
+	Int32:             "int32",
+	Int64:             "int64",
+	Int96:             "int96",
+	Float:             "float",
+	Double:            "double",
+	ByteArray:         "binary",
+	FixedLenByteArray: "fixed_len_byte_array",
+}
+
+func (t Type) String() string {
+	if name, ok := typeNames[t]; ok {
+		return name
+	}
+	return fmt.Sprintf("type(%d)", int32(t))
+}
+
+// Repetition is the repetition of a field.
+type Repetition int32
+
+// Field repetitions.
+const (
+	Required Repetition = 0
+	Optional Repetition = 1
+	Repeated Repetition = 2
+)
+
+var repetitionNames = map[Repetition]string{
+	Required: "required",
+	Optional: "optional",
+	Repeated: "repeated",
+}
+
+func (r Repetition) String() string {
+	if name, ok := repetitionNames[r]; ok {
+		return name
+	}
+	return fmt.Sprintf("repetition(%d)", int32(r))
+}
+
+// Codec is the compression codec of the pages of a column.
+type Codec int32
+
+// Compression codecs.
+const (
+	Uncompressed Codec = 0
+	Snappy       Codec = 1
+	Gzip         Codec = 2
+	LZO          Codec = 3
+	Brotli       Codec = 4
+	LZ4          Codec = 5
+	Zstd         Codec = 6
+	LZ4Raw       Codec = 7
+)
+
+var codecNames = map[Codec]string{
+	Uncompressed: "none",
+	Snappy:       "snappy",
+	Gzip:         "gzip",
+	LZO:          "lzo",
+	Brotli:       "brotli",
+	LZ4:          "lz4",
+	Zstd:         "zstd",
+	LZ4Raw:       "lz4_raw",
+}
+
+func (c Codec) String() string {
+	if name, ok := codecNames[c]; ok {
+		return name
+	}
+	return fmt.Sprintf("codec(%d)", int32(c))
+}
+
+// ParseCodec returns the codec with the given name, one of none, snappy, gzip
+// and zstd, if it is supported by the build.
+func ParseCodec(name string) (Codec, error) {
+	switch strings.ToLower(name) {
+	case "none", "uncompressed":
+		return Uncompressed, nil
+	case "snappy":
+		return Snappy, nil
+	case "gzip":
+		return Gzip, nil
+	case "zstd":
+		if !zstdSupported {
+			return 0, fmt.Errorf("unsupported compression codec '%v': this build does not support zstd, which requires building with -tags zstd", name)
+		}
+		return Zstd, nil
+	}
+	return 0, fmt.Errorf("unsupported compression codec '%v', must be one of none, snappy, gzip or zstd", name)
+}
+
+// encoding is the encoding of the values or levels of a page.
+type encoding int32
+
+const (
+	encodingPlain                encoding = 0
+	encodingPlainDictionary      encoding = 2
+	encodingRLE                  encoding = 3
+	encodingBitPacked            encoding = 4
+	encodingDeltaBinaryPacked    encoding = 5
+	encodingDeltaLengthByteArray encoding = 6
+	encodingDeltaByteArray       encoding = 7
+	encodingRLEDictionary        encoding = 8
+	encodingByteStreamSplit      encoding = 9
+)
+
+// pageType is the type of a page of a column chunk.
+type pageType int32
+
+const (
+	pageData       pageType = 0
+	pageIndex      pageType = 1
+	pageDictionary pageType = 2
+	pageDataV2     pageType = 3
+)
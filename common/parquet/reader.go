@@ -0,0 +1,555 @@
+package parquet
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// Reader reads the rows of a Parquet file. The columns of a row group are
+// decoded when its first row is read, and its rows are then assembled from
+// them one at a time.
+type Reader struct {
+	file     io.ReaderAt
+	size     int64
+	metadata *fileMetaData
+	schema   *Schema
+
+	// index of the next row group to decode
+	nextRowGroup int
+	// decoded columns of the current row group, and the number of its rows
+	// left to read
+	columns  []*columnData
+	rowsLeft int64
+}
+
+// columnData holds the decoded levels and values of a column chunk.
+type columnData struct {
+	col *column
+	// repetition and definition levels of the column, which are nil if the
+	// maximum level of the column is 0
+	repLevels []int32
+	defLevels []int32
+	numLevels int
+	// the values of the column that aren't null
+	values []interface{}
+	// positions of the next level and value of the next row
+	levelPos int
+	valuePos int
+	// index of the current element of each of the repeated fields on the path
+	// of the column, by their repetition level
+	indexes []int
+}
+
+// NewReader returns a Reader that reads the Parquet file of the given size
+// from file.
+func NewReader(file io.ReaderAt, size int64) (*Reader, error) {
+	if size < int64(2*len(magic)+4) {
+		return nil, fmt.Errorf("file is too small to be a parquet file")
+	}
+	header := make([]byte, len(magic))
+	if _, err := file.ReadAt(header, 0); err != nil {
+		return nil, fmt.Errorf("error reading parquet file header: %v", err)
+	}
+	trailer := make([]byte, 4+len(magic))
+	if _, err := file.ReadAt(trailer, size-int64(len(trailer))); err != nil {
+		return nil, fmt.Errorf("error reading parquet file footer: %v", err)
+	}
+	if string(trailer[4:]) == "PARE" {
+		return nil, fmt.Errorf("encrypted parquet files are not supported")
+	}
+	if string(header) != magic || string(trailer[4:]) != magic {
+		return nil, fmt.Errorf("file is not a parquet file")
+	}
+	footerLength := int64(binary.LittleEndian.Uint32(trailer))
+	if footerLength > size-int64(len(header)+len(trailer)) {
+		return nil, fmt.Errorf("parquet file footer length %v is larger than the file", footerLength)
+	}
+	footer := make([]byte, footerLength)
+	if _, err := file.ReadAt(footer, size-int64(len(trailer))-footerLength); err != nil {
+		return nil, fmt.Errorf("error reading parquet file footer: %v", err)
+	}
+	metadata, err := readFileMetaData(footer)
+	if err != nil {
+		return nil, err
+	}
+	schema, err := schemaFromElements(metadata.Schema)
+	if err != nil {
+		return nil, fmt.Errorf("invalid parquet schema: %v", err)
+	}
+	for i, rowGroup := range metadata.RowGroups {
+		if len(rowGroup.Columns) != len(schema.columns) {
+			return nil, fmt.Errorf("row group %v has %v columns instead of %v",
+				i, len(rowGroup.Columns), len(schema.columns))
+		}
+	}
+	return &Reader{
+		file:     file,
+		size:     size,
+		metadata: metadata,
+		schema:   schema,
+	}, nil
+}
+
+// Schema returns the schema of the file.
+func (r *Reader) Schema() *Schema {
+	return r.schema
+}
+
+// NumRows returns the number of rows in the file.
+func (r *Reader) NumRows() int64 {
+	return r.metadata.NumRows
+}
+
+// Read returns the next row of the file, or io.EOF once all the rows have
+// been read.
+func (r *Reader) Read() (Group, error) {
+	for r.rowsLeft == 0 {
+		if r.nextRowGroup >= len(r.metadata.RowGroups) {
+			return nil, io.EOF
+		}
+		if err := r.decodeRowGroup(r.nextRowGroup); err != nil {
+			return nil, err
+		}
+		r.nextRowGroup++
+	}
+	row := &groupBuilder{}
+	for _, c := range r.columns {
+		if err := c.assemble(row); err != nil {
+			return nil, err
+		}
+	}
+	r.rowsLeft--
+	return finishGroup(r.schema.Root, row).(Group), nil
+}
+
+// decodeRowGroup decodes the columns of a row group.
+func (r *Reader) decodeRowGroup(i int) error {
+	rowGroup := r.metadata.RowGroups[i]
+	r.columns = make([]*columnData, len(rowGroup.Columns))
+	for j, chunk := range rowGroup.Columns {
+		c, err := r.decodeColumnChunk(r.schema.columns[j], chunk)
+		if err != nil {
+			return fmt.Errorf("error reading column %v of row group %v: %v", r.schema.columns[j], i, err)
+		}
+		r.columns[j] = c
+	}
+	r.rowsLeft = rowGroup.NumRows
+	return nil
+}
+
+func (r *Reader) decodeColumnChunk(col *column, chunk columnChunk) (*columnData, error) {
+	meta := chunk.MetaData
+	if meta == nil {
+		return nil, fmt.Errorf("column chunk has no metadata")
+	}
+	if chunk.FilePath != "" {
+		return nil, fmt.Errorf("column chunks in other files are not supported")
+	}
+	if meta.Type != col.leaf().Type {
+		return nil, fmt.Errorf("column chunk has type %v instead of %v", meta.Type, col.leaf().Type)
+	}
+	start := meta.DataPageOffset
+	if meta.DictionaryPageOffset > 0 && meta.DictionaryPageOffset < start {
+		start = meta.DictionaryPageOffset
+	}
+	if start < 0 || meta.TotalCompressedSize < 0 || start+meta.TotalCompressedSize > r.size {
+		return nil, fmt.Errorf("column chunk is outside of the file")
+	}
+	data := make([]byte, meta.TotalCompressedSize)
+	if _, err := r.file.ReadAt(data, start); err != nil {
+		return nil, err
+	}
+	c := &columnData{col: col, indexes: make([]int, col.maxRep+1)}
+	var dictionary []interface{}
+	for pos := 0; int64(c.numLevels) < meta.NumValues && pos < len(data); {
+		header, n, err := readPageHeader(data[pos:])
+		if err != nil {
+			return nil, err
+		}
+		pos += n
+		if header.CompressedPageSize < 0 || int(header.CompressedPageSize) > len(data)-pos ||
+			header.UncompressedPageSize < 0 {
+			return nil, fmt.Errorf("page is outside of the column chunk")
+		}
+		page := data[pos : pos+int(header.CompressedPageSize)]
+		pos += int(header.CompressedPageSize)
+		switch {
+		case header.Type == pageDictionary && header.DictionaryPageHeader != nil:
+			if page, err = decompress(meta.Codec, page, int(header.UncompressedPageSize)); err != nil {
+				return nil, err
+			}
+			h := header.DictionaryPageHeader
+			if h.Encoding != encodingPlain && h.Encoding != encodingPlainDictionary {
+				return nil, fmt.Errorf("unsupported dictionary encoding %v", h.Encoding)
+			}
+			if dictionary, err = decodePlain(page, col.leaf().Type, col.leaf().TypeLength, int(h.NumValues)); err != nil {
+				return nil, fmt.Errorf("error decoding dictionary: %v", err)
+			}
+		case header.Type == pageData && header.DataPageHeader != nil:
+			if page, err = decompress(meta.Codec, page, int(header.UncompressedPageSize)); err != nil {
+				return nil, err
+			}
+			if err = c.decodeDataPage(header.DataPageHeader, page, dictionary); err != nil {
+				return nil, err
+			}
+		case header.Type == pageDataV2 && header.DataPageHeaderV2 != nil:
+			if err = c.decodeDataPageV2(header, meta.Codec, page, dictionary); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if int64(c.numLevels) != meta.NumValues {
+		return nil, fmt.Errorf("column chunk has %v values instead of %v", c.numLevels, meta.NumValues)
+	}
+	return c, nil
+}
+
+func (c *columnData) decodeDataPage(h *dataPageHeader, page []byte, dictionary []interface{}) error {
+	count := int(h.NumValues)
+	if count < 0 {
+		return fmt.Errorf("page has a negative number of values")
+	}
+	var repLevels, defLevels []int32
+	var n int
+	var err error
+	if c.col.maxRep > 0 {
+		if h.RepetitionLevelEncoding != encodingRLE {
+			return fmt.Errorf("unsupported repetition level encoding %v", h.RepetitionLevelEncoding)
+		}
+		if repLevels, n, err = decodeLevels(page, c.col.maxRep, count); err != nil {
+			return fmt.Errorf("error decoding repetition levels: %v", err)
+		}
+		page = page[n:]
+	}
+	if c.col.maxDef > 0 {
+		if h.DefinitionLevelEncoding != encodingRLE {
+			return fmt.Errorf("unsupported definition level encoding %v", h.DefinitionLevelEncoding)
+		}
+		if defLevels, n, err = decodeLevels(page, c.col.maxDef, count); err != nil {
+			return fmt.Errorf("error decoding definition levels: %v", err)
+		}
+		page = page[n:]
+	}
+	return c.addPage(count, repLevels, defLevels, h.Encoding, page, dictionary)
+}
+
+func (c *columnData) decodeDataPageV2(header *pageHeader, codec Codec, page []byte, dictionary []interface{}) error {
+	h := header.DataPageHeaderV2
+	count := int(h.NumValues)
+	repLength, defLength := int(h.RepetitionLevelsByteLength), int(h.DefinitionLevelsByteLength)
+	if count < 0 || repLength < 0 || defLength < 0 || repLength+defLength > len(page) {
+		return fmt.Errorf("invalid data page header")
+	}
+	var repLevels, defLevels []int32
+	var err error
+	if c.col.maxRep > 0 {
+		if repLevels, err = decodeRLE(page[:repLength], bitWidth(c.col.maxRep), count); err != nil {
+			return fmt.Errorf("error decoding repetition levels: %v", err)
+		}
+	}
+	if c.col.maxDef > 0 {
+		if defLevels, err = decodeRLE(page[repLength:repLength+defLength], bitWidth(c.col.maxDef), count); err != nil {
+			return fmt.Errorf("error decoding definition levels: %v", err)
+		}
+	}
+	values := page[repLength+defLength:]
+	if h.IsCompressed {
+		size := int(header.UncompressedPageSize) - repLength - defLength
+		if values, err = decompress(codec, values, size); err != nil {
+			return err
+		}
+	}
+	return c.addPage(count, repLevels, defLevels, h.Encoding, values, dictionary)
+}
+
+// addPage adds the levels and values of a data page to the column.
+func (c *columnData) addPage(count int, repLevels, defLevels []int32, enc encoding,
+	data []byte, dictionary []interface{}) error {
+	numValues := count
+	if defLevels != nil {
+		numValues = 0
+		for _, def := range defLevels {
+			if int(def) > c.col.maxDef {
+				return fmt.Errorf("definition level %v is larger than %v", def, c.col.maxDef)
+			}
+			if int(def) == c.col.maxDef {
+				numValues++
+			}
+		}
+	}
+	for _, rep := range repLevels {
+		if int(rep) > c.col.maxRep {
+			return fmt.Errorf("repetition level %v is larger than %v", rep, c.col.maxRep)
+		}
+	}
+	values, err := decodeValues(c.col.leaf(), enc, data, numValues, dictionary)
+	if err != nil {
+		return fmt.Errorf("error decoding values: %v", err)
+	}
+	c.repLevels = append(c.repLevels, repLevels...)
+	c.defLevels = append(c.defLevels, defLevels...)
+	c.values = append(c.values, values...)
+	c.numLevels += count
+	return nil
+}
+
+// decodeValues decodes count values of a leaf from data.
+func decodeValues(leaf *Node, enc encoding, data []byte, count int, dictionary []interface{}) ([]interface{}, error) {
+	switch enc {
+	case encodingPlain:
+		return decodePlain(data, leaf.Type, leaf.TypeLength, count)
+	case encodingPlainDictionary, encodingRLEDictionary:
+		indexes, err := decodeDictionaryIndices(data, count)
+		if err != nil {
+			return nil, err
+		}
+		values := make([]interface{}, count)
+		for i, index := range indexes {
+			if index < 0 || int(index) >= len(dictionary) {
+				return nil, fmt.Errorf("dictionary index %v is out of range", index)
+			}
+			values[i] = dictionary[index]
+		}
+		return values, nil
+	case encodingRLE:
+		if leaf.Type != Boolean {
+			return nil, fmt.Errorf("RLE encoding doesn't apply to type %v", leaf.Type)
+		}
+		levels, _, err := decodeLevels(data, 1, count)
+		if err != nil {
+			return nil, err
+		}
+		values := make([]interface{}, count)
+		for i, level := range levels {
+			values[i] = level == 1
+		}
+		return values, nil
+	case encodingDeltaBinaryPacked:
+		if leaf.Type != Int32 && leaf.Type != Int64 {
+			return nil, fmt.Errorf("DELTA_BINARY_PACKED encoding doesn't apply to type %v", leaf.Type)
+		}
+		ints, _, err := decodeDeltaBinaryPacked(data)
+		if err != nil {
+			return nil, err
+		}
+		if len(ints) < count {
+			return nil, errPageTruncated
+		}
+		values := make([]interface{}, count)
+		for i := range values {
+			if leaf.Type == Int32 {
+				values[i] = int32(ints[i])
+			} else {
+				values[i] = ints[i]
+			}
+		}
+		return values, nil
+	case encodingDeltaLengthByteArray, encodingDeltaByteArray:
+		if leaf.Type != ByteArray && leaf.Type != FixedLenByteArray {
+			return nil, fmt.Errorf("delta byte array encodings don't apply to type %v", leaf.Type)
+		}
+		var arrays [][]byte
+		var err error
+		if enc == encodingDeltaLengthByteArray {
+			arrays, _, err = decodeDeltaLengthByteArray(data)
+		} else {
+			arrays, err = decodeDeltaByteArray(data)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(arrays) < count {
+			return nil, errPageTruncated
+		}
+		values := make([]interface{}, count)
+		for i := range values {
+			values[i] = arrays[i]
+		}
+		return values, nil
+	case encodingByteStreamSplit:
+		return decodeByteStreamSplit(data, leaf.Type, leaf.TypeLength, count)
+	}
+	return nil, fmt.Errorf("unsupported encoding %v", enc)
+}
+
+// groupBuilder and listBuilder hold the values of groups and repeated fields
+// while a row is assembled.
+type groupBuilder struct {
+	fields []builderField
+}
+
+type builderField struct {
+	node  *Node
+	value interface{}
+}
+
+type listBuilder struct {
+	elements []interface{}
+}
+
+// field returns the value of the field of the group for node, adding the
+// field if the group doesn't have it yet. Fields are added in the order of
+// the columns, which is the order of the schema.
+func (g *groupBuilder) field(node *Node) *interface{} {
+	for i := len(g.fields) - 1; i >= 0; i-- {
+		if g.fields[i].node == node {
+			return &g.fields[i].value
+		}
+	}
+	g.fields = append(g.fields, builderField{node: node})
+	return &g.fields[len(g.fields)-1].value
+}
+
+// assemble adds the values of the next row of the column to row.
+func (c *columnData) assemble(row *groupBuilder) error {
+	col := c.col
+	for first := true; c.levelPos < c.numLevels; first = false {
+		rep, def := 0, col.maxDef
+		if c.repLevels != nil {
+			rep = int(c.repLevels[c.levelPos])
+		}
+		if c.defLevels != nil {
+			def = int(c.defLevels[c.levelPos])
+		}
+		if rep == 0 && !first {
+			return nil
+		}
+		if first && rep != 0 {
+			return fmt.Errorf("column %v has a row that doesn't start with a repetition level of 0", col)
+		}
+		// the repeated field at the repetition level gets a new element, and
+		// the repeated fields nested in it start over
+		c.indexes[rep]++
+		for k := rep + 1; k < len(c.indexes); k++ {
+			c.indexes[k] = 0
+		}
+		var value interface{}
+		if def == col.maxDef {
+			if c.valuePos >= len(c.values) {
+				return fmt.Errorf("column %v has fewer values than definition levels", col)
+			}
+			value = c.values[c.valuePos]
+			c.valuePos++
+		}
+		c.levelPos++
+		if err := c.place(row, def, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// place adds a value with the given definition level to the row, creating
+// the groups and elements of repeated fields on its path that the row doesn't
+// have yet.
+func (c *columnData) place(row *groupBuilder, def int, value interface{}) error {
+	col := c.col
+	current := row
+	for i, node := range col.nodes {
+		isLeaf := i == len(col.nodes)-1
+		field := current.field(node)
+		if def < col.defLevels[i] {
+			// the field is null, or an empty repeated field
+			if node.Repetition == Repeated && *field == nil {
+				*field = &listBuilder{}
+			}
+			return nil
+		}
+		if node.Repetition == Repeated {
+			list, _ := (*field).(*listBuilder)
+			if list == nil {
+				list = &listBuilder{}
+				*field = list
+			}
+			index := c.indexes[col.repLevels[i]]
+			if index > len(list.elements) {
+				return fmt.Errorf("column %v skips elements of repeated field '%v'", col, node.Name)
+			}
+			if index == len(list.elements) {
+				if isLeaf {
+					list.elements = append(list.elements, value)
+				} else {
+					list.elements = append(list.elements, &groupBuilder{})
+				}
+			}
+			if isLeaf {
+				return nil
+			}
+			current = list.elements[index].(*groupBuilder)
+			continue
+		}
+		if isLeaf {
+			*field = value
+			return nil
+		}
+		group, _ := (*field).(*groupBuilder)
+		if group == nil {
+			group = &groupBuilder{}
+			*field = group
+		}
+		current = group
+	}
+	return nil
+}
+
+// finishGroup converts an assembled group to its value.
+func finishGroup(node *Node, g *groupBuilder) interface{} {
+	group := make(Group, len(g.fields))
+	for i, f := range g.fields {
+		group[i] = Field{Name: f.node.Name, Value: finishField(f.node, f.value)}
+	}
+	if repeated, element, ok := listElement(node); ok {
+		elements, _ := group[0].Value.([]interface{})
+		if element == repeated {
+			return elements
+		}
+		for i, e := range elements {
+			if inner, ok := e.(Group); ok && len(inner) == 1 {
+				elements[i] = inner[0].Value
+			}
+		}
+		return elements
+	}
+	if _, key, _, ok := mapKeyValue(node); ok {
+		entries, _ := group[0].Value.([]interface{})
+		if !key.IsLeaf() || key.Logical.Kind != LogicalString && key.Logical.Kind != LogicalEnum {
+			return entries
+		}
+		m := make(Group, 0, len(entries))
+		for _, e := range entries {
+			entry, _ := e.(Group)
+			k, _ := entry.Get(key.Name)
+			keyString, _ := k.(string)
+			var v interface{}
+			if len(entry) > 1 {
+				v = entry[1].Value
+			}
+			m = append(m, Field{Name: keyString, Value: v})
+		}
+		return m
+	}
+	return group
+}
+
+// finishField converts the assembled value of a field to its value.
+func finishField(node *Node, v interface{}) interface{} {
+	switch b := v.(type) {
+	case nil:
+		return nil
+	case *listBuilder:
+		elements := make([]interface{}, len(b.elements))
+		for i, e := range b.elements {
+			elements[i] = finishNode(node, e)
+		}
+		return elements
+	}
+	return finishNode(node, v)
+}
+
+func finishNode(node *Node, v interface{}) interface{} {
+	if g, ok := v.(*groupBuilder); ok {
+		return finishGroup(node, g)
+	}
+	return logicalValue(node, v)
+}
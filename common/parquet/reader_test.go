@@ -0,0 +1,420 @@
+package parquet
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang/snappy"
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// readAll reads all the rows of a Parquet file.
+func readAll(data []byte) ([]Group, error) {
+	r, err := NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, err
+	}
+	var rows []Group
+	for {
+		row, err := r.Read()
+		if err == io.EOF {
+			return rows, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		rows = append(rows, row)
+	}
+}
+
+func mustParseDecimal(s string) Decimal {
+	d, err := ParseDecimal(s)
+	So(err, ShouldBeNil)
+	return d
+}
+
+func TestWriteAndRead(t *testing.T) {
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With rows written to a parquet file", t, func() {
+		schema, err := ParseSchema(testSchema)
+		So(err, ShouldBeNil)
+		when := time.Date(2018, 3, 5, 12, 30, 15, 250e6, time.UTC)
+		full := Group{
+			{"_id", "a"},
+			{"count", int64(5)},
+			{"when", when},
+			{"price", mustParseDecimal("12.5")},
+			{"tags", []interface{}{"x", nil, "y"}},
+			{"attributes", Group{{"k1", 1.5}, {"k2", nil}}},
+			{"points", []interface{}{
+				Group{{"x", int32(1)}, {"y", []interface{}{int32(1), int32(2)}}},
+				Group{{"x", 2}},
+			}},
+			{"ignored", "not in the schema"},
+		}
+		empty := Group{{"_id", "b"}, {"tags", []interface{}{}}}
+
+		Convey("the rows should be read back with the values of the schema", func() {
+			codecs := []Codec{Uncompressed, Snappy, Gzip}
+			if zstdSupported {
+				codecs = append(codecs, Zstd)
+			}
+			for _, codec := range codecs {
+				buf := &bytes.Buffer{}
+				w, err := NewWriter(buf, schema, WriterOptions{Codec: codec})
+				So(err, ShouldBeNil)
+				So(w.Write(full), ShouldBeNil)
+				So(w.Write(empty), ShouldBeNil)
+				So(w.Close(), ShouldBeNil)
+
+				rows, err := readAll(buf.Bytes())
+				So(err, ShouldBeNil)
+				So(len(rows), ShouldEqual, 2)
+				price, _ := rows[0].Get("price")
+				So(price.(Decimal).String(), ShouldEqual, "12.50")
+				rows[0][3].Value = nil
+				So(rows[0], ShouldResemble, Group{
+					{"_id", "a"},
+					{"count", int64(5)},
+					{"when", when},
+					{"price", nil},
+					{"tags", []interface{}{"x", nil, "y"}},
+					{"attributes", Group{{"k1", 1.5}, {"k2", nil}}},
+					{"points", []interface{}{
+						Group{{"x", int32(1)}, {"y", []interface{}{int32(1), int32(2)}}},
+						Group{{"x", int32(2)}, {"y", []interface{}{}}},
+					}},
+				})
+				So(rows[1], ShouldResemble, Group{
+					{"_id", "b"},
+					{"count", nil},
+					{"when", nil},
+					{"price", nil},
+					{"tags", []interface{}{}},
+					{"attributes", nil},
+					{"points", []interface{}{}},
+				})
+			}
+		})
+
+		Convey("rows should be split into row groups", func() {
+			buf := &bytes.Buffer{}
+			w, err := NewWriter(buf, schema, WriterOptions{Codec: Snappy, RowGroupSize: 1})
+			So(err, ShouldBeNil)
+			for i := 0; i < 3; i++ {
+				So(w.Write(empty), ShouldBeNil)
+			}
+			So(w.Close(), ShouldBeNil)
+			r, err := NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+			So(err, ShouldBeNil)
+			So(r.NumRows(), ShouldEqual, 3)
+			So(len(r.metadata.RowGroups), ShouldEqual, 3)
+			rows, err := readAll(buf.Bytes())
+			So(err, ShouldBeNil)
+			So(len(rows), ShouldEqual, 3)
+		})
+
+		Convey("rows that can't be written should be left out of the file", func() {
+			buf := &bytes.Buffer{}
+			w, err := NewWriter(buf, schema, WriterOptions{})
+			So(err, ShouldBeNil)
+			So(w.Write(Group{{"count", int64(1)}}), ShouldNotBeNil)
+			So(w.Write(Group{{"_id", "c"}, {"tags", []interface{}{"x"}}, {"count", "many"}}), ShouldNotBeNil)
+			So(w.Write(Group{{"_id", "c"}, {"price", mustParseDecimal("1.005")}}), ShouldNotBeNil)
+			So(w.Write(empty), ShouldBeNil)
+			So(w.Close(), ShouldBeNil)
+			rows, err := readAll(buf.Bytes())
+			So(err, ShouldBeNil)
+			So(len(rows), ShouldEqual, 1)
+			id, _ := rows[0].Get("_id")
+			So(id, ShouldEqual, "b")
+		})
+	})
+
+	Convey("Values of annotated types should be read back", t, func() {
+		schema, err := ParseSchema(`message m {
+			required int32 day (DATE);
+			required int96 legacy;
+			required int64 micros (TIMESTAMP(MICROS,false));
+			required int32 small (INTEGER(8,false));
+			required int32 unsigned (INTEGER(32,false));
+			required int64 big (INTEGER(64,false));
+			required int64 cents (DECIMAL(18,2));
+			required binary json (JSON);
+			required fixed_len_byte_array(16) id (UUID);
+			required boolean flag;
+			required float f;
+		}`)
+		So(err, ShouldBeNil)
+		before := time.Date(1969, 12, 31, 23, 59, 59, 123456000, time.UTC)
+		id := UUID{0x12, 0x34, 0x56, 0x78, 0x12, 0x34, 0x56, 0x78, 0x12, 0x34, 0x56, 0x78, 0x12, 0x34, 0x56, 0x78}
+		buf := &bytes.Buffer{}
+		w, err := NewWriter(buf, schema, WriterOptions{})
+		So(err, ShouldBeNil)
+		So(w.Write(Group{
+			{"day", before},
+			{"legacy", before},
+			{"micros", before},
+			{"small", 255},
+			{"unsigned", uint32(4294967295)},
+			{"big", uint64(18446744073709551615)},
+			{"cents", mustParseDecimal("-0.5")},
+			{"json", `{"a": 1}`},
+			{"id", id},
+			{"flag", true},
+			{"f", 1.5},
+		}), ShouldBeNil)
+		So(w.Write(Group{{"small", 256}}), ShouldNotBeNil)
+		So(w.Close(), ShouldBeNil)
+		rows, err := readAll(buf.Bytes())
+		So(err, ShouldBeNil)
+		So(len(rows), ShouldEqual, 1)
+		cents, _ := rows[0].Get("cents")
+		So(cents.(Decimal).String(), ShouldEqual, "-0.50")
+		rows[0][6].Value = nil
+		So(rows[0], ShouldResemble, Group{
+			{"day", time.Date(1969, 12, 31, 0, 0, 0, 0, time.UTC)},
+			{"legacy", before},
+			{"micros", before},
+			{"small", int32(255)},
+			{"unsigned", int64(4294967295)},
+			{"big", uint64(18446744073709551615)},
+			{"cents", nil},
+			{"json", `{"a": 1}`},
+			{"id", id},
+			{"flag", true},
+			{"f", float32(1.5)},
+		})
+		So(id.String(), ShouldEqual, "12345678-1234-5678-1234-567812345678")
+	})
+}
+
+// testPageHeader returns a page header, whose page specific header is written
+// by writeHeader.
+func testPageHeader(t pageType, uncompressed, compressed int, writeHeader func(w *thriftWriter)) []byte {
+	w := &thriftWriter{}
+	w.structBegin()
+	w.i32Field(1, int32(t))
+	w.i32Field(2, int32(uncompressed))
+	w.i32Field(3, int32(compressed))
+	writeHeader(w)
+	w.structEnd()
+	return w.buf
+}
+
+func TestReadEncodings(t *testing.T) {
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("A file with dictionary, version 2 and delta encoded pages should be read", t, func() {
+		schema, err := ParseSchema(`message m {
+			optional binary s (STRING);
+			required int64 n;
+		}`)
+		So(err, ShouldBeNil)
+		file := []byte(magic)
+
+		// the strings are dictionary encoded in a snappy compressed version 2
+		// data page
+		dictionaryOffset := int64(len(file))
+		dictionary := []byte{1, 0, 0, 0, 'a', 1, 0, 0, 0, 'b'}
+		compressedDictionary := snappy.Encode(nil, dictionary)
+		file = append(file, testPageHeader(pageDictionary, len(dictionary), len(compressedDictionary), func(w *thriftWriter) {
+			w.structField(7)
+			w.i32Field(1, 2)
+			w.i32Field(2, int32(encodingPlain))
+			w.structEnd()
+		})...)
+		file = append(file, compressedDictionary...)
+		dataOffset := int64(len(file))
+		defLevels := encodeRLE(nil, []int32{1, 0, 1, 1}, 1)
+		indexes := encodeRLE([]byte{1}, []int32{1, 0, 1}, 1)
+		compressedIndexes := snappy.Encode(nil, indexes)
+		file = append(file, testPageHeader(pageDataV2, len(defLevels)+len(indexes), len(defLevels)+len(compressedIndexes), func(w *thriftWriter) {
+			w.structField(8)
+			w.i32Field(1, 4)
+			w.i32Field(2, 1)
+			w.i32Field(3, 4)
+			w.i32Field(4, int32(encodingRLEDictionary))
+			w.i32Field(5, int32(len(defLevels)))
+			w.i32Field(6, 0)
+			w.structEnd()
+		})...)
+		file = append(file, defLevels...)
+		file = append(file, compressedIndexes...)
+		stringsChunk := columnChunk{FileOffset: dataOffset, MetaData: &columnMetaData{
+			Type:                 ByteArray,
+			Encodings:            []encoding{encodingPlain, encodingRLE, encodingRLEDictionary},
+			PathInSchema:         []string{"s"},
+			Codec:                Snappy,
+			NumValues:            4,
+			TotalCompressedSize:  int64(len(file)) - dictionaryOffset,
+			DataPageOffset:       dataOffset,
+			DictionaryPageOffset: dictionaryOffset,
+		}}
+
+		// the integers are delta encoded in a version 1 data page
+		dataOffset = int64(len(file))
+		deltas := []byte{0x80, 0x01, 0x04, 0x04, 0x02, 0x02, 0, 0, 0, 0}
+		file = append(file, testPageHeader(pageData, len(deltas), len(deltas), func(w *thriftWriter) {
+			w.structField(5)
+			w.i32Field(1, 4)
+			w.i32Field(2, int32(encodingDeltaBinaryPacked))
+			w.i32Field(3, int32(encodingRLE))
+			w.i32Field(4, int32(encodingRLE))
+			w.structEnd()
+		})...)
+		file = append(file, deltas...)
+		intsChunk := columnChunk{FileOffset: dataOffset, MetaData: &columnMetaData{
+			Type:                Int64,
+			Encodings:           []encoding{encodingDeltaBinaryPacked},
+			PathInSchema:        []string{"n"},
+			Codec:               Uncompressed,
+			NumValues:           4,
+			TotalCompressedSize: int64(len(file)) - dataOffset,
+			DataPageOffset:      dataOffset,
+		}}
+
+		metadata := &fileMetaData{
+			Version: 1,
+			Schema:  schemaElements(schema.Root),
+			NumRows: 4,
+			RowGroups: []rowGroup{
+				{Columns: []columnChunk{stringsChunk, intsChunk}, NumRows: 4},
+			},
+		}
+		w := &thriftWriter{}
+		metadata.write(w)
+		file = append(file, w.buf...)
+		file = binary.LittleEndian.AppendUint32(file, uint32(len(w.buf)))
+		file = append(file, magic...)
+
+		rows, err := readAll(file)
+		So(err, ShouldBeNil)
+		So(rows, ShouldResemble, []Group{
+			{{"s", "b"}, {"n", int64(1)}},
+			{{"s", nil}, {"n", int64(2)}},
+			{{"s", "a"}, {"n", int64(3)}},
+			{{"s", "b"}, {"n", int64(4)}},
+		})
+
+		Convey("and a truncated file should fail to be read", func() {
+			_, err := readAll(file[:len(file)-20])
+			So(err, ShouldNotBeNil)
+			_, err = readAll(append(append([]byte{}, file[:40]...), file[len(file)-8:]...))
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
+
+// readFixture reads the rows of a Parquet file in testdata, which is written
+// by pyarrow with testdata/generate_fixtures.py. The test is skipped if the
+// file hasn't been generated.
+func readFixture(t *testing.T, name string) []Group {
+	data, err := ioutil.ReadFile(filepath.Join("testdata", name))
+	if os.IsNotExist(err) {
+		t.Skipf("testdata/%v hasn't been generated with testdata/generate_fixtures.py", name)
+	}
+	So(err, ShouldBeNil)
+	rows, err := readAll(data)
+	So(err, ShouldBeNil)
+	return rows
+}
+
+func TestReadPyarrowFiles(t *testing.T) {
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	fixtures := []string{"pyarrow_none.parquet", "pyarrow_snappy.parquet", "pyarrow_gzip.parquet", "pyarrow_v2.parquet"}
+	if zstdSupported {
+		fixtures = append(fixtures, "pyarrow_zstd.parquet")
+	}
+	for _, name := range fixtures {
+		Convey("The rows of "+name+" should be read", t, func() {
+			rows := readFixture(t, name)
+			So(len(rows), ShouldEqual, 3)
+
+			// decimals are compared by their text, since the unscaled value
+			// is a big.Int
+			decimals := []string{}
+			for _, row := range rows[:2] {
+				for _, field := range []string{"dec9", "dec18"} {
+					value, ok := row.Get(field)
+					So(ok, ShouldBeTrue)
+					decimals = append(decimals, value.(Decimal).String())
+					for i := range row {
+						if row[i].Name == field {
+							row[i].Value = nil
+						}
+					}
+				}
+			}
+			So(decimals, ShouldResemble, []string{"-1234567.89", "123456789012345.678", "0.01", "-0.001"})
+
+			So(rows[0], ShouldResemble, Group{
+				{"i8", int32(-8)},
+				{"u8", int32(200)},
+				{"u32", int64(4000000000)},
+				{"i64", int64(-1 << 40)},
+				{"u64", uint64(18446744073709551615)},
+				{"f32", float32(1.5)},
+				{"f64", -2.25},
+				{"flag", true},
+				{"s", "héllo"},
+				{"bin", []byte{0x00, 0xff}},
+				{"day", time.Date(1969, 12, 31, 0, 0, 0, 0, time.UTC)},
+				{"ts_ms", time.Date(2001, 2, 3, 4, 5, 6, 789000000, time.UTC)},
+				{"ts_us", time.Date(1969, 12, 31, 23, 59, 59, 123456000, time.UTC)},
+				{"ts_ns", time.Unix(0, 1000000000123456789).UTC()},
+				// TIME values are read as they are stored
+				{"t_ms", int32(3723456)},
+				{"t_us", int64(86399999999)},
+				{"dec9", nil},
+				{"dec18", nil},
+				{"tags", []interface{}{"a", "b"}},
+				{"attrs", Group{{"x", int64(1)}, {"y", int64(2)}}},
+				{"point", Group{{"x", 1.5}, {"y", -0.5}}},
+			})
+			So(rows[1], ShouldResemble, Group{
+				{"i8", int32(127)},
+				{"u8", int32(0)},
+				{"u32", int64(0)},
+				{"i64", int64(0)},
+				{"u64", uint64(0)},
+				{"f32", float32(0)},
+				{"f64", 1e300},
+				{"flag", false},
+				{"s", ""},
+				{"bin", []byte{}},
+				{"day", time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC)},
+				{"ts_ms", time.Unix(0, 0).UTC()},
+				{"ts_us", time.Date(2038, 1, 19, 3, 14, 8, 0, time.UTC)},
+				{"ts_ns", time.Unix(0, 0).UTC()},
+				{"t_ms", int32(0)},
+				{"t_us", int64(0)},
+				{"dec9", nil},
+				{"dec18", nil},
+				{"tags", []interface{}{"c"}},
+				{"attrs", Group{{"z", int64(3)}}},
+				{"point", Group{{"x", 0.0}, {"y", 0.0}}},
+			})
+			for _, field := range rows[2] {
+				So(field.Value, ShouldBeNil)
+			}
+		})
+	}
+
+	Convey("INT96 timestamps written by pyarrow should be read", t, func() {
+		rows := readFixture(t, "pyarrow_int96.parquet")
+		So(rows, ShouldResemble, []Group{
+			{{"legacy", time.Date(1969, 12, 31, 23, 59, 59, 123456000, time.UTC)}},
+			{{"legacy", time.Date(2001, 2, 3, 4, 5, 6, 789000000, time.UTC)}},
+		})
+	})
+}
@@ -0,0 +1,671 @@
+package parquet
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// LogicalKind is the kind of a logical type annotation.
+type LogicalKind int
+
+// Logical type annotations.
+const (
+	NoLogicalType LogicalKind = iota
+	LogicalString
+	LogicalEnum
+	LogicalJSON
+	LogicalBSON
+	LogicalUUID
+	LogicalDate
+	LogicalTime
+	LogicalTimestamp
+	LogicalDecimal
+	LogicalInteger
+	LogicalInterval
+	LogicalList
+	LogicalMap
+	LogicalMapKeyValue
+)
+
+// TimeUnit is the unit of TIME and TIMESTAMP values.
+type TimeUnit int
+
+// Time units.
+const (
+	Millis TimeUnit = iota
+	Micros
+	Nanos
+)
+
+var timeUnitNames = map[TimeUnit]string{
+	Millis: "MILLIS",
+	Micros: "MICROS",
+	Nanos:  "NANOS",
+}
+
+func (u TimeUnit) String() string {
+	return timeUnitNames[u]
+}
+
+// LogicalType annotates a field with how its values should be interpreted.
+type LogicalType struct {
+	Kind LogicalKind
+	// Precision and Scale of DECIMAL values.
+	Precision, Scale int
+	// Unit of TIME and TIMESTAMP values, and whether they are in UTC.
+	Unit          TimeUnit
+	AdjustedToUTC bool
+	// BitWidth of INTEGER values, and whether they are signed.
+	BitWidth int
+	Signed   bool
+}
+
+var simpleLogicalNames = map[LogicalKind]string{
+	LogicalString:      "STRING",
+	LogicalEnum:        "ENUM",
+	LogicalJSON:        "JSON",
+	LogicalBSON:        "BSON",
+	LogicalUUID:        "UUID",
+	LogicalDate:        "DATE",
+	LogicalInterval:    "INTERVAL",
+	LogicalList:        "LIST",
+	LogicalMap:         "MAP",
+	LogicalMapKeyValue: "MAP_KEY_VALUE",
+}
+
+func (l LogicalType) String() string {
+	switch l.Kind {
+	case NoLogicalType:
+		return ""
+	case LogicalTime:
+		return fmt.Sprintf("TIME(%v,%v)", l.Unit, l.AdjustedToUTC)
+	case LogicalTimestamp:
+		return fmt.Sprintf("TIMESTAMP(%v,%v)", l.Unit, l.AdjustedToUTC)
+	case LogicalDecimal:
+		return fmt.Sprintf("DECIMAL(%v,%v)", l.Precision, l.Scale)
+	case LogicalInteger:
+		return fmt.Sprintf("INTEGER(%v,%v)", l.BitWidth, l.Signed)
+	}
+	return simpleLogicalNames[l.Kind]
+}
+
+// Node is a field of a schema. Leaf nodes hold the values of a column, and
+// group nodes hold other fields.
+type Node struct {
+	Name       string
+	Repetition Repetition
+	// Type of the values of a leaf, and TypeLength of its values if it is a
+	// FixedLenByteArray.
+	Type       Type
+	TypeLength int
+	Logical    LogicalType
+	// Children of a group, which is empty for leaves.
+	Children []*Node
+}
+
+// IsLeaf returns whether the node is a leaf.
+func (n *Node) IsLeaf() bool {
+	return len(n.Children) == 0
+}
+
+// Child returns the child of the group with the given name, or nil.
+func (n *Node) Child(name string) *Node {
+	for _, child := range n.Children {
+		if child.Name == name {
+			return child
+		}
+	}
+	return nil
+}
+
+// ListElement returns the element field of a LIST group, or nil if the node
+// isn't a LIST group.
+func (n *Node) ListElement() *Node {
+	_, element, _ := listElement(n)
+	return element
+}
+
+// MapKeyValue returns the key and value fields of a MAP group, or nil if the
+// node isn't a MAP group. The value is nil for maps that only have keys.
+func (n *Node) MapKeyValue() (key, value *Node) {
+	_, key, value, _ = mapKeyValue(n)
+	return key, value
+}
+
+// column describes the leaf of a schema that a column holds the values of.
+type column struct {
+	// path of names from the top-level field to the leaf
+	path []string
+	// nodes on the path, from the top-level field to the leaf
+	nodes []*Node
+	// definition and repetition levels of each node on the path, which are
+	// those of their values when they are present
+	defLevels []int
+	repLevels []int
+	maxDef    int
+	maxRep    int
+}
+
+func (c *column) leaf() *Node {
+	return c.nodes[len(c.nodes)-1]
+}
+
+func (c *column) String() string {
+	return strings.Join(c.path, ".")
+}
+
+// Schema is the schema of a Parquet file. The root of the schema is the group
+// holding the top-level fields, whose name is the name of the schema.
+type Schema struct {
+	Root    *Node
+	columns []*column
+}
+
+// NewSchema validates the schema with the given root and returns it.
+func NewSchema(root *Node) (*Schema, error) {
+	if root.IsLeaf() {
+		return nil, fmt.Errorf("schema '%v' has no fields", root.Name)
+	}
+	schema := &Schema{Root: root}
+	var nodes []*Node
+	var defLevels, repLevels []int
+	var walk func(node *Node, def, rep int) error
+	walk = func(node *Node, def, rep int) error {
+		if node.Name == "" {
+			return fmt.Errorf("schema has a field without a name")
+		}
+		switch node.Repetition {
+		case Required:
+		case Optional:
+			def++
+		case Repeated:
+			def++
+			rep++
+		default:
+			return fmt.Errorf("field '%v' has an invalid repetition %v", node.Name, node.Repetition)
+		}
+		nodes = append(nodes, node)
+		defLevels = append(defLevels, def)
+		repLevels = append(repLevels, rep)
+		defer func() {
+			nodes = nodes[:len(nodes)-1]
+			defLevels = defLevels[:len(defLevels)-1]
+			repLevels = repLevels[:len(repLevels)-1]
+		}()
+		if node.IsLeaf() {
+			if err := validateLeaf(node); err != nil {
+				return err
+			}
+			c := &column{
+				nodes:     append([]*Node(nil), nodes...),
+				defLevels: append([]int(nil), defLevels...),
+				repLevels: append([]int(nil), repLevels...),
+				maxDef:    def,
+				maxRep:    rep,
+			}
+			for _, n := range nodes {
+				c.path = append(c.path, n.Name)
+			}
+			schema.columns = append(schema.columns, c)
+			return nil
+		}
+		names := map[string]bool{}
+		for _, child := range node.Children {
+			if names[child.Name] {
+				return fmt.Errorf("group '%v' has more than one field named '%v'", node.Name, child.Name)
+			}
+			names[child.Name] = true
+			if err := walk(child, def, rep); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	names := map[string]bool{}
+	for _, field := range root.Children {
+		if names[field.Name] {
+			return nil, fmt.Errorf("schema has more than one field named '%v'", field.Name)
+		}
+		names[field.Name] = true
+		if err := walk(field, 0, 0); err != nil {
+			return nil, err
+		}
+	}
+	return schema, nil
+}
+
+// validateLeaf checks that the type annotation of a leaf applies to its type.
+func validateLeaf(node *Node) error {
+	if node.Type < Boolean || node.Type > FixedLenByteArray {
+		return fmt.Errorf("field '%v' has an invalid type %v", node.Name, node.Type)
+	}
+	if node.Type == FixedLenByteArray && node.TypeLength <= 0 {
+		return fmt.Errorf("field '%v' must have a positive length", node.Name)
+	}
+	valid := true
+	switch l := node.Logical; l.Kind {
+	case LogicalString, LogicalEnum, LogicalJSON, LogicalBSON:
+		valid = node.Type == ByteArray
+	case LogicalUUID:
+		valid = node.Type == FixedLenByteArray && node.TypeLength == 16
+	case LogicalDate:
+		valid = node.Type == Int32
+	case LogicalTime:
+		valid = node.Type == Int32 && l.Unit == Millis || node.Type == Int64 && l.Unit != Millis
+	case LogicalTimestamp:
+		valid = node.Type == Int64
+	case LogicalDecimal:
+		if l.Precision <= 0 || l.Scale < 0 || l.Scale > l.Precision {
+			return fmt.Errorf("field '%v' has an invalid decimal precision %v and scale %v",
+				node.Name, l.Precision, l.Scale)
+		}
+		switch node.Type {
+		case Int32:
+			valid = l.Precision <= 9
+		case Int64:
+			valid = l.Precision <= 18
+		case FixedLenByteArray:
+			valid = l.Precision <= maxDecimalPrecision(node.TypeLength)
+		case ByteArray:
+		default:
+			valid = false
+		}
+	case LogicalInteger:
+		switch l.BitWidth {
+		case 8, 16, 32:
+			valid = node.Type == Int32
+		case 64:
+			valid = node.Type == Int64
+		default:
+			valid = false
+		}
+	case LogicalInterval:
+		valid = node.Type == FixedLenByteArray && node.TypeLength == 12
+	case LogicalList, LogicalMap, LogicalMapKeyValue:
+		valid = false
+	}
+	if !valid {
+		return fmt.Errorf("field '%v' of type %v can't be annotated with %v", node.Name, node.Type, node.Logical)
+	}
+	return nil
+}
+
+// listElement returns the repeated field and the element field of a LIST
+// group, following the backward compatibility rules of the Parquet format for
+// lists written with two levels. The element is the repeated field itself in
+// lists written with two levels.
+func listElement(node *Node) (repeated, element *Node, ok bool) {
+	if node.Logical.Kind != LogicalList || len(node.Children) != 1 {
+		return nil, nil, false
+	}
+	repeated = node.Children[0]
+	if repeated.Repetition != Repeated {
+		return nil, nil, false
+	}
+	if repeated.IsLeaf() || len(repeated.Children) > 1 ||
+		repeated.Name == "array" || repeated.Name == node.Name+"_tuple" {
+		return repeated, repeated, true
+	}
+	return repeated, repeated.Children[0], true
+}
+
+// mapKeyValue returns the repeated field and the key and value fields of a
+// MAP group. The value is nil for maps that only have keys.
+func mapKeyValue(node *Node) (repeated, key, value *Node, ok bool) {
+	if node.Logical.Kind != LogicalMap && node.Logical.Kind != LogicalMapKeyValue || len(node.Children) != 1 {
+		return nil, nil, nil, false
+	}
+	repeated = node.Children[0]
+	if repeated.Repetition != Repeated || repeated.IsLeaf() || len(repeated.Children) > 2 {
+		return nil, nil, nil, false
+	}
+	key = repeated.Children[0]
+	if len(repeated.Children) == 2 {
+		value = repeated.Children[1]
+	}
+	return repeated, key, value, true
+}
+
+// String returns the schema in the message syntax used by the Parquet tools,
+// which ParseSchema parses.
+func (s *Schema) String() string {
+	buf := &bytes.Buffer{}
+	fmt.Fprintf(buf, "message %v {\n", s.Root.Name)
+	for _, field := range s.Root.Children {
+		writeNode(buf, field, "  ")
+	}
+	buf.WriteString("}\n")
+	return buf.String()
+}
+
+func writeNode(buf *bytes.Buffer, node *Node, indent string) {
+	buf.WriteString(indent)
+	buf.WriteString(node.Repetition.String())
+	switch {
+	case !node.IsLeaf():
+		buf.WriteString(" group")
+	case node.Type == FixedLenByteArray:
+		fmt.Fprintf(buf, " %v(%v)", node.Type, node.TypeLength)
+	default:
+		fmt.Fprintf(buf, " %v", node.Type)
+	}
+	fmt.Fprintf(buf, " %v", node.Name)
+	if node.Logical.Kind != NoLogicalType {
+		fmt.Fprintf(buf, " (%v)", node.Logical)
+	}
+	if node.IsLeaf() {
+		buf.WriteString(";\n")
+		return
+	}
+	buf.WriteString(" {\n")
+	for _, child := range node.Children {
+		writeNode(buf, child, indent+"  ")
+	}
+	buf.WriteString(indent + "}\n")
+}
+
+// schemaParser parses the message syntax of schemas.
+type schemaParser struct {
+	tokens []string
+	pos    int
+}
+
+// ParseSchema parses a schema written in the message syntax used by the
+// Parquet tools, such as:
+//
+//	message document {
+//	  required binary _id (STRING);
+//	  optional int64 count;
+//	  optional group tags (LIST) {
+//	    repeated group list {
+//	      optional binary element (STRING);
+//	    }
+//	  }
+//	}
+func ParseSchema(text string) (*Schema, error) {
+	p := &schemaParser{tokens: tokenizeSchema(text)}
+	if err := p.expect("message"); err != nil {
+		return nil, err
+	}
+	root := &Node{Name: p.next()}
+	if root.Name == "" {
+		return nil, fmt.Errorf("expected a message name")
+	}
+	children, err := p.parseGroup()
+	if err != nil {
+		return nil, err
+	}
+	root.Children = children
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("unexpected '%v' after the end of the message", p.tokens[p.pos])
+	}
+	return NewSchema(root)
+}
+
+func tokenizeSchema(text string) []string {
+	var tokens []string
+	start := -1
+	for i, r := range text {
+		isDelim := strings.ContainsRune("{}();,=", r)
+		isSpace := r == ' ' || r == '\t' || r == '\n' || r == '\r'
+		if isDelim || isSpace {
+			if start >= 0 {
+				tokens = append(tokens, text[start:i])
+				start = -1
+			}
+			if isDelim {
+				tokens = append(tokens, string(r))
+			}
+		} else if start < 0 {
+			start = i
+		}
+	}
+	if start >= 0 {
+		tokens = append(tokens, text[start:])
+	}
+	return tokens
+}
+
+func (p *schemaParser) peek() string {
+	if p.pos >= len(p.tokens) {
+		return ""
+	}
+	return p.tokens[p.pos]
+}
+
+func (p *schemaParser) next() string {
+	token := p.peek()
+	if token != "" {
+		p.pos++
+	}
+	return token
+}
+
+func (p *schemaParser) expect(token string) error {
+	if next := p.next(); !strings.EqualFold(next, token) {
+		if next == "" {
+			return fmt.Errorf("expected '%v' but the schema ended", token)
+		}
+		return fmt.Errorf("expected '%v' but found '%v'", token, next)
+	}
+	return nil
+}
+
+func (p *schemaParser) parseInt() (int, error) {
+	token := p.next()
+	i, err := strconv.Atoi(token)
+	if err != nil {
+		return 0, fmt.Errorf("expected a number but found '%v'", token)
+	}
+	return i, nil
+}
+
+// parseGroup parses the fields of a group, between braces.
+func (p *schemaParser) parseGroup() ([]*Node, error) {
+	if err := p.expect("{"); err != nil {
+		return nil, err
+	}
+	children := []*Node{}
+	for p.peek() != "}" {
+		if p.peek() == "" {
+			return nil, fmt.Errorf("expected '}' but the schema ended")
+		}
+		child, err := p.parseField()
+		if err != nil {
+			return nil, err
+		}
+		children = append(children, child)
+	}
+	p.next()
+	return children, nil
+}
+
+func (p *schemaParser) parseField() (*Node, error) {
+	node := &Node{}
+	switch repetition := strings.ToLower(p.next()); repetition {
+	case "required":
+		node.Repetition = Required
+	case "optional":
+		node.Repetition = Optional
+	case "repeated":
+		node.Repetition = Repeated
+	default:
+		return nil, fmt.Errorf("expected a repetition but found '%v'", repetition)
+	}
+	typeName := strings.ToLower(p.next())
+	isGroup := typeName == "group"
+	if !isGroup {
+		found := false
+		for t, name := range typeNames {
+			if name == typeName {
+				node.Type, found = t, true
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("unknown type '%v'", typeName)
+		}
+		if node.Type == FixedLenByteArray {
+			var err error
+			if err = p.expect("("); err != nil {
+				return nil, err
+			}
+			if node.TypeLength, err = p.parseInt(); err != nil {
+				return nil, err
+			}
+			if err = p.expect(")"); err != nil {
+				return nil, err
+			}
+		}
+	}
+	node.Name = p.next()
+	if node.Name == "" || strings.Contains("{}();,=", node.Name) {
+		return nil, fmt.Errorf("expected a field name but found '%v'", node.Name)
+	}
+	if p.peek() == "(" {
+		p.next()
+		logical, err := p.parseLogicalType()
+		if err != nil {
+			return nil, fmt.Errorf("invalid annotation of field '%v': %v", node.Name, err)
+		}
+		node.Logical = logical
+		if err = p.expect(")"); err != nil {
+			return nil, err
+		}
+	}
+	// field ids aren't used
+	if p.peek() == "=" {
+		p.next()
+		if _, err := p.parseInt(); err != nil {
+			return nil, err
+		}
+	}
+	if !isGroup {
+		return node, p.expect(";")
+	}
+	children, err := p.parseGroup()
+	if err != nil {
+		return nil, err
+	}
+	if len(children) == 0 {
+		return nil, fmt.Errorf("group '%v' has no fields", node.Name)
+	}
+	node.Children = children
+	return node, nil
+}
+
+// legacyIntegers are the names of the integer converted types.
+var legacyIntegers = map[string]LogicalType{
+	"INT_8":   {Kind: LogicalInteger, BitWidth: 8, Signed: true},
+	"INT_16":  {Kind: LogicalInteger, BitWidth: 16, Signed: true},
+	"INT_32":  {Kind: LogicalInteger, BitWidth: 32, Signed: true},
+	"INT_64":  {Kind: LogicalInteger, BitWidth: 64, Signed: true},
+	"UINT_8":  {Kind: LogicalInteger, BitWidth: 8},
+	"UINT_16": {Kind: LogicalInteger, BitWidth: 16},
+	"UINT_32": {Kind: LogicalInteger, BitWidth: 32},
+	"UINT_64": {Kind: LogicalInteger, BitWidth: 64},
+}
+
+// parseLogicalType parses a logical type annotation, in either its current
+// syntax or the syntax of the converted type it replaces.
+func (p *schemaParser) parseLogicalType() (LogicalType, error) {
+	name := strings.ToUpper(p.next())
+	for kind, simpleName := range simpleLogicalNames {
+		if name == simpleName {
+			return LogicalType{Kind: kind}, nil
+		}
+	}
+	if logical, ok := legacyIntegers[name]; ok {
+		return logical, nil
+	}
+	switch name {
+	case "UTF8":
+		return LogicalType{Kind: LogicalString}, nil
+	case "TIME_MILLIS":
+		return LogicalType{Kind: LogicalTime, Unit: Millis, AdjustedToUTC: true}, nil
+	case "TIME_MICROS":
+		return LogicalType{Kind: LogicalTime, Unit: Micros, AdjustedToUTC: true}, nil
+	case "TIMESTAMP_MILLIS":
+		return LogicalType{Kind: LogicalTimestamp, Unit: Millis, AdjustedToUTC: true}, nil
+	case "TIMESTAMP_MICROS":
+		return LogicalType{Kind: LogicalTimestamp, Unit: Micros, AdjustedToUTC: true}, nil
+	case "TIME", "TIMESTAMP":
+		logical := LogicalType{Kind: LogicalTime}
+		if name == "TIMESTAMP" {
+			logical.Kind = LogicalTimestamp
+		}
+		var err error
+		if logical.Unit, logical.AdjustedToUTC, err = p.parseTimeParams(); err != nil {
+			return LogicalType{}, err
+		}
+		return logical, nil
+	case "DECIMAL":
+		logical := LogicalType{Kind: LogicalDecimal}
+		var err error
+		if logical.Precision, logical.Scale, err = p.parseIntParams(); err != nil {
+			return LogicalType{}, err
+		}
+		return logical, nil
+	case "INTEGER":
+		logical := LogicalType{Kind: LogicalInteger}
+		if err := p.expect("("); err != nil {
+			return LogicalType{}, err
+		}
+		var err error
+		if logical.BitWidth, err = p.parseInt(); err != nil {
+			return LogicalType{}, err
+		}
+		if err = p.expect(","); err != nil {
+			return LogicalType{}, err
+		}
+		if logical.Signed, err = strconv.ParseBool(p.next()); err != nil {
+			return LogicalType{}, fmt.Errorf("expected true or false")
+		}
+		return logical, p.expect(")")
+	}
+	return LogicalType{}, fmt.Errorf("unknown annotation '%v'", name)
+}
+
+func (p *schemaParser) parseTimeParams() (TimeUnit, bool, error) {
+	if err := p.expect("("); err != nil {
+		return 0, false, err
+	}
+	unitName := strings.ToUpper(p.next())
+	var unit TimeUnit
+	found := false
+	for u, name := range timeUnitNames {
+		if name == unitName {
+			unit, found = u, true
+		}
+	}
+	if !found {
+		return 0, false, fmt.Errorf("unknown time unit '%v'", unitName)
+	}
+	if err := p.expect(","); err != nil {
+		return 0, false, err
+	}
+	adjustedToUTC, err := strconv.ParseBool(p.next())
+	if err != nil {
+		return 0, false, fmt.Errorf("expected true or false")
+	}
+	return unit, adjustedToUTC, p.expect(")")
+}
+
+func (p *schemaParser) parseIntParams() (int, int, error) {
+	if err := p.expect("("); err != nil {
+		return 0, 0, err
+	}
+	first, err := p.parseInt()
+	if err != nil {
+		return 0, 0, err
+	}
+	if err = p.expect(","); err != nil {
+		return 0, 0, err
+	}
+	second, err := p.parseInt()
+	if err != nil {
+		return 0, 0, err
+	}
+	return first, second, p.expect(")")
+}
@@ -0,0 +1,120 @@
+package parquet
+
+import (
+	"testing"
+
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+const testSchema = `message document {
+  required binary _id (STRING);
+  optional int64 count;
+  optional int64 when (TIMESTAMP(MILLIS,true));
+  optional fixed_len_byte_array(16) price (DECIMAL(20,2));
+  optional group tags (LIST) {
+    repeated group list {
+      optional binary element (STRING);
+    }
+  }
+  optional group attributes (MAP) {
+    repeated group key_value {
+      required binary key (STRING);
+      optional double value;
+    }
+  }
+  repeated group points {
+    required int32 x (INTEGER(16,true));
+    repeated int32 y;
+  }
+}
+`
+
+func TestParseSchema(t *testing.T) {
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("Parsing a schema", t, func() {
+		Convey("gives back the schema it was printed from", func() {
+			schema, err := ParseSchema(testSchema)
+			So(err, ShouldBeNil)
+			So(schema.String(), ShouldEqual, testSchema)
+		})
+
+		Convey("computes the levels and paths of the columns", func() {
+			schema, err := ParseSchema(testSchema)
+			So(err, ShouldBeNil)
+			So(len(schema.columns), ShouldEqual, 9)
+			y := schema.columns[8]
+			So(y.path, ShouldResemble, []string{"points", "y"})
+			So(y.maxDef, ShouldEqual, 2)
+			So(y.maxRep, ShouldEqual, 2)
+			tags := schema.columns[4]
+			So(tags.String(), ShouldEqual, "tags.list.element")
+			So(tags.defLevels, ShouldResemble, []int{1, 2, 3})
+			So(tags.repLevels, ShouldResemble, []int{0, 1, 1})
+		})
+
+		Convey("accepts the names of converted types and field ids", func() {
+			schema, err := ParseSchema(`message m {
+				optional binary s (UTF8) = 1;
+				optional int64 t (TIMESTAMP_MICROS);
+				optional int32 u (UINT_8);
+			}`)
+			So(err, ShouldBeNil)
+			So(schema.Root.Children[0].Logical, ShouldResemble, LogicalType{Kind: LogicalString})
+			So(schema.Root.Children[1].Logical, ShouldResemble,
+				LogicalType{Kind: LogicalTimestamp, Unit: Micros, AdjustedToUTC: true})
+			So(schema.Root.Children[2].Logical, ShouldResemble, LogicalType{Kind: LogicalInteger, BitWidth: 8})
+		})
+
+		Convey("fails on invalid schemas", func() {
+			for _, text := range []string{
+				``,
+				`message m {}`,
+				`message m { required int32 a }`,
+				`message m { required text a; }`,
+				`message m { optional group g {} }`,
+				`message m { required int32 a; required int64 a; }`,
+				`message m { required int32 s (STRING); }`,
+				`message m { required fixed_len_byte_array(4) d (DECIMAL(12,2)); }`,
+				`message m { required int32 a; } extra`,
+			} {
+				_, err := ParseSchema(text)
+				So(err, ShouldNotBeNil)
+			}
+		})
+	})
+}
+
+func TestSchemaElements(t *testing.T) {
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("Schemas stored in file metadata", t, func() {
+		schema, err := ParseSchema(testSchema)
+		So(err, ShouldBeNil)
+
+		Convey("are read back as the same schema", func() {
+			metadata := &fileMetaData{Schema: schemaElements(schema.Root)}
+			w := &thriftWriter{}
+			metadata.write(w)
+			read, err := readFileMetaData(w.buf)
+			So(err, ShouldBeNil)
+			readSchema, err := schemaFromElements(read.Schema)
+			So(err, ShouldBeNil)
+			So(readSchema.String(), ShouldEqual, testSchema)
+		})
+
+		Convey("fall back to converted types without logical types", func() {
+			elements := schemaElements(schema.Root)
+			for i := range elements {
+				elements[i].LogicalType = nil
+			}
+			readSchema, err := schemaFromElements(elements)
+			So(err, ShouldBeNil)
+			when := readSchema.Root.Child("when")
+			So(when.Logical, ShouldResemble, LogicalType{Kind: LogicalTimestamp, Unit: Millis, AdjustedToUTC: true})
+			price := readSchema.Root.Child("price")
+			So(price.Logical, ShouldResemble, LogicalType{Kind: LogicalDecimal, Precision: 20, Scale: 2})
+		})
+	})
+}
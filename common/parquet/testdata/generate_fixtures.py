@@ -0,0 +1,111 @@
+#!/usr/bin/env python3
+"""Writes the Parquet fixtures that reader_test.go reads, with pyarrow, so that
+the reader is tested against files written by another implementation than
+its own writer.
+
+Run it from this directory with pyarrow installed, and commit the files it
+writes:
+
+    pip install pyarrow
+    python3 generate_fixtures.py
+
+pyarrow doesn't write the ENUM, JSON, BSON, UUID and INTERVAL annotations, so
+fixtures for those would have to be written with parquet-mr.
+"""
+
+import datetime
+import decimal
+
+import pyarrow as pa
+import pyarrow.parquet as pq
+
+UTC = datetime.timezone.utc
+
+schema = pa.schema([
+    ("i8", pa.int8()),
+    ("u8", pa.uint8()),
+    ("u32", pa.uint32()),
+    ("i64", pa.int64()),
+    ("u64", pa.uint64()),
+    ("f32", pa.float32()),
+    ("f64", pa.float64()),
+    ("flag", pa.bool_()),
+    ("s", pa.string()),
+    ("bin", pa.binary()),
+    ("day", pa.date32()),
+    ("ts_ms", pa.timestamp("ms", tz="UTC")),
+    ("ts_us", pa.timestamp("us")),
+    ("ts_ns", pa.timestamp("ns", tz="UTC")),
+    ("t_ms", pa.time32("ms")),
+    ("t_us", pa.time64("us")),
+    ("dec9", pa.decimal128(9, 2)),
+    ("dec18", pa.decimal128(18, 3)),
+    ("tags", pa.list_(pa.string())),
+    ("attrs", pa.map_(pa.string(), pa.int64())),
+    ("point", pa.struct([("x", pa.float64()), ("y", pa.float64())])),
+])
+
+rows = [
+    {
+        "i8": -8,
+        "u8": 200,
+        "u32": 4000000000,
+        "i64": -(2 ** 40),
+        "u64": 2 ** 64 - 1,
+        "f32": 1.5,
+        "f64": -2.25,
+        "flag": True,
+        "s": "héllo",
+        "bin": b"\x00\xff",
+        "day": datetime.date(1969, 12, 31),
+        "ts_ms": datetime.datetime(2001, 2, 3, 4, 5, 6, 789000, tzinfo=UTC),
+        "ts_us": datetime.datetime(1969, 12, 31, 23, 59, 59, 123456),
+        "ts_ns": 1000000000123456789,
+        "t_ms": datetime.time(1, 2, 3, 456000),
+        "t_us": datetime.time(23, 59, 59, 999999),
+        "dec9": decimal.Decimal("-1234567.89"),
+        "dec18": decimal.Decimal("123456789012345.678"),
+        "tags": ["a", "b"],
+        "attrs": [("x", 1), ("y", 2)],
+        "point": {"x": 1.5, "y": -0.5},
+    },
+    {
+        "i8": 127,
+        "u8": 0,
+        "u32": 0,
+        "i64": 0,
+        "u64": 0,
+        "f32": 0.0,
+        "f64": 1e300,
+        "flag": False,
+        "s": "",
+        "bin": b"",
+        "day": datetime.date(2024, 2, 29),
+        "ts_ms": datetime.datetime(1970, 1, 1, tzinfo=UTC),
+        "ts_us": datetime.datetime(2038, 1, 19, 3, 14, 8),
+        "ts_ns": 0,
+        "t_ms": datetime.time(0, 0),
+        "t_us": datetime.time(0, 0),
+        "dec9": decimal.Decimal("0.01"),
+        "dec18": decimal.Decimal("-0.001"),
+        "tags": ["c"],
+        "attrs": [("z", 3)],
+        "point": {"x": 0.0, "y": 0.0},
+    },
+    {name: None for name in schema.names},
+]
+
+table = pa.Table.from_pylist(rows, schema=schema)
+for codec in ["none", "snappy", "gzip", "zstd"]:
+    pq.write_table(table, "pyarrow_%s.parquet" % codec, compression=codec)
+# the same rows in version 2 data pages, with values that aren't dictionary
+# encoded
+pq.write_table(table, "pyarrow_v2.parquet", data_page_version="2.0",
+               use_dictionary=False, compression="snappy")
+
+legacy = pa.table({"legacy": pa.array([
+    datetime.datetime(1969, 12, 31, 23, 59, 59, 123456),
+    datetime.datetime(2001, 2, 3, 4, 5, 6, 789000),
+], pa.timestamp("us"))})
+pq.write_table(legacy, "pyarrow_int96.parquet",
+               use_deprecated_int96_timestamps=True)
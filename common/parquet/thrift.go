@@ -0,0 +1,307 @@
+package parquet
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// The metadata of Parquet files is serialized with the Thrift compact
+// protocol. Only the parts of the protocol used by the Parquet metadata are
+// implemented here: structs, lists and the scalar types.
+
+// Thrift compact protocol type identifiers.
+const (
+	thriftStop         = 0
+	thriftBooleanTrue  = 1
+	thriftBooleanFalse = 2
+	thriftByte         = 3
+	thriftI16          = 4
+	thriftI32          = 5
+	thriftI64          = 6
+	thriftDouble       = 7
+	thriftBinary       = 8
+	thriftList         = 9
+	thriftSet          = 10
+	thriftMap          = 11
+	thriftStruct       = 12
+)
+
+// maxThriftDepth bounds the nesting of structs and lists, so that corrupt
+// metadata can't exhaust the stack.
+const maxThriftDepth = 64
+
+var errThriftTruncated = errors.New("thrift data is truncated")
+
+// thriftReader decodes Thrift compact protocol data. The first error it runs
+// into is kept in err, after which all reads return zero values.
+type thriftReader struct {
+	data  []byte
+	pos   int
+	depth int
+	err   error
+}
+
+func (r *thriftReader) fail(err error) {
+	if r.err == nil {
+		r.err = err
+	}
+}
+
+func (r *thriftReader) readByte() byte {
+	if r.err != nil {
+		return 0
+	}
+	if r.pos >= len(r.data) {
+		r.fail(errThriftTruncated)
+		return 0
+	}
+	b := r.data[r.pos]
+	r.pos++
+	return b
+}
+
+func (r *thriftReader) readUvarint() uint64 {
+	if r.err != nil {
+		return 0
+	}
+	v, n := binary.Uvarint(r.data[r.pos:])
+	if n <= 0 {
+		r.fail(errThriftTruncated)
+		return 0
+	}
+	r.pos += n
+	return v
+}
+
+func (r *thriftReader) readVarint() int64 {
+	v := r.readUvarint()
+	return int64(v>>1) ^ -int64(v&1)
+}
+
+func (r *thriftReader) readI32() int32 {
+	return int32(r.readVarint())
+}
+
+func (r *thriftReader) readI64() int64 {
+	return r.readVarint()
+}
+
+func (r *thriftReader) readDouble() float64 {
+	if r.err != nil {
+		return 0
+	}
+	if len(r.data)-r.pos < 8 {
+		r.fail(errThriftTruncated)
+		return 0
+	}
+	v := math.Float64frombits(binary.LittleEndian.Uint64(r.data[r.pos:]))
+	r.pos += 8
+	return v
+}
+
+func (r *thriftReader) readBinary() []byte {
+	length := r.readUvarint()
+	if r.err != nil {
+		return nil
+	}
+	if uint64(len(r.data)-r.pos) < length {
+		r.fail(errThriftTruncated)
+		return nil
+	}
+	v := r.data[r.pos : r.pos+int(length)]
+	r.pos += int(length)
+	return v
+}
+
+func (r *thriftReader) readString() string {
+	return string(r.readBinary())
+}
+
+// readBool reads a boolean field, whose value is encoded in its type.
+func (r *thriftReader) readBool(fieldType byte) bool {
+	return fieldType == thriftBooleanTrue
+}
+
+// readList reads the header of a list and calls readElement for each of its
+// elements.
+func (r *thriftReader) readList(readElement func(elemType byte)) {
+	header := r.readByte()
+	size := uint64(header >> 4)
+	elemType := header & 0x0F
+	if size == 15 {
+		size = r.readUvarint()
+	}
+	if r.err != nil {
+		return
+	}
+	// every element takes at least one byte
+	if size > uint64(len(r.data)-r.pos) {
+		r.fail(errThriftTruncated)
+		return
+	}
+	if r.depth++; r.depth > maxThriftDepth {
+		r.fail(errors.New("thrift data is nested too deeply"))
+		return
+	}
+	for i := uint64(0); i < size && r.err == nil; i++ {
+		readElement(elemType)
+	}
+	r.depth--
+}
+
+// readStruct reads the fields of a struct, calling readField with the id and
+// type of each of them. readField must read the value of the field, or skip
+// it if the field is unknown.
+func (r *thriftReader) readStruct(readField func(id int16, fieldType byte)) {
+	if r.depth++; r.depth > maxThriftDepth {
+		r.fail(errors.New("thrift data is nested too deeply"))
+		return
+	}
+	var lastID int16
+	for r.err == nil {
+		header := r.readByte()
+		fieldType := header & 0x0F
+		if fieldType == thriftStop {
+			break
+		}
+		id := lastID + int16(header>>4)
+		if header>>4 == 0 {
+			id = int16(r.readVarint())
+		}
+		lastID = id
+		readField(id, fieldType)
+	}
+	r.depth--
+}
+
+// readListElementBool reads a boolean list element, which unlike boolean
+// fields takes a byte of its own.
+func (r *thriftReader) readListElementBool() bool {
+	return r.readByte() == thriftBooleanTrue
+}
+
+// skip skips a value of the given type.
+func (r *thriftReader) skip(fieldType byte) {
+	switch fieldType {
+	case thriftBooleanTrue, thriftBooleanFalse:
+	case thriftByte:
+		r.readByte()
+	case thriftI16, thriftI32, thriftI64:
+		r.readVarint()
+	case thriftDouble:
+		r.readDouble()
+	case thriftBinary:
+		r.readBinary()
+	case thriftList, thriftSet:
+		r.readList(func(elemType byte) {
+			if elemType == thriftBooleanTrue || elemType == thriftBooleanFalse {
+				r.readByte()
+				return
+			}
+			r.skip(elemType)
+		})
+	case thriftMap:
+		size := r.readUvarint()
+		if size == 0 || r.err != nil {
+			return
+		}
+		types := r.readByte()
+		for i := uint64(0); i < size && r.err == nil; i++ {
+			r.skip(types >> 4)
+			r.skip(types & 0x0F)
+		}
+	case thriftStruct:
+		r.readStruct(func(id int16, fieldType byte) {
+			r.skip(fieldType)
+		})
+	default:
+		r.fail(fmt.Errorf("unknown thrift type %v", fieldType))
+	}
+}
+
+// thriftWriter encodes Thrift compact protocol data.
+type thriftWriter struct {
+	buf []byte
+	// the ids of the last fields written in each of the structs being written
+	lastIDs []int16
+}
+
+func (w *thriftWriter) writeUvarint(v uint64) {
+	w.buf = binary.AppendUvarint(w.buf, v)
+}
+
+func (w *thriftWriter) writeVarint(v int64) {
+	w.writeUvarint(uint64(v<<1) ^ uint64(v>>63))
+}
+
+func (w *thriftWriter) fieldHeader(id int16, fieldType byte) {
+	lastID := &w.lastIDs[len(w.lastIDs)-1]
+	if delta := id - *lastID; delta > 0 && delta <= 15 {
+		w.buf = append(w.buf, byte(delta)<<4|fieldType)
+	} else {
+		w.buf = append(w.buf, fieldType)
+		w.writeVarint(int64(id))
+	}
+	*lastID = id
+}
+
+func (w *thriftWriter) structBegin() {
+	w.lastIDs = append(w.lastIDs, 0)
+}
+
+func (w *thriftWriter) structEnd() {
+	w.buf = append(w.buf, thriftStop)
+	w.lastIDs = w.lastIDs[:len(w.lastIDs)-1]
+}
+
+// structField begins a struct value for a field, which is ended by structEnd.
+func (w *thriftWriter) structField(id int16) {
+	w.fieldHeader(id, thriftStruct)
+	w.structBegin()
+}
+
+func (w *thriftWriter) boolField(id int16, v bool) {
+	if v {
+		w.fieldHeader(id, thriftBooleanTrue)
+	} else {
+		w.fieldHeader(id, thriftBooleanFalse)
+	}
+}
+
+func (w *thriftWriter) i32Field(id int16, v int32) {
+	w.fieldHeader(id, thriftI32)
+	w.writeVarint(int64(v))
+}
+
+func (w *thriftWriter) i64Field(id int16, v int64) {
+	w.fieldHeader(id, thriftI64)
+	w.writeVarint(v)
+}
+
+func (w *thriftWriter) binaryField(id int16, v []byte) {
+	w.fieldHeader(id, thriftBinary)
+	w.writeBinary(v)
+}
+
+func (w *thriftWriter) stringField(id int16, v string) {
+	w.binaryField(id, []byte(v))
+}
+
+func (w *thriftWriter) writeBinary(v []byte) {
+	w.writeUvarint(uint64(len(v)))
+	w.buf = append(w.buf, v...)
+}
+
+// listField writes the header of a list of size elements of elemType, which
+// the caller then writes.
+func (w *thriftWriter) listField(id int16, elemType byte, size int) {
+	w.fieldHeader(id, thriftList)
+	if size < 15 {
+		w.buf = append(w.buf, byte(size)<<4|elemType)
+		return
+	}
+	w.buf = append(w.buf, 0xF0|elemType)
+	w.writeUvarint(uint64(size))
+}
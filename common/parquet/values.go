@@ -0,0 +1,371 @@
+package parquet
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Field is a field of a group and its value.
+type Field struct {
+	Name  string
+	Value interface{}
+}
+
+// Group holds the values of the fields of a group.
+type Group []Field
+
+// Get returns the value of the field with the given name, and whether the
+// group has that field.
+func (g Group) Get(name string) (interface{}, bool) {
+	for _, field := range g {
+		if field.Name == name {
+			return field.Value, true
+		}
+	}
+	return nil, false
+}
+
+// UUID is the value of a UUID annotated field.
+type UUID [16]byte
+
+func (u UUID) String() string {
+	s := hex.EncodeToString(u[:])
+	return s[0:8] + "-" + s[8:12] + "-" + s[12:16] + "-" + s[16:20] + "-" + s[20:]
+}
+
+// Decimal is the value of a DECIMAL annotated field, which is Unscaled times
+// ten to the power of minus Scale.
+type Decimal struct {
+	Unscaled *big.Int
+	Scale    int
+}
+
+var bigTen = big.NewInt(10)
+
+// ParseDecimal parses a decimal number, such as 12.50, -3 or 1.5E+3.
+func ParseDecimal(s string) (Decimal, error) {
+	mantissa, exponent := s, 0
+	if i := strings.IndexAny(s, "eE"); i >= 0 {
+		var err error
+		mantissa = s[:i]
+		if exponent, err = strconv.Atoi(s[i+1:]); err != nil {
+			return Decimal{}, fmt.Errorf("invalid decimal '%v'", s)
+		}
+	}
+	digits := mantissa
+	scale := 0
+	if i := strings.IndexByte(mantissa, '.'); i >= 0 {
+		digits = mantissa[:i] + mantissa[i+1:]
+		scale = len(mantissa) - i - 1
+	}
+	if digits == "" || strings.ContainsAny(digits[1:], "+-") {
+		return Decimal{}, fmt.Errorf("invalid decimal '%v'", s)
+	}
+	unscaled, ok := new(big.Int).SetString(digits, 10)
+	if !ok {
+		return Decimal{}, fmt.Errorf("invalid decimal '%v'", s)
+	}
+	return Decimal{Unscaled: unscaled, Scale: scale - exponent}, nil
+}
+
+func (d Decimal) String() string {
+	digits := new(big.Int).Abs(d.Unscaled).String()
+	if d.Scale < 0 {
+		digits += strings.Repeat("0", -d.Scale)
+	} else if d.Scale > 0 {
+		if len(digits) <= d.Scale {
+			digits = strings.Repeat("0", d.Scale-len(digits)+1) + digits
+		}
+		digits = digits[:len(digits)-d.Scale] + "." + digits[len(digits)-d.Scale:]
+	}
+	if d.Unscaled.Sign() < 0 {
+		return "-" + digits
+	}
+	return digits
+}
+
+// rescale returns the unscaled value of the decimal at the given scale and
+// precision, failing if it can't be represented exactly.
+func (d Decimal) rescale(precision, scale int) (*big.Int, error) {
+	unscaled := new(big.Int).Set(d.Unscaled)
+	if d.Scale < scale {
+		factor := new(big.Int).Exp(bigTen, big.NewInt(int64(scale-d.Scale)), nil)
+		unscaled.Mul(unscaled, factor)
+	} else if d.Scale > scale {
+		factor := new(big.Int).Exp(bigTen, big.NewInt(int64(d.Scale-scale)), nil)
+		remainder := new(big.Int)
+		unscaled.QuoRem(unscaled, factor, remainder)
+		if remainder.Sign() != 0 {
+			return nil, fmt.Errorf("decimal %v has more than %v digits after the decimal point", d, scale)
+		}
+	}
+	if len(new(big.Int).Abs(unscaled).String()) > precision {
+		return nil, fmt.Errorf("decimal %v has more than %v digits", d, precision)
+	}
+	return unscaled, nil
+}
+
+// decimalFromBytes returns the decimal with the big-endian two's complement
+// unscaled value b.
+func decimalFromBytes(b []byte, scale int) Decimal {
+	unscaled := new(big.Int).SetBytes(b)
+	if len(b) > 0 && b[0]&0x80 != 0 {
+		unscaled.Sub(unscaled, new(big.Int).Lsh(big.NewInt(1), uint(len(b)*8)))
+	}
+	return Decimal{Unscaled: unscaled, Scale: scale}
+}
+
+// decimalBytes returns the big-endian two's complement of unscaled in size
+// bytes, or in as few bytes as it fits in if size is 0.
+func decimalBytes(unscaled *big.Int, size int) []byte {
+	if size == 0 {
+		size = unscaled.BitLen()/8 + 1
+	}
+	v := unscaled
+	if v.Sign() < 0 {
+		v = new(big.Int).Add(v, new(big.Int).Lsh(big.NewInt(1), uint(size*8)))
+	}
+	return v.FillBytes(make([]byte, size))
+}
+
+// maxDecimalPrecision returns the largest precision of the decimals that fit
+// in a fixed length byte array of the given size.
+func maxDecimalPrecision(size int) int {
+	return int(math.Floor(float64(8*size-1) * math.Log10(2)))
+}
+
+// julianDayOfEpoch is the Julian day of the Unix epoch, which INT96
+// timestamps count their days from.
+const julianDayOfEpoch = 2440588
+
+// logicalValue converts a physical value read from a column to the value of
+// its leaf.
+func logicalValue(leaf *Node, v interface{}) interface{} {
+	l := leaf.Logical
+	switch v := v.(type) {
+	case int32:
+		switch {
+		case l.Kind == LogicalDate:
+			return time.Unix(int64(v)*86400, 0).UTC()
+		case l.Kind == LogicalDecimal:
+			return Decimal{Unscaled: big.NewInt(int64(v)), Scale: l.Scale}
+		case l.Kind == LogicalInteger && !l.Signed && l.BitWidth == 32:
+			return int64(uint32(v))
+		}
+	case int64:
+		switch {
+		case l.Kind == LogicalTimestamp:
+			switch l.Unit {
+			case Millis:
+				return time.Unix(v/1e3, v%1e3*1e6).UTC()
+			case Micros:
+				return time.Unix(v/1e6, v%1e6*1e3).UTC()
+			default:
+				return time.Unix(0, v).UTC()
+			}
+		case l.Kind == LogicalDecimal:
+			return Decimal{Unscaled: big.NewInt(v), Scale: l.Scale}
+		case l.Kind == LogicalInteger && !l.Signed:
+			return uint64(v)
+		}
+	case []byte:
+		switch {
+		case leaf.Type == Int96:
+			nanos := int64(binary.LittleEndian.Uint64(v))
+			days := int64(binary.LittleEndian.Uint32(v[8:])) - julianDayOfEpoch
+			return time.Unix(days*86400, nanos).UTC()
+		case l.Kind == LogicalString || l.Kind == LogicalEnum || l.Kind == LogicalJSON:
+			return string(v)
+		case l.Kind == LogicalDecimal:
+			return decimalFromBytes(v, l.Scale)
+		case l.Kind == LogicalUUID:
+			var u UUID
+			copy(u[:], v)
+			return u
+		}
+	}
+	return v
+}
+
+// physicalValue converts the value of a leaf to the physical value written to
+// its column.
+func physicalValue(leaf *Node, v interface{}) (interface{}, error) {
+	l := leaf.Logical
+	switch leaf.Type {
+	case Boolean:
+		if b, ok := v.(bool); ok {
+			return b, nil
+		}
+	case Int32, Int64:
+		switch value := v.(type) {
+		case time.Time:
+			switch {
+			case l.Kind == LogicalDate:
+				days := value.Unix() / 86400
+				if value.Unix() < 0 && value.Unix()%86400 != 0 {
+					days--
+				}
+				return int32(days), nil
+			case l.Kind == LogicalTimestamp && l.Unit == Millis:
+				return value.Unix()*1e3 + int64(value.Nanosecond()/1e6), nil
+			case l.Kind == LogicalTimestamp && l.Unit == Micros:
+				return value.Unix()*1e6 + int64(value.Nanosecond()/1e3), nil
+			case l.Kind == LogicalTimestamp:
+				return value.UnixNano(), nil
+			}
+		case Decimal:
+			if l.Kind != LogicalDecimal {
+				break
+			}
+			unscaled, err := value.rescale(l.Precision, l.Scale)
+			if err != nil {
+				return nil, err
+			}
+			if leaf.Type == Int32 {
+				return int32(unscaled.Int64()), nil
+			}
+			return unscaled.Int64(), nil
+		default:
+			return integerValue(leaf, v)
+		}
+	case Int96:
+		if t, ok := v.(time.Time); ok {
+			b := make([]byte, 12)
+			days := t.Unix() / 86400
+			if t.Unix() < 0 && t.Unix()%86400 != 0 {
+				days--
+			}
+			nanos := (t.Unix()-days*86400)*1e9 + int64(t.Nanosecond())
+			binary.LittleEndian.PutUint64(b, uint64(nanos))
+			binary.LittleEndian.PutUint32(b[8:], uint32(days+julianDayOfEpoch))
+			return b, nil
+		}
+	case Float:
+		switch value := v.(type) {
+		case float32:
+			return value, nil
+		case float64:
+			return float32(value), nil
+		case int32:
+			return float32(value), nil
+		case int64:
+			return float32(value), nil
+		case int:
+			return float32(value), nil
+		}
+	case Double:
+		switch value := v.(type) {
+		case float64:
+			return value, nil
+		case float32:
+			return float64(value), nil
+		case int32:
+			return float64(value), nil
+		case int64:
+			return float64(value), nil
+		case int:
+			return float64(value), nil
+		}
+	case ByteArray, FixedLenByteArray:
+		var b []byte
+		switch value := v.(type) {
+		case []byte:
+			b = value
+		case string:
+			b = []byte(value)
+		case UUID:
+			b = value[:]
+		case Decimal:
+			if l.Kind != LogicalDecimal {
+				return nil, fmt.Errorf("can't write a decimal to a %v field", leaf.Type)
+			}
+			unscaled, err := value.rescale(l.Precision, l.Scale)
+			if err != nil {
+				return nil, err
+			}
+			b = decimalBytes(unscaled, leaf.TypeLength)
+		default:
+			return nil, fmt.Errorf("can't write a %T value to a %v field", v, leaf.Type)
+		}
+		if leaf.Type == FixedLenByteArray && len(b) != leaf.TypeLength {
+			return nil, fmt.Errorf("can't write %v bytes to a %v(%v) field", len(b), leaf.Type, leaf.TypeLength)
+		}
+		return b, nil
+	}
+	return nil, fmt.Errorf("can't write a %T value to a %v%v field", v, leaf.Type, annotationSuffix(l))
+}
+
+func annotationSuffix(l LogicalType) string {
+	if l.Kind == NoLogicalType {
+		return ""
+	}
+	return fmt.Sprintf(" (%v)", l)
+}
+
+// integerValue converts an integer to the physical value of an Int32 or
+// Int64 leaf, checking that it is in the range of the leaf.
+func integerValue(leaf *Node, v interface{}) (interface{}, error) {
+	var i int64
+	var u uint64
+	unsigned := false
+	switch value := v.(type) {
+	case int:
+		i = int64(value)
+	case int8:
+		i = int64(value)
+	case int16:
+		i = int64(value)
+	case int32:
+		i = int64(value)
+	case int64:
+		i = value
+	case uint8:
+		i = int64(value)
+	case uint16:
+		i = int64(value)
+	case uint32:
+		i = int64(value)
+	case uint64:
+		u, unsigned = value, true
+	case uint:
+		u, unsigned = uint64(value), true
+	default:
+		return nil, fmt.Errorf("can't write a %T value to a %v%v field", v, leaf.Type, annotationSuffix(leaf.Logical))
+	}
+	bitWidth, signed := 32, true
+	if leaf.Type == Int64 {
+		bitWidth = 64
+	}
+	if l := leaf.Logical; l.Kind == LogicalInteger {
+		bitWidth, signed = l.BitWidth, l.Signed
+	}
+	outOfRange := func() error {
+		return fmt.Errorf("integer %v is out of the range of a %v%v field", v, leaf.Type, annotationSuffix(leaf.Logical))
+	}
+	if unsigned {
+		if u > math.MaxInt64 {
+			if signed || bitWidth < 64 {
+				return nil, outOfRange()
+			}
+			return int64(u), nil
+		}
+		i = int64(u)
+	}
+	if signed {
+		if bitWidth < 64 && (i < -1<<uint(bitWidth-1) || i >= 1<<uint(bitWidth-1)) {
+			return nil, outOfRange()
+		}
+	} else if i < 0 || bitWidth < 64 && i >= 1<<uint(bitWidth) {
+		return nil, outOfRange()
+	}
+	if leaf.Type == Int32 {
+		return int32(i), nil
+	}
+	return i, nil
+}
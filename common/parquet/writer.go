@@ -0,0 +1,386 @@
+package parquet
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+)
+
+// DefaultRowGroupSize is the approximate size in bytes of the encoded values of
+// a row group, before compression, past which the row group is written.
+const DefaultRowGroupSize = 64 * 1024 * 1024
+
+// WriterOptions configures how a Writer writes a file.
+type WriterOptions struct {
+	// Codec the pages are compressed with.
+	Codec Codec
+	// RowGroupSize is the approximate size in bytes of the encoded values of
+	// a row group, which defaults to DefaultRowGroupSize.
+	RowGroupSize int
+	// CreatedBy names the application that wrote the file.
+	CreatedBy string
+}
+
+// Writer writes rows to a Parquet file. Rows are buffered in memory until
+// their row group is written, with one PLAIN encoded data page per column.
+// The file is only complete once the Writer is closed.
+type Writer struct {
+	out     io.Writer
+	offset  int64
+	schema  *Schema
+	options WriterOptions
+
+	columns []*columnWriter
+	// column writers of the leaves of the schema, and of the leaves under
+	// each group
+	leaves      map[*Node]*columnWriter
+	groupLeaves map[*Node][]*columnWriter
+	// definition and repetition levels of each repeated field
+	repLevels map[*Node]int
+
+	rowGroups []rowGroup
+	numRows   int64
+	groupRows int64
+	closed    bool
+}
+
+// columnWriter buffers the levels and PLAIN encoded values of a column.
+type columnWriter struct {
+	col       *column
+	repLevels []int32
+	defLevels []int32
+	numLevels int
+	values    []byte
+	bools     []uint64
+}
+
+// NewWriter returns a Writer that writes a Parquet file with the given schema
+// to out.
+func NewWriter(out io.Writer, schema *Schema, options WriterOptions) (*Writer, error) {
+	if options.RowGroupSize <= 0 {
+		options.RowGroupSize = DefaultRowGroupSize
+	}
+	if _, err := compress(options.Codec, nil); err != nil {
+		return nil, err
+	}
+	w := &Writer{
+		out:         out,
+		schema:      schema,
+		options:     options,
+		leaves:      map[*Node]*columnWriter{},
+		groupLeaves: map[*Node][]*columnWriter{},
+		repLevels:   map[*Node]int{},
+	}
+	for _, col := range schema.columns {
+		c := &columnWriter{col: col}
+		w.columns = append(w.columns, c)
+		w.leaves[col.leaf()] = c
+		for i, node := range col.nodes {
+			w.groupLeaves[node] = append(w.groupLeaves[node], c)
+			w.repLevels[node] = col.repLevels[i]
+		}
+	}
+	if err := w.write([]byte(magic)); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+func (w *Writer) write(data []byte) error {
+	n, err := w.out.Write(data)
+	w.offset += int64(n)
+	return err
+}
+
+// Write writes a row. The values of the fields of the row that aren't in the
+// schema are ignored. LIST groups can be given as lists of their elements,
+// and MAP groups as groups of their entries, or as lists of groups holding a
+// key and a value field.
+func (w *Writer) Write(row Group) error {
+	if w.closed {
+		return fmt.Errorf("parquet writer is closed")
+	}
+	// a row that fails to be written is removed from the columns it was
+	// partly written to
+	marks := make([]columnMark, len(w.columns))
+	for i, c := range w.columns {
+		marks[i] = c.mark()
+	}
+	for _, field := range w.schema.Root.Children {
+		value, _ := row.Get(field.Name)
+		if err := w.writeField(field, value, 0, 0); err != nil {
+			for i, c := range w.columns {
+				c.rollback(marks[i])
+			}
+			return err
+		}
+	}
+	w.numRows++
+	w.groupRows++
+	size := 0
+	for _, c := range w.columns {
+		size += c.size()
+	}
+	if size >= w.options.RowGroupSize {
+		return w.writeRowGroup()
+	}
+	return nil
+}
+
+// writeField shreds the value of a field into the columns of its leaves. rep
+// and def are the repetition and definition levels of the parent of the
+// field.
+func (w *Writer) writeField(node *Node, v interface{}, rep, def int) error {
+	switch node.Repetition {
+	case Required:
+		if v == nil {
+			return fmt.Errorf("required field '%v' is missing", node.Name)
+		}
+		return w.writeNode(node, v, rep, def)
+	case Optional:
+		if v == nil {
+			w.writeNulls(node, rep, def)
+			return nil
+		}
+		return w.writeNode(node, v, rep, def+1)
+	}
+	elements, ok := v.([]interface{})
+	if v != nil && !ok {
+		return fmt.Errorf("repeated field '%v' must be a list, not a %T", node.Name, v)
+	}
+	if len(elements) == 0 {
+		w.writeNulls(node, rep, def)
+		return nil
+	}
+	for i, element := range elements {
+		if element == nil {
+			return fmt.Errorf("repeated field '%v' can't have null elements", node.Name)
+		}
+		if i > 0 {
+			rep = w.repLevels[node]
+		}
+		if err := w.writeNode(node, element, rep, def+1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeNode shreds a value of a field that isn't null.
+func (w *Writer) writeNode(node *Node, v interface{}, rep, def int) error {
+	if node.IsLeaf() {
+		return w.leaves[node].add(rep, def, v)
+	}
+	if repeated, element, ok := listElement(node); ok {
+		if elements, isList := v.([]interface{}); isList {
+			if element != repeated {
+				wrapped := make([]interface{}, len(elements))
+				for i, e := range elements {
+					wrapped[i] = Group{{Name: element.Name, Value: e}}
+				}
+				elements = wrapped
+			}
+			v = Group{{Name: repeated.Name, Value: elements}}
+		}
+	} else if repeated, key, value, ok := mapKeyValue(node); ok {
+		switch m := v.(type) {
+		case Group:
+			entries := make([]interface{}, len(m))
+			for i, field := range m {
+				entry := Group{{Name: key.Name, Value: field.Name}}
+				if value != nil {
+					entry = append(entry, Field{Name: value.Name, Value: field.Value})
+				}
+				entries[i] = entry
+			}
+			v = Group{{Name: repeated.Name, Value: entries}}
+		case []interface{}:
+			v = Group{{Name: repeated.Name, Value: m}}
+		}
+	}
+	group, ok := v.(Group)
+	if !ok {
+		return fmt.Errorf("group field '%v' must be a group, not a %T", node.Name, v)
+	}
+	for _, child := range node.Children {
+		childValue, _ := group.Get(child.Name)
+		if err := w.writeField(child, childValue, rep, def); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeNulls writes a null value to all the columns under a field.
+func (w *Writer) writeNulls(node *Node, rep, def int) {
+	for _, c := range w.groupLeaves[node] {
+		c.addLevels(rep, def)
+	}
+}
+
+// writeRowGroup writes the buffered rows as a row group.
+func (w *Writer) writeRowGroup() error {
+	if w.groupRows == 0 {
+		return nil
+	}
+	group := rowGroup{NumRows: w.groupRows}
+	for _, c := range w.columns {
+		page := c.page()
+		compressed, err := compress(w.options.Codec, page)
+		if err != nil {
+			return fmt.Errorf("error compressing column %v: %v", c.col, err)
+		}
+		header := &pageHeader{
+			Type:                 pageData,
+			UncompressedPageSize: int32(len(page)),
+			CompressedPageSize:   int32(len(compressed)),
+			DataPageHeader: &dataPageHeader{
+				NumValues:               int32(c.numLevels),
+				Encoding:                encodingPlain,
+				DefinitionLevelEncoding: encodingRLE,
+				RepetitionLevelEncoding: encodingRLE,
+			},
+		}
+		t := &thriftWriter{}
+		header.write(t)
+		offset := w.offset
+		if err = w.write(t.buf); err != nil {
+			return err
+		}
+		if err = w.write(compressed); err != nil {
+			return err
+		}
+		group.Columns = append(group.Columns, columnChunk{
+			FileOffset: offset,
+			MetaData: &columnMetaData{
+				Type:                  c.col.leaf().Type,
+				Encodings:             []encoding{encodingPlain, encodingRLE},
+				PathInSchema:          c.col.path,
+				Codec:                 w.options.Codec,
+				NumValues:             int64(c.numLevels),
+				TotalUncompressedSize: int64(len(t.buf) + len(page)),
+				TotalCompressedSize:   int64(len(t.buf) + len(compressed)),
+				DataPageOffset:        offset,
+			},
+		})
+		group.TotalByteSize += int64(len(t.buf) + len(page))
+		*c = columnWriter{col: c.col}
+	}
+	w.rowGroups = append(w.rowGroups, group)
+	w.groupRows = 0
+	return nil
+}
+
+// Close writes the buffered rows and the footer of the file. It doesn't close
+// the underlying writer.
+func (w *Writer) Close() error {
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	if err := w.writeRowGroup(); err != nil {
+		return err
+	}
+	metadata := &fileMetaData{
+		Version:   1,
+		Schema:    schemaElements(w.schema.Root),
+		NumRows:   w.numRows,
+		RowGroups: w.rowGroups,
+		CreatedBy: w.options.CreatedBy,
+	}
+	t := &thriftWriter{}
+	metadata.write(t)
+	footer := binary.LittleEndian.AppendUint32(t.buf, uint32(len(t.buf)))
+	return w.write(append(footer, magic...))
+}
+
+// columnMark records the size of the buffers of a column writer.
+type columnMark struct {
+	values, bools, numLevels int
+}
+
+func (c *columnWriter) mark() columnMark {
+	return columnMark{len(c.values), len(c.bools), c.numLevels}
+}
+
+// rollback truncates the buffers of a column writer back to a mark.
+func (c *columnWriter) rollback(m columnMark) {
+	if c.col.maxRep > 0 {
+		c.repLevels = c.repLevels[:m.numLevels]
+	}
+	if c.col.maxDef > 0 {
+		c.defLevels = c.defLevels[:m.numLevels]
+	}
+	c.values = c.values[:m.values]
+	c.bools = c.bools[:m.bools]
+	c.numLevels = m.numLevels
+}
+
+// size returns the approximate size of the encoded page of the column.
+func (c *columnWriter) size() int {
+	return len(c.values) + len(c.bools)/8 + (len(c.repLevels)+len(c.defLevels))/2
+}
+
+func (c *columnWriter) addLevels(rep, def int) {
+	if c.col.maxRep > 0 {
+		c.repLevels = append(c.repLevels, int32(rep))
+	}
+	if c.col.maxDef > 0 {
+		c.defLevels = append(c.defLevels, int32(def))
+	}
+	c.numLevels++
+}
+
+// add adds a value of the leaf to the column.
+func (c *columnWriter) add(rep, def int, v interface{}) error {
+	physical, err := physicalValue(c.col.leaf(), v)
+	if err != nil {
+		return fmt.Errorf("error writing field '%v': %v", c.col, err)
+	}
+	switch p := physical.(type) {
+	case bool:
+		bit := uint64(0)
+		if p {
+			bit = 1
+		}
+		c.bools = append(c.bools, bit)
+	case int32:
+		c.values = binary.LittleEndian.AppendUint32(c.values, uint32(p))
+	case int64:
+		c.values = binary.LittleEndian.AppendUint64(c.values, uint64(p))
+	case float32:
+		c.values = binary.LittleEndian.AppendUint32(c.values, math.Float32bits(p))
+	case float64:
+		c.values = binary.LittleEndian.AppendUint64(c.values, math.Float64bits(p))
+	case []byte:
+		if c.col.leaf().Type == ByteArray {
+			c.values = binary.LittleEndian.AppendUint32(c.values, uint32(len(p)))
+		}
+		c.values = append(c.values, p...)
+	}
+	c.addLevels(rep, def)
+	return nil
+}
+
+// page returns the uncompressed version 1 data page holding the levels and
+// values of the column.
+func (c *columnWriter) page() []byte {
+	var page []byte
+	for _, levels := range []struct {
+		values   []int32
+		maxLevel int
+	}{{c.repLevels, c.col.maxRep}, {c.defLevels, c.col.maxDef}} {
+		if levels.maxLevel == 0 {
+			continue
+		}
+		start := len(page)
+		page = append(page, 0, 0, 0, 0)
+		page = encodeRLE(page, levels.values, bitWidth(levels.maxLevel))
+		binary.LittleEndian.PutUint32(page[start:], uint32(len(page)-start-4))
+	}
+	if c.col.leaf().Type == Boolean {
+		return packBits(page, c.bools, 1)
+	}
+	return append(page, c.values...)
+}
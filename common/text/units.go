@@ -3,6 +3,8 @@ package text
 import (
 	"fmt"
 	"math"
+	"strconv"
+	"strings"
 )
 
 const (
@@ -23,6 +25,33 @@ func FormatByteAmount(size int64) string {
 	return formatUnitAmount(binary, size, 3, longByteUnits)
 }
 
+// ParseByteAmount parses a size in bytes with an optional unit, using the
+// same binary units as FormatByteAmount, e.g. 512, 100KB, 4G or 1.5GB.
+func ParseByteAmount(amount string) (int64, error) {
+	trimmed := strings.ToUpper(strings.TrimSpace(amount))
+	multiplier := int64(1)
+	for i := len(longByteUnits) - 1; i > 0; i-- {
+		unit := longByteUnits[i]
+		if strings.HasSuffix(trimmed, unit) {
+			trimmed = strings.TrimSuffix(trimmed, unit)
+		} else if strings.HasSuffix(trimmed, shortByteUnits[i]) {
+			trimmed = strings.TrimSuffix(trimmed, shortByteUnits[i])
+		} else {
+			continue
+		}
+		multiplier = int64(math.Pow(binary, float64(i)))
+		break
+	}
+	if multiplier == 1 {
+		trimmed = strings.TrimSuffix(trimmed, "B")
+	}
+	value, err := strconv.ParseFloat(strings.TrimSpace(trimmed), 64)
+	if err != nil || value < 0 {
+		return 0, fmt.Errorf("invalid byte amount '%v'", amount)
+	}
+	return int64(value * float64(multiplier)), nil
+}
+
 // FormatMegabyteAmount is equivalent to FormatByteAmount but expects
 // an amount of MB instead of bytes.
 func FormatMegabyteAmount(size int64) string {
@@ -100,3 +100,31 @@ func TestBitFormatPrecision(t *testing.T) {
 		})
 	})
 }
+
+func TestParseByteAmount(t *testing.T) {
+	Convey("With some sample byte amounts", t, func() {
+		Convey("plain numbers are bytes", func() {
+			So(mustParseByteAmount("512"), ShouldEqual, 512)
+			So(mustParseByteAmount("512B"), ShouldEqual, 512)
+		})
+		Convey("long and short units are binary", func() {
+			So(mustParseByteAmount("100KB"), ShouldEqual, 100*1024)
+			So(mustParseByteAmount("100k"), ShouldEqual, 100*1024)
+			So(mustParseByteAmount("2MB"), ShouldEqual, 2*1024*1024)
+			So(mustParseByteAmount("4G"), ShouldEqual, 4*1024*1024*1024)
+			So(mustParseByteAmount("1.5GB"), ShouldEqual, 3*512*1024*1024)
+		})
+		Convey("garbage is an error", func() {
+			for _, amount := range []string{"", "GB", "ten", "-1MB", "4TB"} {
+				_, err := ParseByteAmount(amount)
+				So(err, ShouldNotBeNil)
+			}
+		})
+	})
+}
+
+func mustParseByteAmount(amount string) int64 {
+	size, err := ParseByteAmount(amount)
+	So(err, ShouldBeNil)
+	return size
+}
@@ -0,0 +1,94 @@
+package transform
+
+import (
+	"strings"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+// asDocument returns the document in a value, as the parsers of mongoimport
+// store nested documents as either bson.D or *bson.D.
+func asDocument(value interface{}) (bson.D, bool) {
+	switch v := value.(type) {
+	case bson.D:
+		return v, true
+	case *bson.D:
+		if v != nil {
+			return *v, true
+		}
+	}
+	return nil, false
+}
+
+func indexOf(doc bson.D, name string) int {
+	for i, elem := range doc {
+		if elem.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// getPath returns the value of the field at a dotted path in a document, and
+// whether it was found.
+func getPath(doc bson.D, path string) (interface{}, bool) {
+	names := strings.Split(path, ".")
+	for i, name := range names {
+		index := indexOf(doc, name)
+		if index < 0 {
+			return nil, false
+		}
+		if i == len(names)-1 {
+			return doc[index].Value, true
+		}
+		var ok bool
+		if doc, ok = asDocument(doc[index].Value); !ok {
+			return nil, false
+		}
+	}
+	return nil, false
+}
+
+// setPath sets the field at a dotted path in a document, replacing it where
+// it is if it exists or appending it otherwise, and creating the
+// subdocuments on the way to it. A field on the way that isn't a document is
+// replaced by one.
+func setPath(doc bson.D, path string, value interface{}) bson.D {
+	name, rest := path, ""
+	if i := strings.Index(path, "."); i >= 0 {
+		name, rest = path[:i], path[i+1:]
+	}
+	index := indexOf(doc, name)
+	if rest != "" {
+		var sub bson.D
+		if index >= 0 {
+			sub, _ = asDocument(doc[index].Value)
+		}
+		value = setPath(sub, rest, value)
+	}
+	if index < 0 {
+		return append(doc, bson.DocElem{Name: name, Value: value})
+	}
+	doc[index].Value = value
+	return doc
+}
+
+// removePath removes the field at a dotted path from a document, if it
+// exists. Subdocuments left empty are kept.
+func removePath(doc bson.D, path string) bson.D {
+	name, rest := path, ""
+	if i := strings.Index(path, "."); i >= 0 {
+		name, rest = path[:i], path[i+1:]
+	}
+	index := indexOf(doc, name)
+	if index < 0 {
+		return doc
+	}
+	if rest == "" {
+		return append(doc[:index], doc[index+1:]...)
+	}
+	if sub, ok := asDocument(doc[index].Value); ok {
+		doc[index].Value = removePath(sub, rest)
+	}
+	return doc
+}
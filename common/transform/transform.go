@@ -0,0 +1,452 @@
+// Package transform reshapes documents with an ordered list of declarative
+// rules, read from a YAML or JSON file. Each rule renames, removes, splits,
+// combines or nests fields, and can be limited to the namespaces it applies to.
+package transform
+
+import (
+	"fmt"
+	"io/ioutil"
+	"math"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/mongodb/mongo-tools/common/bsonutil"
+	"github.com/mongodb/mongo-tools/common/json"
+	"github.com/mongodb/mongo-tools/common/util"
+	"gopkg.in/mgo.v2/bson"
+	"gopkg.in/yaml.v2"
+)
+
+// The operations that rules apply.
+const (
+	// OpRename moves the From field to To.
+	OpRename = "rename"
+	// OpRemove removes the Fields.
+	OpRemove = "remove"
+	// OpSplit splits the string in Field at Separator into an array in To.
+	OpSplit = "split"
+	// OpGeoPoint builds a GeoJSON point in To from a "latitude,longitude"
+	// string in From, or from the Latitude and Longitude fields, and removes
+	// them.
+	OpGeoPoint = "geoPoint"
+	// OpConcat joins the values of the Fields with Separator into To.
+	OpConcat = "concat"
+	// OpNest moves the Fields, or the fields starting with Prefix without it,
+	// into the subdocument To.
+	OpNest = "nest"
+	// OpSet sets Field to Value.
+	OpSet = "set"
+)
+
+// ruleOptions are the options that each operation takes, and whether they
+// are required.
+var ruleOptions = map[string]map[string]bool{
+	OpRename:   {"from": true, "to": true},
+	OpRemove:   {"fields": true},
+	OpSplit:    {"field": true, "separator": false, "to": false},
+	OpGeoPoint: {"from": false, "separator": false, "latitude": false, "longitude": false, "to": true},
+	OpConcat:   {"fields": true, "separator": false, "to": true},
+	OpNest:     {"fields": false, "prefix": false, "to": true},
+	OpSet:      {"field": true, "value": true},
+}
+
+// Rule is one step of a Transform. Fields are addressed by dotted paths.
+type Rule struct {
+	Op string
+	// Namespace is a pattern of the namespaces the rule applies to, where *
+	// matches any characters; the rule applies to all namespaces if empty.
+	Namespace string
+
+	Field     string
+	From      string
+	To        string
+	Fields    []string
+	Prefix    string
+	Separator string
+	Latitude  string
+	Longitude string
+	Value     interface{}
+}
+
+// Transform is an ordered list of rules applied to documents.
+type Transform struct {
+	Rules []Rule
+}
+
+// ReadFile reads a Transform from a YAML or JSON file. A file with a .json
+// extension is read as JSON, and any other as YAML.
+func ReadFile(filename string) (*Transform, error) {
+	data, err := ioutil.ReadFile(util.ToUniversalPath(filename))
+	if err != nil {
+		return nil, fmt.Errorf("error reading transform file: %v", err)
+	}
+	isJSON := strings.ToLower(filepath.Ext(filename)) == ".json"
+	t, err := Parse(data, isJSON)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing transform file %v: %v", filename, err)
+	}
+	return t, nil
+}
+
+// Parse parses a Transform from a list of rules in JSON, or in YAML if
+// isJSON is false. Each rule is a document with an "op" naming the operation,
+// the options it takes and an optional "namespace".
+func Parse(data []byte, isJSON bool) (*Transform, error) {
+	var rules []bson.D
+	if isJSON {
+		if err := json.Unmarshal(data, &rules); err != nil {
+			return nil, err
+		}
+	} else {
+		var err error
+		if rules, err = parseYAML(data); err != nil {
+			return nil, err
+		}
+	}
+	t := &Transform{}
+	for i, rule := range rules {
+		r, err := parseRule(rule.Map())
+		if err != nil {
+			return nil, fmt.Errorf("rule #%v: %v", i+1, err)
+		}
+		t.Rules = append(t.Rules, r)
+	}
+	return t, nil
+}
+
+// parseYAML parses a list of rules in YAML. Mappings are decoded in order,
+// into bson.D, so that documents in values keep the order of their fields.
+func parseYAML(data []byte) ([]bson.D, error) {
+	var parsed []yaml.MapSlice
+	if err := yaml.Unmarshal(data, &parsed); err != nil {
+		return nil, err
+	}
+	rules := make([]bson.D, len(parsed))
+	for i, rule := range parsed {
+		doc, err := convertYAMLValue(rule)
+		if err != nil {
+			return nil, fmt.Errorf("rule #%v: %v", i+1, err)
+		}
+		rules[i] = doc.(bson.D)
+	}
+	return rules, nil
+}
+
+// convertYAMLValue converts a value decoded from YAML to the types decoded
+// from JSON by the json package, which the values of rules are parsed from.
+func convertYAMLValue(value interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case yaml.MapSlice:
+		doc := make(bson.D, len(v))
+		for i, item := range v {
+			key, ok := item.Key.(string)
+			if !ok {
+				return nil, fmt.Errorf("invalid key %v: keys must be strings", item.Key)
+			}
+			converted, err := convertYAMLValue(item.Value)
+			if err != nil {
+				return nil, err
+			}
+			doc[i] = bson.DocElem{Name: key, Value: converted}
+		}
+		return doc, nil
+	case []interface{}:
+		list := make([]interface{}, len(v))
+		for i, item := range v {
+			converted, err := convertYAMLValue(item)
+			if err != nil {
+				return nil, err
+			}
+			list[i] = converted
+		}
+		return list, nil
+	case int:
+		if v >= math.MinInt32 && v <= math.MaxInt32 {
+			return int32(v), nil
+		}
+		return int64(v), nil
+	case uint64:
+		return nil, fmt.Errorf("integer %v is too large", v)
+	}
+	return value, nil
+}
+
+func parseRule(options map[string]interface{}) (Rule, error) {
+	var r Rule
+	op, ok := options["op"].(string)
+	if !ok {
+		return r, fmt.Errorf("missing 'op'")
+	}
+	allowed, ok := ruleOptions[op]
+	if !ok {
+		return r, fmt.Errorf("unknown op '%v'", op)
+	}
+	r.Op = op
+
+	var names []string
+	for name := range options {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		value := options[name]
+		if _, ok := allowed[name]; !ok && name != "op" && name != "namespace" {
+			return r, fmt.Errorf("unknown option '%v' for op '%v'", name, op)
+		}
+		var err error
+		switch name {
+		case "namespace":
+			r.Namespace, err = stringOption(name, value)
+			if err == nil {
+				_, err = path.Match(r.Namespace, "")
+			}
+		case "field":
+			r.Field, err = stringOption(name, value)
+		case "from":
+			r.From, err = stringOption(name, value)
+		case "to":
+			r.To, err = stringOption(name, value)
+		case "prefix":
+			r.Prefix, err = stringOption(name, value)
+		case "separator":
+			r.Separator, err = stringOption(name, value)
+		case "latitude":
+			r.Latitude, err = stringOption(name, value)
+		case "longitude":
+			r.Longitude, err = stringOption(name, value)
+		case "fields":
+			r.Fields, err = stringsOption(name, value)
+		case "value":
+			r.Value, err = bsonutil.ParseJSONValue(value)
+		}
+		if err != nil {
+			return r, err
+		}
+	}
+	for name, required := range allowed {
+		if _, ok := options[name]; required && !ok {
+			return r, fmt.Errorf("op '%v' requires '%v'", op, name)
+		}
+	}
+
+	switch op {
+	case OpGeoPoint:
+		if (r.From == "") == (r.Latitude == "" || r.Longitude == "") {
+			return r, fmt.Errorf("op '%v' requires either 'from' or both 'latitude' and 'longitude'", op)
+		}
+	case OpNest:
+		if (len(r.Fields) == 0) == (r.Prefix == "") {
+			return r, fmt.Errorf("op '%v' requires either 'fields' or 'prefix'", op)
+		}
+	case OpSplit:
+		if r.To == "" {
+			r.To = r.Field
+		}
+	}
+	if r.Separator == "" && (op == OpSplit || op == OpGeoPoint) {
+		r.Separator = ","
+	}
+	return r, nil
+}
+
+func stringOption(name string, value interface{}) (string, error) {
+	s, ok := value.(string)
+	if !ok {
+		return "", fmt.Errorf("'%v' must be a string", name)
+	}
+	return s, nil
+}
+
+// stringsOption reads an option that is a list of strings, or a single one.
+func stringsOption(name string, value interface{}) ([]string, error) {
+	if s, ok := value.(string); ok {
+		return []string{s}, nil
+	}
+	list, ok := value.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("'%v' must be a list of strings", name)
+	}
+	strs := make([]string, len(list))
+	for i, item := range list {
+		s, ok := item.(string)
+		if !ok {
+			return nil, fmt.Errorf("'%v' must be a list of strings", name)
+		}
+		strs[i] = s
+	}
+	return strs, nil
+}
+
+// AppliesTo returns whether any rule applies to the documents of a namespace.
+func (t *Transform) AppliesTo(namespace string) bool {
+	for _, r := range t.Rules {
+		if r.appliesTo(namespace) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r Rule) appliesTo(namespace string) bool {
+	if r.Namespace == "" {
+		return true
+	}
+	matched, _ := path.Match(r.Namespace, namespace)
+	return matched
+}
+
+// Apply applies the rules that apply to namespace to a document, in order,
+// and returns the transformed document. Rules whose fields are missing from
+// the document leave it as it is. The document may be modified in place.
+func (t *Transform) Apply(namespace string, doc bson.D) (bson.D, error) {
+	var err error
+	for i, r := range t.Rules {
+		if !r.appliesTo(namespace) {
+			continue
+		}
+		if doc, err = r.apply(doc); err != nil {
+			return nil, fmt.Errorf("transform rule #%v (%v): %v", i+1, r.Op, err)
+		}
+	}
+	return doc, nil
+}
+
+func (r Rule) apply(doc bson.D) (bson.D, error) {
+	switch r.Op {
+	case OpRename:
+		if value, ok := getPath(doc, r.From); ok {
+			doc = removePath(doc, r.From)
+			doc = setPath(doc, r.To, value)
+		}
+	case OpRemove:
+		for _, field := range r.Fields {
+			doc = removePath(doc, field)
+		}
+	case OpSplit:
+		value, ok := getPath(doc, r.Field)
+		s, isString := value.(string)
+		if !ok || !isString {
+			return doc, nil
+		}
+		parts := []interface{}{}
+		for _, part := range strings.Split(s, r.Separator) {
+			parts = append(parts, strings.TrimSpace(part))
+		}
+		if r.To != r.Field {
+			doc = removePath(doc, r.Field)
+		}
+		doc = setPath(doc, r.To, parts)
+	case OpGeoPoint:
+		return r.applyGeoPoint(doc)
+	case OpConcat:
+		var parts []string
+		for _, field := range r.Fields {
+			if value, ok := getPath(doc, field); ok && value != nil {
+				parts = append(parts, fmt.Sprint(value))
+			}
+		}
+		if len(parts) > 0 {
+			doc = setPath(doc, r.To, strings.Join(parts, r.Separator))
+		}
+	case OpNest:
+		nested := bson.D{}
+		if value, ok := getPath(doc, r.To); ok {
+			if existing, ok := asDocument(value); ok {
+				nested = existing
+			}
+		}
+		moved := false
+		if r.Prefix != "" {
+			var rest bson.D
+			for _, elem := range doc {
+				if strings.HasPrefix(elem.Name, r.Prefix) && len(elem.Name) > len(r.Prefix) {
+					nested = append(nested, bson.DocElem{Name: elem.Name[len(r.Prefix):], Value: elem.Value})
+					moved = true
+				} else {
+					rest = append(rest, elem)
+				}
+			}
+			doc = rest
+		}
+		for _, field := range r.Fields {
+			if value, ok := getPath(doc, field); ok {
+				doc = removePath(doc, field)
+				nested = append(nested, bson.DocElem{Name: field[strings.LastIndex(field, ".")+1:], Value: value})
+				moved = true
+			}
+		}
+		if moved {
+			doc = setPath(doc, r.To, nested)
+		}
+	case OpSet:
+		doc = setPath(doc, r.Field, r.Value)
+	}
+	return doc, nil
+}
+
+func (r Rule) applyGeoPoint(doc bson.D) (bson.D, error) {
+	var latitude, longitude interface{}
+	if r.From != "" {
+		value, ok := getPath(doc, r.From)
+		if !ok {
+			return doc, nil
+		}
+		s, ok := value.(string)
+		parts := strings.Split(s, r.Separator)
+		if !ok || len(parts) != 2 {
+			return nil, fmt.Errorf("'%v' must be a string of a latitude and a longitude separated by '%v', got %v",
+				r.From, r.Separator, value)
+		}
+		latitude, longitude = parts[0], parts[1]
+		doc = removePath(doc, r.From)
+	} else {
+		var latOK, lonOK bool
+		latitude, latOK = getPath(doc, r.Latitude)
+		longitude, lonOK = getPath(doc, r.Longitude)
+		if !latOK || !lonOK {
+			return doc, nil
+		}
+		doc = removePath(removePath(doc, r.Latitude), r.Longitude)
+	}
+
+	lat, err := coordinate("latitude", latitude, 90)
+	if err != nil {
+		return nil, err
+	}
+	lon, err := coordinate("longitude", longitude, 180)
+	if err != nil {
+		return nil, err
+	}
+	point := bson.D{{"type", "Point"}, {"coordinates", []interface{}{lon, lat}}}
+	return setPath(doc, r.To, point), nil
+}
+
+// coordinate returns the number of a latitude or longitude, which can be
+// written as a string, and must be within [-limit, limit].
+func coordinate(name string, value interface{}, limit float64) (float64, error) {
+	var f float64
+	switch v := value.(type) {
+	case float64:
+		f = v
+	case int:
+		f = float64(v)
+	case int32:
+		f = float64(v)
+	case int64:
+		f = float64(v)
+	case string:
+		var err error
+		if f, err = strconv.ParseFloat(strings.TrimSpace(v), 64); err != nil {
+			return 0, fmt.Errorf("invalid %v '%v'", name, v)
+		}
+	default:
+		return 0, fmt.Errorf("invalid %v %v", name, value)
+	}
+	if f < -limit || f > limit {
+		return 0, fmt.Errorf("%v %v is out of range", name, f)
+	}
+	return f, nil
+}
@@ -0,0 +1,185 @@
+package transform
+
+import (
+	"testing"
+
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const testRulesYAML = `# rules for the stores collection
+- op: rename
+  from: zip
+  to: address.zip
+- op: geoPoint
+  from: "location"
+  to: loc
+- {op: split, field: tags, separator: ";"}
+- op: concat
+  fields: [first, last]
+  separator: ' '
+  to: name
+- op: remove
+  fields:
+  - first
+  - last
+- op: nest
+  prefix: contact_
+  to: contact
+- op: set
+  namespace: test.*
+  field: source
+  value: {$numberLong: "1"}
+`
+
+func TestParse(t *testing.T) {
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With YAML rules", t, func() {
+		Convey("values should be parsed in block and flow style", func() {
+			transform, err := Parse([]byte(`
+- op: set
+  field: a
+  value:
+    b: [1.5, "x, y", 'it''s', ~, true, 5000000000]
+    c: {e: f g, "h": -2}
+    list:
+    - one # a comment
+    -
+      - two
+    - k: v
+      l: m
+`), false)
+			So(err, ShouldBeNil)
+			So(transform.Rules[0].Value, ShouldResemble, bson.D{
+				{"b", []interface{}{1.5, "x, y", "it's", nil, true, int64(5000000000)}},
+				{"c", bson.D{{"e", "f g"}, {"h", int32(-2)}}},
+				{"list", []interface{}{
+					"one",
+					[]interface{}{"two"},
+					bson.D{{"k", "v"}, {"l", "m"}},
+				}},
+			})
+		})
+
+		Convey("invalid YAML should be rejected", func() {
+			for _, invalid := range []string{
+				"- op: remove\n  fields: [a, b",
+				"- op: remove\n  fields: a\n   to: b",
+				"op: remove",
+				"- [remove, a]",
+				"- op: set\n  field: a\n  value: {1: b}",
+			} {
+				_, err := Parse([]byte(invalid), false)
+				So(err, ShouldNotBeNil)
+			}
+		})
+
+		Convey("rules should be parsed in order", func() {
+			transform, err := Parse([]byte(testRulesYAML), false)
+			So(err, ShouldBeNil)
+			So(len(transform.Rules), ShouldEqual, 7)
+			So(transform.Rules[0], ShouldResemble, Rule{Op: OpRename, From: "zip", To: "address.zip"})
+			So(transform.Rules[2], ShouldResemble, Rule{Op: OpSplit, Field: "tags", To: "tags", Separator: ";"})
+			So(transform.Rules[4].Fields, ShouldResemble, []string{"first", "last"})
+			So(transform.Rules[6].Value, ShouldEqual, int64(1))
+		})
+	})
+
+	Convey("JSON rules should be parsed", t, func() {
+		transform, err := Parse([]byte(`[{"op": "remove", "fields": "a", "namespace": "db.c*"}]`), true)
+		So(err, ShouldBeNil)
+		So(transform.Rules, ShouldResemble, []Rule{{Op: OpRemove, Namespace: "db.c*", Fields: []string{"a"}}})
+	})
+
+	Convey("Invalid rules should be rejected", t, func() {
+		for _, invalid := range []string{
+			`{"op": "remove"}`,
+			`[{"fields": ["a"]}]`,
+			`[{"op": "explode", "field": "a"}]`,
+			`[{"op": "remove", "fields": ["a"], "to": "b"}]`,
+			`[{"op": "rename", "from": "a"}]`,
+			`[{"op": "rename", "from": 1, "to": "b"}]`,
+			`[{"op": "geoPoint", "latitude": "lat", "to": "loc"}]`,
+			`[{"op": "nest", "to": "sub"}]`,
+			`[{"op": "remove", "fields": ["a"], "namespace": "db.["}]`,
+		} {
+			_, err := Parse([]byte(invalid), true)
+			So(err, ShouldNotBeNil)
+		}
+	})
+}
+
+func TestApply(t *testing.T) {
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With a transform", t, func() {
+		transform, err := Parse([]byte(testRulesYAML), false)
+		So(err, ShouldBeNil)
+
+		Convey("all the rules should be applied to a document in order", func() {
+			doc := bson.D{
+				{"first", "Ada"},
+				{"zip", int64(10001)},
+				{"location", "40.75, -73.99"},
+				{"tags", "a; b"},
+				{"last", "Lovelace"},
+				{"contact_email", "ada@example.com"},
+				{"address", &bson.D{{"street", "5th Ave"}}},
+				{"contact_phone", "555"},
+			}
+			out, err := transform.Apply("test.stores", doc)
+			So(err, ShouldBeNil)
+			So(out, ShouldResemble, bson.D{
+				{"tags", []interface{}{"a", "b"}},
+				{"address", bson.D{{"street", "5th Ave"}, {"zip", int64(10001)}}},
+				{"loc", bson.D{{"type", "Point"}, {"coordinates", []interface{}{-73.99, 40.75}}}},
+				{"name", "Ada Lovelace"},
+				{"contact", bson.D{{"email", "ada@example.com"}, {"phone", "555"}}},
+				{"source", int64(1)},
+			})
+		})
+
+		Convey("rules should only apply to the namespaces they match", func() {
+			So(transform.AppliesTo("other.stores"), ShouldBeTrue)
+			out, err := transform.Apply("other.stores", bson.D{{"zip", "1"}})
+			So(err, ShouldBeNil)
+			So(out, ShouldResemble, bson.D{{"address", bson.D{{"zip", "1"}}}})
+
+			limited := &Transform{Rules: transform.Rules[6:]}
+			So(limited.AppliesTo("test.stores"), ShouldBeTrue)
+			So(limited.AppliesTo("other.stores"), ShouldBeFalse)
+		})
+
+		Convey("rules whose fields are missing should be skipped", func() {
+			out, err := transform.Apply("other.stores", bson.D{{"a", 1}})
+			So(err, ShouldBeNil)
+			So(out, ShouldResemble, bson.D{{"a", 1}})
+		})
+	})
+
+	Convey("A geoPoint rule", t, func() {
+		transform := &Transform{Rules: []Rule{{Op: OpGeoPoint, Latitude: "lat", Longitude: "lon", To: "loc"}}}
+
+		Convey("should build a point from latitude and longitude fields", func() {
+			out, err := transform.Apply("db.c", bson.D{{"lat", 1.5}, {"lon", int32(2)}, {"a", 1}})
+			So(err, ShouldBeNil)
+			So(out, ShouldResemble, bson.D{
+				{"a", 1},
+				{"loc", bson.D{{"type", "Point"}, {"coordinates", []interface{}{2.0, 1.5}}}},
+			})
+		})
+
+		Convey("should reject invalid coordinates", func() {
+			_, err := transform.Apply("db.c", bson.D{{"lat", 91}, {"lon", 0}})
+			So(err, ShouldNotBeNil)
+			_, err = transform.Apply("db.c", bson.D{{"lat", "north"}, {"lon", 0}})
+			So(err, ShouldNotBeNil)
+
+			transform.Rules[0] = Rule{Op: OpGeoPoint, From: "pos", Separator: ",", To: "loc"}
+			_, err = transform.Apply("db.c", bson.D{{"pos", "1"}})
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
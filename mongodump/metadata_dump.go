@@ -9,13 +9,16 @@ import (
 	"github.com/mongodb/mongo-tools/common/intents"
 	"github.com/mongodb/mongo-tools/common/json"
 	"github.com/mongodb/mongo-tools/common/log"
+	"gopkg.in/mgo.v2"
 	"gopkg.in/mgo.v2/bson"
 )
 
-// Metadata holds information about a collection's options and indexes.
+// Metadata holds information about a collection's options, indexes and,
+// for collections dumped through a mongos, its sharding configuration.
 type Metadata struct {
-	Options interface{}   `json:"options,omitempty"`
-	Indexes []interface{} `json:"indexes"`
+	Options  interface{}   `json:"options,omitempty"`
+	Indexes  []interface{} `json:"indexes"`
+	Sharding interface{}   `json:"sharding,omitempty"`
 }
 
 // IndexDocumentFromDB is used internally to preserve key ordering.
@@ -83,6 +86,15 @@ func (dump *MongoDump) dumpMetadata(intent *intents.Intent, buffer resettableOut
 		if err := indexesIter.Err(); err != nil {
 			return fmt.Errorf("error getting indexes for collection `%v`: %v", intent.Namespace(), err)
 		}
+
+		// When dumping through a mongos, record how the collection is sharded so that
+		// mongorestore can recreate the shard key and chunk layout.
+		if dump.isMongos {
+			meta.Sharding, err = dump.getShardingMetadata(session, intent)
+			if err != nil {
+				return fmt.Errorf("error getting sharding information for collection `%v`: %v", intent.Namespace(), err)
+			}
+		}
 	}
 
 	// Finally, we send the results to the writer as JSON bytes
@@ -120,3 +132,41 @@ func (dump *MongoDump) dumpMetadata(intent *intents.Intent, buffer resettableOut
 	}
 	return
 }
+
+// getShardingMetadata reads the shard key, uniqueness and chunk split points of
+// the intent's collection from the config database, converted to JSON. It returns
+// nil if the collection is not sharded.
+func (dump *MongoDump) getShardingMetadata(session *mgo.Session, intent *intents.Intent) (interface{}, error) {
+	if intent.DB == "config" {
+		// the config database describes the cluster itself
+		return nil, nil
+	}
+
+	collInfo, err := db.GetShardedCollection(session, intent.Namespace())
+	if err != nil || collInfo == nil {
+		return nil, err
+	}
+	log.Logvf(log.DebugLow, "\tcollection `%v` is sharded on %v", intent.Namespace(), collInfo.Key)
+
+	// every chunk but the first starts at a split point; the first starts at MinKey
+	splitPoints := []interface{}{}
+	chunksIter := db.GetChunks(session, intent.Namespace(), collInfo)
+	chunk := db.Chunk{}
+	for first := true; chunksIter.Next(&chunk); first = false {
+		if !first {
+			splitPoints = append(splitPoints, chunk.Min)
+		}
+		chunk = db.Chunk{}
+	}
+	if err = chunksIter.Close(); err != nil {
+		return nil, fmt.Errorf("error reading chunks: %v", err)
+	}
+	log.Logvf(log.DebugHigh, "\tcollection `%v` has %v split points", intent.Namespace(), len(splitPoints))
+
+	sharding := bson.D{
+		{"key", collInfo.Key},
+		{"unique", collInfo.Unique},
+		{"splitPoints", splitPoints},
+	}
+	return bsonutil.ConvertBSONValueToJSON(sharding)
+}
@@ -12,6 +12,7 @@ import (
 	"github.com/mongodb/mongo-tools/common/log"
 	"github.com/mongodb/mongo-tools/common/options"
 	"github.com/mongodb/mongo-tools/common/progress"
+	"github.com/mongodb/mongo-tools/common/text"
 	"github.com/mongodb/mongo-tools/common/util"
 	"gopkg.in/mgo.v2"
 	"gopkg.in/mgo.v2/bson"
@@ -50,6 +51,9 @@ type MongoDump struct {
 	isMongos        bool
 	authVersion     int
 	archive         *archive.Writer
+	// archiveVolumeSize is the parsed --archiveVolumeSize, or 0 if the
+	// archive isn't split into volumes
+	archiveVolumeSize int64
 	// shutdownIntentsNotifier is provided to the multiplexer
 	// as well as the signal handler, and allows them to notify
 	// the intent dumpers that they should shutdown
@@ -109,6 +113,22 @@ func (dump *MongoDump) ValidateOptions() error {
 		return fmt.Errorf("compression can't be used when dumping a single collection to standard output")
 	case dump.OutputOptions.NumParallelCollections <= 0:
 		return fmt.Errorf("numParallelCollections must be positive")
+	case dump.OutputOptions.ArchiveTableOfContents && dump.OutputOptions.Archive == "":
+		return fmt.Errorf("--archiveTableOfContents can only be used with --archive")
+	case dump.OutputOptions.ArchiveVolumeSize != "" && dump.OutputOptions.Archive == "":
+		return fmt.Errorf("--archiveVolumeSize can only be used with --archive")
+	case dump.OutputOptions.ArchiveVolumeSize != "" && dump.OutputOptions.Archive == "-":
+		return fmt.Errorf("--archiveVolumeSize can't be used when writing the archive to standard output")
+	}
+	if dump.OutputOptions.ArchiveVolumeSize != "" {
+		size, err := text.ParseByteAmount(dump.OutputOptions.ArchiveVolumeSize)
+		if err != nil {
+			return fmt.Errorf("invalid --archiveVolumeSize: %v", err)
+		}
+		if size <= archive.VolumeHeaderSize {
+			return fmt.Errorf("--archiveVolumeSize must be larger than %v bytes", archive.VolumeHeaderSize)
+		}
+		dump.archiveVolumeSize = size
 	}
 	return nil
 }
@@ -232,8 +252,15 @@ func (dump *MongoDump) Dump() (err error) {
 			Out: archiveOut,
 			Mux: archive.NewMultiplexer(archiveOut, dump.shutdownIntentsNotifier),
 		}
+		dump.archive.Mux.TableOfContents = dump.OutputOptions.ArchiveTableOfContents
 		go dump.archive.Mux.Run()
 		defer func() {
+			if err != nil && dump.archive.Prelude != nil {
+				// the namespaces that weren't dumped in full are marked as such,
+				// and the archive ends with a marker saying it is incomplete
+				log.Logv(log.Always, "dump did not finish, marking the archive as incomplete")
+				dump.archive.Mux.MarkIncomplete()
+			}
 			// The Mux runs until its Control is closed
 			close(dump.archive.Mux.Control)
 			muxErr := <-dump.archive.Mux.Completed
@@ -480,6 +507,14 @@ func (dump *MongoDump) DumpIntents() error {
 			buffer := dump.getResettableOutputBuffer()
 			log.Logvf(log.DebugHigh, "starting dump routine with id=%v", id)
 			for {
+				// don't start on another collection once the dump is being shut down
+				select {
+				case <-dump.shutdownIntentsNotifier.notified:
+					log.Logvf(log.DebugHigh, "ending dump routine with id=%v, dump is shutting down", id)
+					resultChan <- util.ErrTerminated
+					return
+				default:
+				}
 				intent := dump.manager.Pop()
 				if intent == nil {
 					log.Logvf(log.DebugHigh, "ending dump routine with id=%v, no more work to do", id)
@@ -498,14 +533,17 @@ func (dump *MongoDump) DumpIntents() error {
 		}(i)
 	}
 
-	// wait until all goroutines are done or one of them errors out
+	// wait until all goroutines are done. When one of them errors out, the others
+	// are shut down, so that every collection they started gets finished cleanly.
+	var err error
 	for i := 0; i < jobs; i++ {
-		if err := <-resultChan; err != nil {
-			return err
+		if jobErr := <-resultChan; jobErr != nil && err == nil {
+			err = jobErr
+			dump.shutdownIntentsNotifier.Notify()
 		}
 	}
 
-	return nil
+	return err
 }
 
 // DumpIntent dumps the specified database's collection.
@@ -590,6 +628,10 @@ func (dump *MongoDump) dumpQueryToIntent(
 		return 0, err
 	}
 	defer func() {
+		if muxIn, ok := intent.BSONFile.(*archive.MuxIn); ok && err != nil {
+			// let the archive record that this collection was only partially dumped
+			muxIn.Incomplete = true
+		}
 		closeErr := intent.BSONFile.Close()
 		if err == nil && closeErr != nil {
 			err = fmt.Errorf("error writing data for collection `%v` to disk: %v", intent.Namespace(), closeErr)
@@ -797,12 +839,12 @@ func (dump *MongoDump) getArchiveOut() (out io.WriteCloser, err error) {
 			if dump.OutputOptions.Gzip {
 				defaultArchiveFilePath = defaultArchiveFilePath + ".gz"
 			}
-			out, err = os.Create(defaultArchiveFilePath)
+			out, err = dump.createArchiveFile(defaultArchiveFilePath)
 			if err != nil {
 				return nil, err
 			}
 		} else {
-			out, err = os.Create(dump.OutputOptions.Archive)
+			out, err = dump.createArchiveFile(dump.OutputOptions.Archive)
 			if err != nil {
 				return nil, err
 			}
@@ -814,6 +856,15 @@ func (dump *MongoDump) getArchiveOut() (out io.WriteCloser, err error) {
 	return out, nil
 }
 
+// createArchiveFile creates the archive file at path, or its first volume
+// if the archive is split into volumes.
+func (dump *MongoDump) createArchiveFile(path string) (io.WriteCloser, error) {
+	if dump.archiveVolumeSize > 0 {
+		return archive.NewVolumeWriter(path, dump.archiveVolumeSize)
+	}
+	return os.Create(path)
+}
+
 // docPlural returns "document" or "documents" depending on the
 // count of documents passed in.
 func docPlural(count int64) string {
@@ -50,6 +50,8 @@ type OutputOptions struct {
 	Repair                     bool     `long:"repair" description:"try to recover documents from damaged data files (not supported by all storage engines)"`
 	Oplog                      bool     `long:"oplog" description:"use oplog for taking a point-in-time snapshot"`
 	Archive                    string   `long:"archive" value-name:"<file-path>" optional:"true" optional-value:"-" description:"dump as an archive to the specified path. If flag is specified without a value, archive is written to stdout"`
+	ArchiveVolumeSize          string   `long:"archiveVolumeSize" value-name:"<size>" description:"split the archive into volumes of at most the given size (e.g. 4GB), written to <file-path>.001, <file-path>.002 and so on"`
+	ArchiveTableOfContents     bool     `long:"archiveTableOfContents" description:"end an archive written to a file with a table of contents, letting mongorestore skip the namespaces it doesn't restore; archives with one can't be read by versions of mongorestore from before it"`
 	DumpDBUsersAndRoles        bool     `long:"dumpDbUsersAndRoles" description:"dump user and role definitions for the specified database"`
 	ExcludedCollections        []string `long:"excludeCollection" value-name:"<collection-name>" description:"collection to exclude from the dump (may be specified multiple times to exclude additional collections)"`
 	ExcludedCollectionPrefixes []string `long:"excludeCollectionsWithPrefix" value-name:"<collection-prefix>" description:"exclude all collections from the dump that have the given prefix (may be specified multiple times to exclude additional prefixes)"`
@@ -1,9 +1,10 @@
 package mongoexport
 
 import (
-	"encoding/csv"
 	"fmt"
 	"github.com/mongodb/mongo-tools/common/bsonutil"
+	"github.com/mongodb/mongo-tools/common/charset"
+	"github.com/mongodb/mongo-tools/common/csv"
 	"github.com/mongodb/mongo-tools/common/json"
 	"gopkg.in/mgo.v2/bson"
 	"io"
@@ -29,16 +30,18 @@ type CSVExportOutput struct {
 	NoHeaderLine bool
 
 	csvWriter *csv.Writer
+
+	// encoder transcodes the output to its --encoding, if it is set
+	encoder charset.Encoder
 }
 
 // NewCSVExportOutput returns a CSVExportOutput configured to write output to the
 // given io.Writer, extracting the specified fields only.
 func NewCSVExportOutput(fields []string, noHeaderLine bool, out io.Writer) *CSVExportOutput {
 	return &CSVExportOutput{
-		fields,
-		0,
-		noHeaderLine,
-		csv.NewWriter(out),
+		Fields:       fields,
+		NoHeaderLine: noHeaderLine,
+		csvWriter:    csv.NewWriter(out),
 	}
 }
 
@@ -60,7 +63,13 @@ func (csvExporter *CSVExportOutput) WriteFooter() error {
 // Flush writes any pending data to the underlying I/O stream.
 func (csvExporter *CSVExportOutput) Flush() error {
 	csvExporter.csvWriter.Flush()
-	return csvExporter.csvWriter.Error()
+	if err := csvExporter.csvWriter.Error(); err != nil {
+		return err
+	}
+	if csvExporter.encoder != nil {
+		return csvExporter.encoder.Flush()
+	}
+	return nil
 }
 
 // ExportDocument writes a line to output with the CSV representation of a document.
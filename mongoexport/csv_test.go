@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"encoding/csv"
 	"github.com/mongodb/mongo-tools/common/bsonutil"
+	"github.com/mongodb/mongo-tools/common/options"
 	"github.com/mongodb/mongo-tools/common/testutil"
 	. "github.com/smartystreets/goconvey/convey"
 	"gopkg.in/mgo.v2/bson"
@@ -70,6 +71,58 @@ func TestWriteCSV(t *testing.T) {
 	})
 }
 
+func TestWriteCSVDialect(t *testing.T) {
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With a CSV export output", t, func() {
+		out := &bytes.Buffer{}
+		document := bson.D{{"a", `say "hi"; \o/`}, {"b", "plain"}, {"c", 1}}
+
+		Convey("the delimiter, quote and escape characters should be used", func() {
+			csvExporter := NewCSVExportOutput([]string{"a", "b", "c"}, false, out)
+			writer := csvExporter.csvWriter
+			writer.Comma, writer.Quote, writer.Escape = ';', '\'', '\\'
+			So(csvExporter.WriteHeader(), ShouldBeNil)
+			So(csvExporter.ExportDocument(document), ShouldBeNil)
+			So(csvExporter.ExportDocument(bson.D{{"a", "it's"}}), ShouldBeNil)
+			So(csvExporter.Flush(), ShouldBeNil)
+			So(out.String(), ShouldEqual, "a;b;c\n'say \"hi\"; \\\\o/';plain;1\n'it\\'s';;\n")
+		})
+
+		Convey("the output should be written in the encoding", func() {
+			exp := MongoExport{OutputOpts: &OutputFormatOptions{
+				Type:     CSV,
+				Fields:   "a",
+				Encoding: "latin1",
+			}}
+			csvExporter, err := exp.getExportOutput(out)
+			So(err, ShouldBeNil)
+			So(csvExporter.ExportDocument(bson.D{{"a", "Zoë"}}), ShouldBeNil)
+			So(csvExporter.Flush(), ShouldBeNil)
+			So(out.Bytes(), ShouldResemble, []byte{'Z', 'o', 0xEB, '\n'})
+
+			Convey("and characters it can't represent should be an error", func() {
+				So(csvExporter.ExportDocument(bson.D{{"a", "€"}}), ShouldBeNil)
+				So(csvExporter.Flush(), ShouldNotBeNil)
+			})
+		})
+
+		Convey("the dialect and encoding options should only be valid for CSV", func() {
+			exp := MongoExport{
+				OutputOpts: &OutputFormatOptions{Type: CSV, Delimiter: `\t`, EscapeChar: `\`, Encoding: "utf-16"},
+				InputOpts:  &InputOptions{},
+			}
+			exp.ToolOptions.Namespace = &options.Namespace{Collection: "c"}
+			So(exp.ValidateSettings(), ShouldBeNil)
+			exp.OutputOpts.QuoteChar = `\t`
+			So(exp.ValidateSettings(), ShouldNotBeNil)
+			exp.OutputOpts.QuoteChar = ""
+			exp.OutputOpts.Type = JSON
+			So(exp.ValidateSettings(), ShouldNotBeNil)
+		})
+	})
+}
+
 func TestExtractDField(t *testing.T) {
 	Convey("With a test bson.D", t, func() {
 		b := []interface{}{"inner", bsonutil.MarshalD{{"inner2", 1}}}
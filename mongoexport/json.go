@@ -17,17 +17,20 @@ type JSONExportOutput struct {
 	ArrayOutput bool
 	// Pretty when set to true indicates that the output will be written in pretty mode.
 	PrettyOutput bool
-	Encoder      *json.Encoder
-	Out          io.Writer
-	NumExported  int64
+	// JSONFormat is the flavor of Extended JSON to write.
+	JSONFormat  json.Format
+	Encoder     *json.Encoder
+	Out         io.Writer
+	NumExported int64
 }
 
 // NewJSONExportOutput creates a new JSONExportOutput in array mode if specified,
-// configured to write data to the given io.Writer.
-func NewJSONExportOutput(arrayOutput bool, prettyOutput bool, out io.Writer) *JSONExportOutput {
+// configured to write data in the given Extended JSON format to the given io.Writer.
+func NewJSONExportOutput(arrayOutput bool, prettyOutput bool, jsonFormat json.Format, out io.Writer) *JSONExportOutput {
 	return &JSONExportOutput{
 		arrayOutput,
 		prettyOutput,
+		jsonFormat,
 		json.NewEncoder(out),
 		out,
 		0,
@@ -80,7 +83,7 @@ func (jsonExporter *JSONExportOutput) ExportDocument(document bson.D) error {
 				jsonExporter.Out.Write([]byte("\n"))
 			}
 		}
-		extendedDoc, err := bsonutil.ConvertBSONValueToJSON(document)
+		extendedDoc, err := bsonutil.ConvertBSONValueToExtendedJSON(document, jsonExporter.JSONFormat)
 		if err != nil {
 			return err
 		}
@@ -95,7 +98,7 @@ func (jsonExporter *JSONExportOutput) ExportDocument(document bson.D) error {
 		}
 		jsonExporter.Out.Write(jsonOut)
 	} else {
-		extendedDoc, err := bsonutil.ConvertBSONValueToJSON(document)
+		extendedDoc, err := bsonutil.ConvertBSONValueToExtendedJSON(document, jsonExporter.JSONFormat)
 		if err != nil {
 			return err
 		}
@@ -7,6 +7,7 @@ import (
 	. "github.com/smartystreets/goconvey/convey"
 	"gopkg.in/mgo.v2/bson"
 	"testing"
+	"time"
 )
 
 func TestWriteJSON(t *testing.T) {
@@ -18,7 +19,7 @@ func TestWriteJSON(t *testing.T) {
 		Convey("Special types should serialize as extended JSON", func() {
 
 			Convey("ObjectId should have an extended JSON format", func() {
-				jsonExporter := NewJSONExportOutput(false, false, out)
+				jsonExporter := NewJSONExportOutput(false, false, json.LegacyFormat, out)
 				objId := bson.NewObjectId()
 				err := jsonExporter.WriteHeader()
 				So(err, ShouldBeNil)
@@ -29,6 +30,20 @@ func TestWriteJSON(t *testing.T) {
 				So(out.String(), ShouldEqual, `{"_id":{"$oid":"`+objId.Hex()+`"}}`+"\n")
 			})
 
+			Convey("numbers and dates should be wrapped in canonical mode", func() {
+				jsonExporter := NewJSONExportOutput(false, false, json.CanonicalFormat, out)
+				err := jsonExporter.ExportDocument(bson.D{{"a", 1}, {"b", time.Unix(0, 0)}})
+				So(err, ShouldBeNil)
+				So(out.String(), ShouldEqual, `{"a":{"$numberInt":"1"},"b":{"$date":{"$numberLong":"0"}}}`+"\n")
+			})
+
+			Convey("numbers should be plain in relaxed mode", func() {
+				jsonExporter := NewJSONExportOutput(false, false, json.RelaxedFormat, out)
+				err := jsonExporter.ExportDocument(bson.D{{"a", 1}, {"b", int64(2)}})
+				So(err, ShouldBeNil)
+				So(out.String(), ShouldEqual, `{"a":1,"b":2}`+"\n")
+			})
+
 			Reset(func() {
 				out.Reset()
 			})
@@ -43,7 +58,7 @@ func TestJSONArray(t *testing.T) {
 	Convey("With a JSON export output in array mode", t, func() {
 		out := &bytes.Buffer{}
 		Convey("exporting a bunch of documents should produce valid json", func() {
-			jsonExporter := NewJSONExportOutput(true, false, out)
+			jsonExporter := NewJSONExportOutput(true, false, json.LegacyFormat, out)
 			err := jsonExporter.WriteHeader()
 			So(err, ShouldBeNil)
 
@@ -1,4 +1,4 @@
-// Package mongoexport produces a JSON or CSV export of data stored in a MongoDB instance.
+// Package mongoexport produces a JSON, CSV or Parquet export of data stored in a MongoDB instance.
 package mongoexport
 
 import (
@@ -9,10 +9,13 @@ import (
 	"strings"
 
 	"github.com/mongodb/mongo-tools/common/bsonutil"
+	"github.com/mongodb/mongo-tools/common/charset"
+	"github.com/mongodb/mongo-tools/common/csv"
 	"github.com/mongodb/mongo-tools/common/db"
 	"github.com/mongodb/mongo-tools/common/json"
 	"github.com/mongodb/mongo-tools/common/log"
 	"github.com/mongodb/mongo-tools/common/options"
+	"github.com/mongodb/mongo-tools/common/parquet"
 	"github.com/mongodb/mongo-tools/common/progress"
 	"github.com/mongodb/mongo-tools/common/util"
 	"gopkg.in/mgo.v2"
@@ -23,6 +26,7 @@ import (
 const (
 	CSV                            = "csv"
 	JSON                           = "json"
+	PARQUET                        = "parquet"
 	watchProgressorUpdateFrequency = 8000
 )
 
@@ -94,8 +98,49 @@ func (exp *MongoExport) ValidateSettings() error {
 		// special error for an empty type value
 		return fmt.Errorf("--type cannot be empty")
 	}
-	if exp.OutputOpts.Type != CSV && exp.OutputOpts.Type != JSON {
-		return fmt.Errorf("invalid output type '%v', choose 'json' or 'csv'", exp.OutputOpts.Type)
+	if exp.OutputOpts.Type != CSV && exp.OutputOpts.Type != JSON && exp.OutputOpts.Type != PARQUET {
+		return fmt.Errorf("invalid output type '%v', choose 'json', 'csv' or 'parquet'", exp.OutputOpts.Type)
+	}
+
+	jsonFormat, err := json.ParseFormat(exp.OutputOpts.JSONFormat)
+	if err != nil {
+		return err
+	}
+	if exp.OutputOpts.Type != JSON && jsonFormat != json.LegacyFormat {
+		return fmt.Errorf("cannot use --jsonFormat with --type=%v", exp.OutputOpts.Type)
+	}
+
+	if exp.OutputOpts.Type == PARQUET {
+		if _, err = parquet.ParseCodec(exp.OutputOpts.ParquetCompression); err != nil {
+			return err
+		}
+		if exp.OutputOpts.ParquetSchemaFile == "" && exp.OutputOpts.ParquetSampleSize <= 0 {
+			return fmt.Errorf("--parquetSampleSize must be positive")
+		}
+	} else if exp.OutputOpts.ParquetSchemaFile != "" {
+		return fmt.Errorf("cannot use --parquetSchemaFile with --type=%v", exp.OutputOpts.Type)
+	}
+
+	if exp.OutputOpts.Type == CSV {
+		if _, err = exp.csvDialect(); err != nil {
+			return err
+		}
+		if _, err = charset.Lookup(exp.OutputOpts.Encoding); err != nil {
+			return fmt.Errorf("invalid --encoding argument: %v", err)
+		}
+	} else {
+		if exp.OutputOpts.Delimiter != "" && exp.OutputOpts.Delimiter != "," {
+			return fmt.Errorf("cannot use --delimiter with --type=%v", exp.OutputOpts.Type)
+		}
+		if exp.OutputOpts.QuoteChar != "" && exp.OutputOpts.QuoteChar != `"` {
+			return fmt.Errorf("cannot use --quoteChar with --type=%v", exp.OutputOpts.Type)
+		}
+		if exp.OutputOpts.EscapeChar != "" {
+			return fmt.Errorf("cannot use --escapeChar with --type=%v", exp.OutputOpts.Type)
+		}
+		if encoding, err := charset.Lookup(exp.OutputOpts.Encoding); err != nil || encoding != charset.UTF8 {
+			return fmt.Errorf("cannot use --encoding with --type=%v", exp.OutputOpts.Type)
+		}
 	}
 
 	if exp.InputOpts.Query != "" && exp.InputOpts.ForceTableScan {
@@ -123,31 +168,70 @@ func (exp *MongoExport) ValidateSettings() error {
 			return err
 		}
 	}
-	return nil
+
+	if exp.InputOpts.Pipeline != "" && exp.InputOpts.PipelineFile != "" {
+		return fmt.Errorf("either --pipeline or --pipelineFile can be specified as a pipeline option")
+	}
+
+	if exp.InputOpts != nil && exp.InputOpts.HasPipeline() {
+		// the pipeline replaces the query, so its stages must be used instead
+		// of the options of a query
+		switch {
+		case exp.InputOpts.HasQuery():
+			return fmt.Errorf("cannot use --query or --queryFile with --pipeline; use a $match stage instead")
+		case exp.InputOpts.Sort != "":
+			return fmt.Errorf("cannot use --sort with --pipeline; use a $sort stage instead")
+		case exp.InputOpts.Skip != 0:
+			return fmt.Errorf("cannot use --skip with --pipeline; use a $skip stage instead")
+		case exp.InputOpts.Limit != 0:
+			return fmt.Errorf("cannot use --limit with --pipeline; use a $limit stage instead")
+		case exp.InputOpts.ForceTableScan:
+			return fmt.Errorf("cannot use --forceTableScan with --pipeline")
+		}
+		content, err := exp.InputOpts.GetPipeline()
+		if err != nil {
+			return err
+		}
+		if _, err = getPipelineFromByteArg(content); err != nil {
+			return err
+		}
+	}
+
+	return exp.validateParallel()
+}
+
+// csvDialect returns the dialect of CSV output set by the --delimiter,
+// --quoteChar and --escapeChar options.
+func (exp *MongoExport) csvDialect() (csv.Dialect, error) {
+	opts := exp.OutputOpts
+	return csv.ParseDialect(opts.Delimiter, opts.QuoteChar, opts.EscapeChar, "")
 }
 
 // GetOutputWriter opens and returns an io.WriteCloser for the output
 // options or nil if none is set. The caller is responsible for closing it.
+// With --splitOutput, the file of each partition is opened when it is
+// exported, and nil is returned.
 func (exp *MongoExport) GetOutputWriter() (io.WriteCloser, error) {
-	if exp.OutputOpts.OutputFile != "" {
-		// If the directory in which the output file is to be
-		// written does not exist, create it
-		fileDir := filepath.Dir(exp.OutputOpts.OutputFile)
-		err := os.MkdirAll(fileDir, 0750)
-		if err != nil {
-			return nil, err
-		}
-
-		file, err := os.Create(util.ToUniversalPath(exp.OutputOpts.OutputFile))
-		if err != nil {
-			return nil, err
-		}
-		return file, err
+	if exp.OutputOpts.OutputFile != "" && !exp.OutputOpts.SplitOutput {
+		return createOutputFile(exp.OutputOpts.OutputFile)
 	}
 	// No writer, so caller should assume Stdout (or some other reasonable default)
 	return nil, nil
 }
 
+// createOutputFile creates a file to write output to.
+func createOutputFile(filename string) (*os.File, error) {
+	// If the directory in which the output file is to be
+	// written does not exist, create it
+	fileDir := filepath.Dir(filename)
+	err := os.MkdirAll(fileDir, 0750)
+	if err != nil {
+		return nil, err
+	}
+
+	return os.Create(util.ToUniversalPath(filename))
+}
+
 // Take a comma-delimited set of field names and build a selector doc for query projection.
 // For fields containing a dot '.', we project the entire top-level portion.
 // e.g. "a,b,c.d.e,f.$" -> {a:1, b:1, "c":1, "f.$": 1}.
@@ -173,7 +257,8 @@ func makeFieldSelector(fields string) bson.M {
 // getCount returns an estimate of how many documents the cursor will fetch
 // It always returns Limit if there is a limit, assuming that in general
 // limits will less then the total possible.
-// If there is a query and no limit then it returns 0, because it's too expensive to count the query.
+// If there is a query or a pipeline and no limit then it returns 0, because it's too expensive to count
+// its results.
 // Otherwise it returns the count minus the skip
 func (exp *MongoExport) getCount() (c int, err error) {
 	session, err := exp.SessionProvider.GetSession()
@@ -184,7 +269,7 @@ func (exp *MongoExport) getCount() (c int, err error) {
 	if exp.InputOpts != nil && exp.InputOpts.Limit != 0 {
 		return exp.InputOpts.Limit, nil
 	}
-	if exp.InputOpts != nil && exp.InputOpts.Query != "" {
+	if exp.InputOpts != nil && (exp.InputOpts.Query != "" || exp.InputOpts.HasPipeline()) {
 		return 0, nil
 	}
 	q := session.DB(exp.ToolOptions.Namespace.DB).C(exp.ToolOptions.Namespace.Collection).Find(nil)
@@ -207,7 +292,9 @@ func (exp *MongoExport) getCount() (c int, err error) {
 // getCursor returns a cursor that can be iterated over to get all the documents
 // to export, based on the options given to mongoexport. Also returns the
 // associated session, so that it can be closed once the cursor is used up.
-func (exp *MongoExport) getCursor() (*mgo.Iter, *mgo.Session, error) {
+// If partition is not nil, the cursor only returns the documents in it, sorted
+// by its field.
+func (exp *MongoExport) getCursor(partition *db.FieldRange) (*mgo.Iter, *mgo.Session, error) {
 	sortFields := []string{}
 	if exp.InputOpts != nil && exp.InputOpts.Sort != "" {
 		sortD, err := getSortFromArg(exp.InputOpts.Sort)
@@ -233,6 +320,27 @@ func (exp *MongoExport) getCursor() (*mgo.Iter, *mgo.Session, error) {
 		}
 	}
 
+	if partition != nil {
+		if len(query) > 0 {
+			query = bson.M{"$and": []interface{}{query, partition.Selector()}}
+		} else {
+			query = partition.Selector()
+		}
+		sortFields = []string{partition.Field}
+	}
+
+	var pipeline []bson.D
+	if exp.InputOpts != nil && exp.InputOpts.HasPipeline() {
+		content, err := exp.InputOpts.GetPipeline()
+		if err != nil {
+			return nil, nil, err
+		}
+		pipeline, err = getPipelineFromByteArg(content)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
 	session, err := exp.SessionProvider.GetSession()
 	if err != nil {
 		return nil, nil, err
@@ -255,7 +363,7 @@ func (exp *MongoExport) getCursor() (*mgo.Iter, *mgo.Session, error) {
 	flags := 0
 	// don't snapshot if we've been asked not to,
 	// or if we cannot because  we are querying, sorting, or if the collection is a view
-	if !exp.InputOpts.ForceTableScan && len(query) == 0 && exp.InputOpts != nil && exp.InputOpts.Sort == "" && !isView {
+	if !exp.InputOpts.ForceTableScan && len(query) == 0 && exp.InputOpts != nil && exp.InputOpts.Sort == "" && !isView && partition == nil {
 		flags = flags | db.Snapshot
 	}
 
@@ -279,6 +387,15 @@ func (exp *MongoExport) getCursor() (*mgo.Iter, *mgo.Session, error) {
 		}
 	}
 
+	// run the aggregation, spilling to disk so that large pipelines don't
+	// hit the memory limit of their stages
+	if pipeline != nil {
+		if len(exp.OutputOpts.Fields) > 0 {
+			pipeline = append(pipeline, bson.D{{"$project", makeFieldSelector(exp.OutputOpts.Fields)}})
+		}
+		return collection.Pipe(pipeline).AllowDiskUse().Iter(), session, nil
+	}
+
 	// build the query
 	q := collection.Find(query).Sort(sortFields...).Skip(skip).Limit(limit)
 
@@ -308,18 +425,47 @@ func (exp *MongoExport) exportInternal(out io.Writer) (int64, error) {
 		defer exp.ProgressManager.Detach(name)
 	}
 
+	if exp.InputOpts != nil && exp.InputOpts.NumParallelReaders > 1 {
+		return exp.exportParallel(out, watchProgressor)
+	}
+
 	exportOutput, err := exp.getExportOutput(out)
 	if err != nil {
 		return 0, err
 	}
 
-	cursor, session, err := exp.getCursor()
+	cursor, session, err := exp.getCursor(nil)
 	if err != nil {
 		return 0, err
 	}
 	defer session.Close()
 	defer cursor.Close()
 
+	exp.logConnection()
+
+	// Write headers
+	err = exportOutput.WriteHeader()
+	if err != nil {
+		return 0, err
+	}
+
+	// Write document content
+	docsCount, err := writeDocuments(cursor, exportOutput, watchProgressor)
+	if err != nil {
+		return docsCount, err
+	}
+
+	// Write footers
+	err = exportOutput.WriteFooter()
+	if err != nil {
+		return docsCount, err
+	}
+	exportOutput.Flush()
+	return docsCount, nil
+}
+
+// logConnection logs the server that documents are exported from.
+func (exp *MongoExport) logConnection() {
 	connURL := exp.ToolOptions.Host
 	if connURL == "" {
 		connURL = util.DefaultHost
@@ -328,40 +474,33 @@ func (exp *MongoExport) exportInternal(out io.Writer) (int64, error) {
 		connURL = connURL + ":" + exp.ToolOptions.Port
 	}
 	log.Logvf(log.Always, "connected to: %v", connURL)
+}
 
-	// Write headers
-	err = exportOutput.WriteHeader()
-	if err != nil {
-		return 0, err
-	}
+// documentSource is a source of documents to export, such as a cursor.
+type documentSource interface {
+	Next(result interface{}) bool
+	Err() error
+}
 
+// writeDocuments exports the documents of a source to an ExportOutput, and
+// returns how many it exported. The progressor is advanced by that number.
+func writeDocuments(source documentSource, exportOutput ExportOutput, progressor progress.Updateable) (int64, error) {
 	var result bson.D
 
 	docsCount := int64(0)
-
-	// Write document content
-	for cursor.Next(&result) {
+	for source.Next(&result) {
 		err := exportOutput.ExportDocument(result)
 		if err != nil {
+			progressor.Inc(docsCount % watchProgressorUpdateFrequency)
 			return docsCount, err
 		}
 		docsCount++
 		if docsCount%watchProgressorUpdateFrequency == 0 {
-			watchProgressor.Set(docsCount)
+			progressor.Inc(watchProgressorUpdateFrequency)
 		}
 	}
-	watchProgressor.Set(docsCount)
-	if err := cursor.Err(); err != nil {
-		return docsCount, err
-	}
-
-	// Write footers
-	err = exportOutput.WriteFooter()
-	if err != nil {
-		return docsCount, err
-	}
-	exportOutput.Flush()
-	return docsCount, nil
+	progressor.Inc(docsCount % watchProgressorUpdateFrequency)
+	return docsCount, source.Err()
 }
 
 // Export executes the entire export operation. It returns an integer of the count
@@ -401,9 +540,39 @@ func (exp *MongoExport) getExportOutput(out io.Writer) (ExportOutput, error) {
 			}
 		}
 
-		return NewCSVExportOutput(exportFields, exp.OutputOpts.NoHeaderLine, out), nil
+		dialect, err := exp.csvDialect()
+		if err != nil {
+			return nil, err
+		}
+		encoding, err := charset.Lookup(exp.OutputOpts.Encoding)
+		if err != nil {
+			return nil, err
+		}
+		encoder := encoding.NewEncoder(out)
+		csvExporter := NewCSVExportOutput(exportFields, exp.OutputOpts.NoHeaderLine, encoder)
+		csvExporter.csvWriter.SetDialect(dialect)
+		csvExporter.encoder = encoder
+		return csvExporter, nil
+	}
+	if exp.OutputOpts.Type == PARQUET {
+		codec, err := parquet.ParseCodec(exp.OutputOpts.ParquetCompression)
+		if err != nil {
+			return nil, err
+		}
+		var schema *parquet.Schema
+		if exp.OutputOpts.ParquetSchemaFile != "" {
+			schema, err = ReadParquetSchemaFile(exp.OutputOpts.ParquetSchemaFile)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return NewParquetExportOutput(schema, exp.OutputOpts.ParquetSampleSize, codec, out), nil
 	}
-	return NewJSONExportOutput(exp.OutputOpts.JSONArray, exp.OutputOpts.Pretty, out), nil
+	jsonFormat, err := json.ParseFormat(exp.OutputOpts.JSONFormat)
+	if err != nil {
+		return nil, err
+	}
+	return NewJSONExportOutput(exp.OutputOpts.JSONArray, exp.OutputOpts.Pretty, jsonFormat, out), nil
 }
 
 // getObjectFromByteArg takes an object in extended JSON, and converts it to an object that
@@ -423,6 +592,30 @@ func getObjectFromByteArg(queryRaw []byte) (map[string]interface{}, error) {
 	return parsedJSON, nil
 }
 
+// getPipelineFromByteArg takes an aggregation pipeline in extended JSON, which
+// must be an array of stage documents, and converts it to a list of stages that
+// can be passed to db.collection.aggregate(...). The order of the keys of the
+// stages is preserved.
+func getPipelineFromByteArg(pipelineRaw []byte) ([]bson.D, error) {
+	var pipeline []bson.D
+	err := json.Unmarshal(pipelineRaw, &pipeline)
+	if err != nil {
+		return nil, fmt.Errorf("pipeline '%s' is not valid JSON: %v", pipelineRaw, err)
+	}
+	if pipeline == nil {
+		return nil, fmt.Errorf("pipeline '%s' must be an array of stages", pipelineRaw)
+	}
+	for i, stage := range pipeline {
+		if len(stage) != 1 {
+			return nil, fmt.Errorf("pipeline stage #%v must have exactly one field, the name of the stage", i+1)
+		}
+		if _, err = bsonutil.ConvertJSONValueToBSON(stage); err != nil {
+			return nil, fmt.Errorf("pipeline stage #%v: %v", i+1, err)
+		}
+	}
+	return pipeline, nil
+}
+
 // getSortFromArg takes a sort specification in JSON and returns it as a bson.D
 // object which preserves the ordering of the keys as they appear in the input.
 func getSortFromArg(queryRaw string) (bson.D, error) {
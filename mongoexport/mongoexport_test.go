@@ -3,11 +3,13 @@ package mongoexport
 import (
 	"encoding/json"
 	"github.com/mongodb/mongo-tools/common/bsonutil"
+	"github.com/mongodb/mongo-tools/common/options"
 	"github.com/mongodb/mongo-tools/common/testutil"
 	. "github.com/smartystreets/goconvey/convey"
 	"gopkg.in/mgo.v2/bson"
 	"os"
 	"testing"
+	"time"
 )
 
 func TestExtendedJSON(t *testing.T) {
@@ -42,3 +44,56 @@ func TestFieldSelect(t *testing.T) {
 		So(makeFieldSelector("x,foo.baz"), ShouldResemble, bson.M{"_id": 1, "foo": 1, "x": 1})
 	})
 }
+
+func TestPipeline(t *testing.T) {
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("Parsing a pipeline should keep the order of its stages and fields", t, func() {
+		pipeline, err := getPipelineFromByteArg([]byte(`[{"$match": {"d": {"$gt": {"$date": 0}}}}, {"$sort": {"b": 1, "a": -1}}]`))
+		So(err, ShouldBeNil)
+		So(len(pipeline), ShouldEqual, 2)
+		So(pipeline[1], ShouldResemble, bson.D{{"$sort", bson.D{{"b", int32(1)}, {"a", int32(-1)}}}})
+		match := pipeline[0][0].Value.(bson.D)
+		gt := match[0].Value.(bson.D)
+		So(gt[0].Value, ShouldHaveSameTypeAs, time.Time{})
+	})
+
+	Convey("Invalid pipelines should be rejected", t, func() {
+		for _, invalid := range []string{
+			`{"$match": {}}`,
+			`[1]`,
+			`[{"$match": {}, "$sort": {"a": 1}}]`,
+			`[{}]`,
+			`null`,
+			`[{"$match": {]`,
+		} {
+			_, err := getPipelineFromByteArg([]byte(invalid))
+			So(err, ShouldNotBeNil)
+		}
+	})
+
+	Convey("With a pipeline", t, func() {
+		exp := MongoExport{
+			OutputOpts: &OutputFormatOptions{Type: JSON},
+			InputOpts:  &InputOptions{Pipeline: `[{"$match": {"a": 1}}]`},
+		}
+		exp.ToolOptions.Namespace = &options.Namespace{Collection: "c"}
+		So(exp.ValidateSettings(), ShouldBeNil)
+
+		Convey("the options of a query should be rejected", func() {
+			exp.InputOpts.Query = `{"a": 1}`
+			So(exp.ValidateSettings(), ShouldNotBeNil)
+			exp.InputOpts.Query = ""
+			exp.InputOpts.Sort = `{"a": 1}`
+			So(exp.ValidateSettings(), ShouldNotBeNil)
+			exp.InputOpts.Sort = ""
+			exp.InputOpts.Limit = 1
+			So(exp.ValidateSettings(), ShouldNotBeNil)
+		})
+
+		Convey("a pipeline file should not be allowed as well", func() {
+			exp.InputOpts.PipelineFile = "pipeline.json"
+			So(exp.ValidateSettings(), ShouldNotBeNil)
+		})
+	})
+}
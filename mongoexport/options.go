@@ -7,7 +7,7 @@ import (
 
 var Usage = `<options>
 
-Export data from MongoDB in CSV or JSON format.
+Export data from MongoDB in CSV, JSON or Parquet format.
 
 See http://docs.mongodb.org/manual/reference/program/mongoexport/ for more information.`
 
@@ -19,8 +19,8 @@ type OutputFormatOptions struct {
 	// FieldFile is a filename that refers to a list of fields to export, 1 per line.
 	FieldFile string `long:"fieldFile" value-name:"<filename>" description:"file with field names - 1 per line"`
 
-	// Type selects the type of output to export as (json or csv).
-	Type string `long:"type" value-name:"<type>" default:"json" default-mask:"-" description:"the output format, either json or csv (defaults to 'json')"`
+	// Type selects the type of output to export as (json, csv or parquet).
+	Type string `long:"type" value-name:"<type>" default:"json" default-mask:"-" description:"the output format, either json, csv or parquet (defaults to 'json')"`
 
 	// Deprecated: allow legacy --csv option in place of --type=csv
 	CSVOutputType bool `long:"csv" default:"false" hidden:"true"`
@@ -34,8 +34,35 @@ type OutputFormatOptions struct {
 	// Pretty displays JSON data in a human-readable form.
 	Pretty bool `long:"pretty" description:"output JSON formatted to be human-readable"`
 
+	// JSONFormat is the flavor of Extended JSON to write.
+	JSONFormat string `long:"jsonFormat" value-name:"<format>" default:"legacy" default-mask:"-" description:"the Extended JSON format to write, either canonical, relaxed or legacy (defaults to 'legacy')"`
+
+	// ParquetSchemaFile is a file with the Parquet schema to export with.
+	ParquetSchemaFile string `long:"parquetSchemaFile" value-name:"<filename>" description:"file with the Parquet schema of the exported rows, in the message syntax of the Parquet tools; inferred from the first documents if not specified"`
+
+	// ParquetSampleSize is the number of documents to infer the Parquet schema from.
+	ParquetSampleSize int `long:"parquetSampleSize" value-name:"<count>" default:"1000" default-mask:"-" description:"number of documents to infer the Parquet schema from (defaults to 1000)"`
+
+	// ParquetCompression is the codec to compress Parquet pages with.
+	ParquetCompression string `long:"parquetCompression" value-name:"<codec>" default:"snappy" default-mask:"-" description:"the compression of Parquet data, either none, snappy, gzip or zstd, which requires a build with the zstd tag (defaults to 'snappy')"`
+
+	// SplitOutput writes each partition read with --numParallelReaders to its own file.
+	SplitOutput bool `long:"splitOutput" description:"with --numParallelReaders, write each range to its own file, named after --out with the number of the range before the extension, rather than merging them into --out in order, which spools the ranges to temporary files as large as the collection"`
+
 	// NoHeaderLine, if set, will export CSV data without a list of field names at the first line.
 	NoHeaderLine bool `long:"noHeaderLine" description:"export CSV data without a list of field names at the first line"`
+
+	// Delimiter is the character that separates the fields of CSV output.
+	Delimiter string `long:"delimiter" value-name:"<char>" default:"," default-mask:"-" description:"character that separates fields in CSV output, e.g. ';' or '\\t' for a tab (defaults to ',')"`
+
+	// QuoteChar is the character that quotes the fields of CSV output.
+	QuoteChar string `long:"quoteChar" value-name:"<char>" default:"\"" default-mask:"-" description:"character that quotes fields in CSV output (defaults to '\"')"`
+
+	// EscapeChar is the character written before quotes in quoted fields of CSV output.
+	EscapeChar string `long:"escapeChar" value-name:"<char>" description:"character written before the quote and escape characters in quoted fields of CSV output, e.g. '\\'; by default a quote is escaped by doubling it"`
+
+	// Encoding is the character encoding to write CSV output in.
+	Encoding string `long:"encoding" value-name:"<encoding>" default:"utf-8" default-mask:"-" description:"character encoding of CSV output: utf-8, utf-16, utf-16le, utf-16be, latin1 or windows-1252 (defaults to 'utf-8')"`
 }
 
 // Name returns a human-readable group name for output format options.
@@ -45,15 +72,19 @@ func (*OutputFormatOptions) Name() string {
 
 // InputOptions defines the set of options to use in retrieving data from the server.
 type InputOptions struct {
-	Query          string `long:"query" value-name:"<json>" short:"q" description:"query filter, as a JSON string, e.g., '{x:{$gt:1}}'"`
-	QueryFile      string `long:"queryFile" value-name:"<filename>" description:"path to a file containing a query filter (JSON)"`
-	SlaveOk        bool   `long:"slaveOk" short:"k" description:"allow secondary reads if available (default true)" default:"false" default-mask:"-"`
-	ReadPreference string `long:"readPreference" value-name:"<string>|<json>" description:"specify either a preference name or a preference json object"`
-	ForceTableScan bool   `long:"forceTableScan" description:"force a table scan (do not use $snapshot)"`
-	Skip           int    `long:"skip" value-name:"<count>" description:"number of documents to skip"`
-	Limit          int    `long:"limit" value-name:"<count>" description:"limit the number of documents to export"`
-	Sort           string `long:"sort" value-name:"<json>" description:"sort order, as a JSON string, e.g. '{x:1}'"`
-	AssertExists   bool   `long:"assertExists" default:"false" description:"if specified, export fails if the collection does not exist"`
+	Query              string `long:"query" value-name:"<json>" short:"q" description:"query filter, as a JSON string, e.g., '{x:{$gt:1}}'"`
+	QueryFile          string `long:"queryFile" value-name:"<filename>" description:"path to a file containing a query filter (JSON)"`
+	SlaveOk            bool   `long:"slaveOk" short:"k" description:"allow secondary reads if available (default true)" default:"false" default-mask:"-"`
+	ReadPreference     string `long:"readPreference" value-name:"<string>|<json>" description:"specify either a preference name or a preference json object"`
+	ForceTableScan     bool   `long:"forceTableScan" description:"force a table scan (do not use $snapshot)"`
+	Skip               int    `long:"skip" value-name:"<count>" description:"number of documents to skip"`
+	Limit              int    `long:"limit" value-name:"<count>" description:"limit the number of documents to export"`
+	Sort               string `long:"sort" value-name:"<json>" description:"sort order, as a JSON string, e.g. '{x:1}'"`
+	AssertExists       bool   `long:"assertExists" default:"false" description:"if specified, export fails if the collection does not exist"`
+	Pipeline           string `long:"pipeline" value-name:"<json>" description:"aggregation pipeline whose results are exported, as a JSON array of stages, e.g. '[{$match:{x:1}},{$sort:{y:1}}]'"`
+	PipelineFile       string `long:"pipelineFile" value-name:"<filename>" description:"path to a file containing an aggregation pipeline (JSON)"`
+	NumParallelReaders int    `long:"numParallelReaders" value-name:"<count>" default:"1" default-mask:"-" description:"number of ranges of --partitionField to split the collection into and read in parallel; unless --splitOutput is set, the ranges are spooled to temporary files next to --out, which need as much free space as the collection (defaults to 1)"`
+	PartitionField     string `long:"partitionField" value-name:"<field>" description:"indexed field whose ranges are read in parallel with --numParallelReaders, and by which the export is ordered (defaults to '_id')"`
 }
 
 // Name returns a human-readable group name for input options.
@@ -77,3 +108,20 @@ func (inputOptions *InputOptions) GetQuery() ([]byte, error) {
 	}
 	panic("GetQuery can return valid values only for query or queryFile input")
 }
+
+func (inputOptions *InputOptions) HasPipeline() bool {
+	return inputOptions.Pipeline != "" || inputOptions.PipelineFile != ""
+}
+
+func (inputOptions *InputOptions) GetPipeline() ([]byte, error) {
+	if inputOptions.Pipeline != "" {
+		return []byte(inputOptions.Pipeline), nil
+	} else if inputOptions.PipelineFile != "" {
+		content, err := ioutil.ReadFile(inputOptions.PipelineFile)
+		if err != nil {
+			err = fmt.Errorf("error reading pipelineFile: %s", err)
+		}
+		return content, err
+	}
+	panic("GetPipeline can return valid values only for pipeline or pipelineFile input")
+}
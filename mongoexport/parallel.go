@@ -0,0 +1,288 @@
+package mongoexport
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/mongodb/mongo-tools/common/db"
+	"github.com/mongodb/mongo-tools/common/log"
+	"github.com/mongodb/mongo-tools/common/progress"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// validateParallel validates the options for reading the collection in
+// partitions, with several readers.
+func (exp *MongoExport) validateParallel() error {
+	inputOpts := exp.InputOpts
+	if inputOpts.NumParallelReaders < 0 {
+		return fmt.Errorf("--numParallelReaders must be positive")
+	}
+	if inputOpts.NumParallelReaders <= 1 {
+		if inputOpts.PartitionField != "" {
+			return fmt.Errorf("cannot use --partitionField without --numParallelReaders")
+		}
+		if exp.OutputOpts.SplitOutput {
+			return fmt.Errorf("cannot use --splitOutput without --numParallelReaders")
+		}
+		return nil
+	}
+
+	// the documents of each partition are read in the order of the partition
+	// field, so the options that order or count them across the collection
+	// can't be applied
+	switch {
+	case inputOpts.HasPipeline():
+		return fmt.Errorf("cannot use --pipeline with --numParallelReaders")
+	case inputOpts.Sort != "":
+		return fmt.Errorf("cannot use --sort with --numParallelReaders; documents are sorted by --partitionField")
+	case inputOpts.Skip != 0:
+		return fmt.Errorf("cannot use --skip with --numParallelReaders")
+	case inputOpts.Limit != 0:
+		return fmt.Errorf("cannot use --limit with --numParallelReaders")
+	case inputOpts.ForceTableScan:
+		return fmt.Errorf("cannot use --forceTableScan with --numParallelReaders")
+	case exp.OutputOpts.SplitOutput && exp.OutputOpts.OutputFile == "":
+		return fmt.Errorf("--splitOutput requires --out")
+	}
+
+	if inputOpts.PartitionField == "" {
+		inputOpts.PartitionField = "_id"
+	}
+	if strings.HasPrefix(inputOpts.PartitionField, "$") {
+		return fmt.Errorf("invalid --partitionField '%v'", inputOpts.PartitionField)
+	}
+	for _, name := range strings.Split(inputOpts.PartitionField, ".") {
+		if name == "" {
+			return fmt.Errorf("invalid --partitionField '%v'", inputOpts.PartitionField)
+		}
+	}
+	return nil
+}
+
+// partitionFilename returns the name of the file a partition is written to
+// with --splitOutput, which is the --out file with the number of the
+// partition before its extension, e.g. "out.2.json".
+func partitionFilename(filename string, i int) string {
+	ext := filepath.Ext(filename)
+	return fmt.Sprintf("%v.%v%v", strings.TrimSuffix(filename, ext), i, ext)
+}
+
+// exportParallel splits the collection into ranges of the --partitionField,
+// and reads them concurrently. The ranges are written either to a file each
+// with --splitOutput, or to out in the order of the field.
+func (exp *MongoExport) exportParallel(out io.Writer, progressor progress.Updateable) (int64, error) {
+	session, err := exp.SessionProvider.GetSession()
+	if err != nil {
+		return 0, err
+	}
+	collection := session.DB(exp.ToolOptions.Namespace.DB).C(exp.ToolOptions.Namespace.Collection)
+	partitions, err := db.SplitFieldRanges(collection, exp.InputOpts.PartitionField, exp.InputOpts.NumParallelReaders)
+	session.Close()
+	if err != nil {
+		return 0, err
+	}
+	log.Logvf(log.Info, "reading %v ranges of '%v' in parallel", len(partitions), exp.InputOpts.PartitionField)
+
+	exp.logConnection()
+
+	if exp.OutputOpts.SplitOutput {
+		return exp.exportPartitionFiles(partitions, progressor)
+	}
+	return exp.exportPartitionsMerged(out, partitions, progressor)
+}
+
+// exportPartitionFiles exports each partition to its own file, concurrently.
+func (exp *MongoExport) exportPartitionFiles(partitions []db.FieldRange, progressor progress.Updateable) (int64, error) {
+	var docsCount int64
+	errs := make(chan error, len(partitions))
+	for i := range partitions {
+		go func(i int) {
+			count, err := exp.exportPartitionFile(i, &partitions[i], progressor)
+			atomic.AddInt64(&docsCount, count)
+			errs <- err
+		}(i)
+	}
+
+	var err error
+	for range partitions {
+		if partitionErr := <-errs; partitionErr != nil && err == nil {
+			err = partitionErr
+		}
+	}
+	return atomic.LoadInt64(&docsCount), err
+}
+
+func (exp *MongoExport) exportPartitionFile(i int, partition *db.FieldRange, progressor progress.Updateable) (int64, error) {
+	filename := partitionFilename(exp.OutputOpts.OutputFile, i)
+	file, err := createOutputFile(filename)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	exportOutput, err := exp.getExportOutput(file)
+	if err != nil {
+		return 0, err
+	}
+	count, err := exp.exportPartition(partition, exportOutput, progressor)
+	if err != nil {
+		return count, fmt.Errorf("error exporting to %v: %v", filename, err)
+	}
+	if err = exportOutput.Flush(); err != nil {
+		return count, err
+	}
+	log.Logvf(log.Info, "exported %v records to %v", count, filename)
+	return count, nil
+}
+
+// exportPartition exports the documents of a partition to an ExportOutput,
+// with its header and footer.
+func (exp *MongoExport) exportPartition(partition *db.FieldRange, exportOutput ExportOutput, progressor progress.Updateable) (int64, error) {
+	cursor, session, err := exp.getCursor(partition)
+	if session != nil {
+		defer session.Close()
+	}
+	if err != nil {
+		return 0, err
+	}
+	defer cursor.Close()
+
+	if err = exportOutput.WriteHeader(); err != nil {
+		return 0, err
+	}
+	count, err := writeDocuments(cursor, exportOutput, progressor)
+	if err != nil {
+		return count, err
+	}
+	return count, exportOutput.WriteFooter()
+}
+
+// exportPartitionsMerged reads the partitions concurrently into temporary
+// files, and writes each of them to out in order once it is read, so that the
+// export is ordered by the partition field. The temporary files are created
+// next to the --out file, or in the system's temporary directory, and take as
+// much space as the collection until the export is done. If the export fails,
+// the partitions still being read are stopped before the files are removed.
+func (exp *MongoExport) exportPartitionsMerged(out io.Writer, partitions []db.FieldRange, progressor progress.Updateable) (int64, error) {
+	exportOutput, err := exp.getExportOutput(out)
+	if err != nil {
+		return 0, err
+	}
+	tempDir := os.TempDir()
+	if exp.OutputOpts.OutputFile != "" {
+		tempDir = filepath.Dir(exp.OutputOpts.OutputFile)
+	}
+
+	spools := make([]*os.File, len(partitions))
+	done := make([]chan error, len(partitions))
+	stop := make(chan struct{})
+	readers := &sync.WaitGroup{}
+	defer func() {
+		close(stop)
+		readers.Wait()
+		for _, spool := range spools {
+			if spool != nil {
+				spool.Close()
+				os.Remove(spool.Name())
+			}
+		}
+	}()
+	for i := range partitions {
+		spools[i], err = ioutil.TempFile(tempDir, "mongoexport-")
+		if err != nil {
+			return 0, fmt.Errorf("error creating temporary file: %v", err)
+		}
+		done[i] = make(chan error, 1)
+		readers.Add(1)
+		go func(i int) {
+			defer readers.Done()
+			out := newSpoolOutput(spools[i])
+			out.stop = stop
+			_, err := exp.exportPartition(&partitions[i], out, progressor)
+			if err == nil {
+				err = out.Flush()
+			}
+			done[i] <- err
+		}(i)
+	}
+
+	if err = exportOutput.WriteHeader(); err != nil {
+		return 0, err
+	}
+	var docsCount int64
+	for i, spool := range spools {
+		if err = <-done[i]; err != nil {
+			return docsCount, err
+		}
+		if _, err = spool.Seek(0, io.SeekStart); err != nil {
+			return docsCount, err
+		}
+		source := db.NewDecodedBSONSource(db.NewBSONSource(ioutil.NopCloser(bufio.NewReader(spool))))
+		// the documents were counted in the progress as they were read
+		count, err := writeDocuments(source, exportOutput, progress.NewCounter(0))
+		docsCount += count
+		if err != nil {
+			return docsCount, err
+		}
+	}
+
+	if err = exportOutput.WriteFooter(); err != nil {
+		return docsCount, err
+	}
+	return docsCount, exportOutput.Flush()
+}
+
+// errExportStopped is returned when spooling the documents of a partition
+// that is no longer needed because the export failed.
+var errExportStopped = errors.New("export stopped")
+
+// spoolOutput is an ExportOutput that writes documents as BSON, to hold the
+// partitions read in parallel until they are exported in order.
+type spoolOutput struct {
+	out *bufio.Writer
+	// stop is closed when the documents are no longer needed, if it is set
+	stop <-chan struct{}
+}
+
+func newSpoolOutput(out io.Writer) *spoolOutput {
+	return &spoolOutput{out: bufio.NewWriter(out)}
+}
+
+// WriteHeader is part of the ExportOutput interface, and writes nothing.
+func (spool *spoolOutput) WriteHeader() error {
+	return nil
+}
+
+// ExportDocument is part of the ExportOutput interface, and writes a document
+// as BSON.
+func (spool *spoolOutput) ExportDocument(document bson.D) error {
+	select {
+	case <-spool.stop:
+		return errExportStopped
+	default:
+	}
+	raw, err := bson.Marshal(document)
+	if err != nil {
+		return err
+	}
+	_, err = spool.out.Write(raw)
+	return err
+}
+
+// WriteFooter is part of the ExportOutput interface, and writes nothing.
+func (spool *spoolOutput) WriteFooter() error {
+	return nil
+}
+
+// Flush is part of the ExportOutput interface.
+func (spool *spoolOutput) Flush() error {
+	return spool.out.Flush()
+}
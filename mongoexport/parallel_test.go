@@ -0,0 +1,230 @@
+package mongoexport
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mongodb/mongo-tools/common/db"
+	"github.com/mongodb/mongo-tools/common/json"
+	"github.com/mongodb/mongo-tools/common/options"
+	"github.com/mongodb/mongo-tools/common/progress"
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func TestValidateParallel(t *testing.T) {
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With parallel readers", t, func() {
+		exp := MongoExport{
+			OutputOpts: &OutputFormatOptions{Type: JSON},
+			InputOpts:  &InputOptions{NumParallelReaders: 4},
+		}
+		exp.ToolOptions.Namespace = &options.Namespace{Collection: "c"}
+
+		Convey("the collection should be partitioned by _id by default", func() {
+			So(exp.ValidateSettings(), ShouldBeNil)
+			So(exp.InputOpts.PartitionField, ShouldEqual, "_id")
+		})
+
+		Convey("a query should be allowed, but not the options that order the export", func() {
+			exp.InputOpts.Query = `{"a": 1}`
+			So(exp.ValidateSettings(), ShouldBeNil)
+			exp.InputOpts.Sort = `{"a": 1}`
+			So(exp.ValidateSettings(), ShouldNotBeNil)
+			exp.InputOpts.Sort = ""
+			exp.InputOpts.Skip = 10
+			So(exp.ValidateSettings(), ShouldNotBeNil)
+		})
+
+		Convey("invalid partition fields should be rejected", func() {
+			exp.InputOpts.PartitionField = "a..b"
+			So(exp.ValidateSettings(), ShouldNotBeNil)
+			exp.InputOpts.PartitionField = "$a"
+			So(exp.ValidateSettings(), ShouldNotBeNil)
+		})
+
+		Convey("split output should require an output file", func() {
+			exp.OutputOpts.SplitOutput = true
+			So(exp.ValidateSettings(), ShouldNotBeNil)
+			exp.OutputOpts.OutputFile = "out.json"
+			So(exp.ValidateSettings(), ShouldBeNil)
+
+			writer, err := exp.GetOutputWriter()
+			So(err, ShouldBeNil)
+			So(writer, ShouldBeNil)
+		})
+	})
+
+	Convey("Without parallel readers", t, func() {
+		exp := MongoExport{
+			OutputOpts: &OutputFormatOptions{Type: JSON, SplitOutput: true, OutputFile: "out.json"},
+			InputOpts:  &InputOptions{NumParallelReaders: 1},
+		}
+		exp.ToolOptions.Namespace = &options.Namespace{Collection: "c"}
+
+		Convey("the options of partitions should be rejected", func() {
+			So(exp.ValidateSettings(), ShouldNotBeNil)
+			exp.OutputOpts.SplitOutput = false
+			exp.InputOpts.PartitionField = "a"
+			So(exp.ValidateSettings(), ShouldNotBeNil)
+		})
+	})
+}
+
+func TestPartitionOutput(t *testing.T) {
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("Partition files should be named after the output file", t, func() {
+		So(partitionFilename("out/export.json", 2), ShouldEqual, "out/export.2.json")
+		So(partitionFilename("export", 0), ShouldEqual, "export.0")
+	})
+
+	Convey("Documents spooled as BSON should be exported as they were read", t, func() {
+		spooled := &bytes.Buffer{}
+		spool := newSpoolOutput(spooled)
+		docs := []bson.D{{{"_id", 1}, {"a", "x"}}, {{"_id", 2}, {"b", bson.D{{"c", 1.5}}}}}
+		for _, doc := range docs {
+			So(spool.ExportDocument(doc), ShouldBeNil)
+		}
+		So(spool.Flush(), ShouldBeNil)
+
+		out := &bytes.Buffer{}
+		jsonExporter := NewJSONExportOutput(false, false, json.LegacyFormat, out)
+		source := db.NewDecodedBSONSource(db.NewBSONSource(ioutil.NopCloser(spooled)))
+		progressor := progress.NewCounter(2)
+		count, err := writeDocuments(source, jsonExporter, progressor)
+		So(err, ShouldBeNil)
+		So(count, ShouldEqual, 2)
+		So(jsonExporter.Flush(), ShouldBeNil)
+		So(out.String(), ShouldEqual, "{\"_id\":1,\"a\":\"x\"}\n{\"_id\":2,\"b\":{\"c\":1.5}}\n")
+
+		current, _ := progressor.Progress()
+		So(current, ShouldEqual, 2)
+
+		Convey("and spooling should fail once the export is stopped", func() {
+			stop := make(chan struct{})
+			spool.stop = stop
+			So(spool.ExportDocument(docs[0]), ShouldBeNil)
+			close(stop)
+			So(spool.ExportDocument(docs[1]), ShouldEqual, errExportStopped)
+		})
+	})
+}
+
+// exportedIDs returns the _ids of the documents exported as JSON to out.
+func exportedIDs(out []byte) []int {
+	ids := []int{}
+	for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+		doc := struct {
+			ID int `json:"_id"`
+		}{}
+		So(json.Unmarshal([]byte(line), &doc), ShouldBeNil)
+		ids = append(ids, doc.ID)
+	}
+	return ids
+}
+
+func TestExportParallel(t *testing.T) {
+	testutil.VerifyTestType(t, testutil.IntegrationTestType)
+
+	Convey("With a collection exported by parallel readers", t, func() {
+		ssl := testutil.GetSSLOptions()
+		auth := testutil.GetAuthOptions()
+		toolOptions := options.ToolOptions{
+			General:    &options.General{},
+			SSL:        &ssl,
+			Namespace:  &options.Namespace{DB: "mongoexport_parallel", Collection: "docs"},
+			Connection: &options.Connection{Host: "localhost", Port: db.DefaultTestPort},
+			Auth:       &auth,
+		}
+		provider, err := db.NewSessionProvider(toolOptions)
+		So(err, ShouldBeNil)
+		session, err := provider.GetSession()
+		So(err, ShouldBeNil)
+		defer session.Close()
+		collection := session.DB("mongoexport_parallel").C("docs")
+		collection.DropCollection()
+		Reset(func() {
+			collection.DropCollection()
+		})
+
+		// the documents are inserted out of the order of their _ids, so that
+		// the export has to order them
+		const numDocs = 1000
+		expected := make([]int, numDocs)
+		for i := range expected {
+			expected[i] = i
+			So(collection.Insert(bson.M{"_id": i * 7 % numDocs}), ShouldBeNil)
+		}
+
+		outDir, err := ioutil.TempDir("", "mongoexport-parallel-")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(outDir)
+
+		exp := MongoExport{
+			ToolOptions:     toolOptions,
+			OutputOpts:      &OutputFormatOptions{Type: JSON},
+			InputOpts:       &InputOptions{NumParallelReaders: 4},
+			SessionProvider: provider,
+		}
+
+		Convey("the ranges should hold every document once", func() {
+			partitions, err := db.SplitFieldRanges(collection, "_id", 4)
+			So(err, ShouldBeNil)
+			So(len(partitions), ShouldBeGreaterThan, 1)
+			ids := []int{}
+			for _, partition := range partitions {
+				docs := []struct {
+					ID int `bson:"_id"`
+				}{}
+				So(collection.Find(partition.Selector()).Sort("_id").All(&docs), ShouldBeNil)
+				for _, doc := range docs {
+					ids = append(ids, doc.ID)
+				}
+			}
+			So(ids, ShouldResemble, expected)
+		})
+
+		Convey("every document should be exported once, in order, when the "+
+			"ranges are merged", func() {
+			exp.OutputOpts.OutputFile = filepath.Join(outDir, "docs.json")
+			So(exp.ValidateSettings(), ShouldBeNil)
+			out := &bytes.Buffer{}
+			count, err := exp.Export(out)
+			So(err, ShouldBeNil)
+			So(count, ShouldEqual, numDocs)
+			So(exportedIDs(out.Bytes()), ShouldResemble, expected)
+
+			// the temporary files should have been removed
+			files, err := ioutil.ReadDir(outDir)
+			So(err, ShouldBeNil)
+			So(len(files), ShouldEqual, 0)
+		})
+
+		Convey("every document should be exported once, in order, when the "+
+			"ranges are split", func() {
+			exp.OutputOpts.OutputFile = filepath.Join(outDir, "docs.json")
+			exp.OutputOpts.SplitOutput = true
+			So(exp.ValidateSettings(), ShouldBeNil)
+			count, err := exp.Export(nil)
+			So(err, ShouldBeNil)
+			So(count, ShouldEqual, numDocs)
+
+			files, err := ioutil.ReadDir(outDir)
+			So(err, ShouldBeNil)
+			ids := []int{}
+			for i := range files {
+				out, err := ioutil.ReadFile(partitionFilename(exp.OutputOpts.OutputFile, i))
+				So(err, ShouldBeNil)
+				ids = append(ids, exportedIDs(out)...)
+			}
+			So(ids, ShouldResemble, expected)
+		})
+	})
+}
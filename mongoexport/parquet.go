@@ -0,0 +1,507 @@
+package mongoexport
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"time"
+
+	"github.com/mongodb/mongo-tools/common/bsonutil"
+	"github.com/mongodb/mongo-tools/common/json"
+	"github.com/mongodb/mongo-tools/common/log"
+	"github.com/mongodb/mongo-tools/common/options"
+	"github.com/mongodb/mongo-tools/common/parquet"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// maxDecimalPrecision is the number of digits of the decimals of inferred
+// schemas, which are stored in 16 bytes like BSON decimals.
+const maxDecimalPrecision = 38
+
+// ParquetExportOutput is an implementation of ExportOutput that writes documents
+// to the output as the rows of a Parquet file.
+type ParquetExportOutput struct {
+	// Schema of the rows written. If it is nil, the schema is inferred from the
+	// first SampleSize documents, which are held until it is.
+	Schema *parquet.Schema
+
+	// SampleSize is the number of documents to infer the schema from.
+	SampleSize int
+
+	// Codec the pages of the file are compressed with.
+	Codec parquet.Codec
+
+	// NumExported maintains a running total of the number of documents written.
+	NumExported int64
+
+	out    io.Writer
+	writer *parquet.Writer
+
+	// inferred is set if the schema was inferred from the sample
+	inferred bool
+	sample   []bson.D
+
+	// dropped records the fields that aren't in the schema, which are only
+	// logged once
+	dropped map[string]bool
+}
+
+// NewParquetExportOutput returns a ParquetExportOutput configured to write
+// rows with the given schema to the given io.Writer, or with a schema inferred
+// from the first sampleSize documents if schema is nil.
+func NewParquetExportOutput(schema *parquet.Schema, sampleSize int, codec parquet.Codec, out io.Writer) *ParquetExportOutput {
+	return &ParquetExportOutput{
+		Schema:     schema,
+		SampleSize: sampleSize,
+		Codec:      codec,
+		out:        out,
+		dropped:    map[string]bool{},
+	}
+}
+
+// ReadParquetSchemaFile reads a Parquet schema in the message syntax of the
+// Parquet tools from the given file.
+func ReadParquetSchemaFile(path string) (*parquet.Schema, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading parquetSchemaFile: %v", err)
+	}
+	schema, err := parquet.ParseSchema(string(content))
+	if err != nil {
+		return nil, fmt.Errorf("error parsing parquetSchemaFile: %v", err)
+	}
+	return schema, nil
+}
+
+// WriteHeader starts the Parquet file if its schema is known.
+func (parquetExporter *ParquetExportOutput) WriteHeader() error {
+	if parquetExporter.Schema == nil {
+		return nil
+	}
+	return parquetExporter.startFile()
+}
+
+// WriteFooter writes the rows held to infer the schema from, if there are
+// fewer of them than the sample size, and the footer of the Parquet file.
+func (parquetExporter *ParquetExportOutput) WriteFooter() error {
+	if parquetExporter.writer == nil {
+		if err := parquetExporter.writeSample(); err != nil {
+			return err
+		}
+	}
+	return parquetExporter.writer.Close()
+}
+
+// Flush is a no-op for Parquet export formats, since rows are written in row
+// groups and the file is only complete once its footer is written.
+func (parquetExporter *ParquetExportOutput) Flush() error {
+	return nil
+}
+
+// ExportDocument writes a document as a row of the Parquet file, or holds it
+// until the schema is inferred.
+func (parquetExporter *ParquetExportOutput) ExportDocument(document bson.D) error {
+	if parquetExporter.writer == nil {
+		parquetExporter.sample = append(parquetExporter.sample, document)
+		if len(parquetExporter.sample) < parquetExporter.SampleSize {
+			return nil
+		}
+		return parquetExporter.writeSample()
+	}
+	return parquetExporter.writeRow(document)
+}
+
+func (parquetExporter *ParquetExportOutput) startFile() error {
+	writer, err := parquet.NewWriter(parquetExporter.out, parquetExporter.Schema, parquet.WriterOptions{
+		Codec:     parquetExporter.Codec,
+		CreatedBy: fmt.Sprintf("mongoexport version %v", options.VersionStr),
+	})
+	if err != nil {
+		return err
+	}
+	parquetExporter.writer = writer
+	return nil
+}
+
+// writeSample infers the schema from the documents held, starts the file and
+// writes them.
+func (parquetExporter *ParquetExportOutput) writeSample() error {
+	if len(parquetExporter.sample) == 0 {
+		return fmt.Errorf("no documents to infer a parquet schema from; use --parquetSchemaFile to specify one")
+	}
+	schema, err := inferParquetSchema(parquetExporter.sample)
+	if err != nil {
+		return fmt.Errorf("error inferring parquet schema: %v", err)
+	}
+	log.Logvf(log.Info, "inferred parquet schema from %v documents:\n%v", len(parquetExporter.sample), schema)
+	parquetExporter.Schema = schema
+	parquetExporter.inferred = true
+	if err = parquetExporter.startFile(); err != nil {
+		return err
+	}
+	sample := parquetExporter.sample
+	parquetExporter.sample = nil
+	for _, document := range sample {
+		if err = parquetExporter.writeRow(document); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (parquetExporter *ParquetExportOutput) writeRow(document bson.D) error {
+	row, err := parquetExporter.groupValue(parquetExporter.Schema.Root, "", document)
+	if err == nil {
+		err = parquetExporter.writer.Write(row)
+	}
+	if err != nil {
+		if parquetExporter.inferred {
+			return fmt.Errorf("error writing document #%v to parquet: %v; the schema was inferred "+
+				"from the first %v documents, use --parquetSchemaFile to specify one that fits",
+				parquetExporter.NumExported+1, err, parquetExporter.SampleSize)
+		}
+		return fmt.Errorf("error writing document #%v to parquet: %v", parquetExporter.NumExported+1, err)
+	}
+	parquetExporter.NumExported++
+	return nil
+}
+
+// groupValue converts a document to the value of a group of the schema. prefix
+// is the dotted path of the group.
+func (parquetExporter *ParquetExportOutput) groupValue(node *parquet.Node, prefix string, document bson.D) (parquet.Group, error) {
+	group := make(parquet.Group, 0, len(node.Children))
+	for _, elem := range document {
+		path := prefix + elem.Name
+		child := node.Child(elem.Name)
+		if child == nil {
+			if !parquetExporter.dropped[path] {
+				log.Logvf(log.Always, "field '%v' is not in the parquet schema and will not be exported", path)
+				parquetExporter.dropped[path] = true
+			}
+			continue
+		}
+		value, err := parquetExporter.fieldValue(child, path, elem.Value)
+		if err != nil {
+			return nil, err
+		}
+		group = append(group, parquet.Field{Name: elem.Name, Value: value})
+	}
+	return group, nil
+}
+
+// fieldValue converts the value of a document field to the value of the
+// field of the schema at the given path.
+func (parquetExporter *ParquetExportOutput) fieldValue(node *parquet.Node, path string, value interface{}) (interface{}, error) {
+	if value == nil || node.Repetition != parquet.Repeated {
+		return parquetExporter.nodeValue(node, path, value)
+	}
+	array, ok := value.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("repeated field '%v' must be an array, not a %T", path, value)
+	}
+	return parquetExporter.listValue(node, path, array)
+}
+
+func (parquetExporter *ParquetExportOutput) listValue(element *parquet.Node, path string, array []interface{}) ([]interface{}, error) {
+	elements := make([]interface{}, len(array))
+	for i, e := range array {
+		converted, err := parquetExporter.nodeValue(element, fmt.Sprintf("%v.%v", path, i), e)
+		if err != nil {
+			return nil, err
+		}
+		elements[i] = converted
+	}
+	return elements, nil
+}
+
+// nodeValue converts a single value of a field of the schema.
+func (parquetExporter *ParquetExportOutput) nodeValue(node *parquet.Node, path string, value interface{}) (interface{}, error) {
+	if value == nil {
+		return nil, nil
+	}
+	if node.IsLeaf() {
+		v, err := leafValue(node, value)
+		if err != nil {
+			return nil, fmt.Errorf("field '%v': %v", path, err)
+		}
+		return v, nil
+	}
+	if key, valueNode := node.MapKeyValue(); key != nil {
+		document, ok := value.(bson.D)
+		if !ok {
+			return nil, fmt.Errorf("map field '%v' must be a document, not a %T", path, value)
+		}
+		entries := make(parquet.Group, len(document))
+		for i, elem := range document {
+			entries[i].Name = elem.Name
+			if valueNode == nil {
+				continue
+			}
+			converted, err := parquetExporter.nodeValue(valueNode, path+"."+elem.Name, elem.Value)
+			if err != nil {
+				return nil, err
+			}
+			entries[i].Value = converted
+		}
+		return entries, nil
+	}
+	if element := node.ListElement(); element != nil {
+		array, ok := value.([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("list field '%v' must be an array, not a %T", path, value)
+		}
+		return parquetExporter.listValue(element, path, array)
+	}
+	document, ok := value.(bson.D)
+	if !ok {
+		return nil, fmt.Errorf("group field '%v' must be a document, not a %T", path, value)
+	}
+	return parquetExporter.groupValue(node, path+".", document)
+}
+
+// leafValue converts a BSON value to a value the Parquet writer accepts for
+// the given leaf.
+func leafValue(leaf *parquet.Node, value interface{}) (interface{}, error) {
+	switch leaf.Logical.Kind {
+	case parquet.LogicalJSON:
+		return extendedJSONString(value)
+	case parquet.LogicalString, parquet.LogicalEnum:
+		switch v := value.(type) {
+		case string:
+			return v, nil
+		case bson.ObjectId:
+			return v.Hex(), nil
+		case bson.Symbol:
+			return string(v), nil
+		}
+		return nil, fmt.Errorf("can't write a %T value to a %v field", value, leaf.Logical)
+	}
+	switch v := value.(type) {
+	case bson.Decimal128:
+		decimal, err := parquet.ParseDecimal(v.String())
+		if err != nil {
+			return nil, fmt.Errorf("decimal %v can't be written to parquet", v)
+		}
+		return decimal, nil
+	case bson.ObjectId:
+		return v.Hex(), nil
+	case bson.Symbol:
+		return string(v), nil
+	case bson.Binary:
+		if leaf.Logical.Kind == parquet.LogicalUUID && len(v.Data) == 16 {
+			var uuid parquet.UUID
+			copy(uuid[:], v.Data)
+			return uuid, nil
+		}
+		return v.Data, nil
+	}
+	return value, nil
+}
+
+// extendedJSONString returns a value in canonical Extended JSON.
+func extendedJSONString(value interface{}) (string, error) {
+	extendedValue, err := bsonutil.ConvertBSONValueToExtendedJSON(value, json.CanonicalFormat)
+	if err != nil {
+		return "", err
+	}
+	data, err := json.Marshal(extendedValue)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// parquetKind is the kind of Parquet field a BSON value is exported to.
+type parquetKind int
+
+const (
+	kindNull parquetKind = iota
+	kindBoolean
+	kindInt32
+	kindInt64
+	kindDouble
+	kindString
+	kindTimestamp
+	kindDecimal
+	kindBinary
+	kindDocument
+	kindArray
+	// kindJSON fields hold values in Extended JSON, for the BSON types that
+	// have no Parquet equivalent and fields with values of different types.
+	kindJSON
+)
+
+// parquetType is the type of a field inferred from the values it has in a
+// sample of documents.
+type parquetType struct {
+	kind parquetKind
+
+	// scale of decimals
+	scale int
+
+	// fields of documents, in the order they were first seen
+	fields   []string
+	children map[string]*parquetType
+
+	// element type of arrays
+	element *parquetType
+}
+
+// kindOf returns the kind of Parquet field a value is exported to.
+func kindOf(value interface{}) parquetKind {
+	switch v := value.(type) {
+	case nil:
+		return kindNull
+	case bool:
+		return kindBoolean
+	case int, int32:
+		return kindInt32
+	case int64:
+		return kindInt64
+	case float64:
+		return kindDouble
+	case string, bson.Symbol, bson.ObjectId:
+		return kindString
+	case time.Time:
+		return kindTimestamp
+	case bson.Decimal128:
+		if _, err := parquet.ParseDecimal(v.String()); err == nil {
+			return kindDecimal
+		}
+	case bson.Binary, []byte:
+		return kindBinary
+	case bson.D:
+		return kindDocument
+	case []interface{}:
+		return kindArray
+	}
+	return kindJSON
+}
+
+// widen returns the kind of a field with values of both the given kinds.
+func widen(a, b parquetKind) parquetKind {
+	switch {
+	case a == b:
+		return a
+	case a == kindNull:
+		return b
+	case b == kindNull:
+		return a
+	case a == kindInt32 && b == kindInt64, a == kindInt64 && b == kindInt32:
+		return kindInt64
+	case (a == kindInt32 || a == kindInt64) && b == kindDouble,
+		a == kindDouble && (b == kindInt32 || b == kindInt64):
+		return kindDouble
+	}
+	return kindJSON
+}
+
+// add widens the type to fit the given value.
+func (t *parquetType) add(value interface{}) {
+	t.kind = widen(t.kind, kindOf(value))
+	switch v := value.(type) {
+	case bson.Decimal128:
+		if t.kind != kindDecimal {
+			return
+		}
+		decimal, _ := parquet.ParseDecimal(v.String())
+		if decimal.Scale > t.scale {
+			t.scale = decimal.Scale
+		}
+	case bson.D:
+		if t.kind != kindDocument {
+			return
+		}
+		if t.children == nil {
+			t.children = map[string]*parquetType{}
+		}
+		for _, elem := range v {
+			child, ok := t.children[elem.Name]
+			if !ok {
+				child = &parquetType{}
+				t.children[elem.Name] = child
+				t.fields = append(t.fields, elem.Name)
+			}
+			child.add(elem.Value)
+		}
+	case []interface{}:
+		if t.kind != kindArray {
+			return
+		}
+		if t.element == nil {
+			t.element = &parquetType{}
+		}
+		for _, element := range v {
+			t.element.add(element)
+		}
+	}
+}
+
+// node returns the optional field of the schema with the given name for the
+// type.
+func (t *parquetType) node(name string) *parquet.Node {
+	node := &parquet.Node{Name: name, Repetition: parquet.Optional}
+	switch t.kind {
+	case kindBoolean:
+		node.Type = parquet.Boolean
+	case kindInt32:
+		node.Type = parquet.Int32
+	case kindInt64:
+		node.Type = parquet.Int64
+	case kindDouble:
+		node.Type = parquet.Double
+	case kindString:
+		node.Type = parquet.ByteArray
+		node.Logical = parquet.LogicalType{Kind: parquet.LogicalString}
+	case kindTimestamp:
+		node.Type = parquet.Int64
+		node.Logical = parquet.LogicalType{Kind: parquet.LogicalTimestamp, Unit: parquet.Millis, AdjustedToUTC: true}
+	case kindDecimal:
+		scale := t.scale
+		if scale > maxDecimalPrecision {
+			scale = maxDecimalPrecision
+		}
+		node.Type = parquet.FixedLenByteArray
+		node.TypeLength = 16
+		node.Logical = parquet.LogicalType{Kind: parquet.LogicalDecimal, Precision: maxDecimalPrecision, Scale: scale}
+	case kindBinary:
+		node.Type = parquet.ByteArray
+	case kindDocument:
+		if len(t.fields) == 0 {
+			// empty documents have no Parquet equivalent
+			return (&parquetType{kind: kindJSON}).node(name)
+		}
+		for _, field := range t.fields {
+			node.Children = append(node.Children, t.children[field].node(field))
+		}
+	case kindArray:
+		element := &parquetType{}
+		if t.element != nil {
+			element = t.element
+		}
+		node.Logical = parquet.LogicalType{Kind: parquet.LogicalList}
+		node.Children = []*parquet.Node{{
+			Name:       "list",
+			Repetition: parquet.Repeated,
+			Children:   []*parquet.Node{element.node("element")},
+		}}
+	default:
+		// fields that are always null and fields with values of different
+		// types are written in Extended JSON
+		node.Type = parquet.ByteArray
+		node.Logical = parquet.LogicalType{Kind: parquet.LogicalJSON}
+	}
+	return node
+}
+
+// inferParquetSchema returns a schema that fits the given documents, in which
+// all fields are optional.
+func inferParquetSchema(documents []bson.D) (*parquet.Schema, error) {
+	t := &parquetType{}
+	for _, document := range documents {
+		t.add(document)
+	}
+	root := t.node("document")
+	root.Repetition = parquet.Required
+	return parquet.NewSchema(root)
+}
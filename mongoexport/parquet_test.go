@@ -0,0 +1,171 @@
+package mongoexport
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/mongodb/mongo-tools/common/parquet"
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// readParquet reads all the rows of a Parquet file.
+func readParquet(data []byte) (*parquet.Schema, []parquet.Group) {
+	r, err := parquet.NewReader(bytes.NewReader(data), int64(len(data)))
+	So(err, ShouldBeNil)
+	var rows []parquet.Group
+	for {
+		row, err := r.Read()
+		if err == io.EOF {
+			return r.Schema(), rows
+		}
+		So(err, ShouldBeNil)
+		rows = append(rows, row)
+	}
+}
+
+func TestParquetSchemaInference(t *testing.T) {
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With a sample of documents", t, func() {
+		price, err := bson.ParseDecimal128("1.25")
+		So(err, ShouldBeNil)
+		otherPrice, err := bson.ParseDecimal128("100.5")
+		So(err, ShouldBeNil)
+		documents := []bson.D{
+			{
+				{"_id", bson.NewObjectId()},
+				{"n", 1},
+				{"when", time.Unix(0, 0)},
+				{"price", price},
+				{"tags", []interface{}{"a", "b"}},
+				{"address", bson.D{{"city", "Dublin"}}},
+				{"mixed", "text"},
+				{"empty", bson.D{}},
+			},
+			{
+				{"_id", bson.NewObjectId()},
+				{"n", int64(2)},
+				{"price", otherPrice},
+				{"address", bson.D{{"zip", 1}}},
+				{"mixed", true},
+				{"flag", false},
+				{"missing", nil},
+			},
+		}
+
+		Convey("the narrowest type that fits every value should be inferred", func() {
+			schema, err := inferParquetSchema(documents)
+			So(err, ShouldBeNil)
+			So(schema.String(), ShouldEqual, `message document {
+  optional binary _id (STRING);
+  optional int64 n;
+  optional int64 when (TIMESTAMP(MILLIS,true));
+  optional fixed_len_byte_array(16) price (DECIMAL(38,2));
+  optional group tags (LIST) {
+    repeated group list {
+      optional binary element (STRING);
+    }
+  }
+  optional group address {
+    optional binary city (STRING);
+    optional int32 zip;
+  }
+  optional binary mixed (JSON);
+  optional binary empty (JSON);
+  optional boolean flag;
+  optional binary missing (JSON);
+}
+`)
+		})
+
+		Convey("integers and doubles should be widened to doubles", func() {
+			schema, err := inferParquetSchema([]bson.D{{{"x", 1}}, {{"x", 1.5}}})
+			So(err, ShouldBeNil)
+			So(schema.Root.Child("x").Type, ShouldEqual, parquet.Double)
+		})
+	})
+}
+
+func TestWriteParquet(t *testing.T) {
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With a parquet export output", t, func() {
+		out := &bytes.Buffer{}
+		id := bson.NewObjectId()
+		when := time.Date(2018, 6, 1, 8, 0, 0, 0, time.UTC)
+		price, err := bson.ParseDecimal128("-10.50")
+		So(err, ShouldBeNil)
+		document := bson.D{
+			{"_id", id},
+			{"n", 1},
+			{"when", when},
+			{"price", price},
+			{"tags", []interface{}{"a", nil}},
+			{"address", bson.D{{"city", "Dublin"}}},
+			{"code", bson.JavaScript{Code: "f()"}},
+		}
+
+		Convey("documents should be written with an inferred schema", func() {
+			parquetExporter := NewParquetExportOutput(nil, 2, parquet.Snappy, out)
+			So(parquetExporter.WriteHeader(), ShouldBeNil)
+			for i := 0; i < 3; i++ {
+				So(parquetExporter.ExportDocument(document), ShouldBeNil)
+			}
+			So(parquetExporter.ExportDocument(bson.D{{"n", "not a number"}}), ShouldNotBeNil)
+			So(parquetExporter.WriteFooter(), ShouldBeNil)
+			So(parquetExporter.NumExported, ShouldEqual, 3)
+
+			schema, rows := readParquet(out.Bytes())
+			So(schema.String(), ShouldEqual, parquetExporter.Schema.String())
+			So(len(rows), ShouldEqual, 3)
+			decimal, _ := rows[0].Get("price")
+			So(decimal.(parquet.Decimal).String(), ShouldEqual, "-10.50")
+			rows[0][3].Value = nil
+			So(rows[0], ShouldResemble, parquet.Group{
+				{"_id", id.Hex()},
+				{"n", int32(1)},
+				{"when", when},
+				{"price", nil},
+				{"tags", []interface{}{"a", nil}},
+				{"address", parquet.Group{{"city", "Dublin"}}},
+				{"code", `{"$code":"f()"}`},
+			})
+		})
+
+		Convey("documents should be written with the given schema", func() {
+			schema, err := parquet.ParseSchema(`message document {
+				required binary _id (STRING);
+				optional int64 n;
+				optional group address (MAP) {
+					repeated group key_value {
+						required binary key (STRING);
+						optional binary value (STRING);
+					}
+				}
+			}`)
+			So(err, ShouldBeNil)
+			parquetExporter := NewParquetExportOutput(schema, 0, parquet.Uncompressed, out)
+			So(parquetExporter.WriteHeader(), ShouldBeNil)
+			So(parquetExporter.ExportDocument(document), ShouldBeNil)
+			So(parquetExporter.ExportDocument(bson.D{{"n", 2}}), ShouldNotBeNil)
+			So(parquetExporter.WriteFooter(), ShouldBeNil)
+
+			_, rows := readParquet(out.Bytes())
+			So(rows, ShouldResemble, []parquet.Group{{
+				{"_id", id.Hex()},
+				{"n", int64(1)},
+				{"address", parquet.Group{{"city", "Dublin"}}},
+			}})
+		})
+
+		Convey("exporting no documents without a schema should fail", func() {
+			parquetExporter := NewParquetExportOutput(nil, 10, parquet.Snappy, out)
+			So(parquetExporter.WriteHeader(), ShouldBeNil)
+			So(parquetExporter.WriteFooter(), ShouldNotBeNil)
+		})
+	})
+}
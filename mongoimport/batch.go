@@ -0,0 +1,211 @@
+package mongoimport
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/mongodb/mongo-tools/common/log"
+	"github.com/mongodb/mongo-tools/common/progress"
+	"github.com/mongodb/mongo-tools/common/util"
+)
+
+// batchFile is one of the files matched by --files, with the collection it
+// is imported into.
+type batchFile struct {
+	path       string
+	collection string
+}
+
+// batchProgressor implements Progressor to report the progress of importing
+// all the --files, in bytes of the files read so far.
+type batchProgressor struct {
+	sync.Mutex
+	max      int64
+	trackers []sizeTracker
+}
+
+// watch adds the size tracker of a file being imported to the progress.
+func (bp *batchProgressor) watch(tracker sizeTracker) {
+	bp.Lock()
+	defer bp.Unlock()
+	bp.trackers = append(bp.trackers, tracker)
+}
+
+func (bp *batchProgressor) Progress() (int64, int64) {
+	bp.Lock()
+	defer bp.Unlock()
+	var current int64
+	for _, tracker := range bp.trackers {
+		current += tracker.Size()
+	}
+	return current, bp.max
+}
+
+// collectionFromFileName returns the collection that a file is imported into
+// when no collection is specified: its base name without extensions.
+func collectionFromFileName(fileName string) string {
+	fileBaseName := trimCompressionExtension(filepath.Base(fileName))
+	lastDotIndex := strings.LastIndex(fileBaseName, ".")
+	if lastDotIndex != -1 {
+		fileBaseName = fileBaseName[0:lastDotIndex]
+	}
+	return fileBaseName
+}
+
+// expandFiles finds the files matched by --files and the collection each of
+// them is imported into. A file goes into the collection named by the first
+// group of --collectionFromFile, or all of its match if it has no groups, into
+// --collection if that is set instead, or otherwise into the collection named
+// after the file.
+func (imp *MongoImport) expandFiles() ([]batchFile, error) {
+	paths, err := filepath.Glob(util.ToUniversalPath(imp.InputOptions.Files))
+	if err != nil {
+		return nil, fmt.Errorf("invalid --files argument: %v", err)
+	}
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("no files match '%v'", imp.InputOptions.Files)
+	}
+	sort.Strings(paths)
+
+	files := make([]batchFile, 0, len(paths))
+	for _, path := range paths {
+		collection := imp.ToolOptions.Collection
+		if imp.collectionFromFile != nil {
+			match := imp.collectionFromFile.FindStringSubmatch(filepath.Base(path))
+			if match == nil {
+				return nil, fmt.Errorf("file name '%v' does not match --collectionFromFile", filepath.Base(path))
+			}
+			collection = match[0]
+			if len(match) > 1 {
+				collection = match[1]
+			}
+		} else if collection == "" {
+			collection = collectionFromFileName(path)
+		}
+		if err = util.ValidateCollectionName(collection); err != nil {
+			return nil, fmt.Errorf("invalid collection name for file '%v': %v", path, err)
+		}
+		files = append(files, batchFile{path: path, collection: collection})
+	}
+	return files, nil
+}
+
+// forFile returns a MongoImport that imports one of the --files into its
+// collection, reporting its progress to batch.
+func (imp *MongoImport) forFile(file batchFile, batch *batchProgressor) *MongoImport {
+	toolOptions := *imp.ToolOptions
+	namespace := *imp.ToolOptions.Namespace
+	namespace.Collection = file.collection
+	toolOptions.Namespace = &namespace
+
+	inputOptions := *imp.InputOptions
+	inputOptions.Files = ""
+	inputOptions.File = file.path
+
+	// the collections are dropped and the reject file is created once for
+	// all the files
+	ingestOptions := *imp.IngestOptions
+	ingestOptions.Drop = false
+	ingestOptions.RejectFile = ""
+
+	return &MongoImport{
+		ToolOptions:     &toolOptions,
+		InputOptions:    &inputOptions,
+		IngestOptions:   &ingestOptions,
+		SessionProvider: imp.SessionProvider,
+		upsertFields:    imp.upsertFields,
+		rejects:         imp.rejects.forFile(file.path),
+		batch:           batch,
+		transform:       imp.transform,
+	}
+}
+
+// importFiles imports all the --files, up to --numParallelFiles at a time,
+// and logs a summary of each of them. A file that fails to import doesn't
+// stop the others. Returns the total number of documents imported.
+func (imp *MongoImport) importFiles() (uint64, error) {
+	batch := &batchProgressor{}
+	for _, file := range imp.batchFiles {
+		fileStat, err := os.Stat(file.path)
+		if err != nil {
+			return 0, err
+		}
+		batch.max += fileStat.Size()
+	}
+
+	if imp.IngestOptions.Drop {
+		session, err := imp.SessionProvider.GetSession()
+		if err != nil {
+			return 0, err
+		}
+		dropped := map[string]bool{}
+		for _, file := range imp.batchFiles {
+			if dropped[file.collection] {
+				continue
+			}
+			dropped[file.collection] = true
+			if err = imp.dropCollection(session, file.collection); err != nil {
+				session.Close()
+				return 0, err
+			}
+		}
+		session.Close()
+	}
+
+	if imp.IngestOptions.RejectFile != "" {
+		rejectFile, err := os.Create(util.ToUniversalPath(imp.IngestOptions.RejectFile))
+		if err != nil {
+			return 0, fmt.Errorf("error creating reject file: %v", err)
+		}
+		defer rejectFile.Close()
+		imp.rejects = newRejectWriter(rejectFile)
+	}
+
+	bar := &progress.Bar{
+		Name:      fmt.Sprintf("%v files", len(imp.batchFiles)),
+		Watching:  batch,
+		Writer:    log.Writer(0),
+		BarLength: progressBarLength,
+		IsBytes:   true,
+	}
+	bar.Start()
+	defer bar.Stop()
+
+	fileChan := make(chan batchFile, len(imp.batchFiles))
+	for _, file := range imp.batchFiles {
+		fileChan <- file
+	}
+	close(fileChan)
+
+	var numImported, numFailed uint64
+	wg := new(sync.WaitGroup)
+	for i := 0; i < imp.IngestOptions.NumParallelFiles; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for file := range fileChan {
+				numDocs, err := imp.forFile(file, batch).ImportDocuments()
+				atomic.AddUint64(&numImported, numDocs)
+				if err != nil {
+					atomic.AddUint64(&numFailed, 1)
+					log.Logvf(log.Always, "%v: failed after importing %v documents into %v.%v: %v",
+						file.path, numDocs, imp.ToolOptions.DB, file.collection, err)
+					continue
+				}
+				log.Logvf(log.Always, "%v: imported %v documents into %v.%v",
+					file.path, numDocs, imp.ToolOptions.DB, file.collection)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if numFailed > 0 {
+		return numImported, fmt.Errorf("%v of %v files failed to import", numFailed, len(imp.batchFiles))
+	}
+	return numImported, nil
+}
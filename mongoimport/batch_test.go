@@ -0,0 +1,110 @@
+package mongoimport
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// makeBatchDir creates a temporary directory with empty files of the given
+// names.
+func makeBatchDir(names ...string) string {
+	dir, err := ioutil.TempDir("", "mongoimport")
+	So(err, ShouldBeNil)
+	for _, name := range names {
+		So(ioutil.WriteFile(filepath.Join(dir, name), []byte("{}\n"), 0644), ShouldBeNil)
+	}
+	return dir
+}
+
+func TestValidateFiles(t *testing.T) {
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With a directory of files to import", t, func() {
+		dir := makeBatchDir("events_2026-10-02.json", "events_2026-10-01.json", "users.json.gz")
+		defer os.RemoveAll(dir)
+		imp, err := NewMongoImport()
+		So(err, ShouldBeNil)
+		imp.ToolOptions.Namespace.Collection = ""
+
+		Convey("the files should be imported into collections named after them", func() {
+			imp.InputOptions.Files = filepath.Join(dir, "*")
+			So(imp.ValidateSettings([]string{}), ShouldBeNil)
+			So(imp.IngestOptions.NumParallelFiles, ShouldEqual, 1)
+			So(imp.batchFiles, ShouldResemble, []batchFile{
+				{filepath.Join(dir, "events_2026-10-01.json"), "events_2026-10-01"},
+				{filepath.Join(dir, "events_2026-10-02.json"), "events_2026-10-02"},
+				{filepath.Join(dir, "users.json.gz"), "users"},
+			})
+		})
+
+		Convey("the collections should be named by --collectionFromFile or "+
+			"--collection", func() {
+			imp.InputOptions.Files = filepath.Join(dir, "events_*.json")
+			imp.InputOptions.CollectionFromFile = `events_(\d+)-.*\.json`
+			So(imp.ValidateSettings([]string{}), ShouldBeNil)
+			So(imp.batchFiles[0].collection, ShouldEqual, "2026")
+			So(imp.batchFiles[1].collection, ShouldEqual, "2026")
+
+			imp.InputOptions.CollectionFromFile = `events`
+			So(imp.ValidateSettings([]string{}), ShouldBeNil)
+			So(imp.batchFiles[0].collection, ShouldEqual, "events")
+
+			imp.InputOptions.CollectionFromFile = ""
+			imp.ToolOptions.Namespace.Collection = "all"
+			So(imp.ValidateSettings([]string{}), ShouldBeNil)
+			So(imp.batchFiles[1].collection, ShouldEqual, "all")
+		})
+
+		Convey("an error should be thrown if a file name doesn't match "+
+			"--collectionFromFile", func() {
+			imp.InputOptions.Files = filepath.Join(dir, "*")
+			imp.InputOptions.CollectionFromFile = `events_(.*)\.json`
+			So(imp.ValidateSettings([]string{}), ShouldNotBeNil)
+			imp.InputOptions.CollectionFromFile = `events_(`
+			So(imp.ValidateSettings([]string{}), ShouldNotBeNil)
+		})
+
+		Convey("an error should be thrown if no file matches or --files is "+
+			"used with other files", func() {
+			imp.InputOptions.Files = filepath.Join(dir, "*.csv")
+			So(imp.ValidateSettings([]string{}), ShouldNotBeNil)
+			imp.InputOptions.Files = filepath.Join(dir, "*")
+			So(imp.ValidateSettings([]string{"other.json"}), ShouldNotBeNil)
+			imp.InputOptions.File = "other.json"
+			So(imp.ValidateSettings([]string{}), ShouldNotBeNil)
+		})
+
+		Convey("an error should be thrown if --collectionFromFile is used "+
+			"without --files or with --collection", func() {
+			imp.InputOptions.CollectionFromFile = `(.*)\.json`
+			So(imp.ValidateSettings([]string{}), ShouldNotBeNil)
+			imp.InputOptions.Files = filepath.Join(dir, "*.json")
+			imp.ToolOptions.Namespace.Collection = "all"
+			So(imp.ValidateSettings([]string{}), ShouldNotBeNil)
+		})
+	})
+}
+
+func TestBatchProgressor(t *testing.T) {
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("The progress of a batch should add up the progress of its files", t, func() {
+		batch := &batchProgressor{max: 100}
+		current, max := batch.Progress()
+		So(current, ShouldEqual, 0)
+		So(max, ShouldEqual, 100)
+		first := newSizeTrackingReader(nil)
+		first.bytesRead = 10
+		second := newSizeTrackingReader(nil)
+		second.bytesRead = 15
+		batch.watch(first)
+		batch.watch(second)
+		current, _ = batch.Progress()
+		So(current, ShouldEqual, 25)
+	})
+}
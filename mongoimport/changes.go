@@ -0,0 +1,388 @@
+package mongoimport
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/mongodb/mongo-tools/common/db"
+	"github.com/mongodb/mongo-tools/common/util"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// Formats of the change events imported with --mode=changes.
+const (
+	// {op: <op>, key: <selector>, doc: <document>}, where op is one of i
+	// (insert), u (update), r (replace) or d (delete), or spelled out. The
+	// key defaults to the --upsertFields of the document. An update is a
+	// document of update operators, or fields to set.
+	changeFormatOp = "op"
+	// the change events of change streams
+	changeFormatChangeStream = "changeStream"
+	// the entries of the oplog
+	changeFormatOplog = "oplog"
+)
+
+// The operations that change events are applied as.
+const (
+	changeInsert  = "insert"
+	changeUpdate  = "update"
+	changeReplace = "replace"
+	changeDelete  = "delete"
+	changeNoop    = "noop"
+)
+
+// change is a write decoded from a change event.
+type change struct {
+	op string
+	// selector matches the document that is updated, replaced or deleted
+	selector bson.D
+	// doc is the document inserted, the update or the replacement
+	doc bson.D
+}
+
+// errNoChange is returned by changeWriter.Insert for the change events that
+// write nothing, such as no-op oplog entries, which are neither buffered nor
+// counted as imported.
+var errNoChange = errors.New("change event writes nothing")
+
+// changeWriter implements flushInserter to apply the change events imported
+// with --mode=changes as bulk writes, in the order they are read.
+type changeWriter struct {
+	imp  *MongoImport
+	bulk *db.BufferedBulkInserter
+}
+
+func (imp *MongoImport) newChangeWriter(bulk *db.BufferedBulkInserter) *changeWriter {
+	return &changeWriter{
+		imp:  imp,
+		bulk: bulk,
+	}
+}
+
+// Insert is part of the flushInserter interface and buffers the write of a
+// change event.
+func (cw *changeWriter) Insert(doc interface{}) error {
+	c, err := cw.imp.parseChange(doc.(bson.D))
+	if err != nil {
+		return err
+	}
+	switch c.op {
+	case changeInsert:
+		return cw.bulk.Insert(c.doc)
+	case changeUpdate:
+		return cw.bulk.Update(c.selector, c.doc, false)
+	case changeReplace:
+		return cw.bulk.Update(c.selector, c.doc, true)
+	case changeDelete:
+		return cw.bulk.Remove(c.selector)
+	}
+	return errNoChange
+}
+
+// Flush is part of the flushInserter interface and writes the buffered
+// changes.
+func (cw *changeWriter) Flush() error {
+	return cw.bulk.Flush()
+}
+
+// Flushes returns the number of bulk writes made so far.
+func (cw *changeWriter) Flushes() int {
+	return cw.bulk.Flushes()
+}
+
+// parseChange decodes a change event in the --changeFormat.
+func (imp *MongoImport) parseChange(event bson.D) (*change, error) {
+	var c *change
+	var err error
+	switch imp.IngestOptions.ChangeFormat {
+	case changeFormatChangeStream:
+		c, err = parseChangeStreamEvent(event)
+	case changeFormatOplog:
+		c, err = parseOplogEvent(event)
+	default:
+		c, err = imp.parseOpEvent(event)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid change event: %v", err)
+	}
+	if c.op != changeInsert && c.op != changeNoop && len(c.selector) == 0 {
+		return nil, fmt.Errorf("invalid change event: no key for %v", c.op)
+	}
+	return c, nil
+}
+
+func (imp *MongoImport) parseOpEvent(event bson.D) (*change, error) {
+	op, err := changeString(event, "op")
+	if err != nil {
+		return nil, err
+	}
+	c := &change{}
+	if c.doc, err = changeDocument(event, "doc"); err != nil {
+		return nil, err
+	}
+	if c.selector, err = changeDocument(event, "key"); err != nil {
+		return nil, err
+	}
+	if c.selector == nil && c.doc != nil {
+		c.selector = constructUpsertDocument(imp.upsertFields, c.doc)
+	}
+
+	switch op {
+	case "i", changeInsert:
+		c.op = changeInsert
+	case "u", changeUpdate:
+		c.op = changeUpdate
+	case "r", changeReplace:
+		c.op = changeReplace
+	case "d", changeDelete:
+		c.op = changeDelete
+		return c, nil
+	default:
+		return nil, fmt.Errorf("unknown op '%v'", op)
+	}
+	if len(c.doc) == 0 {
+		return nil, fmt.Errorf("no 'doc' for %v", c.op)
+	}
+	if c.op == changeUpdate && !hasUpdateOperators(c.doc) {
+		c.doc = bson.D{{"$set", c.doc}}
+	}
+	return c, nil
+}
+
+func parseChangeStreamEvent(event bson.D) (*change, error) {
+	operationType, err := changeString(event, "operationType")
+	if err != nil {
+		return nil, err
+	}
+	c := &change{op: operationType}
+	if c.selector, err = changeDocument(event, "documentKey"); err != nil {
+		return nil, err
+	}
+	switch operationType {
+	case changeInsert, changeReplace:
+		if c.doc, err = changeDocument(event, "fullDocument"); err != nil {
+			return nil, err
+		}
+		if len(c.doc) == 0 {
+			return nil, fmt.Errorf("no 'fullDocument' for %v", operationType)
+		}
+	case changeUpdate:
+		description, err := changeDocument(event, "updateDescription")
+		if err != nil {
+			return nil, err
+		}
+		updated, err := changeDocument(description, "updatedFields")
+		if err != nil {
+			return nil, err
+		}
+		if len(updated) > 0 {
+			c.doc = append(c.doc, bson.DocElem{Name: "$set", Value: updated})
+		}
+		if value, ok := changeValue(description, "removedFields"); ok && value != nil {
+			removed, ok := value.([]interface{})
+			if !ok {
+				return nil, fmt.Errorf("'removedFields' must be an array")
+			}
+			unset := bson.D{}
+			for _, field := range removed {
+				name, ok := field.(string)
+				if !ok {
+					return nil, fmt.Errorf("'removedFields' must be an array of strings")
+				}
+				unset = append(unset, bson.DocElem{Name: name, Value: ""})
+			}
+			if len(unset) > 0 {
+				c.doc = append(c.doc, bson.DocElem{Name: "$unset", Value: unset})
+			}
+		}
+		if len(c.doc) == 0 {
+			c.op = changeNoop
+		}
+	case changeDelete:
+	default:
+		return nil, fmt.Errorf("unsupported operationType '%v'", operationType)
+	}
+	return c, nil
+}
+
+func parseOplogEvent(event bson.D) (*change, error) {
+	op, err := changeString(event, "op")
+	if err != nil {
+		return nil, err
+	}
+	c := &change{}
+	o, err := changeDocument(event, "o")
+	if err != nil {
+		return nil, err
+	}
+	switch op {
+	case "i":
+		c.op, c.doc = changeInsert, o
+		if len(c.doc) == 0 {
+			return nil, fmt.Errorf("no 'o' for insert")
+		}
+	case "u":
+		if len(o) == 0 {
+			return nil, fmt.Errorf("no 'o' for update")
+		}
+		if c.op, c.doc, err = parseOplogUpdate(o); err != nil {
+			return nil, err
+		}
+		if c.selector, err = changeDocument(event, "o2"); err != nil {
+			return nil, err
+		}
+	case "d":
+		c.op, c.selector = changeDelete, o
+	case "n":
+		c.op = changeNoop
+	default:
+		return nil, fmt.Errorf("unsupported op '%v'", op)
+	}
+	return c, nil
+}
+
+// parseOplogUpdate decodes the 'o' of an update oplog entry, which is either
+// a replacement document or an update in the format of its '$v' field:
+// update operators if it is missing or 1 (before 5.0), or a diff of the
+// document if it is 2 (5.0 and later), which is converted to operators.
+func parseOplogUpdate(o bson.D) (string, bson.D, error) {
+	version, ok := changeValue(o, "$v")
+	if !ok {
+		if hasUpdateOperators(o) {
+			return changeUpdate, o, nil
+		}
+		return changeReplace, o, nil
+	}
+	update := bson.D{}
+	for _, elem := range o {
+		if elem.Name != "$v" {
+			update = append(update, elem)
+		}
+	}
+	v, err := util.ToInt(version)
+	if err != nil {
+		return "", nil, fmt.Errorf("unsupported oplog update format: '$v' must be a number")
+	}
+	switch v {
+	case 1:
+		if !hasUpdateOperators(update) {
+			return "", nil, fmt.Errorf("unsupported oplog update format: expected update operators with '$v' 1")
+		}
+		return changeUpdate, update, nil
+	case 2:
+		diff, err := changeDocument(update, "diff")
+		if err != nil || len(update) != 1 || len(diff) == 0 {
+			return "", nil, fmt.Errorf("unsupported oplog update format: expected a 'diff' document with '$v' 2")
+		}
+		set, unset := bson.D{}, bson.D{}
+		if err = convertOplogDiff(diff, "", &set, &unset); err != nil {
+			return "", nil, fmt.Errorf("unsupported oplog update format: %v", err)
+		}
+		if len(set) > 0 {
+			update = bson.D{{"$set", set}}
+		} else {
+			update = bson.D{}
+		}
+		if len(unset) > 0 {
+			update = append(update, bson.DocElem{Name: "$unset", Value: unset})
+		}
+		if len(update) == 0 {
+			return changeNoop, nil, nil
+		}
+		return changeUpdate, update, nil
+	}
+	return "", nil, fmt.Errorf("unsupported oplog update format: '$v' %v", v)
+}
+
+// convertOplogDiff converts a diff of a document, or of the document at
+// prefix, to the fields set and unset by the update. The fields of a diff
+// are 'u' and 'i' for the fields updated and inserted, 'd' for the fields
+// deleted, and 's<name>' for the diffs of subdocuments and arrays. Arrays
+// that are truncated can't be converted.
+func convertOplogDiff(diff bson.D, prefix string, set, unset *bson.D) error {
+	isArray := false
+	for _, elem := range diff {
+		if elem.Name == "a" {
+			isArray = elem.Value == true
+			if !isArray {
+				return fmt.Errorf("invalid array diff at '%v'", prefix)
+			}
+		}
+	}
+	for _, elem := range diff {
+		var err error
+		switch {
+		case elem.Name == "a":
+		case isArray && elem.Name == "l":
+			err = fmt.Errorf("arrays that are truncated (at '%v') are not supported", prefix)
+		case isArray && strings.HasPrefix(elem.Name, "u"):
+			*set = append(*set, bson.DocElem{Name: prefix + elem.Name[1:], Value: elem.Value})
+		case !isArray && (elem.Name == "u" || elem.Name == "i" || elem.Name == "d"):
+			var fields bson.D
+			if fields, err = changeDocument(diff, elem.Name); err != nil {
+				break
+			}
+			for _, field := range fields {
+				if elem.Name == "d" {
+					*unset = append(*unset, bson.DocElem{Name: prefix + field.Name, Value: ""})
+				} else {
+					*set = append(*set, bson.DocElem{Name: prefix + field.Name, Value: field.Value})
+				}
+			}
+		case strings.HasPrefix(elem.Name, "s") && len(elem.Name) > 1:
+			var sub bson.D
+			if sub, err = changeDocument(diff, elem.Name); err == nil {
+				err = convertOplogDiff(sub, prefix+elem.Name[1:]+".", set, unset)
+			}
+		default:
+			err = fmt.Errorf("unknown diff field '%v'", elem.Name)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// hasUpdateOperators returns whether a document is made of update operators,
+// rather than of the fields of a document.
+func hasUpdateOperators(doc bson.D) bool {
+	return len(doc) > 0 && strings.HasPrefix(doc[0].Name, "$")
+}
+
+func changeValue(event bson.D, name string) (interface{}, bool) {
+	for _, elem := range event {
+		if elem.Name == name {
+			return elem.Value, true
+		}
+	}
+	return nil, false
+}
+
+func changeString(event bson.D, name string) (string, error) {
+	value, ok := changeValue(event, name)
+	if !ok {
+		return "", fmt.Errorf("missing '%v'", name)
+	}
+	s, ok := value.(string)
+	if !ok {
+		return "", fmt.Errorf("'%v' must be a string", name)
+	}
+	return s, nil
+}
+
+// changeDocument returns the subdocument of a change event in a field, or nil
+// if it is missing.
+func changeDocument(event bson.D, name string) (bson.D, error) {
+	value, _ := changeValue(event, name)
+	switch v := value.(type) {
+	case nil:
+		return nil, nil
+	case bson.D:
+		return v, nil
+	case *bson.D:
+		return *v, nil
+	}
+	return nil, fmt.Errorf("'%v' must be a document", name)
+}
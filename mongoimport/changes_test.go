@@ -0,0 +1,299 @@
+package mongoimport
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func TestParseChange(t *testing.T) {
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With a mongoimport instance in changes mode", t, func() {
+		imp, err := NewMongoImport()
+		So(err, ShouldBeNil)
+		imp.IngestOptions.Mode = modeChanges
+		So(imp.ValidateSettings([]string{}), ShouldBeNil)
+		So(imp.IngestOptions.StopOnError, ShouldBeTrue)
+		So(imp.IngestOptions.MaintainInsertionOrder, ShouldBeTrue)
+
+		Convey("op events should be parsed", func() {
+			c, err := imp.parseChange(bson.D{{"op", "i"}, {"doc", bson.D{{"_id", 1}}}})
+			So(err, ShouldBeNil)
+			So(*c, ShouldResemble, change{op: changeInsert, selector: bson.D{{"_id", 1}}, doc: bson.D{{"_id", 1}}})
+
+			c, err = imp.parseChange(bson.D{{"op", "update"}, {"doc", &bson.D{{"_id", 1}, {"a", 2}}}})
+			So(err, ShouldBeNil)
+			So(*c, ShouldResemble, change{
+				op:       changeUpdate,
+				selector: bson.D{{"_id", 1}},
+				doc:      bson.D{{"$set", bson.D{{"_id", 1}, {"a", 2}}}},
+			})
+
+			c, err = imp.parseChange(bson.D{{"op", "u"}, {"key", bson.D{{"k", 1}}}, {"doc", bson.D{{"$inc", bson.D{{"a", 1}}}}}})
+			So(err, ShouldBeNil)
+			So(*c, ShouldResemble, change{op: changeUpdate, selector: bson.D{{"k", 1}}, doc: bson.D{{"$inc", bson.D{{"a", 1}}}}})
+
+			c, err = imp.parseChange(bson.D{{"op", "r"}, {"key", bson.D{{"_id", 1}}}, {"doc", bson.D{{"a", 1}}}})
+			So(err, ShouldBeNil)
+			So(c.op, ShouldEqual, changeReplace)
+
+			c, err = imp.parseChange(bson.D{{"op", "d"}, {"key", bson.D{{"_id", 1}}}})
+			So(err, ShouldBeNil)
+			So(*c, ShouldResemble, change{op: changeDelete, selector: bson.D{{"_id", 1}}})
+		})
+
+		Convey("the key of op events should default to the --upsertFields", func() {
+			imp.IngestOptions.UpsertFields = "a,b"
+			So(imp.ValidateSettings([]string{}), ShouldBeNil)
+			c, err := imp.parseChange(bson.D{{"op", "d"}, {"doc", bson.D{{"_id", 1}, {"a", 2}}}})
+			So(err, ShouldBeNil)
+			So(c.selector, ShouldResemble, bson.D{{"a", 2}, {"b", nil}})
+		})
+
+		Convey("invalid op events should be rejected", func() {
+			for _, event := range []bson.D{
+				{{"doc", bson.D{{"_id", 1}}}},
+				{{"op", 1}, {"doc", bson.D{{"_id", 1}}}},
+				{{"op", "x"}, {"doc", bson.D{{"_id", 1}}}},
+				{{"op", "i"}},
+				{{"op", "i"}, {"doc", "text"}},
+				{{"op", "d"}},
+				{{"op", "u"}, {"key", bson.D{{"_id", 1}}}},
+				{{"op", "r"}, {"doc", bson.D{{"a", 1}}}},
+			} {
+				_, err := imp.parseChange(event)
+				So(err, ShouldNotBeNil)
+			}
+		})
+
+		Convey("change stream events should be parsed", func() {
+			imp.IngestOptions.ChangeFormat = changeFormatChangeStream
+			key := bson.D{{"_id", 1}}
+
+			c, err := imp.parseChange(bson.D{{"operationType", "insert"}, {"documentKey", key}, {"fullDocument", bson.D{{"_id", 1}, {"a", 1}}}})
+			So(err, ShouldBeNil)
+			So(*c, ShouldResemble, change{op: changeInsert, selector: key, doc: bson.D{{"_id", 1}, {"a", 1}}})
+
+			c, err = imp.parseChange(bson.D{
+				{"operationType", "update"},
+				{"documentKey", key},
+				{"updateDescription", bson.D{
+					{"updatedFields", bson.D{{"a", 2}, {"b.c", 3}}},
+					{"removedFields", []interface{}{"d"}},
+				}},
+			})
+			So(err, ShouldBeNil)
+			So(*c, ShouldResemble, change{op: changeUpdate, selector: key, doc: bson.D{
+				{"$set", bson.D{{"a", 2}, {"b.c", 3}}},
+				{"$unset", bson.D{{"d", ""}}},
+			}})
+
+			c, err = imp.parseChange(bson.D{{"operationType", "replace"}, {"documentKey", key}, {"fullDocument", bson.D{{"a", 1}}}})
+			So(err, ShouldBeNil)
+			So(c.op, ShouldEqual, changeReplace)
+
+			c, err = imp.parseChange(bson.D{{"operationType", "delete"}, {"documentKey", key}})
+			So(err, ShouldBeNil)
+			So(*c, ShouldResemble, change{op: changeDelete, selector: key})
+
+			_, err = imp.parseChange(bson.D{{"operationType", "drop"}})
+			So(err, ShouldNotBeNil)
+			_, err = imp.parseChange(bson.D{{"operationType", "delete"}})
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("oplog entries should be parsed", func() {
+			imp.IngestOptions.ChangeFormat = changeFormatOplog
+			key := bson.D{{"_id", 1}}
+
+			c, err := imp.parseChange(bson.D{{"op", "i"}, {"ns", "db.c"}, {"o", bson.D{{"_id", 1}}}})
+			So(err, ShouldBeNil)
+			So(*c, ShouldResemble, change{op: changeInsert, doc: bson.D{{"_id", 1}}})
+
+			c, err = imp.parseChange(bson.D{{"op", "u"}, {"o2", key}, {"o", bson.D{{"$set", bson.D{{"a", 1}}}}}})
+			So(err, ShouldBeNil)
+			So(*c, ShouldResemble, change{op: changeUpdate, selector: key, doc: bson.D{{"$set", bson.D{{"a", 1}}}}})
+
+			c, err = imp.parseChange(bson.D{{"op", "u"}, {"o2", key}, {"o", bson.D{{"a", 1}}}})
+			So(err, ShouldBeNil)
+			So(c.op, ShouldEqual, changeReplace)
+
+			c, err = imp.parseChange(bson.D{{"op", "d"}, {"o", key}})
+			So(err, ShouldBeNil)
+			So(*c, ShouldResemble, change{op: changeDelete, selector: key})
+
+			c, err = imp.parseChange(bson.D{{"op", "n"}, {"o", bson.D{{"msg", "noop"}}}})
+			So(err, ShouldBeNil)
+			So(c.op, ShouldEqual, changeNoop)
+
+			// an update in the oplog of 3.6
+			c, err = imp.parseChange(bson.D{
+				{"ts", bson.MongoTimestamp(6601318919565000705)},
+				{"t", int64(1)},
+				{"h", int64(-3206343581484722117)},
+				{"v", 2},
+				{"op", "u"},
+				{"ns", "test.c"},
+				{"o2", key},
+				{"wall", time.Date(2018, 9, 10, 12, 0, 0, 0, time.UTC)},
+				{"o", bson.D{{"$v", 1}, {"$set", bson.D{{"a", 2}}}}},
+			})
+			So(err, ShouldBeNil)
+			So(*c, ShouldResemble, change{op: changeUpdate, selector: key, doc: bson.D{{"$set", bson.D{{"a", 2}}}}})
+
+			// an update in the oplog of 5.0
+			c, err = imp.parseChange(bson.D{
+				{"op", "u"},
+				{"ns", "test.c"},
+				{"ui", bson.Binary{Kind: 4, Data: []byte("0123456789abcdef")}},
+				{"o", bson.D{{"$v", 2}, {"diff", bson.D{
+					{"u", bson.D{{"a", 2}}},
+					{"d", bson.D{{"b", false}}},
+					{"i", bson.D{{"c", "x"}}},
+					{"sd", bson.D{{"u", bson.D{{"e", 3}}}}},
+					{"sf", bson.D{{"a", true}, {"u1", 4}, {"s2", bson.D{{"d", bson.D{{"g", false}}}}}}},
+				}}}},
+				{"o2", key},
+				{"ts", bson.MongoTimestamp(7014776394616700929)},
+				{"t", int64(1)},
+				{"v", int64(2)},
+				{"wall", time.Date(2021, 10, 1, 12, 0, 0, 0, time.UTC)},
+			})
+			So(err, ShouldBeNil)
+			So(*c, ShouldResemble, change{op: changeUpdate, selector: key, doc: bson.D{
+				{"$set", bson.D{{"a", 2}, {"c", "x"}, {"d.e", 3}, {"f.1", 4}}},
+				{"$unset", bson.D{{"b", ""}, {"f.2.g", ""}}},
+			}})
+
+			c, err = imp.parseChange(bson.D{{"op", "u"}, {"o2", key}, {"o", bson.D{{"$v", 2}, {"diff", bson.D{{"u", bson.D{}}}}}}})
+			So(err, ShouldBeNil)
+			So(c.op, ShouldEqual, changeNoop)
+
+			for _, o := range []bson.D{
+				{{"$v", 2}, {"diff", bson.D{{"sa", bson.D{{"a", true}, {"l", 1}}}}}},
+				{{"$v", 2}, {"diff", bson.D{{"x", bson.D{}}}}},
+				{{"$v", 2}, {"$set", bson.D{{"a", 1}}}},
+				{{"$v", 3}, {"diff", bson.D{{"u", bson.D{{"a", 1}}}}}},
+				{{"$v", 1}, {"a", 1}},
+			} {
+				_, err = imp.parseChange(bson.D{{"op", "u"}, {"o2", key}, {"o", o}})
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldContainSubstring, "unsupported oplog update format")
+			}
+
+			_, err = imp.parseChange(bson.D{{"op", "c"}, {"o", bson.D{{"drop", "c"}}}})
+			So(err, ShouldNotBeNil)
+			_, err = imp.parseChange(bson.D{{"op", "u"}, {"o", bson.D{{"a", 1}}}})
+			So(err, ShouldNotBeNil)
+		})
+	})
+
+	Convey("Change events imported from JSON should be parsed", t, func() {
+		imp, err := NewMongoImport()
+		So(err, ShouldBeNil)
+		imp.IngestOptions.Mode = modeChanges
+		So(imp.ValidateSettings([]string{}), ShouldBeNil)
+		key := bson.D{{"_id", 1}}
+
+		for _, test := range []struct {
+			format string
+			json   string
+			change change
+		}{
+			{changeFormatOp, `{"op": "u", "key": {"_id": 1}, "doc": {"$inc": {"a": NumberLong(1)}}}`,
+				change{op: changeUpdate, selector: key, doc: bson.D{{"$inc", bson.D{{"a", int64(1)}}}}}},
+			{changeFormatChangeStream, `{"operationType": "update", "documentKey": {"_id": 1}, ` +
+				`"updateDescription": {"updatedFields": {"a.b": 2}, "removedFields": ["c"]}}`,
+				change{op: changeUpdate, selector: key, doc: bson.D{{"$set", bson.D{{"a.b", 2}}}, {"$unset", bson.D{{"c", ""}}}}}},
+			{changeFormatOplog, `{"ts": {"$timestamp": {"t": 1633089600, "i": 1}}, "t": NumberLong(1), "op": "u", ` +
+				`"ns": "test.c", "o": {"$v": 2, "diff": {"u": {"a": 2}, "sb": {"d": {"c": false}}}}, "o2": {"_id": 1}}`,
+				change{op: changeUpdate, selector: key, doc: bson.D{{"$set", bson.D{{"a", 2}}}, {"$unset", bson.D{{"b.c", ""}}}}}},
+		} {
+			imp.IngestOptions.ChangeFormat = test.format
+			event, err := JSONConverter{data: []byte(test.json)}.Convert()
+			So(err, ShouldBeNil)
+			c, err := imp.parseChange(event)
+			So(err, ShouldBeNil)
+			So(*c, ShouldResemble, test.change)
+		}
+	})
+
+	Convey("--changeFormat should be validated", t, func() {
+		imp, err := NewMongoImport()
+		So(err, ShouldBeNil)
+		imp.IngestOptions.ChangeFormat = changeFormatOplog
+		So(imp.ValidateSettings([]string{}), ShouldNotBeNil)
+
+		imp.IngestOptions.Mode = modeChanges
+		So(imp.ValidateSettings([]string{}), ShouldBeNil)
+
+		imp.IngestOptions.UpsertFields = "a"
+		So(imp.ValidateSettings([]string{}), ShouldNotBeNil)
+	})
+}
+
+// fakeChangeInserter buffers the change events it is given, except for the
+// events marked as no-ops, and fails to write them when it is flushed.
+type fakeChangeInserter struct {
+	buffered []interface{}
+	flushes  int
+}
+
+func (f *fakeChangeInserter) Insert(doc interface{}) error {
+	if _, ok := changeValue(doc.(bson.D), "noop"); ok {
+		return errNoChange
+	}
+	f.buffered = append(f.buffered, doc)
+	return nil
+}
+
+func (f *fakeChangeInserter) Flush() error {
+	f.flushes++
+	f.buffered = nil
+	return fmt.Errorf("document failed validation")
+}
+
+func (f *fakeChangeInserter) Flushes() int {
+	return f.flushes
+}
+
+func TestInsertChanges(t *testing.T) {
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With change events that write nothing among others", t, func() {
+		imp, err := NewMongoImport()
+		So(err, ShouldBeNil)
+		rejectFile := &bytes.Buffer{}
+		imp.rejects = newRejectWriter(rejectFile)
+		inserter := &fakeChangeInserter{}
+		target := &insertTarget{inserter: inserter, bulkInserter: inserter}
+
+		lines := []string{`{"_id": 1}`, `{"noop": 1}`, `{"_id": 2}`, `{"noop": 2}`}
+		for i, line := range lines {
+			converter := JSONConverter{data: []byte(line), line: uint64(i + 1)}
+			document, err := converter.Convert()
+			So(err, ShouldBeNil)
+			So(imp.insert(target, importDocument{document: document, source: converter}), ShouldBeNil)
+		}
+
+		Convey("only the events that write should be buffered and counted", func() {
+			So(len(inserter.buffered), ShouldEqual, 2)
+			So(len(target.buffered), ShouldEqual, 2)
+			So(target.count, ShouldEqual, 2)
+		})
+
+		Convey("a failed write should reject the events that were written", func() {
+			So(imp.flush(target), ShouldBeNil)
+			So(readRejects(rejectFile), ShouldResemble, []rejectedRecord{
+				{Line: 1, Record: `{"_id": 1}`, Reason: "document failed validation"},
+				{Line: 3, Record: `{"_id": 2}`, Reason: "document failed validation"},
+			})
+		})
+	})
+}
@@ -3,8 +3,11 @@ package mongoimport
 import (
 	"bufio"
 	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
 	"fmt"
 	"io"
+	"path/filepath"
 	"sort"
 	"strconv"
 	"strings"
@@ -12,6 +15,7 @@ import (
 	"sync/atomic"
 
 	"github.com/mongodb/mongo-tools/common/bsonutil"
+	"github.com/mongodb/mongo-tools/common/charset"
 	"github.com/mongodb/mongo-tools/common/db"
 	"github.com/mongodb/mongo-tools/common/log"
 	"github.com/mongodb/mongo-tools/common/util"
@@ -56,6 +60,18 @@ func ParsePG(pg string) (res ParseGrace) {
 // If conversion fails, err will be set.
 type Converter interface {
 	Convert() (document bson.D, err error)
+
+	// Record returns the line of the input source on which the record being
+	// converted starts, and its raw text.
+	Record() (line uint64, raw string)
+}
+
+// importDocument is a document converted from the input source, along with
+// the Converter it was converted by, which identifies the input record it
+// came from if the document has to be rejected.
+type importDocument struct {
+	document bson.D
+	source   Converter
 }
 
 // An importWorker reads Converter from the unprocessedDataChan channel and
@@ -65,7 +81,7 @@ type importWorker struct {
 	unprocessedDataChan chan Converter
 
 	// used to stream the processed document back to the caller
-	processedDocumentChan chan bson.D
+	processedDocumentChan chan importDocument
 
 	// used to synchronise all worker goroutines
 	tomb *tomb.Tomb
@@ -127,6 +143,155 @@ func newBomDiscardingReader(r io.Reader) *bomDiscardingReader {
 	return &bomDiscardingReader{buf: bufio.NewReader(r)}
 }
 
+// Compression formats that mongoimport decompresses while reading its input.
+const (
+	compressionNone  = ""
+	compressionGzip  = "gzip"
+	compressionBzip2 = "bzip2"
+	compressionZstd  = "zstd"
+)
+
+var (
+	gzipMagic  = []byte{0x1F, 0x8B, 0x08}
+	zstdMagic  = []byte{0x28, 0xB5, 0x2F, 0xFD}
+	bzip2Magic = []byte("BZh")
+
+	// a bzip2 stream starts with either a block or, if it is empty, the
+	// end-of-stream marker
+	bzip2BlockMagic = []byte{0x31, 0x41, 0x59, 0x26, 0x53, 0x59}
+	bzip2EndMagic   = []byte{0x17, 0x72, 0x45, 0x38, 0x50, 0x90}
+
+	// compressionExtensions maps file extensions to the compression they imply
+	compressionExtensions = map[string]string{
+		".gz":  compressionGzip,
+		".bz2": compressionBzip2,
+		".zst": compressionZstd,
+	}
+)
+
+// compressionHeaderSize is the number of bytes needed to recognize any of the
+// supported compression formats.
+const compressionHeaderSize = 10
+
+// detectCompression returns the compression format of an input, given its
+// first bytes and its file name. The magic bytes take precedence; the
+// extension is only used when they don't match any format.
+func detectCompression(header []byte, fileName string) string {
+	switch {
+	case bytes.HasPrefix(header, gzipMagic):
+		return compressionGzip
+	case bytes.HasPrefix(header, zstdMagic):
+		return compressionZstd
+	case len(header) >= compressionHeaderSize && bytes.HasPrefix(header, bzip2Magic) &&
+		header[3] >= '1' && header[3] <= '9' &&
+		(bytes.Equal(header[4:10], bzip2BlockMagic) || bytes.Equal(header[4:10], bzip2EndMagic)):
+		return compressionBzip2
+	}
+	return compressionExtensions[strings.ToLower(filepath.Ext(fileName))]
+}
+
+// trimCompressionExtension removes the extension of a compressed file from
+// fileName, such that "data.json.gz" becomes "data.json".
+func trimCompressionExtension(fileName string) string {
+	ext := filepath.Ext(fileName)
+	if _, ok := compressionExtensions[strings.ToLower(ext)]; ok {
+		return strings.TrimSuffix(fileName, ext)
+	}
+	return fileName
+}
+
+// decompressingReader implements io.ReadCloser and sizeTracker by wrapping a
+// compressed input. Read returns the decompressed data, while Size reports the
+// number of compressed bytes consumed so far, which is what the size of the
+// input file is measured in.
+type decompressingReader struct {
+	io.Reader
+	compressed *sizeTrackingReader
+	closers    []io.Closer
+}
+
+func (dr *decompressingReader) Size() int64 {
+	return dr.compressed.Size()
+}
+
+// Close closes the decompressor and then the underlying input.
+func (dr *decompressingReader) Close() error {
+	var err error
+	for _, closer := range dr.closers {
+		if closeErr := closer.Close(); closeErr != nil && err == nil {
+			err = closeErr
+		}
+	}
+	return err
+}
+
+// passthroughReader implements io.ReadCloser for an input that isn't
+// compressed, reading through the buffer used to detect the compression.
+type passthroughReader struct {
+	io.Reader
+	io.Closer
+}
+
+// newDecompressingReader detects whether source is compressed with gzip,
+// bzip2 or zstd and returns a reader that decompresses it while streaming,
+// along with the detected format. An input that isn't compressed is returned
+// as-is, with compressionNone.
+func newDecompressingReader(source io.ReadCloser, fileName string) (io.ReadCloser, string, error) {
+	compressed := newSizeTrackingReader(source)
+	buf := bufio.NewReader(compressed)
+	header, err := buf.Peek(compressionHeaderSize)
+	if err != nil && err != io.EOF {
+		return nil, compressionNone, err
+	}
+
+	dr := &decompressingReader{compressed: compressed}
+	compression := detectCompression(header, fileName)
+	switch compression {
+	case compressionGzip:
+		gzipReader, err := gzip.NewReader(buf)
+		if err != nil {
+			return nil, compression, fmt.Errorf("error reading gzip input: %v", err)
+		}
+		dr.Reader = gzipReader
+		dr.closers = []io.Closer{gzipReader, source}
+	case compressionBzip2:
+		dr.Reader = bzip2.NewReader(buf)
+		dr.closers = []io.Closer{source}
+	case compressionZstd:
+		readCloser, err := newZstdReader(buf)
+		if err != nil {
+			return nil, compression, fmt.Errorf("error reading zstd input: %v", err)
+		}
+		dr.Reader = readCloser
+		dr.closers = []io.Closer{readCloser, source}
+	default:
+		return &passthroughReader{buf, source}, compressionNone, nil
+	}
+	return dr, compression, nil
+}
+
+// transcodingReader implements io.ReadCloser and sizeTracker by wrapping an
+// input in another character encoding. Read returns the input transcoded to
+// UTF-8, while Size reports the number of bytes of the input consumed so far.
+type transcodingReader struct {
+	io.Reader
+	io.Closer
+	sizeTracker
+}
+
+// newTranscodingReader returns a reader that transcodes source from the
+// encoding to UTF-8 while streaming. A source that tracks its own size, like a
+// compressed input, keeps reporting it.
+func newTranscodingReader(source io.ReadCloser, encoding charset.Encoding) *transcodingReader {
+	var in io.Reader = source
+	tracker, ok := source.(sizeTracker)
+	if !ok {
+		sizeTrackingSource := newSizeTrackingReader(source)
+		in, tracker = sizeTrackingSource, sizeTrackingSource
+	}
+	return &transcodingReader{encoding.NewDecoder(in), source, tracker}
+}
+
 // channelQuorumError takes a channel and a quorum - which specifies how many
 // messages to receive on that channel before returning. It either returns the
 // first non-nil error received on the channel or nil if up to `quorum` nil
@@ -161,7 +326,7 @@ func constructUpsertDocument(upsertFields []string, document bson.D) bson.D {
 // an outputChan (output) channel. It sequentially writes unprocessed data read from
 // the input channel to each worker and then sequentially reads the processed data
 // from each worker before passing it on to the output channel
-func doSequentialStreaming(workers []*importWorker, readDocs chan Converter, outputChan chan bson.D) {
+func doSequentialStreaming(workers []*importWorker, readDocs chan Converter, outputChan chan importDocument) {
 	numWorkers := len(workers)
 
 	// feed in the data to be processed and do round-robin
@@ -222,6 +387,55 @@ func getUpsertValue(field string, document bson.D) interface{} {
 	return getUpsertValue(field[index+1:], subDocD)
 }
 
+// unmarshalDocument decodes the BSON document in data like bson.Unmarshal does
+// into a bson.D, with subdocuments as bson.D, except that binary values of the
+// old subtype 0x02 are kept as bson.Binary rather than decoded as []byte, which
+// would be inserted with the generic subtype.
+func unmarshalDocument(data []byte) (bson.D, error) {
+	elems := bson.RawD{}
+	if err := bson.Unmarshal(data, &elems); err != nil {
+		return nil, err
+	}
+	document := make(bson.D, len(elems))
+	for i, elem := range elems {
+		value, err := unmarshalValue(elem.Value)
+		if err != nil {
+			return nil, err
+		}
+		document[i] = bson.DocElem{Name: elem.Name, Value: value}
+	}
+	return document, nil
+}
+
+func unmarshalValue(raw bson.Raw) (interface{}, error) {
+	switch raw.Kind {
+	case 0x03: // document
+		return unmarshalDocument(raw.Data)
+	case 0x04: // array
+		elems := bson.RawD{}
+		if err := bson.Unmarshal(raw.Data, &elems); err != nil {
+			return nil, err
+		}
+		array := make([]interface{}, len(elems))
+		for i, elem := range elems {
+			value, err := unmarshalValue(elem.Value)
+			if err != nil {
+				return nil, err
+			}
+			array[i] = value
+		}
+		return array, nil
+	}
+	var value interface{}
+	if err := raw.Unmarshal(&value); err != nil {
+		return nil, err
+	}
+	if data, ok := value.([]byte); ok && raw.Kind == 0x05 && len(raw.Data) > 4 && raw.Data[4] == 0x02 {
+		return bson.Binary{Kind: 0x02, Data: data}, nil
+	}
+	return value, nil
+}
+
 // filterIngestError accepts a boolean indicating if a non-nil error should be,
 // returned as an actual error.
 //
@@ -294,7 +508,7 @@ func setNestedValue(key string, value interface{}, document *bson.D) {
 // channel in parallel and then sends over the processed data to the outputChan
 // channel - either in sequence or concurrently (depending on the value of
 // ordered) - in which the data was received
-func streamDocuments(ordered bool, numDecoders int, readDocs chan Converter, outputChan chan bson.D) (retErr error) {
+func streamDocuments(ordered bool, numDecoders int, readDocs chan Converter, outputChan chan importDocument) (retErr error) {
 	if numDecoders == 0 {
 		numDecoders = 1
 	}
@@ -306,7 +520,7 @@ func streamDocuments(ordered bool, numDecoders int, readDocs chan Converter, out
 	for i := 0; i < numDecoders; i++ {
 		if ordered {
 			inChan = make(chan Converter, workerBufferSize)
-			outChan = make(chan bson.D, workerBufferSize)
+			outChan = make(chan importDocument, workerBufferSize)
 		}
 		iw := &importWorker{
 			unprocessedDataChan:   inChan,
@@ -338,10 +552,13 @@ func streamDocuments(ordered bool, numDecoders int, readDocs chan Converter, out
 }
 
 // coercionError should only be used as a specific error type to check
-// whether tokensToBSON wants the row to print
-type coercionError struct{}
+// whether tokensToBSON wants the row to print. It describes the token that
+// could not be parsed.
+type coercionError struct {
+	reason string
+}
 
-func (coercionError) Error() string { return "coercionError" }
+func (ce coercionError) Error() string { return ce.reason }
 
 // tokensToBSON reads in slice of records - along with ordered column names -
 // and returns a BSON document for the record.
@@ -366,7 +583,9 @@ func tokensToBSON(colSpecs []ColumnSpec, tokens []string, numProcessed uint64, i
 					continue
 				case pgSkipRow:
 					log.Logvf(log.Always, "skipping row #%d: %v", numProcessed, tokens)
-					return nil, coercionError{}
+					return nil, coercionError{fmt.Sprintf("type coercion failure for column '%s', "+
+						"could not parse token '%s' to type %s",
+						colSpecs[index].Name, token, colSpecs[index].TypeName)}
 				case pgStop:
 					return nil, fmt.Errorf("type coercion failure in document #%d for column '%s', "+
 						"could not parse token '%s' to type %s",
@@ -464,7 +683,7 @@ func (iw *importWorker) processDocuments(ordered bool) error {
 			if document == nil {
 				continue
 			}
-			iw.processedDocumentChan <- document
+			iw.processedDocumentChan <- importDocument{document, converter}
 		case <-iw.tomb.Dying():
 			return nil
 		}
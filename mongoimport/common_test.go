@@ -140,6 +140,29 @@ func TestValidateFields(t *testing.T) {
 	})
 }
 
+func TestDetectCompression(t *testing.T) {
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+	Convey("Given the start of an input and its file name", t, func() {
+		bzip2Header := append([]byte("BZh9"), bzip2BlockMagic...)
+		Convey("the magic bytes should determine the compression", func() {
+			So(detectCompression([]byte{0x1F, 0x8B, 0x08, 0x00}, "data.json"), ShouldEqual, compressionGzip)
+			So(detectCompression([]byte{0x28, 0xB5, 0x2F, 0xFD, 0x24}, ""), ShouldEqual, compressionZstd)
+			So(detectCompression(bzip2Header, "data.gz"), ShouldEqual, compressionBzip2)
+		})
+		Convey("the extension should be used if the magic bytes don't match", func() {
+			So(detectCompression([]byte("a,b,c"), "data.csv.gz"), ShouldEqual, compressionGzip)
+			So(detectCompression([]byte("a,b,c"), "DATA.CSV.ZST"), ShouldEqual, compressionZstd)
+			So(detectCompression(nil, "data.tsv.bz2"), ShouldEqual, compressionBzip2)
+		})
+		Convey("text that happens to start like a bzip2 stream should not be "+
+			"mistaken for one", func() {
+			So(detectCompression([]byte("BZh1,name,value"), "data.csv"), ShouldEqual, compressionNone)
+			So(detectCompression([]byte(`{"a": 1}`), "data.json"), ShouldEqual, compressionNone)
+			So(detectCompression(nil, ""), ShouldEqual, compressionNone)
+		})
+	})
+}
+
 func TestGetUpsertValue(t *testing.T) {
 	testutil.VerifyTestType(t, testutil.UnitTestType)
 
@@ -170,6 +193,33 @@ func TestGetUpsertValue(t *testing.T) {
 	})
 }
 
+func TestUnmarshalDocument(t *testing.T) {
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("BSON documents should be decoded with native values", t, func() {
+		data, err := bson.Marshal(bson.D{
+			{"a", bson.D{{"b", 4}, {"c", []interface{}{int64(5), bson.D{{"d", "x"}}}}}},
+			{"e", nil},
+			{"f", bson.Binary{Kind: 0x02, Data: []byte("hi")}},
+			{"g", bson.Binary{Kind: 0x00, Data: []byte("hi")}},
+		})
+		So(err, ShouldBeNil)
+		document, err := unmarshalDocument(data)
+		So(err, ShouldBeNil)
+		So(document, ShouldResemble, bson.D{
+			{"a", bson.D{{"b", 4}, {"c", []interface{}{int64(5), bson.D{{"d", "x"}}}}}},
+			{"e", nil},
+			{"f", bson.Binary{Kind: 0x02, Data: []byte("hi")}},
+			{"g", []byte("hi")},
+		})
+		So(getUpsertValue("a.b", document), ShouldEqual, 4)
+
+		redone, err := bson.Marshal(document)
+		So(err, ShouldBeNil)
+		So(redone, ShouldResemble, data)
+	})
+}
+
 func TestConstructUpsertDocument(t *testing.T) {
 	testutil.VerifyTestType(t, testutil.UnitTestType)
 
@@ -417,7 +467,7 @@ func TestProcessDocuments(t *testing.T) {
 		Convey("processDocuments should execute the expected conversion for documents, "+
 			"pass then on the output channel, and close the input channel if ordered is true", func() {
 			inputChannel := make(chan Converter, 100)
-			outputChannel := make(chan bson.D, 100)
+			outputChannel := make(chan importDocument, 100)
 			iw := &importWorker{
 				unprocessedDataChan:   inputChannel,
 				processedDocumentChan: outputChannel,
@@ -428,10 +478,10 @@ func TestProcessDocuments(t *testing.T) {
 			close(inputChannel)
 			So(iw.processDocuments(true), ShouldBeNil)
 			doc1, open := <-outputChannel
-			So(doc1, ShouldResemble, expectedDocuments[0])
+			So(doc1.document, ShouldResemble, expectedDocuments[0])
 			So(open, ShouldEqual, true)
 			doc2, open := <-outputChannel
-			So(doc2, ShouldResemble, expectedDocuments[1])
+			So(doc2.document, ShouldResemble, expectedDocuments[1])
 			So(open, ShouldEqual, true)
 			_, open = <-outputChannel
 			So(open, ShouldEqual, false)
@@ -439,7 +489,7 @@ func TestProcessDocuments(t *testing.T) {
 		Convey("processDocuments should execute the expected conversion for documents, "+
 			"pass then on the output channel, and leave the input channel open if ordered is false", func() {
 			inputChannel := make(chan Converter, 100)
-			outputChannel := make(chan bson.D, 100)
+			outputChannel := make(chan importDocument, 100)
 			iw := &importWorker{
 				unprocessedDataChan:   inputChannel,
 				processedDocumentChan: outputChannel,
@@ -450,10 +500,10 @@ func TestProcessDocuments(t *testing.T) {
 			close(inputChannel)
 			So(iw.processDocuments(false), ShouldBeNil)
 			doc1, open := <-outputChannel
-			So(doc1, ShouldResemble, expectedDocuments[0])
+			So(doc1.document, ShouldResemble, expectedDocuments[0])
 			So(open, ShouldEqual, true)
 			doc2, open := <-outputChannel
-			So(doc2, ShouldResemble, expectedDocuments[1])
+			So(doc2.document, ShouldResemble, expectedDocuments[1])
 			So(open, ShouldEqual, true)
 			// close will throw a runtime error if outputChannel is already closed
 			close(outputChannel)
@@ -466,14 +516,14 @@ func TestDoSequentialStreaming(t *testing.T) {
 
 	Convey("Given some import workers, a Converters input channel and an bson.D output channel", t, func() {
 		inputChannel := make(chan Converter, 5)
-		outputChannel := make(chan bson.D, 5)
+		outputChannel := make(chan importDocument, 5)
 		workerInputChannel := []chan Converter{
 			make(chan Converter),
 			make(chan Converter),
 		}
-		workerOutputChannel := []chan bson.D{
-			make(chan bson.D),
-			make(chan bson.D),
+		workerOutputChannel := []chan importDocument{
+			make(chan importDocument),
+			make(chan importDocument),
 		}
 		importWorkers := []*importWorker{
 			&importWorker{
@@ -499,7 +549,7 @@ func TestDoSequentialStreaming(t *testing.T) {
 			close(inputChannel)
 			doSequentialStreaming(importWorkers, inputChannel, outputChannel)
 			for _, document := range expectedDocuments {
-				So(<-outputChannel, ShouldResemble, document)
+				So((<-outputChannel).document, ShouldResemble, document)
 			}
 		})
 	})
@@ -513,7 +563,7 @@ func TestStreamDocuments(t *testing.T) {
 			3. an output channel where processed documents are streamed out`, t, func() {
 
 		inputChannel := make(chan Converter, 5)
-		outputChannel := make(chan bson.D, 5)
+		outputChannel := make(chan importDocument, 5)
 
 		Convey("the entire pipeline should complete without error under normal circumstances", func() {
 			// stream in some documents
@@ -525,7 +575,7 @@ func TestStreamDocuments(t *testing.T) {
 
 			// ensure documents are streamed out and processed in the correct manner
 			for _, expectedDocument := range expectedDocuments {
-				So(<-outputChannel, ShouldResemble, expectedDocument)
+				So((<-outputChannel).document, ShouldResemble, expectedDocument)
 			}
 		})
 		Convey("the entire pipeline should complete with error if an error is encountered", func() {
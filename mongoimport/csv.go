@@ -1,11 +1,10 @@
 package mongoimport
 
 import (
-	gocsv "encoding/csv"
 	"fmt"
 	"io"
 
-	"github.com/mongodb/mongo-tools/mongoimport/csv"
+	"github.com/mongodb/mongo-tools/common/csv"
 	"gopkg.in/mgo.v2/bson"
 )
 
@@ -18,11 +17,19 @@ type CSVInputReader struct {
 	csvReader *csv.Reader
 
 	// csvRejectWriter is where coercion-failed rows are written, if applicable
-	csvRejectWriter *gocsv.Writer
+	csvRejectWriter *csv.Writer
+
+	// rejects is where coercion-failed rows are written along with their line
+	// number and the reason, if a reject file is used
+	rejects *rejectWriter
 
 	// csvRecord stores each line of input we read from the underlying reader
 	csvRecord []string
 
+	// sample holds the records read to infer the column types from, until
+	// they are streamed
+	sample []CSVConverter
+
 	// numProcessed tracks the number of CSV records processed by the underlying reader
 	numProcessed uint64
 
@@ -40,9 +47,12 @@ type CSVInputReader struct {
 type CSVConverter struct {
 	colSpecs     []ColumnSpec
 	data         []string
+	raw          string
 	index        uint64
+	line         uint64
 	ignoreBlanks bool
-	rejectWriter *gocsv.Writer
+	rejectWriter *csv.Writer
+	rejects      *rejectWriter
 }
 
 // NewCSVInputReader returns a CSVInputReader configured to read data from the
@@ -57,7 +67,7 @@ func NewCSVInputReader(colSpecs []ColumnSpec, in io.Reader, rejects io.Writer, n
 	return &CSVInputReader{
 		colSpecs:        colSpecs,
 		csvReader:       csvReader,
-		csvRejectWriter: gocsv.NewWriter(rejects),
+		csvRejectWriter: csv.NewWriter(rejects),
 		numProcessed:    uint64(0),
 		numDecoders:     numDecoders,
 		sizeTracker:     szCount,
@@ -65,6 +75,13 @@ func NewCSVInputReader(colSpecs []ColumnSpec, in io.Reader, rejects io.Writer, n
 	}
 }
 
+// setDialect sets the delimiter, quote, escape and comment characters of the
+// input. Rows that fail to be imported are printed in the same dialect.
+func (r *CSVInputReader) setDialect(dialect csv.Dialect) {
+	r.csvReader.SetDialect(dialect)
+	r.csvRejectWriter.SetDialect(dialect)
+}
+
 // ReadAndValidateHeader reads the header from the underlying reader and validates
 // the header fields. It sets err if the read/validation fails.
 func (r *CSVInputReader) ReadAndValidateHeader() (err error) {
@@ -90,16 +107,55 @@ func (r *CSVInputReader) ReadAndValidateTypedHeader(parseGrace ParseGrace) (err
 	return validateReaderFields(ColumnNames(r.colSpecs))
 }
 
+// InferColumnTypes reads up to sampleSize records from the underlying reader
+// and gives each column the narrowest type that parses all of its values.
+// Returns the typed field list. The records read are still imported.
+func (r *CSVInputReader) InferColumnTypes(sampleSize int, parseGrace ParseGrace) ([]string, error) {
+	var records [][]string
+	for len(records) < sampleSize {
+		record, err := r.csvReader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("read error on entry #%v: %v", r.numProcessed+1, err)
+		}
+		records = append(records, record)
+		r.sample = append(r.sample, CSVConverter{
+			data:         record,
+			raw:          r.csvReader.RecordText(),
+			index:        r.numProcessed,
+			line:         uint64(r.csvReader.RecordLine()),
+			ignoreBlanks: r.ignoreBlanks,
+			rejectWriter: r.csvRejectWriter,
+			rejects:      r.rejects,
+		})
+		r.numProcessed++
+	}
+	typedFields := inferTypedHeaders(ColumnNames(r.colSpecs), records, r.ignoreBlanks)
+	colSpecs, err := ParseTypedHeaders(typedFields, parseGrace)
+	if err != nil {
+		return nil, err
+	}
+	r.colSpecs = colSpecs
+	return typedFields, nil
+}
+
 // StreamDocument takes a boolean indicating if the documents should be streamed
 // in read order and a channel on which to stream the documents processed from
 // the underlying reader. Returns a non-nil error if streaming fails.
-func (r *CSVInputReader) StreamDocument(ordered bool, readDocs chan bson.D) (retErr error) {
+func (r *CSVInputReader) StreamDocument(ordered bool, readDocs chan importDocument) (retErr error) {
 	csvRecordChan := make(chan Converter, r.numDecoders)
 	csvErrChan := make(chan error)
 
 	// begin reading from source
 	go func() {
 		var err error
+		for _, converter := range r.sample {
+			converter.colSpecs = r.colSpecs
+			csvRecordChan <- converter
+		}
+		r.sample = nil
 		for {
 			r.csvRecord, err = r.csvReader.Read()
 			if err != nil {
@@ -115,9 +171,12 @@ func (r *CSVInputReader) StreamDocument(ordered bool, readDocs chan bson.D) (ret
 			csvRecordChan <- CSVConverter{
 				colSpecs:     r.colSpecs,
 				data:         r.csvRecord,
+				raw:          r.csvReader.RecordText(),
 				index:        r.numProcessed,
+				line:         uint64(r.csvReader.RecordLine()),
 				ignoreBlanks: r.ignoreBlanks,
 				rejectWriter: r.csvRejectWriter,
+				rejects:      r.rejects,
 			}
 			r.numProcessed++
 		}
@@ -139,13 +198,18 @@ func (c CSVConverter) Convert() (b bson.D, err error) {
 		c.index,
 		c.ignoreBlanks,
 	)
-	if _, ok := err.(coercionError); ok {
+	if coercionErr, ok := err.(coercionError); ok {
 		c.Print()
-		err = nil
+		err = c.rejects.Reject(c, coercionErr)
 	}
 	return
 }
 
+// Record implements the Converter interface for CSV input.
+func (c CSVConverter) Record() (uint64, string) {
+	return c.line, c.raw
+}
+
 func (c CSVConverter) Print() {
 	c.rejectWriter.Write(c.data)
 }
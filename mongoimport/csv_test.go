@@ -7,6 +7,7 @@ import (
 	"strings"
 	"testing"
 
+	"github.com/mongodb/mongo-tools/common/csv"
 	"github.com/mongodb/mongo-tools/common/log"
 	"github.com/mongodb/mongo-tools/common/options"
 	"github.com/mongodb/mongo-tools/common/testutil"
@@ -31,7 +32,7 @@ func TestCSVStreamDocument(t *testing.T) {
 				{"c", new(FieldAutoParser), pgAutoCast, "auto"},
 			}
 			r := NewCSVInputReader(colSpecs, bytes.NewReader([]byte(contents)), os.Stdout, 1, false)
-			docChan := make(chan bson.D, 1)
+			docChan := make(chan importDocument, 1)
 			So(r.StreamDocument(true, docChan), ShouldNotBeNil)
 		})
 		Convey("escaped quotes are parsed correctly", func() {
@@ -42,7 +43,7 @@ func TestCSVStreamDocument(t *testing.T) {
 				{"c", new(FieldAutoParser), pgAutoCast, "auto"},
 			}
 			r := NewCSVInputReader(colSpecs, bytes.NewReader([]byte(contents)), os.Stdout, 1, false)
-			docChan := make(chan bson.D, 1)
+			docChan := make(chan importDocument, 1)
 			So(r.StreamDocument(true, docChan), ShouldBeNil)
 		})
 		Convey("multiple escaped quotes separated by whitespace parsed correctly", func() {
@@ -58,9 +59,9 @@ func TestCSVStreamDocument(t *testing.T) {
 				{"c", `foo" "bar`},
 			}
 			r := NewCSVInputReader(colSpecs, bytes.NewReader([]byte(contents)), os.Stdout, 1, false)
-			docChan := make(chan bson.D, 1)
+			docChan := make(chan importDocument, 1)
 			So(r.StreamDocument(true, docChan), ShouldBeNil)
-			So(<-docChan, ShouldResemble, expectedRead)
+			So((<-docChan).document, ShouldResemble, expectedRead)
 		})
 		Convey("integer valued strings should be converted", func() {
 			contents := `1, 2, " 3e"`
@@ -75,9 +76,9 @@ func TestCSVStreamDocument(t *testing.T) {
 				{"c", " 3e"},
 			}
 			r := NewCSVInputReader(colSpecs, bytes.NewReader([]byte(contents)), os.Stdout, 1, false)
-			docChan := make(chan bson.D, 1)
+			docChan := make(chan importDocument, 1)
 			So(r.StreamDocument(true, docChan), ShouldBeNil)
-			So(<-docChan, ShouldResemble, expectedRead)
+			So((<-docChan).document, ShouldResemble, expectedRead)
 		})
 		Convey("extra fields should be prefixed with 'field'", func() {
 			contents := `1, 2f , " 3e" , " may"`
@@ -93,9 +94,9 @@ func TestCSVStreamDocument(t *testing.T) {
 				{"field3", " may"},
 			}
 			r := NewCSVInputReader(colSpecs, bytes.NewReader([]byte(contents)), os.Stdout, 1, false)
-			docChan := make(chan bson.D, 1)
+			docChan := make(chan importDocument, 1)
 			So(r.StreamDocument(true, docChan), ShouldBeNil)
-			So(<-docChan, ShouldResemble, expectedRead)
+			So((<-docChan).document, ShouldResemble, expectedRead)
 		})
 		Convey("nested CSV fields should be imported properly", func() {
 			contents := `1, 2f , " 3e" , " may"`
@@ -112,10 +113,10 @@ func TestCSVStreamDocument(t *testing.T) {
 				{"field3", " may"},
 			}
 			r := NewCSVInputReader(colSpecs, bytes.NewReader([]byte(contents)), os.Stdout, 1, false)
-			docChan := make(chan bson.D, 4)
+			docChan := make(chan importDocument, 4)
 			So(r.StreamDocument(true, docChan), ShouldBeNil)
 
-			readDocument := <-docChan
+			readDocument := (<-docChan).document
 			So(readDocument[0], ShouldResemble, expectedRead[0])
 			So(readDocument[1].Name, ShouldResemble, expectedRead[1].Name)
 			So(*readDocument[1].Value.(*bson.D), ShouldResemble, expectedRead[1].Value)
@@ -130,7 +131,7 @@ func TestCSVStreamDocument(t *testing.T) {
 				{"c", new(FieldAutoParser), pgAutoCast, "auto"},
 			}
 			r := NewCSVInputReader(colSpecs, bytes.NewReader([]byte(contents)), os.Stdout, 1, false)
-			docChan := make(chan bson.D, 1)
+			docChan := make(chan importDocument, 1)
 			So(r.StreamDocument(true, docChan), ShouldNotBeNil)
 		})
 		Convey("nested CSV fields causing header collisions should error", func() {
@@ -141,7 +142,7 @@ func TestCSVStreamDocument(t *testing.T) {
 				{"field3", new(FieldAutoParser), pgAutoCast, "auto"},
 			}
 			r := NewCSVInputReader(colSpecs, bytes.NewReader([]byte(contents)), os.Stdout, 1, false)
-			docChan := make(chan bson.D, 1)
+			docChan := make(chan importDocument, 1)
 			So(r.StreamDocument(true, docChan), ShouldNotBeNil)
 		})
 		Convey("calling StreamDocument() for CSVs should return next set of "+
@@ -163,10 +164,10 @@ func TestCSVStreamDocument(t *testing.T) {
 				{"c", int32(6)},
 			}
 			r := NewCSVInputReader(colSpecs, bytes.NewReader([]byte(contents)), os.Stdout, 1, false)
-			docChan := make(chan bson.D, 2)
+			docChan := make(chan importDocument, 2)
 			So(r.StreamDocument(true, docChan), ShouldBeNil)
-			So(<-docChan, ShouldResemble, expectedReadOne)
-			So(<-docChan, ShouldResemble, expectedReadTwo)
+			So((<-docChan).document, ShouldResemble, expectedReadOne)
+			So((<-docChan).document, ShouldResemble, expectedReadTwo)
 		})
 		Convey("valid CSV input file that starts with the UTF-8 BOM should "+
 			"not raise an error", func() {
@@ -189,10 +190,10 @@ func TestCSVStreamDocument(t *testing.T) {
 			fileHandle, err := os.Open("testdata/test_bom.csv")
 			So(err, ShouldBeNil)
 			r := NewCSVInputReader(colSpecs, fileHandle, os.Stdout, 1, false)
-			docChan := make(chan bson.D, len(expectedReads))
+			docChan := make(chan importDocument, len(expectedReads))
 			So(r.StreamDocument(true, docChan), ShouldBeNil)
 			for _, expectedRead := range expectedReads {
-				for i, readDocument := range <-docChan {
+				for i, readDocument := range (<-docChan).document {
 					So(readDocument.Name, ShouldResemble, expectedRead[i].Name)
 					So(readDocument.Value, ShouldResemble, expectedRead[i].Value)
 				}
@@ -201,6 +202,56 @@ func TestCSVStreamDocument(t *testing.T) {
 	})
 }
 
+func TestCSVDialect(t *testing.T) {
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+	Convey("With a CSV input reader with a custom dialect", t, func() {
+		colSpecs := []ColumnSpec{
+			{"a", new(FieldAutoParser), pgAutoCast, "auto"},
+			{"b", new(FieldAutoParser), pgAutoCast, "auto"},
+		}
+
+		Convey("the delimiter, quote, escape and comment characters should "+
+			"be used", func() {
+			contents := "# a comment\n'x;\\'y';a\\;b\n'multi\nline';2\n"
+			r := NewCSVInputReader(colSpecs, bytes.NewReader([]byte(contents)), os.Stdout, 1, false)
+			r.setDialect(csv.Dialect{Comma: ';', Quote: '\'', Escape: '\\', Comment: '#'})
+			docChan := make(chan importDocument, 2)
+			So(r.StreamDocument(true, docChan), ShouldBeNil)
+			first := <-docChan
+			So(first.document, ShouldResemble, bson.D{{"a", "x;'y"}, {"b", "a;b"}})
+			line, raw := first.source.Record()
+			So(line, ShouldEqual, 2)
+			So((<-docChan).document, ShouldResemble, bson.D{{"a", "multi\nline"}, {"b", int32(2)}})
+
+			Convey("and rejected records should keep their raw text", func() {
+				So(raw, ShouldEqual, `'x;\'y';a\;b`)
+				r := NewCSVInputReader(colSpecs, bytes.NewReader([]byte(raw)), os.Stdout, 1, false)
+				r.setDialect(csv.Dialect{Comma: ';', Quote: '\'', Escape: '\\', Comment: '#'})
+				docChan := make(chan importDocument, 1)
+				So(r.StreamDocument(true, docChan), ShouldBeNil)
+				So((<-docChan).document, ShouldResemble, first.document)
+			})
+		})
+
+		Convey("an escape character at the end of a quoted field should be "+
+			"an error", func() {
+			r := NewCSVInputReader(colSpecs, bytes.NewReader([]byte(`1,"abc\`)), os.Stdout, 1, false)
+			r.setDialect(csv.Dialect{Comma: ',', Quote: '"', Escape: '\\'})
+			docChan := make(chan importDocument, 1)
+			So(r.StreamDocument(true, docChan), ShouldNotBeNil)
+		})
+
+		Convey("an escape character equal to the quote character should "+
+			"escape doubled quotes", func() {
+			r := NewCSVInputReader(colSpecs, bytes.NewReader([]byte(`"a""b",c`)), os.Stdout, 1, false)
+			r.setDialect(csv.Dialect{Comma: ',', Quote: '"', Escape: '"'})
+			docChan := make(chan importDocument, 1)
+			So(r.StreamDocument(true, docChan), ShouldBeNil)
+			So((<-docChan).document, ShouldResemble, bson.D{{"a", `a"b`}, {"b", "c"}})
+		})
+	})
+}
+
 func TestCSVReadAndValidateHeader(t *testing.T) {
 	testutil.VerifyTestType(t, testutil.UnitTestType)
 	var err error
@@ -320,10 +371,10 @@ func TestCSVReadAndValidateHeader(t *testing.T) {
 			fileHandle, err := os.Open("testdata/test.csv")
 			So(err, ShouldBeNil)
 			r := NewCSVInputReader(colSpecs, fileHandle, os.Stdout, 1, false)
-			docChan := make(chan bson.D, 50)
+			docChan := make(chan importDocument, 50)
 			So(r.StreamDocument(true, docChan), ShouldBeNil)
-			So(<-docChan, ShouldResemble, expectedReadOne)
-			So(<-docChan, ShouldResemble, expectedReadTwo)
+			So((<-docChan).document, ShouldResemble, expectedReadOne)
+			So((<-docChan).document, ShouldResemble, expectedReadTwo)
 		})
 	})
 }
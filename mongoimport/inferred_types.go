@@ -0,0 +1,187 @@
+package mongoimport
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+// inferableTypes are the column types --inferTypes chooses from, from the
+// narrowest to the widest. A column gets the first of them that parses all of
+// its sampled values.
+var inferableTypes = []columnType{ctBoolean, ctInt32, ctInt64, ctDouble, ctDecimal, ctDate, ctString}
+
+// inferableDateLayouts are the layouts that dates are detected in, in the
+// order they are tried.
+var inferableDateLayouts = []string{
+	"2006-01-02T15:04:05Z07:00",
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05Z07:00",
+	"2006-01-02 15:04:05",
+	"2006-01-02",
+	"01/02/2006 15:04:05",
+	"01/02/2006",
+	"02/01/2006 15:04:05",
+	"02/01/2006",
+	"02.01.2006",
+	"Jan 2, 2006",
+	"2 Jan 2006",
+	time.RFC1123Z,
+	time.RFC1123,
+}
+
+var (
+	// numbers with leading zeros, like zip codes, are left as strings since
+	// parsing them as numbers would drop the zeros
+	integerRE = regexp.MustCompile(`^[-+]?(0|[1-9][0-9]*)$`)
+	numberRE  = regexp.MustCompile(`^[-+]?(0|[1-9][0-9]*)(\.[0-9]+)?([eE][-+]?[0-9]+)?$`)
+)
+
+// maxExactDoubleDigits is the number of significant decimal digits a double
+// holds exactly.
+const maxExactDoubleDigits = 15
+
+// columnInference narrows down the types that parse all the values seen in a
+// column.
+type columnInference struct {
+	name      string
+	numValues int
+	excluded  map[columnType]bool
+	// layouts of the dates that parse all the values
+	layouts []string
+}
+
+func newColumnInference(name string) *columnInference {
+	return &columnInference{
+		name:     name,
+		excluded: map[columnType]bool{},
+		layouts:  inferableDateLayouts,
+	}
+}
+
+// add excludes the types that don't parse the given value.
+func (c *columnInference) add(value string) {
+	c.numValues++
+	for _, t := range inferableTypes {
+		if c.excluded[t] {
+			continue
+		}
+		if t == ctDate {
+			var layouts []string
+			for _, layout := range c.layouts {
+				if _, err := time.Parse(layout, value); err == nil {
+					layouts = append(layouts, layout)
+				}
+			}
+			c.layouts = layouts
+			c.excluded[ctDate] = len(layouts) == 0
+		} else if !parsesAs(t, value) {
+			c.excluded[t] = true
+		}
+	}
+}
+
+// typedHeader returns the field of the column with its inferred type, in the
+// form taken by --columnsHaveTypes. Columns without values keep the auto type.
+func (c *columnInference) typedHeader() string {
+	if c.numValues == 0 {
+		return c.name + ".auto()"
+	}
+	for _, t := range inferableTypes {
+		if c.excluded[t] {
+			continue
+		}
+		if t == ctDate {
+			return fmt.Sprintf("%v.date(%v)", c.name, c.layouts[0])
+		}
+		return fmt.Sprintf("%v.%v()", c.name, columnTypeName(t))
+	}
+	return c.name + ".string()"
+}
+
+// parsesAs returns whether the value can be imported as a column type.
+func parsesAs(t columnType, value string) bool {
+	switch t {
+	case ctBoolean:
+		value = strings.ToLower(value)
+		return value == "true" || value == "false"
+	case ctInt32:
+		if !integerRE.MatchString(value) {
+			return false
+		}
+		_, err := strconv.ParseInt(value, 10, 32)
+		return err == nil
+	case ctInt64:
+		if !integerRE.MatchString(value) {
+			return false
+		}
+		_, err := strconv.ParseInt(value, 10, 64)
+		return err == nil
+	case ctDouble:
+		if !numberRE.MatchString(value) || significantDigits(value) > maxExactDoubleDigits {
+			return false
+		}
+		_, err := strconv.ParseFloat(value, 64)
+		return err == nil
+	case ctDecimal:
+		if !numberRE.MatchString(value) {
+			return false
+		}
+		_, err := bson.ParseDecimal128(value)
+		return err == nil
+	case ctString:
+		return true
+	}
+	return false
+}
+
+// significantDigits returns the number of significant digits of a number
+// matched by numberRE.
+func significantDigits(value string) int {
+	if i := strings.IndexAny(value, "eE"); i >= 0 {
+		value = value[:i]
+	}
+	digits := strings.Replace(strings.TrimLeft(value, "+-"), ".", "", 1)
+	return len(strings.Trim(digits, "0"))
+}
+
+// columnTypeName returns the name of a column type in typed headers.
+func columnTypeName(t columnType) string {
+	for name, nameType := range columnTypeNameMap {
+		if nameType == t {
+			return name
+		}
+	}
+	return "auto"
+}
+
+// inferTypedHeaders returns the fields of the named columns with the
+// narrowest type that parses all of their values in the sampled records. Empty
+// values are skipped if ignoreBlanks is set, and otherwise make a column a
+// string.
+func inferTypedHeaders(names []string, records [][]string, ignoreBlanks bool) []string {
+	columns := make([]*columnInference, len(names))
+	for i, name := range names {
+		columns[i] = newColumnInference(name)
+	}
+	for _, record := range records {
+		for i, value := range record {
+			if i >= len(columns) {
+				break
+			}
+			if value == "" && ignoreBlanks {
+				continue
+			}
+			columns[i].add(value)
+		}
+	}
+	headers := make([]string, len(columns))
+	for i, column := range columns {
+		headers[i] = column.typedHeader()
+	}
+	return headers
+}
@@ -0,0 +1,106 @@
+package mongoimport
+
+import (
+	"bytes"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func TestInferTypedHeaders(t *testing.T) {
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With sampled records", t, func() {
+		names := []string{"flag", "small", "big", "ratio", "precise", "zip", "when", "day", "name", "none"}
+		records := [][]string{
+			{"true", "1", "1", "1.5", "1.5", "02134", "2018-06-01T08:00:00Z", "13/01/2018", "a"},
+			{"FALSE", "-7", "9223372036854775807", "2", "0.1234567890123456789", "10001", "2018-06-01T08:00:00.5+02:00", "01/02/2018", ""},
+		}
+
+		Convey("each column should get the narrowest type that parses all its values", func() {
+			So(inferTypedHeaders(names, records, false), ShouldResemble, []string{
+				"flag.boolean()",
+				"small.int32()",
+				"big.int64()",
+				"ratio.double()",
+				"precise.decimal()",
+				"zip.string()",
+				"when.date(2006-01-02T15:04:05Z07:00)",
+				"day.date(02/01/2006)",
+				"name.string()",
+				"none.auto()",
+			})
+		})
+
+		Convey("the typed fields should be parsed like --columnsHaveTypes", func() {
+			colSpecs, err := ParseTypedHeaders(inferTypedHeaders(names, records, false), pgStop)
+			So(err, ShouldBeNil)
+			for _, record := range records {
+				_, err := tokensToBSON(colSpecs, record, 0, false)
+				So(err, ShouldBeNil)
+			}
+		})
+
+		Convey("empty values should only be skipped with --ignoreBlanks", func() {
+			records := [][]string{{"1"}, {""}}
+			So(inferTypedHeaders([]string{"a"}, records, false), ShouldResemble, []string{"a.string()"})
+			So(inferTypedHeaders([]string{"a"}, records, true), ShouldResemble, []string{"a.int32()"})
+		})
+
+		Convey("numbers that don't fit in a double or a decimal should widen", func() {
+			So(parsesAs(ctDouble, "1e400"), ShouldBeFalse)
+			So(parsesAs(ctDecimal, "1e400"), ShouldBeTrue)
+			So(parsesAs(ctDouble, "NaN"), ShouldBeFalse)
+			So(parsesAs(ctInt32, "2147483648"), ShouldBeFalse)
+			So(significantDigits("-0.00120e5"), ShouldEqual, 2)
+		})
+	})
+}
+
+func TestInferColumnTypes(t *testing.T) {
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With a CSV input reader", t, func() {
+		contents := "a,b,c\n1,x,2018-06-01\n2,y,2018-06-02\n3,4.5,2018-06-03\n"
+		r := NewCSVInputReader(nil, bytes.NewReader([]byte(contents)), os.Stdout, 1, false)
+		So(r.ReadAndValidateHeader(), ShouldBeNil)
+
+		Convey("types should be inferred from the sample and the sample should still be imported", func() {
+			typedFields, err := r.InferColumnTypes(2, pgStop)
+			So(err, ShouldBeNil)
+			So(typedFields, ShouldResemble, []string{"a.int32()", "b.string()", "c.date(2006-01-02)"})
+			docChan := make(chan importDocument, 3)
+			So(r.StreamDocument(true, docChan), ShouldBeNil)
+			So((<-docChan).document, ShouldResemble, bson.D{
+				{"a", int32(1)}, {"b", "x"}, {"c", time.Date(2018, 6, 1, 0, 0, 0, 0, time.UTC)},
+			})
+			<-docChan
+			third := <-docChan
+			So(third.document, ShouldResemble, bson.D{
+				{"a", int32(3)}, {"b", "4.5"}, {"c", time.Date(2018, 6, 3, 0, 0, 0, 0, time.UTC)},
+			})
+			line, _ := third.source.Record()
+			So(line, ShouldEqual, 4)
+		})
+	})
+
+	Convey("With a TSV input reader", t, func() {
+		contents := "a\tb\n1\t1.5\n2\t\n"
+		r := NewTSVInputReader(nil, bytes.NewReader([]byte(contents)), os.Stdout, 1, true)
+		So(r.ReadAndValidateHeader(), ShouldBeNil)
+
+		Convey("records of a sample larger than the input should all be imported", func() {
+			typedFields, err := r.InferColumnTypes(10, pgStop)
+			So(err, ShouldBeNil)
+			So(typedFields, ShouldResemble, []string{"a.int32()", "b.double()"})
+			docChan := make(chan importDocument, 2)
+			So(r.StreamDocument(true, docChan), ShouldBeNil)
+			So((<-docChan).document, ShouldResemble, bson.D{{"a", int32(1)}, {"b", 1.5}})
+			So((<-docChan).document, ShouldResemble, bson.D{{"a", int32(2)}})
+		})
+	})
+}
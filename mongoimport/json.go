@@ -1,10 +1,12 @@
 package mongoimport
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
 	"io"
 	"strings"
+	"unicode"
 
 	"github.com/mongodb/mongo-tools/common/bsonutil"
 	"github.com/mongodb/mongo-tools/common/json"
@@ -25,6 +27,9 @@ type JSONInputReader struct {
 	// numProcessed indicates the number of JSON documents processed
 	numProcessed uint64
 
+	// numLines is the number of lines read by the decoder so far
+	numLines uint64
+
 	// readOpeningBracket indicates if the underlying io.Reader has consumed
 	// an opening bracket from the input source. Used to prevent errors when
 	// a JSON input source contains just '[]'
@@ -48,12 +53,19 @@ type JSONInputReader struct {
 
 	// numDecoders is the number of concurrent goroutines to use for decoding
 	numDecoders int
+
+	// rejects is where the documents that can't be parsed are written along
+	// with their line number and the reason, instead of stopping the import,
+	// if it is set
+	rejects *rejectWriter
 }
 
 // JSONConverter implements the Converter interface for JSON input.
 type JSONConverter struct {
-	data  []byte
-	index uint64
+	data    []byte
+	index   uint64
+	line    uint64
+	rejects *rejectWriter
 }
 
 var (
@@ -69,13 +81,18 @@ var (
 )
 
 // NewJSONInputReader creates a new JSONInputReader in array mode if specified,
-// configured to read data to the given io.Reader.
-func NewJSONInputReader(isArray bool, in io.Reader, numDecoders int) *JSONInputReader {
+// configured to read data in the given Extended JSON format to the given io.Reader.
+// Only the legacy format accepts shell mode values, like NumberLong(1).
+func NewJSONInputReader(isArray bool, jsonFormat json.Format, in io.Reader, numDecoders int) *JSONInputReader {
 	szCount := newSizeTrackingReader(newBomDiscardingReader(in))
+	decoder := json.NewDecoder(szCount)
+	if jsonFormat == json.CanonicalFormat || jsonFormat == json.RelaxedFormat {
+		decoder.DisallowShellMode()
+	}
 	return &JSONInputReader{
 		isArray:            isArray,
 		sizeTracker:        szCount,
-		decoder:            json.NewDecoder(szCount),
+		decoder:            decoder,
 		readOpeningBracket: false,
 		bytesFromReader:    make([]byte, 1),
 		numDecoders:        numDecoders,
@@ -92,10 +109,15 @@ func (r *JSONInputReader) ReadAndValidateTypedHeader(parseGrace ParseGrace) erro
 	return nil
 }
 
+// InferColumnTypes is a no-op for JSON imports; always returns nil.
+func (r *JSONInputReader) InferColumnTypes(sampleSize int, parseGrace ParseGrace) ([]string, error) {
+	return nil, nil
+}
+
 // StreamDocument takes a boolean indicating if the documents should be streamed
 // in read order and a channel on which to stream the documents processed from
 // the underlying reader. Returns a non-nil error if encountered
-func (r *JSONInputReader) StreamDocument(ordered bool, readChan chan bson.D) (retErr error) {
+func (r *JSONInputReader) StreamDocument(ordered bool, readChan chan importDocument) (retErr error) {
 	rawChan := make(chan Converter, r.numDecoders)
 	jsonErrChan := make(chan error)
 
@@ -116,6 +138,16 @@ func (r *JSONInputReader) StreamDocument(ordered bool, readChan chan bson.D) (re
 				}
 			}
 			rawBytes, err := r.decoder.ScanObject()
+			if err != nil && err != io.EOF && r.rejects != nil && !r.isArray {
+				// documents are on separate lines, so the import can resume
+				// on the line after the one that can't be parsed
+				if err = r.rejectLine(err); err == nil {
+					continue
+				}
+				close(rawChan)
+				jsonErrChan <- err
+				return
+			}
 			if err != nil {
 				close(rawChan)
 				if err == io.EOF {
@@ -126,11 +158,7 @@ func (r *JSONInputReader) StreamDocument(ordered bool, readChan chan bson.D) (re
 				}
 				return
 			}
-			rawChan <- JSONConverter{
-				data:  rawBytes,
-				index: r.numProcessed,
-			}
-			r.numProcessed++
+			rawChan <- r.converter(rawBytes)
 		}
 	}()
 
@@ -142,21 +170,62 @@ func (r *JSONInputReader) StreamDocument(ordered bool, readChan chan bson.D) (re
 	return channelQuorumError(jsonErrChan, 2)
 }
 
+// converter returns the JSONConverter for the raw bytes of the next document
+// read, and counts the document and the lines it spans.
+func (r *JSONInputReader) converter(rawBytes []byte) JSONConverter {
+	// the document starts after the whitespace scanned along with it
+	leadingSpace := len(rawBytes) - len(bytes.TrimLeftFunc(rawBytes, unicode.IsSpace))
+	converter := JSONConverter{
+		data:    rawBytes,
+		index:   r.numProcessed,
+		line:    r.numLines + uint64(bytes.Count(rawBytes[:leadingSpace], []byte{'\n'})) + 1,
+		rejects: r.rejects,
+	}
+	r.numLines += uint64(bytes.Count(rawBytes, []byte{'\n'}))
+	r.numProcessed++
+	return converter
+}
+
+// rejectLine rejects the rest of the line that the decoder failed to parse
+// with parseErr, so that reading can continue on the next line. Returns the
+// error to stop the import with if the line can't be skipped or rejected.
+func (r *JSONInputReader) rejectLine(parseErr error) error {
+	rawBytes, err := r.decoder.SkipLine()
+	if err != nil {
+		return fmt.Errorf("error processing document #%v: %v", r.numProcessed+1, parseErr)
+	}
+	converter := r.converter(rawBytes)
+	reason := fmt.Errorf("error processing document #%v: %v", r.numProcessed, parseErr)
+	return r.rejects.Reject(converter, reason)
+}
+
 // Convert implements the Converter interface for JSON input. It converts a
-// JSONConverter struct to a BSON document.
+// JSONConverter struct to a BSON document. Documents that can't be converted
+// are rejected instead if there's a reject file.
 func (c JSONConverter) Convert() (bson.D, error) {
-	document, err := json.UnmarshalBsonD(c.data)
-	if err != nil {
-		return nil, fmt.Errorf("error unmarshaling bytes on document #%v: %v", c.index, err)
+	document, err := c.convert()
+	if err != nil && c.rejects != nil {
+		return nil, c.rejects.Reject(c, err)
 	}
-	log.Logvf(log.DebugHigh, "got line: %v", document)
+	return document, err
+}
 
-	bsonD, err := bsonutil.GetExtendedBsonD(document)
+func (c JSONConverter) convert() (bson.D, error) {
+	data, err := bsonutil.ConvertJSONToBSON(c.data)
+	if err != nil {
+		return nil, fmt.Errorf("error converting document #%v to BSON: %v", c.index, err)
+	}
+	document, err := unmarshalDocument(data)
 	if err != nil {
-		return nil, fmt.Errorf("error getting extended BSON for document #%v: %v", c.index, err)
+		return nil, fmt.Errorf("error reading BSON for document #%v: %v", c.index, err)
 	}
-	log.Logvf(log.DebugHigh, "got extended line: %#v", bsonD)
-	return bsonD, nil
+	log.Logvf(log.DebugHigh, "got extended line: %v", document)
+	return document, nil
+}
+
+// Record implements the Converter interface for JSON input.
+func (c JSONConverter) Record() (uint64, string) {
+	return c.line, string(bytes.TrimSpace(c.data))
 }
 
 // readJSONArraySeparator is a helper method used to process JSON arrays. It is
@@ -3,9 +3,11 @@ package mongoimport
 import (
 	"bytes"
 	"io"
+	"math"
 	"os"
 	"testing"
 
+	"github.com/mongodb/mongo-tools/common/json"
 	"github.com/mongodb/mongo-tools/common/testutil"
 	. "github.com/smartystreets/goconvey/convey"
 	"gopkg.in/mgo.v2/bson"
@@ -17,32 +19,32 @@ func TestJSONArrayStreamDocument(t *testing.T) {
 		var jsonFile, fileHandle *os.File
 		Convey("an error should be thrown if a plain JSON document is supplied", func() {
 			contents := `{"a": "ae"}`
-			r := NewJSONInputReader(true, bytes.NewReader([]byte(contents)), 1)
-			So(r.StreamDocument(true, make(chan bson.D, 1)), ShouldNotBeNil)
+			r := NewJSONInputReader(true, json.LegacyFormat, bytes.NewReader([]byte(contents)), 1)
+			So(r.StreamDocument(true, make(chan importDocument, 1)), ShouldNotBeNil)
 		})
 
 		Convey("reading a JSON object that has no opening bracket should "+
 			"error out", func() {
 			contents := `{"a":3},{"b":4}]`
-			r := NewJSONInputReader(true, bytes.NewReader([]byte(contents)), 1)
-			So(r.StreamDocument(true, make(chan bson.D, 1)), ShouldNotBeNil)
+			r := NewJSONInputReader(true, json.LegacyFormat, bytes.NewReader([]byte(contents)), 1)
+			So(r.StreamDocument(true, make(chan importDocument, 1)), ShouldNotBeNil)
 		})
 
 		Convey("JSON arrays that do not end with a closing bracket should "+
 			"error out", func() {
 			contents := `[{"a": "ae"}`
-			r := NewJSONInputReader(true, bytes.NewReader([]byte(contents)), 1)
-			docChan := make(chan bson.D, 1)
+			r := NewJSONInputReader(true, json.LegacyFormat, bytes.NewReader([]byte(contents)), 1)
+			docChan := make(chan importDocument, 1)
 			So(r.StreamDocument(true, docChan), ShouldNotBeNil)
 			// though first read should be fine
-			So(<-docChan, ShouldResemble, bson.D{{"a", "ae"}})
+			So((<-docChan).document, ShouldResemble, bson.D{{"a", "ae"}})
 		})
 
 		Convey("an error should be thrown if a plain JSON file is supplied", func() {
 			fileHandle, err := os.Open("testdata/test_plain.json")
 			So(err, ShouldBeNil)
-			r := NewJSONInputReader(true, fileHandle, 1)
-			So(r.StreamDocument(true, make(chan bson.D, 50)), ShouldNotBeNil)
+			r := NewJSONInputReader(true, json.LegacyFormat, fileHandle, 1)
+			So(r.StreamDocument(true, make(chan importDocument, 50)), ShouldNotBeNil)
 		})
 
 		Convey("array JSON input file sources should be parsed correctly and "+
@@ -60,11 +62,11 @@ func TestJSONArrayStreamDocument(t *testing.T) {
 			}
 			fileHandle, err := os.Open("testdata/test_array.json")
 			So(err, ShouldBeNil)
-			r := NewJSONInputReader(true, fileHandle, 1)
-			docChan := make(chan bson.D, 50)
+			r := NewJSONInputReader(true, json.LegacyFormat, fileHandle, 1)
+			docChan := make(chan importDocument, 50)
 			So(r.StreamDocument(true, docChan), ShouldBeNil)
-			So(<-docChan, ShouldResemble, expectedReadOne)
-			So(<-docChan, ShouldResemble, expectedReadTwo)
+			So((<-docChan).document, ShouldResemble, expectedReadOne)
+			So((<-docChan).document, ShouldResemble, expectedReadTwo)
 		})
 
 		Reset(func() {
@@ -81,10 +83,10 @@ func TestJSONPlainStreamDocument(t *testing.T) {
 		Convey("string valued JSON documents should be imported properly", func() {
 			contents := `{"a": "ae"}`
 			expectedRead := bson.D{{"a", "ae"}}
-			r := NewJSONInputReader(false, bytes.NewReader([]byte(contents)), 1)
-			docChan := make(chan bson.D, 1)
+			r := NewJSONInputReader(false, json.LegacyFormat, bytes.NewReader([]byte(contents)), 1)
+			docChan := make(chan importDocument, 1)
 			So(r.StreamDocument(true, docChan), ShouldBeNil)
-			So(<-docChan, ShouldResemble, expectedRead)
+			So((<-docChan).document, ShouldResemble, expectedRead)
 		})
 
 		Convey("several string valued JSON documents should be imported "+
@@ -92,26 +94,40 @@ func TestJSONPlainStreamDocument(t *testing.T) {
 			contents := `{"a": "ae"}{"b": "dc"}`
 			expectedReadOne := bson.D{{"a", "ae"}}
 			expectedReadTwo := bson.D{{"b", "dc"}}
-			r := NewJSONInputReader(false, bytes.NewReader([]byte(contents)), 1)
-			docChan := make(chan bson.D, 2)
+			r := NewJSONInputReader(false, json.LegacyFormat, bytes.NewReader([]byte(contents)), 1)
+			docChan := make(chan importDocument, 2)
 			So(r.StreamDocument(true, docChan), ShouldBeNil)
-			So(<-docChan, ShouldResemble, expectedReadOne)
-			So(<-docChan, ShouldResemble, expectedReadTwo)
+			So((<-docChan).document, ShouldResemble, expectedReadOne)
+			So((<-docChan).document, ShouldResemble, expectedReadTwo)
 		})
 
 		Convey("number valued JSON documents should be imported properly", func() {
 			contents := `{"a": "ae", "b": 2.0}`
 			expectedRead := bson.D{{"a", "ae"}, {"b", 2.0}}
-			r := NewJSONInputReader(false, bytes.NewReader([]byte(contents)), 1)
-			docChan := make(chan bson.D, 1)
+			r := NewJSONInputReader(false, json.LegacyFormat, bytes.NewReader([]byte(contents)), 1)
+			docChan := make(chan importDocument, 1)
 			So(r.StreamDocument(true, docChan), ShouldBeNil)
-			So(<-docChan, ShouldResemble, expectedRead)
+			So((<-docChan).document, ShouldResemble, expectedRead)
+		})
+
+		Convey("Extended JSON v2 documents should be imported properly, "+
+			"without shell mode values", func() {
+			contents := `{"a": {"$numberDouble": "-Infinity"}, "b": {"$binary": {"base64": "aGk=", "subType": "02"}}}`
+			expectedRead := bson.D{{"a", math.Inf(-1)}, {"b", bson.Binary{0x02, []byte("hi")}}}
+			r := NewJSONInputReader(false, json.CanonicalFormat, bytes.NewReader([]byte(contents)), 1)
+			docChan := make(chan importDocument, 1)
+			So(r.StreamDocument(true, docChan), ShouldBeNil)
+			So((<-docChan).document, ShouldResemble, expectedRead)
+
+			contents = `{"a": NumberLong(1)}`
+			r = NewJSONInputReader(false, json.RelaxedFormat, bytes.NewReader([]byte(contents)), 1)
+			So(r.StreamDocument(true, make(chan importDocument, 1)), ShouldNotBeNil)
 		})
 
 		Convey("JSON arrays should return an error", func() {
 			contents := `[{"a": "ae", "b": 2.0}]`
-			r := NewJSONInputReader(false, bytes.NewReader([]byte(contents)), 1)
-			So(r.StreamDocument(true, make(chan bson.D, 50)), ShouldNotBeNil)
+			r := NewJSONInputReader(false, json.LegacyFormat, bytes.NewReader([]byte(contents)), 1)
+			So(r.StreamDocument(true, make(chan importDocument, 50)), ShouldNotBeNil)
 		})
 
 		Convey("plain JSON input file sources should be parsed correctly and "+
@@ -133,14 +149,11 @@ func TestJSONPlainStreamDocument(t *testing.T) {
 			}
 			fileHandle, err := os.Open("testdata/test_plain.json")
 			So(err, ShouldBeNil)
-			r := NewJSONInputReader(false, fileHandle, 1)
-			docChan := make(chan bson.D, len(expectedReads))
+			r := NewJSONInputReader(false, json.LegacyFormat, fileHandle, 1)
+			docChan := make(chan importDocument, len(expectedReads))
 			So(r.StreamDocument(true, docChan), ShouldBeNil)
 			for i := 0; i < len(expectedReads); i++ {
-				for j, readDocument := range <-docChan {
-					So(readDocument.Name, ShouldEqual, expectedReads[i][j].Name)
-					So(readDocument.Value, ShouldEqual, expectedReads[i][j].Value)
-				}
+				So((<-docChan).document, ShouldResemble, expectedReads[i])
 			}
 		})
 
@@ -159,14 +172,11 @@ func TestJSONPlainStreamDocument(t *testing.T) {
 				}
 				fileHandle, err := os.Open("testdata/test_bom.json")
 				So(err, ShouldBeNil)
-				r := NewJSONInputReader(false, fileHandle, 1)
-				docChan := make(chan bson.D, 2)
+				r := NewJSONInputReader(false, json.LegacyFormat, fileHandle, 1)
+				docChan := make(chan importDocument, 2)
 				So(r.StreamDocument(true, docChan), ShouldBeNil)
 				for _, expectedRead := range expectedReads {
-					for i, readDocument := range <-docChan {
-						So(readDocument.Name, ShouldEqual, expectedRead[i].Name)
-						So(readDocument.Value, ShouldEqual, expectedRead[i].Value)
-					}
+					So((<-docChan).document, ShouldResemble, expectedRead)
 				}
 			})
 
@@ -183,7 +193,7 @@ func TestReadJSONArraySeparator(t *testing.T) {
 		Convey("reading a JSON array separator should consume [",
 			func() {
 				contents := `[{"a": "ae"}`
-				jsonImporter := NewJSONInputReader(true, bytes.NewReader([]byte(contents)), 1)
+				jsonImporter := NewJSONInputReader(true, json.LegacyFormat, bytes.NewReader([]byte(contents)), 1)
 				So(jsonImporter.readJSONArraySeparator(), ShouldBeNil)
 				// at this point it should have consumed all bytes up to `{`
 				So(jsonImporter.readJSONArraySeparator(), ShouldNotBeNil)
@@ -192,14 +202,14 @@ func TestReadJSONArraySeparator(t *testing.T) {
 			"corresponding opening bracket should error out ",
 			func() {
 				contents := `]`
-				jsonImporter := NewJSONInputReader(true, bytes.NewReader([]byte(contents)), 1)
+				jsonImporter := NewJSONInputReader(true, json.LegacyFormat, bytes.NewReader([]byte(contents)), 1)
 				So(jsonImporter.readJSONArraySeparator(), ShouldNotBeNil)
 			})
 		Convey("reading an opening JSON array separator without a "+
 			"corresponding closing bracket should error out ",
 			func() {
 				contents := `[`
-				jsonImporter := NewJSONInputReader(true, bytes.NewReader([]byte(contents)), 1)
+				jsonImporter := NewJSONInputReader(true, json.LegacyFormat, bytes.NewReader([]byte(contents)), 1)
 				So(jsonImporter.readJSONArraySeparator(), ShouldBeNil)
 				So(jsonImporter.readJSONArraySeparator(), ShouldNotBeNil)
 			})
@@ -207,7 +217,7 @@ func TestReadJSONArraySeparator(t *testing.T) {
 			"closing bracket should return EOF",
 			func() {
 				contents := `[]`
-				jsonImporter := NewJSONInputReader(true, bytes.NewReader([]byte(contents)), 1)
+				jsonImporter := NewJSONInputReader(true, json.LegacyFormat, bytes.NewReader([]byte(contents)), 1)
 				So(jsonImporter.readJSONArraySeparator(), ShouldBeNil)
 				So(jsonImporter.readJSONArraySeparator(), ShouldEqual, io.EOF)
 			})
@@ -215,7 +225,7 @@ func TestReadJSONArraySeparator(t *testing.T) {
 			"bracket but then additional characters after that, should error",
 			func() {
 				contents := `[]a`
-				jsonImporter := NewJSONInputReader(true, bytes.NewReader([]byte(contents)), 1)
+				jsonImporter := NewJSONInputReader(true, json.LegacyFormat, bytes.NewReader([]byte(contents)), 1)
 				So(jsonImporter.readJSONArraySeparator(), ShouldBeNil)
 				So(jsonImporter.readJSONArraySeparator(), ShouldNotBeNil)
 			})
@@ -223,8 +233,8 @@ func TestReadJSONArraySeparator(t *testing.T) {
 			"error out",
 			func() {
 				contents := `[{"a":3}x{"b":4}]`
-				r := NewJSONInputReader(true, bytes.NewReader([]byte(contents)), 1)
-				docChan := make(chan bson.D, 1)
+				r := NewJSONInputReader(true, json.LegacyFormat, bytes.NewReader([]byte(contents)), 1)
+				docChan := make(chan importDocument, 1)
 				So(r.StreamDocument(true, docChan), ShouldNotBeNil)
 				// read first valid document
 				<-docChan
@@ -234,11 +244,11 @@ func TestReadJSONArraySeparator(t *testing.T) {
 			"valid objects should error out",
 			func() {
 				contents := `[{"a":3},b{"b":4}]`
-				r := NewJSONInputReader(true, bytes.NewReader([]byte(contents)), 1)
-				So(r.StreamDocument(true, make(chan bson.D, 1)), ShouldNotBeNil)
+				r := NewJSONInputReader(true, json.LegacyFormat, bytes.NewReader([]byte(contents)), 1)
+				So(r.StreamDocument(true, make(chan importDocument, 1)), ShouldNotBeNil)
 				contents = `[{"a":3},,{"b":4}]`
-				r = NewJSONInputReader(true, bytes.NewReader([]byte(contents)), 1)
-				So(r.StreamDocument(true, make(chan bson.D, 1)), ShouldNotBeNil)
+				r = NewJSONInputReader(true, json.LegacyFormat, bytes.NewReader([]byte(contents)), 1)
+				So(r.StreamDocument(true, make(chan importDocument, 1)), ShouldNotBeNil)
 			})
 	})
 }
@@ -260,5 +270,18 @@ func TestJSONConvert(t *testing.T) {
 			So(err, ShouldBeNil)
 			So(document, ShouldResemble, expectedDocument)
 		})
+
+		Convey("the values of the converted document should be native values", func() {
+			jsonConverter := JSONConverter{
+				data:  []byte(`{"a": {"b": [1, {"c": NumberLong(2)}]}, "d": {"$binary": "aGk=", "$type": "02"}}`),
+				index: uint64(0),
+			}
+			document, err := jsonConverter.Convert()
+			So(err, ShouldBeNil)
+			So(document, ShouldResemble, bson.D{
+				{"a", bson.D{{"b", []interface{}{1, bson.D{{"c", int64(2)}}}}}},
+				{"d", bson.Binary{Kind: 0x02, Data: []byte("hi")}},
+			})
+		})
 	})
 }
@@ -43,6 +43,27 @@ func main() {
 		return
 	}
 
+	m := mongoimport.MongoImport{
+		ToolOptions:   opts,
+		InputOptions:  inputOpts,
+		IngestOptions: ingestOpts,
+	}
+
+	if err = m.ValidateSettings(args); err != nil {
+		log.Logvf(log.Always, "error validating settings: %v", err)
+		log.Logvf(log.Always, "try 'mongoimport --help' for more information")
+		os.Exit(util.ExitError)
+	}
+
+	// print the inferred column types, if specified, without connecting
+	if inputOpts.PrintInferredTypes {
+		if err = m.PrintInferredTypes(os.Stdout); err != nil {
+			log.Logvf(log.Always, "Failed: %v", err)
+			os.Exit(util.ExitError)
+		}
+		return
+	}
+
 	// connect directly, unless a replica set name is explicitly specified
 	_, setName := util.ParseConnectionString(opts.Host)
 	opts.Direct = (setName == "")
@@ -56,19 +77,7 @@ func main() {
 	}
 	defer sessionProvider.Close()
 	sessionProvider.SetBypassDocumentValidation(ingestOpts.BypassDocumentValidation)
-
-	m := mongoimport.MongoImport{
-		ToolOptions:     opts,
-		InputOptions:    inputOpts,
-		IngestOptions:   ingestOpts,
-		SessionProvider: sessionProvider,
-	}
-
-	if err = m.ValidateSettings(args); err != nil {
-		log.Logvf(log.Always, "error validating settings: %v", err)
-		log.Logvf(log.Always, "try 'mongoimport --help' for more information")
-		os.Exit(util.ExitError)
-	}
+	m.SessionProvider = sessionProvider
 
 	numDocs, err := m.ImportDocuments()
 	if !opts.Quiet {
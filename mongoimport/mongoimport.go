@@ -1,11 +1,15 @@
-// Package mongoimport allows importing content from a JSON, CSV, or TSV into a MongoDB instance.
+// Package mongoimport allows importing content from a JSON, CSV, TSV or Parquet file into a MongoDB instance.
 package mongoimport
 
 import (
+	"github.com/mongodb/mongo-tools/common/charset"
+	"github.com/mongodb/mongo-tools/common/csv"
 	"github.com/mongodb/mongo-tools/common/db"
+	"github.com/mongodb/mongo-tools/common/json"
 	"github.com/mongodb/mongo-tools/common/log"
 	"github.com/mongodb/mongo-tools/common/options"
 	"github.com/mongodb/mongo-tools/common/progress"
+	"github.com/mongodb/mongo-tools/common/transform"
 	"github.com/mongodb/mongo-tools/common/util"
 	"gopkg.in/mgo.v2"
 	"gopkg.in/mgo.v2/bson"
@@ -13,8 +17,9 @@ import (
 
 	"fmt"
 	"io"
+	"io/ioutil"
 	"os"
-	"path/filepath"
+	"regexp"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -22,16 +27,18 @@ import (
 
 // Input format types accepted by mongoimport.
 const (
-	CSV  = "csv"
-	TSV  = "tsv"
-	JSON = "json"
+	CSV     = "csv"
+	TSV     = "tsv"
+	JSON    = "json"
+	PARQUET = "parquet"
 )
 
 // Modes accepted by mongoimport.
 const (
-	modeInsert = "insert"
-	modeUpsert = "upsert"
-	modeMerge  = "merge"
+	modeInsert  = "insert"
+	modeUpsert  = "upsert"
+	modeMerge   = "merge"
+	modeChanges = "changes"
 )
 
 const (
@@ -68,13 +75,35 @@ type MongoImport struct {
 
 	// type of node the SessionProvider is connected to
 	nodeType db.NodeType
+
+	// rejects is where the input records that fail to be imported are
+	// written, if a reject file is used
+	rejects *rejectWriter
+
+	// batchFiles are the files matched by --files, if it is used
+	batchFiles []batchFile
+
+	// collectionFromFile names the collections of the --files
+	collectionFromFile *regexp.Regexp
+
+	// batch is the progress of importing all the --files, if this imports
+	// one of them
+	batch *batchProgressor
+
+	// transform reshapes the documents before they are inserted, if
+	// --transformFile is used
+	transform *transform.Transform
+
+	// routes sends the documents to collections by the value of a field, if
+	// --routeBy is used
+	routes *router
 }
 
 type InputReader interface {
 	// StreamDocument takes a boolean indicating if the documents should be streamed
 	// in read order and a channel on which to stream the documents processed from
 	// the underlying reader.  Returns a non-nil error if encountered.
-	StreamDocument(ordered bool, read chan bson.D) error
+	StreamDocument(ordered bool, read chan importDocument) error
 
 	// ReadAndValidateHeader reads the header line from the InputReader and returns
 	// a non-nil error if the fields from the header line are invalid; returns
@@ -86,6 +115,12 @@ type InputReader interface {
 	// will be handled according parseGrace.
 	ReadAndValidateTypedHeader(parseGrace ParseGrace) error
 
+	// InferColumnTypes reads up to sampleSize records from the InputReader and
+	// gives each column the narrowest type that parses all of its values. The
+	// records read are still streamed. Returns the typed field list. No-op for
+	// JSON and Parquet input readers.
+	InferColumnTypes(sampleSize int, parseGrace ParseGrace) ([]string, error)
+
 	// embedded io.Reader that tracks number of bytes read, to allow feeding into progress bar.
 	sizeTracker
 }
@@ -109,7 +144,8 @@ func (imp *MongoImport) ValidateSettings(args []string) error {
 	} else {
 		if !(imp.InputOptions.Type == TSV ||
 			imp.InputOptions.Type == JSON ||
-			imp.InputOptions.Type == CSV) {
+			imp.InputOptions.Type == CSV ||
+			imp.InputOptions.Type == PARQUET) {
 			return fmt.Errorf("unknown type %v", imp.InputOptions.Type)
 		}
 	}
@@ -142,25 +178,82 @@ func (imp *MongoImport) ValidateSettings(args []string) error {
 		if _, err := ValidatePG(imp.InputOptions.ParseGrace); err != nil {
 			return err
 		}
+		if imp.InputOptions.PrintInferredTypes {
+			imp.InputOptions.InferTypes = true
+		}
+		if imp.InputOptions.InferTypes {
+			if imp.InputOptions.ColumnsHaveTypes {
+				return fmt.Errorf("incompatible options: --inferTypes and --columnsHaveTypes")
+			}
+			if imp.InputOptions.InferSampleSize <= 0 {
+				return fmt.Errorf("--inferSampleSize must be positive")
+			}
+		}
+		if jsonFormat, err := json.ParseFormat(imp.InputOptions.JSONFormat); err != nil {
+			return err
+		} else if jsonFormat != json.LegacyFormat {
+			return fmt.Errorf("can not use --jsonFormat when input type is %v", imp.InputOptions.Type)
+		}
+		if imp.InputOptions.Type == TSV {
+			if err := imp.validateCSVOnlyOptions("TSV"); err != nil {
+				return err
+			}
+		}
+		if _, err := imp.csvDialect(); err != nil {
+			return err
+		}
 	} else {
-		// input type is JSON
+		// input type is JSON or Parquet, whose documents name their fields
+		inputType := strings.ToUpper(imp.InputOptions.Type)
+		if imp.InputOptions.Type == PARQUET {
+			inputType = "Parquet"
+		}
 		if imp.InputOptions.HeaderLine {
-			return fmt.Errorf("can not use --headerline when input type is JSON")
+			return fmt.Errorf("can not use --headerline when input type is %v", inputType)
 		}
 		if imp.InputOptions.Fields != nil {
-			return fmt.Errorf("can not use --fields when input type is JSON")
+			return fmt.Errorf("can not use --fields when input type is %v", inputType)
 		}
 		if imp.InputOptions.FieldFile != nil {
-			return fmt.Errorf("can not use --fieldFile when input type is JSON")
+			return fmt.Errorf("can not use --fieldFile when input type is %v", inputType)
 		}
 		if imp.IngestOptions.IgnoreBlanks {
-			return fmt.Errorf("can not use --ignoreBlanks when input type is JSON")
+			return fmt.Errorf("can not use --ignoreBlanks when input type is %v", inputType)
 		}
 		if imp.InputOptions.ColumnsHaveTypes {
-			return fmt.Errorf("can not use --columnsHaveTypes when input type is JSON")
+			return fmt.Errorf("can not use --columnsHaveTypes when input type is %v", inputType)
+		}
+		if imp.InputOptions.InferTypes || imp.InputOptions.PrintInferredTypes {
+			return fmt.Errorf("can not use --inferTypes when input type is %v", inputType)
+		}
+		if err := imp.validateCSVOnlyOptions(inputType); err != nil {
+			return err
+		}
+		if imp.InputOptions.Comment != "" {
+			return fmt.Errorf("can not use --comment when input type is %v", inputType)
+		}
+		jsonFormat, err := json.ParseFormat(imp.InputOptions.JSONFormat)
+		if err != nil {
+			return err
+		}
+		if imp.InputOptions.Type == PARQUET {
+			if imp.InputOptions.JSONArray {
+				return fmt.Errorf("can not use --jsonArray when input type is %v", inputType)
+			}
+			if jsonFormat != json.LegacyFormat {
+				return fmt.Errorf("can not use --jsonFormat when input type is %v", inputType)
+			}
 		}
 	}
 
+	encoding, err := charset.Lookup(imp.InputOptions.Encoding)
+	if err != nil {
+		return fmt.Errorf("invalid --encoding argument: %v", err)
+	}
+	if encoding != charset.UTF8 && imp.InputOptions.Type == PARQUET {
+		return fmt.Errorf("can not use --encoding when input type is Parquet")
+	}
+
 	// deprecated
 	if imp.IngestOptions.Upsert == true {
 		imp.IngestOptions.Mode = modeUpsert
@@ -189,10 +282,29 @@ func (imp *MongoImport) ValidateSettings(args []string) error {
 	// double-check mode choices
 	if !(imp.IngestOptions.Mode == modeInsert ||
 		imp.IngestOptions.Mode == modeUpsert ||
-		imp.IngestOptions.Mode == modeMerge) {
+		imp.IngestOptions.Mode == modeMerge ||
+		imp.IngestOptions.Mode == modeChanges) {
 		return fmt.Errorf("invalid --mode argument: %v", imp.IngestOptions.Mode)
 	}
 
+	if imp.IngestOptions.Mode == modeChanges {
+		if imp.IngestOptions.ChangeFormat == "" {
+			imp.IngestOptions.ChangeFormat = changeFormatOp
+		}
+		if !(imp.IngestOptions.ChangeFormat == changeFormatOp ||
+			imp.IngestOptions.ChangeFormat == changeFormatChangeStream ||
+			imp.IngestOptions.ChangeFormat == changeFormatOplog) {
+			return fmt.Errorf("invalid --changeFormat argument: %v", imp.IngestOptions.ChangeFormat)
+		}
+		if imp.IngestOptions.UpsertFields != "" && imp.IngestOptions.ChangeFormat != changeFormatOp {
+			return fmt.Errorf("can not use --upsertFields with --changeFormat=%v", imp.IngestOptions.ChangeFormat)
+		}
+		// the changes after one that fails can't be applied in order
+		imp.IngestOptions.StopOnError = true
+	} else if imp.IngestOptions.ChangeFormat != "" {
+		return fmt.Errorf("can not use --changeFormat without --mode=changes")
+	}
+
 	if imp.IngestOptions.Mode != modeInsert {
 		imp.IngestOptions.MaintainInsertionOrder = true
 		log.Logvf(log.Info, "using upsert fields: %v", imp.upsertFields)
@@ -226,6 +338,24 @@ func (imp *MongoImport) ValidateSettings(args []string) error {
 		return fmt.Errorf("only one positional argument is allowed")
 	}
 
+	imp.transform = nil
+	if imp.InputOptions.TransformFile != "" {
+		if imp.transform, err = transform.ReadFile(imp.InputOptions.TransformFile); err != nil {
+			return err
+		}
+	}
+
+	if err = imp.validateRoute(); err != nil {
+		return err
+	}
+
+	if imp.InputOptions.Files != "" {
+		return imp.validateFiles(args)
+	}
+	if imp.InputOptions.CollectionFromFile != "" {
+		return fmt.Errorf("can not use --collectionFromFile without --files")
+	}
+
 	// ensure either a positional argument is supplied or an argument is passed
 	// to the --file flag - and not both
 	if imp.InputOptions.File != "" && len(args) != 0 {
@@ -239,14 +369,15 @@ func (imp *MongoImport) ValidateSettings(args []string) error {
 		}
 	}
 
+	// the collections of routed documents are named after their fields
+	if imp.routes != nil {
+		return nil
+	}
+
 	// ensure we have a valid string to use for the collection
 	if imp.ToolOptions.Collection == "" {
 		log.Logvf(log.Always, "no collection specified")
-		fileBaseName := filepath.Base(imp.InputOptions.File)
-		lastDotIndex := strings.LastIndex(fileBaseName, ".")
-		if lastDotIndex != -1 {
-			fileBaseName = fileBaseName[0:lastDotIndex]
-		}
+		fileBaseName := collectionFromFileName(imp.InputOptions.File)
 		log.Logvf(log.Always, "using filename '%v' as collection", fileBaseName)
 		imp.ToolOptions.Collection = fileBaseName
 	}
@@ -257,10 +388,67 @@ func (imp *MongoImport) ValidateSettings(args []string) error {
 	return nil
 }
 
-// getSourceReader returns an io.Reader to read from the input source. Also
-// returns a progress.Progressor which can be used to track progress if the
-// reader supports it.
+// validateFiles validates the options for importing several --files and
+// finds the files to import.
+func (imp *MongoImport) validateFiles(args []string) (err error) {
+	if imp.InputOptions.File != "" {
+		return fmt.Errorf("incompatible options: --file and --files")
+	}
+	if len(args) != 0 {
+		return fmt.Errorf("incompatible options: --files and positional argument(s)")
+	}
+	if imp.InputOptions.PrintInferredTypes {
+		return fmt.Errorf("can not use --printInferredTypes with --files")
+	}
+	imp.collectionFromFile = nil
+	if imp.InputOptions.CollectionFromFile != "" {
+		if imp.ToolOptions.Collection != "" {
+			return fmt.Errorf("incompatible options: --collection and --collectionFromFile")
+		}
+		imp.collectionFromFile, err = regexp.Compile(imp.InputOptions.CollectionFromFile)
+		if err != nil {
+			return fmt.Errorf("invalid --collectionFromFile argument: %v", err)
+		}
+	}
+	if imp.IngestOptions.NumParallelFiles <= 0 {
+		imp.IngestOptions.NumParallelFiles = 1
+	}
+	imp.batchFiles, err = imp.expandFiles()
+	return err
+}
+
+// validateCSVOnlyOptions returns an error if the options that set the
+// delimiter, quote or escape character of CSV input are used with another
+// input type.
+func (imp *MongoImport) validateCSVOnlyOptions(inputType string) error {
+	if imp.InputOptions.Delimiter != "" && imp.InputOptions.Delimiter != "," {
+		return fmt.Errorf("can not use --delimiter when input type is %v", inputType)
+	}
+	if imp.InputOptions.QuoteChar != "" && imp.InputOptions.QuoteChar != `"` {
+		return fmt.Errorf("can not use --quoteChar when input type is %v", inputType)
+	}
+	if imp.InputOptions.EscapeChar != "" {
+		return fmt.Errorf("can not use --escapeChar when input type is %v", inputType)
+	}
+	return nil
+}
+
+// csvDialect returns the dialect of CSV input set by the --delimiter,
+// --quoteChar, --escapeChar and --comment options.
+func (imp *MongoImport) csvDialect() (csv.Dialect, error) {
+	opts := imp.InputOptions
+	return csv.ParseDialect(opts.Delimiter, opts.QuoteChar, opts.EscapeChar, opts.Comment)
+}
+
+// getSourceReader returns an io.Reader to read from the input source, which
+// decompresses the input if it is compressed with gzip, bzip2 or zstd, and
+// transcodes it to UTF-8 if it is in another --encoding. Also returns the size
+// of the input in bytes, which can be used to track progress. A compressed or
+// transcoded input is measured in the bytes of the source, so the returned
+// reader then implements sizeTracker to report how many of them have been read.
 func (imp *MongoImport) getSourceReader() (io.ReadCloser, int64, error) {
+	var source io.ReadCloser
+	var fileSize int64
 	if imp.InputOptions.File != "" {
 		file, err := os.Open(util.ToUniversalPath(imp.InputOptions.File))
 		if err != nil {
@@ -268,16 +456,43 @@ func (imp *MongoImport) getSourceReader() (io.ReadCloser, int64, error) {
 		}
 		fileStat, err := file.Stat()
 		if err != nil {
+			file.Close()
 			return nil, -1, err
 		}
 		log.Logvf(log.Info, "filesize: %v bytes", fileStat.Size())
-		return file, int64(fileStat.Size()), err
+		source, fileSize = file, int64(fileStat.Size())
+	} else {
+		log.Logvf(log.Info, "reading from stdin")
+
+		// Stdin has undefined max size, so use 0
+		source, fileSize = os.Stdin, 0
 	}
 
-	log.Logvf(log.Info, "reading from stdin")
+	// Parquet files are read at random rather than streamed, and compress
+	// their own pages
+	if imp.InputOptions.Type == PARQUET {
+		return source, fileSize, nil
+	}
 
-	// Stdin has undefined max size, so return 0
-	return os.Stdin, 0, nil
+	reader, compression, err := newDecompressingReader(source, imp.InputOptions.File)
+	if err != nil {
+		source.Close()
+		return nil, -1, err
+	}
+	if compression != compressionNone {
+		log.Logvf(log.Info, "decompressing %v input", compression)
+	}
+
+	encoding, err := charset.Lookup(imp.InputOptions.Encoding)
+	if err != nil {
+		reader.Close()
+		return nil, -1, err
+	}
+	if encoding != charset.UTF8 {
+		log.Logvf(log.Info, "transcoding %v input to utf-8", encoding)
+		reader = newTranscodingReader(reader, encoding)
+	}
+	return reader, fileSize, nil
 }
 
 // fileSizeProgressor implements Progressor to allow a sizeTracker to hook up with a
@@ -295,31 +510,53 @@ func (fsp *fileSizeProgressor) Progress() (int64, int64) {
 // number of documents successfully imported to the appropriate namespace and
 // any error encountered in doing this
 func (imp *MongoImport) ImportDocuments() (uint64, error) {
+	if imp.InputOptions.Files != "" {
+		return imp.importFiles()
+	}
+
 	source, fileSize, err := imp.getSourceReader()
 	if err != nil {
 		return 0, err
 	}
 	defer source.Close()
 
+	if imp.IngestOptions.RejectFile != "" {
+		rejectFile, err := os.Create(util.ToUniversalPath(imp.IngestOptions.RejectFile))
+		if err != nil {
+			return 0, fmt.Errorf("error creating reject file: %v", err)
+		}
+		defer rejectFile.Close()
+		imp.rejects = newRejectWriter(rejectFile)
+	}
+
 	inputReader, err := imp.getInputReader(source)
 	if err != nil {
 		return 0, err
 	}
+	if _, err = imp.readColumns(inputReader); err != nil {
+		return 0, err
+	}
 
-	if imp.InputOptions.HeaderLine {
-		if imp.InputOptions.ColumnsHaveTypes {
-			err = inputReader.ReadAndValidateTypedHeader(ParsePG(imp.InputOptions.ParseGrace))
-		} else {
-			err = inputReader.ReadAndValidateHeader()
-		}
-		if err != nil {
-			return 0, err
-		}
+	// a compressed input tracks its own size, since the input reader only
+	// sees the decompressed bytes
+	var tracker sizeTracker = inputReader
+	if sourceTracker, ok := source.(sizeTracker); ok {
+		tracker = sourceTracker
+	}
+
+	// a file of a batch reports its progress to the batch's progress bar
+	if imp.batch != nil {
+		imp.batch.watch(tracker)
+		return imp.importDocuments(inputReader)
 	}
 
+	name := fmt.Sprintf("%v.%v", imp.ToolOptions.DB, imp.ToolOptions.Collection)
+	if imp.routes != nil {
+		name = fmt.Sprintf("%v.%v", imp.ToolOptions.DB, imp.IngestOptions.RouteTemplate)
+	}
 	bar := &progress.Bar{
-		Name:      fmt.Sprintf("%v.%v", imp.ToolOptions.DB, imp.ToolOptions.Collection),
-		Watching:  &fileSizeProgressor{fileSize, inputReader},
+		Name:      name,
+		Watching:  &fileSizeProgressor{fileSize, tracker},
 		Writer:    log.Writer(0),
 		BarLength: progressBarLength,
 		IsBytes:   true,
@@ -329,6 +566,59 @@ func (imp *MongoImport) ImportDocuments() (uint64, error) {
 	return imp.importDocuments(inputReader)
 }
 
+// readColumns reads the header line from the input reader if there is one,
+// and infers the types of the columns if --inferTypes is set. Returns the
+// typed field list if the types are inferred.
+func (imp *MongoImport) readColumns(inputReader InputReader) ([]string, error) {
+	parseGrace := ParsePG(imp.InputOptions.ParseGrace)
+	if imp.InputOptions.HeaderLine {
+		var err error
+		if imp.InputOptions.ColumnsHaveTypes {
+			err = inputReader.ReadAndValidateTypedHeader(parseGrace)
+		} else {
+			err = inputReader.ReadAndValidateHeader()
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if !imp.InputOptions.InferTypes {
+		return nil, nil
+	}
+	typedFields, err := inputReader.InferColumnTypes(imp.InputOptions.InferSampleSize, parseGrace)
+	if err != nil {
+		return nil, fmt.Errorf("error inferring column types: %v", err)
+	}
+	log.Logvf(log.Info, "inferred column types: %v", strings.Join(typedFields, ","))
+	return typedFields, nil
+}
+
+// PrintInferredTypes infers the types of the columns of the input source and
+// writes the typed field list to out, one field per line, in the form used by
+// --fieldFile with --columnsHaveTypes.
+func (imp *MongoImport) PrintInferredTypes(out io.Writer) error {
+	source, _, err := imp.getSourceReader()
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+
+	inputReader, err := imp.getInputReader(source)
+	if err != nil {
+		return err
+	}
+	typedFields, err := imp.readColumns(inputReader)
+	if err != nil {
+		return err
+	}
+	for _, field := range typedFields {
+		if _, err = fmt.Fprintln(out, field); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // importDocuments is a helper to ImportDocuments and does all the ingestion
 // work by taking data from the inputReader source and writing it to the
 // appropriate namespace
@@ -363,21 +653,15 @@ func (imp *MongoImport) importDocuments(inputReader InputReader) (numImported ui
 		return 0, fmt.Errorf("error configuring session: %v", err)
 	}
 
-	// drop the database if necessary
-	if imp.IngestOptions.Drop {
-		log.Logvf(log.Always, "dropping: %v.%v",
-			imp.ToolOptions.DB,
-			imp.ToolOptions.Collection)
-		collection := session.DB(imp.ToolOptions.DB).
-			C(imp.ToolOptions.Collection)
-		if err := collection.DropCollection(); err != nil {
-			if err.Error() != db.ErrNsNotFound {
-				return 0, err
-			}
+	// drop the database if necessary; routed collections are dropped when the
+	// first document is routed to them
+	if imp.IngestOptions.Drop && imp.routes == nil {
+		if err = imp.dropCollection(session, imp.ToolOptions.Collection); err != nil {
+			return 0, err
 		}
 	}
 
-	readDocs := make(chan bson.D, workerBufferSize)
+	readDocs := make(chan importDocument, workerBufferSize)
 	processingErrChan := make(chan error)
 	ordered := imp.IngestOptions.MaintainInsertionOrder
 
@@ -392,14 +676,27 @@ func (imp *MongoImport) importDocuments(inputReader InputReader) (numImported ui
 	}()
 
 	e1 := channelQuorumError(processingErrChan, 2)
+	if imp.routes != nil {
+		imp.routes.logCounts(imp.ToolOptions.DB)
+	}
 	insertionCount := atomic.LoadUint64(&imp.insertionCount)
 	return insertionCount, e1
 }
 
+// dropCollection drops a collection of the target database, if it exists.
+func (imp *MongoImport) dropCollection(session *mgo.Session, collection string) error {
+	log.Logvf(log.Always, "dropping: %v.%v", imp.ToolOptions.DB, collection)
+	err := session.DB(imp.ToolOptions.DB).C(collection).DropCollection()
+	if err != nil && err.Error() != db.ErrNsNotFound {
+		return err
+	}
+	return nil
+}
+
 // ingestDocuments accepts a channel from which it reads documents to be inserted
 // into the target collection. It spreads the insert/upsert workload across one
 // or more workers.
-func (imp *MongoImport) ingestDocuments(readDocs chan bson.D) (retErr error) {
+func (imp *MongoImport) ingestDocuments(readDocs chan importDocument) (retErr error) {
 	numInsertionWorkers := imp.IngestOptions.NumInsertionWorkers
 	if numInsertionWorkers <= 0 {
 		numInsertionWorkers = 1
@@ -455,9 +752,53 @@ type flushInserter interface {
 	Flush() error
 }
 
+// bufferedInserter is a flushInserter that buffers the documents it writes
+// in bulk, and counts the bulk writes it makes so that the documents that
+// fail to be written can be traced back to the input.
+type bufferedInserter interface {
+	flushInserter
+	Flushes() int
+}
+
+// insertTarget writes the documents of an insertion worker to one
+// collection.
+type insertTarget struct {
+	inserter flushInserter
+	// bulkInserter is the inserter, if it buffers documents
+	bulkInserter bufferedInserter
+	// the sources of the documents buffered by the bulk inserter, so that the
+	// documents that fail to be written can be traced back to the input
+	buffered []Converter
+	// count is the number of documents written by the target
+	count uint64
+}
+
+// newInsertTarget returns an insertTarget that writes documents to a
+// collection according to the --mode.
+func (imp *MongoImport) newInsertTarget(session *mgo.Session, collectionName string) *insertTarget {
+	collection := session.DB(imp.ToolOptions.DB).C(collectionName)
+	target := &insertTarget{}
+	switch imp.IngestOptions.Mode {
+	case modeInsert:
+		bb := db.NewBufferedBulkInserter(collection, imp.IngestOptions.BulkBufferSize, !imp.IngestOptions.StopOnError)
+		if !imp.IngestOptions.MaintainInsertionOrder {
+			bb.Unordered()
+		}
+		target.bulkInserter = bb
+		target.inserter = bb
+	case modeChanges:
+		bb := db.NewBufferedBulkInserter(collection, imp.IngestOptions.BulkBufferSize, !imp.IngestOptions.StopOnError)
+		target.bulkInserter = imp.newChangeWriter(bb)
+		target.inserter = target.bulkInserter
+	default:
+		target.inserter = imp.newUpserter(collection)
+	}
+	return target
+}
+
 // runInsertionWorker is a helper to InsertDocuments - it reads document off
 // the read channel and prepares then in batches for insertion into the databas
-func (imp *MongoImport) runInsertionWorker(readDocs chan bson.D) (err error) {
+func (imp *MongoImport) runInsertionWorker(readDocs chan importDocument) (err error) {
 	session, err := imp.SessionProvider.GetSession()
 	if err != nil {
 		return fmt.Errorf("error connecting to mongod: %v", err)
@@ -466,17 +807,10 @@ func (imp *MongoImport) runInsertionWorker(readDocs chan bson.D) (err error) {
 	if err = imp.configureSession(session); err != nil {
 		return fmt.Errorf("error configuring session: %v", err)
 	}
-	collection := session.DB(imp.ToolOptions.DB).C(imp.ToolOptions.Collection)
-
-	var inserter flushInserter
-	if imp.IngestOptions.Mode == modeInsert {
-		inserter = db.NewBufferedBulkInserter(collection, imp.IngestOptions.BulkBufferSize, !imp.IngestOptions.StopOnError)
-		if !imp.IngestOptions.MaintainInsertionOrder {
-			inserter.(*db.BufferedBulkInserter).Unordered()
-		}
-	} else {
-		inserter = imp.newUpserter(collection)
+	if imp.routes != nil {
+		return imp.runRoutingWorker(session, readDocs)
 	}
+	target := imp.newInsertTarget(session, imp.ToolOptions.Collection)
 
 readLoop:
 	for {
@@ -485,17 +819,67 @@ readLoop:
 			if !alive {
 				break readLoop
 			}
-			err = filterIngestError(imp.IngestOptions.StopOnError, inserter.Insert(document))
-			if err != nil {
+			if imp.transform != nil {
+				var ok bool
+				if ok, err = imp.transformDocument(imp.ToolOptions.Collection, &document); err != nil {
+					return err
+				}
+				if !ok {
+					continue
+				}
+			}
+			if err = imp.insert(target, document); err != nil {
 				return err
 			}
-			atomic.AddUint64(&imp.insertionCount, 1)
 		case <-imp.Dying():
 			return nil
 		}
 	}
+	return imp.flush(target)
+}
+
+// insert writes a document to a target, or buffers it to be written in bulk.
+// Rejects the documents that fail to be written.
+func (imp *MongoImport) insert(target *insertTarget, document importDocument) error {
+	var flushes int
+	if target.bulkInserter != nil {
+		flushes = target.bulkInserter.Flushes()
+	}
+	err := target.inserter.Insert(document.document)
+	if err == errNoChange {
+		return nil
+	}
 
-	err = inserter.Flush()
+	// the sources of the documents this insert tried to write: the
+	// document itself, unless the bulk inserter buffered it, in which
+	// case only the documents buffered before it may have been flushed
+	written := []Converter{document.source}
+	if target.bulkInserter != nil {
+		if target.bulkInserter.Flushes() != flushes {
+			written, target.buffered = target.buffered, []Converter{document.source}
+		} else if err == nil {
+			written, target.buffered = nil, append(target.buffered, document.source)
+		}
+	}
+	if rejectErr := imp.rejects.RejectWriteError(err, written); rejectErr != nil {
+		return rejectErr
+	}
+	err = filterIngestError(imp.IngestOptions.StopOnError, err)
+	if err != nil {
+		return err
+	}
+	atomic.AddUint64(&imp.insertionCount, 1)
+	target.count++
+	return nil
+}
+
+// flush writes the documents buffered by a target.
+func (imp *MongoImport) flush(target *insertTarget) error {
+	err := target.inserter.Flush()
+	if rejectErr := imp.rejects.RejectWriteError(err, target.buffered); rejectErr != nil {
+		return rejectErr
+	}
+	target.buffered = nil
 	// TOOLS-349 correct import count for bulk operations
 	if bulkError, ok := err.(*mgo.BulkError); ok {
 		failedDocs := make(map[int]bool) // index of failures
@@ -506,11 +890,41 @@ readLoop:
 		if numFailures > 0 {
 			log.Logvf(log.Always, "num failures: %d", numFailures)
 			atomic.AddUint64(&imp.insertionCount, ^uint64(numFailures-1))
+			target.count -= uint64(numFailures)
 		}
 	}
 	return filterIngestError(imp.IngestOptions.StopOnError, err)
 }
 
+// rejectDocument rejects a document that can't be written for err, which is
+// returned with --stopOnError and logged otherwise.
+func (imp *MongoImport) rejectDocument(document importDocument, err error) error {
+	if rejectErr := imp.rejects.Reject(document.source, err); rejectErr != nil {
+		return rejectErr
+	}
+	if line, _ := document.source.Record(); line > 0 {
+		err = fmt.Errorf("line %v: %v", line, err)
+	}
+	if imp.IngestOptions.StopOnError {
+		return err
+	}
+	log.Logvf(log.Always, "error: %v", err)
+	return nil
+}
+
+// transformDocument applies the --transformFile rules to a document before it
+// is inserted into a collection. Returns false if the document can't be
+// transformed, in which case it is rejected and, with --stopOnError, the
+// error is returned.
+func (imp *MongoImport) transformDocument(collection string, document *importDocument) (bool, error) {
+	transformed, err := imp.transform.Apply(imp.ToolOptions.DB+"."+collection, document.document)
+	if err != nil {
+		return false, imp.rejectDocument(*document, err)
+	}
+	document.document = transformed
+	return true, nil
+}
+
 type upserter struct {
 	imp        *MongoImport
 	collection *mgo.Collection
@@ -594,13 +1008,43 @@ func (imp *MongoImport) getInputReader(in io.Reader) (InputReader, error) {
 		}
 	}
 
-	out := os.Stdout
+	// skipped rows are printed, unless they are written to the reject file
+	var out io.Writer = os.Stdout
+	if imp.rejects != nil {
+		out = ioutil.Discard
+	}
 
 	ignoreBlanks := imp.IngestOptions.IgnoreBlanks && imp.InputOptions.Type != JSON
-	if imp.InputOptions.Type == CSV {
-		return NewCSVInputReader(colSpecs, in, out, imp.IngestOptions.NumDecodingWorkers, ignoreBlanks), nil
+	if imp.InputOptions.Type == PARQUET {
+		return NewParquetInputReader(in, imp.IngestOptions.NumDecodingWorkers)
+	} else if imp.InputOptions.Type == CSV {
+		dialect, err := imp.csvDialect()
+		if err != nil {
+			return nil, err
+		}
+		csvInputReader := NewCSVInputReader(colSpecs, in, out, imp.IngestOptions.NumDecodingWorkers, ignoreBlanks)
+		csvInputReader.setDialect(dialect)
+		csvInputReader.rejects = imp.rejects
+		return csvInputReader, nil
 	} else if imp.InputOptions.Type == TSV {
-		return NewTSVInputReader(colSpecs, in, out, imp.IngestOptions.NumDecodingWorkers, ignoreBlanks), nil
+		dialect, err := imp.csvDialect()
+		if err != nil {
+			return nil, err
+		}
+		tsvInputReader := NewTSVInputReader(colSpecs, in, out, imp.IngestOptions.NumDecodingWorkers, ignoreBlanks)
+		tsvInputReader.comment = dialect.Comment
+		tsvInputReader.rejects = imp.rejects
+		return tsvInputReader, nil
+	}
+	jsonFormat, err := json.ParseFormat(imp.InputOptions.JSONFormat)
+	if err != nil {
+		return nil, err
+	}
+	jsonInputReader := NewJSONInputReader(imp.InputOptions.JSONArray, jsonFormat, in, imp.IngestOptions.NumDecodingWorkers)
+	// documents that can't be parsed stop the import, unless they can be
+	// rejected and --stopOnError isn't set
+	if !imp.IngestOptions.StopOnError {
+		jsonInputReader.rejects = imp.rejects
 	}
-	return NewJSONInputReader(imp.InputOptions.JSONArray, in, imp.IngestOptions.NumDecodingWorkers), nil
+	return jsonInputReader, nil
 }
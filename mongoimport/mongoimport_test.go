@@ -1,17 +1,22 @@
 package mongoimport
 
 import (
+	"bytes"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"reflect"
 	"strings"
 	"testing"
 
+	"github.com/mongodb/mongo-tools/common/csv"
 	"github.com/mongodb/mongo-tools/common/db"
+	"github.com/mongodb/mongo-tools/common/json"
 	"github.com/mongodb/mongo-tools/common/options"
 	"github.com/mongodb/mongo-tools/common/testutil"
+	"github.com/mongodb/mongo-tools/common/transform"
 	. "github.com/smartystreets/goconvey/convey"
 	"gopkg.in/mgo.v2/bson"
 )
@@ -152,6 +157,105 @@ func TestMongoImportValidateSettings(t *testing.T) {
 			So(imp.ValidateSettings([]string{}), ShouldBeNil)
 		})
 
+		Convey("no error should be thrown if the parquet type is given", func() {
+			imp, err := NewMongoImport()
+			So(err, ShouldBeNil)
+			imp.InputOptions.Type = "Parquet"
+			So(imp.ValidateSettings([]string{}), ShouldBeNil)
+			So(imp.InputOptions.Type, ShouldEqual, PARQUET)
+		})
+
+		Convey("an error should be thrown if options for other input types "+
+			"are used with the parquet type", func() {
+			imp, err := NewMongoImport()
+			So(err, ShouldBeNil)
+			imp.InputOptions.Type = PARQUET
+			imp.InputOptions.HeaderLine = true
+			So(imp.ValidateSettings([]string{}), ShouldNotBeNil)
+			imp.InputOptions.HeaderLine = false
+			imp.InputOptions.JSONArray = true
+			So(imp.ValidateSettings([]string{}), ShouldNotBeNil)
+			imp.InputOptions.JSONArray = false
+			imp.InputOptions.JSONFormat = "canonical"
+			So(imp.ValidateSettings([]string{}), ShouldNotBeNil)
+		})
+
+		Convey("--inferTypes should need a positive sample size and no "+
+			"--columnsHaveTypes", func() {
+			imp, err := NewMongoImport()
+			So(err, ShouldBeNil)
+			imp.InputOptions.Type = CSV
+			imp.InputOptions.HeaderLine = true
+			imp.InputOptions.PrintInferredTypes = true
+			So(imp.ValidateSettings([]string{}), ShouldNotBeNil)
+			imp.InputOptions.InferSampleSize = 10
+			So(imp.ValidateSettings([]string{}), ShouldBeNil)
+			So(imp.InputOptions.InferTypes, ShouldBeTrue)
+			imp.InputOptions.ColumnsHaveTypes = true
+			So(imp.ValidateSettings([]string{}), ShouldNotBeNil)
+		})
+
+		Convey("an error should be thrown if --inferTypes is used with the "+
+			"json type", func() {
+			imp, err := NewMongoImport()
+			So(err, ShouldBeNil)
+			imp.InputOptions.InferTypes = true
+			So(imp.ValidateSettings([]string{}), ShouldNotBeNil)
+		})
+
+		Convey("the CSV dialect options should be single distinct characters", func() {
+			imp, err := NewMongoImport()
+			So(err, ShouldBeNil)
+			imp.InputOptions.Type = CSV
+			imp.InputOptions.HeaderLine = true
+			imp.InputOptions.Delimiter = `\t`
+			imp.InputOptions.QuoteChar = "'"
+			imp.InputOptions.EscapeChar = `\`
+			imp.InputOptions.Comment = "#"
+			So(imp.ValidateSettings([]string{}), ShouldBeNil)
+			dialect, err := imp.csvDialect()
+			So(err, ShouldBeNil)
+			So(dialect, ShouldResemble, csv.Dialect{Comma: '\t', Quote: '\'', Escape: '\\', Comment: '#'})
+			imp.InputOptions.EscapeChar = "'"
+			So(imp.ValidateSettings([]string{}), ShouldBeNil)
+			imp.InputOptions.Comment = "'"
+			So(imp.ValidateSettings([]string{}), ShouldNotBeNil)
+			imp.InputOptions.Comment = "##"
+			So(imp.ValidateSettings([]string{}), ShouldNotBeNil)
+			imp.InputOptions.Comment = "\n"
+			So(imp.ValidateSettings([]string{}), ShouldNotBeNil)
+		})
+
+		Convey("an error should be thrown if the CSV dialect options are used "+
+			"with other input types", func() {
+			imp, err := NewMongoImport()
+			So(err, ShouldBeNil)
+			imp.InputOptions.Type = TSV
+			imp.InputOptions.HeaderLine = true
+			imp.InputOptions.Comment = "#"
+			So(imp.ValidateSettings([]string{}), ShouldBeNil)
+			imp.InputOptions.Delimiter = ";"
+			So(imp.ValidateSettings([]string{}), ShouldNotBeNil)
+
+			imp, err = NewMongoImport()
+			So(err, ShouldBeNil)
+			imp.InputOptions.Comment = "#"
+			So(imp.ValidateSettings([]string{}), ShouldNotBeNil)
+		})
+
+		Convey("--encoding should name a supported encoding and not be used "+
+			"with the parquet type", func() {
+			imp, err := NewMongoImport()
+			So(err, ShouldBeNil)
+			imp.InputOptions.Encoding = "UTF-16"
+			So(imp.ValidateSettings([]string{}), ShouldBeNil)
+			imp.InputOptions.Encoding = "ebcdic"
+			So(imp.ValidateSettings([]string{}), ShouldNotBeNil)
+			imp.InputOptions.Encoding = "latin1"
+			imp.InputOptions.Type = PARQUET
+			So(imp.ValidateSettings([]string{}), ShouldNotBeNil)
+		})
+
 		Convey("no error should be thrown if no input type is supplied", func() {
 			imp, err := NewMongoImport()
 			So(err, ShouldBeNil)
@@ -349,6 +453,96 @@ func TestMongoImportValidateSettings(t *testing.T) {
 			So(imp.ValidateSettings([]string{}), ShouldBeNil)
 			So(imp.ToolOptions.Namespace.Collection, ShouldEqual, "input")
 		})
+
+		Convey("with no collection name and a compressed file name the "+
+			"compression extension should also be left out of the collection name", func() {
+			imp, err := NewMongoImport()
+			So(err, ShouldBeNil)
+			imp.InputOptions.File = "/path/to/input/file/dot/input.json.gz"
+			imp.ToolOptions.Namespace.Collection = ""
+			So(imp.ValidateSettings([]string{}), ShouldBeNil)
+			So(imp.ToolOptions.Namespace.Collection, ShouldEqual, "input")
+		})
+
+		Convey("the rules of --transformFile should be read", func() {
+			imp, err := NewMongoImport()
+			So(err, ShouldBeNil)
+			imp.InputOptions.TransformFile = "testdata/test_transform.yaml"
+			So(imp.ValidateSettings([]string{}), ShouldBeNil)
+			So(imp.transform, ShouldNotBeNil)
+			So(len(imp.transform.Rules), ShouldEqual, 4)
+
+			imp.InputOptions.TransformFile = "testdata/missing.yaml"
+			So(imp.ValidateSettings([]string{}), ShouldNotBeNil)
+			imp.InputOptions.TransformFile = "testdata/test.csv"
+			So(imp.ValidateSettings([]string{}), ShouldNotBeNil)
+		})
+	})
+}
+
+func TestTransformDocument(t *testing.T) {
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With a --transformFile", t, func() {
+		imp, err := NewMongoImport()
+		So(err, ShouldBeNil)
+		imp.transform, err = transform.Parse([]byte(`[{"op": "geoPoint", "from": "pos", "to": "loc"}]`), true)
+		So(err, ShouldBeNil)
+		rejects := &bytes.Buffer{}
+		imp.rejects = newRejectWriter(rejects)
+
+		Convey("documents should be transformed", func() {
+			document := importDocument{document: bson.D{{"pos", "1,2"}}}
+			ok, err := imp.transformDocument(testCollection, &document)
+			So(err, ShouldBeNil)
+			So(ok, ShouldBeTrue)
+			So(document.document, ShouldResemble, bson.D{
+				{"loc", bson.D{{"type", "Point"}, {"coordinates", []interface{}{2.0, 1.0}}}},
+			})
+		})
+
+		Convey("documents that fail to be transformed should be rejected", func() {
+			document := importDocument{
+				document: bson.D{{"pos", "north"}},
+				source:   JSONConverter{data: []byte(`{"pos": "north"}`), line: 2},
+			}
+			ok, err := imp.transformDocument(testCollection, &document)
+			So(err, ShouldBeNil)
+			So(ok, ShouldBeFalse)
+			var rejected rejectedRecord
+			So(json.Unmarshal(rejects.Bytes(), &rejected), ShouldBeNil)
+			So(rejected.Line, ShouldEqual, 2)
+			So(rejected.Reason, ShouldContainSubstring, "transform rule #1")
+
+			imp.IngestOptions.StopOnError = true
+			document.document = bson.D{{"pos", "north"}}
+			ok, err = imp.transformDocument(testCollection, &document)
+			So(err, ShouldNotBeNil)
+			So(ok, ShouldBeFalse)
+		})
+
+		Convey("documents imported from JSON should be transformed", func() {
+			imp.transform, err = transform.Parse([]byte(`
+- {op: geoPoint, from: place.pos, to: loc}
+- {op: split, field: place.tags, separator: ";", to: tags}
+- {op: rename, from: place.name, to: name}
+- {op: remove, fields: [place]}
+`), false)
+			So(err, ShouldBeNil)
+			converter := JSONConverter{data: []byte(`{"_id": 1, "place": {"pos": "1,2", "tags": "a;b", "name": "x"}}`)}
+			document := importDocument{source: converter}
+			document.document, err = converter.Convert()
+			So(err, ShouldBeNil)
+			ok, err := imp.transformDocument(testCollection, &document)
+			So(err, ShouldBeNil)
+			So(ok, ShouldBeTrue)
+			So(document.document, ShouldResemble, bson.D{
+				{"_id", 1},
+				{"loc", bson.D{{"type", "Point"}, {"coordinates", []interface{}{2.0, 1.0}}}},
+				{"tags", []interface{}{"a", "b"}},
+				{"name", "x"},
+			})
+		})
 	})
 }
 
@@ -383,6 +577,95 @@ func TestGetSourceReader(t *testing.T) {
 				_, _, err = imp.getSourceReader()
 				So(err, ShouldBeNil)
 			})
+
+			Convey("compressed files should be decompressed, with the size "+
+				"tracked in compressed bytes", func() {
+				files := map[string]string{
+					"testdata/test_plain.json.gz": "testdata/test_plain.json",
+					"testdata/test.tsv.bz2":       "testdata/test.tsv",
+				}
+				if zstdSupported {
+					files["testdata/test.csv.zst"] = "testdata/test.csv"
+				}
+				for compressed, plain := range files {
+					imp, err := NewMongoImport()
+					So(err, ShouldBeNil)
+					imp.InputOptions.File = compressed
+					source, fileSize, err := imp.getSourceReader()
+					So(err, ShouldBeNil)
+					tracker, ok := source.(sizeTracker)
+					So(ok, ShouldBeTrue)
+
+					contents, err := ioutil.ReadAll(source)
+					So(err, ShouldBeNil)
+					expected, err := ioutil.ReadFile(plain)
+					So(err, ShouldBeNil)
+					So(string(contents), ShouldEqual, string(expected))
+					So(tracker.Size(), ShouldEqual, fileSize)
+					So(source.Close(), ShouldBeNil)
+				}
+			})
+
+			Convey("zstd files should only be read by builds that support zstd", func() {
+				imp, err := NewMongoImport()
+				So(err, ShouldBeNil)
+				imp.InputOptions.File = "testdata/test.csv.zst"
+				source, _, err := imp.getSourceReader()
+				if zstdSupported {
+					So(err, ShouldBeNil)
+					So(source.Close(), ShouldBeNil)
+				} else {
+					So(err, ShouldNotBeNil)
+				}
+			})
+
+			Convey("files that are not compressed should be read as they are", func() {
+				imp, err := NewMongoImport()
+				So(err, ShouldBeNil)
+				imp.InputOptions.File = "testdata/test.csv"
+				source, _, err := imp.getSourceReader()
+				So(err, ShouldBeNil)
+				_, ok := source.(sizeTracker)
+				So(ok, ShouldBeFalse)
+				contents, err := ioutil.ReadAll(source)
+				So(err, ShouldBeNil)
+				expected, err := ioutil.ReadFile("testdata/test.csv")
+				So(err, ShouldBeNil)
+				So(contents, ShouldResemble, expected)
+				So(source.Close(), ShouldBeNil)
+			})
+
+			Convey("files in another encoding should be transcoded to UTF-8, "+
+				"with the size tracked in bytes of the file", func() {
+				imp, err := NewMongoImport()
+				So(err, ShouldBeNil)
+				imp.InputOptions.File = "testdata/test_utf16.csv"
+				imp.InputOptions.Encoding = "utf-16"
+				source, fileSize, err := imp.getSourceReader()
+				So(err, ShouldBeNil)
+				contents, err := ioutil.ReadAll(source)
+				So(err, ShouldBeNil)
+				So(string(contents), ShouldEqual, "name,city\nZoë,Zürich\n")
+				So(source.(sizeTracker).Size(), ShouldEqual, fileSize)
+				So(source.Close(), ShouldBeNil)
+			})
+
+			Convey("an error should be thrown if a file with a compression "+
+				"extension is not compressed", func() {
+				file, err := ioutil.TempFile("", "mongoimport")
+				So(err, ShouldBeNil)
+				defer os.Remove(file.Name())
+				So(file.Close(), ShouldBeNil)
+				So(os.Rename(file.Name(), file.Name()+".gz"), ShouldBeNil)
+				defer os.Remove(file.Name() + ".gz")
+				So(ioutil.WriteFile(file.Name()+".gz", []byte(`{"a": 1}`), 0644), ShouldBeNil)
+
+				imp, err := NewMongoImport()
+				So(err, ShouldBeNil)
+				imp.InputOptions.File = file.Name() + ".gz"
+				_, _, err = imp.getSourceReader()
+				So(err, ShouldNotBeNil)
+			})
 		})
 }
 
@@ -488,6 +771,27 @@ func TestGetInputReader(t *testing.T) {
 	})
 }
 
+func TestPrintInferredTypes(t *testing.T) {
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+	Convey("With a CSV file to infer column types from", t, func() {
+		imp, err := NewMongoImport()
+		So(err, ShouldBeNil)
+		imp.InputOptions.File = "testdata/test.csv"
+		imp.InputOptions.Type = CSV
+		fields := "a,b,c"
+		imp.InputOptions.Fields = &fields
+		imp.InputOptions.InferTypes = true
+		imp.InputOptions.InferSampleSize = 2
+		So(imp.ValidateSettings([]string{}), ShouldBeNil)
+
+		Convey("the typed field list should be printed one field per line", func() {
+			out := &bytes.Buffer{}
+			So(imp.PrintInferredTypes(out), ShouldBeNil)
+			So(out.String(), ShouldEqual, "a.int32()\nb.double()\nc.string()\n")
+		})
+	})
+}
+
 func TestImportDocuments(t *testing.T) {
 	testutil.VerifyTestType(t, testutil.IntegrationTestType)
 	Convey("With a mongoimport instance", t, func() {
@@ -536,6 +840,43 @@ func TestImportDocuments(t *testing.T) {
 			So(err, ShouldBeNil)
 			So(numImported, ShouldEqual, 10)
 		})
+		Convey("import with --mode=changes should apply the changes in order", func() {
+			imp, err := NewMongoImport()
+			So(err, ShouldBeNil)
+			imp.InputOptions.File = "testdata/test_changes.json"
+			imp.IngestOptions.Mode = modeChanges
+			So(imp.ValidateSettings([]string{}), ShouldBeNil)
+
+			numImported, err := imp.ImportDocuments()
+			So(err, ShouldBeNil)
+			So(numImported, ShouldEqual, 9)
+			expectedDocuments := []bson.M{
+				bson.M{"_id": 1, "a": 1, "b": 1},
+				bson.M{"_id": 3, "c": 3},
+				bson.M{"_id": 4, "a": 5},
+			}
+			So(checkOnlyHasDocuments(*imp.SessionProvider, expectedDocuments), ShouldBeNil)
+		})
+		Convey("CSV import with --transformFile should import the transformed documents", func() {
+			imp, err := NewMongoImport()
+			So(err, ShouldBeNil)
+			imp.InputOptions.Type = CSV
+			imp.InputOptions.File = "testdata/test.csv"
+			fields := "a,b,c"
+			imp.InputOptions.Fields = &fields
+			imp.InputOptions.TransformFile = "testdata/test_transform.yaml"
+			So(imp.ValidateSettings([]string{}), ShouldBeNil)
+
+			numImported, err := imp.ImportDocuments()
+			So(err, ShouldBeNil)
+			So(numImported, ShouldEqual, 3)
+			expectedDocuments := []bson.M{
+				bson.M{"_id": 1, "bc": "2-3", "sub": bson.M{"c": 3}},
+				bson.M{"_id": 3, "bc": "5.4-string", "sub": bson.M{"c": "string"}},
+				bson.M{"_id": 5, "bc": "6-6", "sub": bson.M{"c": 6}},
+			}
+			So(checkOnlyHasDocuments(*imp.SessionProvider, expectedDocuments), ShouldBeNil)
+		})
 		Convey("CSV import with --ignoreBlanks should import only non-blank fields", func() {
 			imp, err := NewMongoImport()
 			So(err, ShouldBeNil)
@@ -752,11 +1093,30 @@ func TestImportDocuments(t *testing.T) {
 			_, err = imp.ImportDocuments()
 			So(err, ShouldNotBeNil)
 		})
+		Convey("all the --files should be imported, with their total returned", func() {
+			dir, err := ioutil.TempDir("", "mongoimport")
+			So(err, ShouldBeNil)
+			defer os.RemoveAll(dir)
+			So(ioutil.WriteFile(filepath.Join(dir, "a.json"), []byte("{\"_id\": 1}\n{\"_id\": 2}\n"), 0644), ShouldBeNil)
+			So(ioutil.WriteFile(filepath.Join(dir, "b.json"), []byte("{\"_id\": 3}\n"), 0644), ShouldBeNil)
+
+			imp, err := NewMongoImport()
+			So(err, ShouldBeNil)
+			imp.InputOptions.Files = filepath.Join(dir, "*.json")
+			imp.IngestOptions.NumParallelFiles = 2
+			imp.IngestOptions.Drop = true
+			So(imp.ValidateSettings([]string{}), ShouldBeNil)
+			numImported, err := imp.ImportDocuments()
+			So(err, ShouldBeNil)
+			So(numImported, ShouldEqual, 3)
+			expectedDocuments := []bson.M{{"_id": 1}, {"_id": 2}, {"_id": 3}}
+			So(checkOnlyHasDocuments(*imp.SessionProvider, expectedDocuments), ShouldBeNil)
+		})
 		Convey("an error should be thrown if a plain JSON file is supplied", func() {
 			fileHandle, err := os.Open("testdata/test_plain.json")
 			So(err, ShouldBeNil)
-			jsonInputReader := NewJSONInputReader(true, fileHandle, 1)
-			docChan := make(chan bson.D, 1)
+			jsonInputReader := NewJSONInputReader(true, json.LegacyFormat, fileHandle, 1)
+			docChan := make(chan importDocument, 1)
 			So(jsonInputReader.StreamDocument(true, docChan), ShouldNotBeNil)
 		})
 		Convey("an error should be thrown for invalid CSV import on test data", func() {
@@ -2,7 +2,7 @@ package mongoimport
 
 var Usage = `<options> <file>
 
-Import CSV, TSV or JSON data into MongoDB. If no file is provided, mongoimport reads from stdin.
+Import CSV, TSV, JSON or Parquet data into MongoDB. If no file is provided, mongoimport reads from stdin. Several files can be imported in one run with --files. CSV, TSV and JSON input compressed with gzip, bzip2 or zstd is decompressed automatically; zstd requires a build with the zstd tag.
 
 See http://docs.mongodb.org/manual/reference/program/mongoimport/ for more information.`
 
@@ -17,20 +17,56 @@ type InputOptions struct {
 	// Specifies the location and name of a file containing the data to import.
 	File string `long:"file" value-name:"<filename>" description:"file to import from; if not specified, stdin is used"`
 
+	// Specifies a glob of files to import in one run.
+	Files string `long:"files" value-name:"<glob>" description:"glob of files to import in one run, e.g. 'dir/*.json'; each file is imported into the collection named by --collectionFromFile, --collection or its own name"`
+
+	// Specifies how the collection of each of the --files is named.
+	CollectionFromFile string `long:"collectionFromFile" value-name:"<regex>" description:"regular expression matched against the name of each of the --files; the file is imported into the collection named by its first group, or by all of the match if it has no groups, e.g. 'events_(.*)\\.json'"`
+
 	// Treats the input source's first line as field list (csv and tsv only).
 	HeaderLine bool `long:"headerline" description:"use first line in input source as the field list (CSV and TSV only)"`
 
 	// Indicates that the underlying input source contains a single JSON array with the documents to import.
 	JSONArray bool `long:"jsonArray" description:"treat input source as a JSON array"`
 
+	// Specifies the flavor of Extended JSON that the input source is in.
+	JSONFormat string `long:"jsonFormat" value-name:"<format>" default:"legacy" default-mask:"-" description:"Extended JSON format of the input: canonical, relaxed or legacy; only legacy accepts shell mode values like NumberLong(1) (defaults to 'legacy')"`
+
 	// Indicates how to handle type coercion failures
 	ParseGrace string `long:"parseGrace" value-name:"<grace>" default:"stop" description:"controls behavior when type coercion fails - one of: autoCast, skipField, skipRow, stop (defaults to 'stop')"`
 
-	// Specifies the file type to import. The default format is JSON, but it’s possible to import CSV and TSV files.
-	Type string `long:"type" value-name:"<type>" default:"json" default-mask:"-" description:"input format to import: json, csv, or tsv (defaults to 'json')"`
+	// Specifies the file type to import. The default format is JSON, but it’s possible to import CSV, TSV and Parquet files.
+	Type string `long:"type" value-name:"<type>" default:"json" default-mask:"-" description:"input format to import: json, csv, tsv, or parquet (defaults to 'json')"`
 
 	// Indicates that field names include type descriptions
 	ColumnsHaveTypes bool `long:"columnsHaveTypes" description:"indicated that the field list (from --fields, --fieldsFile, or --headerline) specifies types; They must be in the form of '<colName>.<type>(<arg>)'. The type can be one of: auto, binary, bool, date, date_go, date_ms, date_oracle, double, int32, int64, string. For each of the date types, the argument is a datetime layout string. For the binary type, the argument can be one of: base32, base64, hex. All other types take an empty argument. Only valid for CSV and TSV imports. e.g. zipcode.string(), thumbnail.binary(base64)"`
+
+	// Infers the type of each column from the first rows of the input.
+	InferTypes bool `long:"inferTypes" description:"infer the type of each column from the first rows of the input and import them with the narrowest of: boolean, int32, int64, double, decimal, date (with a detected layout) or string; empty values make a column a string unless --ignoreBlanks is set. Only valid for CSV and TSV imports"`
+
+	// Sets the number of rows to infer column types from.
+	InferSampleSize int `long:"inferSampleSize" value-name:"<count>" default:"1000" default-mask:"-" description:"number of rows to infer column types from with --inferTypes (defaults to 1000)"`
+
+	// Prints the field list with the inferred types instead of importing.
+	PrintInferredTypes bool `long:"printInferredTypes" description:"print the field list with the types inferred by --inferTypes, one field per line in the form used by --fieldFile with --columnsHaveTypes, instead of importing"`
+
+	// Sets the character that separates the fields of CSV input.
+	Delimiter string `long:"delimiter" value-name:"<char>" default:"," default-mask:"-" description:"character that separates fields in CSV input, e.g. ';' or '\\t' for a tab (defaults to ',')"`
+
+	// Sets the character that quotes the fields of CSV input.
+	QuoteChar string `long:"quoteChar" value-name:"<char>" default:"\"" default-mask:"-" description:"character that quotes fields in CSV input (defaults to '\"')"`
+
+	// Sets the character that escapes the character after it in CSV input.
+	EscapeChar string `long:"escapeChar" value-name:"<char>" description:"character that makes the character after it literal in CSV input, e.g. '\\'; by default a quote is escaped by doubling it"`
+
+	// Sets the character that starts the lines to skip in CSV and TSV input.
+	Comment string `long:"comment" value-name:"<char>" description:"skip the lines of CSV and TSV input that start with this character, e.g. '#'"`
+
+	// Specifies the character encoding of the input source.
+	Encoding string `long:"encoding" value-name:"<encoding>" default:"utf-8" default-mask:"-" description:"character encoding of CSV, TSV and JSON input, transcoded to UTF-8 while reading: utf-8, utf-16, utf-16le, utf-16be, latin1 or windows-1252 (defaults to 'utf-8')"`
+
+	// Specifies a file of rules that reshape the documents before they are inserted.
+	TransformFile string `long:"transformFile" value-name:"<filename>" description:"YAML or JSON file of rules applied in order to each document before it is inserted: rename, remove, split, geoPoint, concat, nest or set fields"`
 }
 
 // Name returns a description of the InputOptions struct.
@@ -46,27 +82,43 @@ type IngestOptions struct {
 	// Ignores fields with empty values in CSV and TSV imports.
 	IgnoreBlanks bool `long:"ignoreBlanks" description:"ignore fields with empty values in CSV and TSV"`
 
+	// Routes the documents to collections by the value of a field.
+	RouteBy string `long:"routeBy" value-name:"<field>" description:"import each document into the collection named after the value of this field, instead of into --collection; --drop drops each of the collections"`
+
+	// Names the collections of the documents routed by --routeBy.
+	RouteTemplate string `long:"routeTemplate" value-name:"<template>" description:"name of the collections of the documents routed by --routeBy, with the value of the field in place of '{{<field>}}', e.g. 'raw_{{type}}' (defaults to the value of the field)"`
+
 	// Indicates that documents will be inserted in the order of their appearance in the input source.
 	MaintainInsertionOrder bool `long:"maintainInsertionOrder" description:"insert documents in the order of their appearance in the input source"`
 
+	// Sets the number of files to import concurrently
+	NumParallelFiles int `long:"numParallelFiles" value-name:"<number>" default:"1" default-mask:"-" description:"number of --files to import concurrently (defaults to 1)"`
+
 	// Sets the number of insertion routines to use
 	NumInsertionWorkers int `short:"j" value-name:"<number>" long:"numInsertionWorkers" description:"number of insert operations to run concurrently (defaults to 1)" default:"1" default-mask:"-"`
 
 	// Forces mongoimport to halt the import operation at the first insert or upsert error.
 	StopOnError bool `long:"stopOnError" description:"stop importing at first insert/upsert error"`
 
+	// Specifies a file to write the input records that fail to be imported to.
+	RejectFile string `long:"rejectFile" value-name:"<filename>" description:"file to write the input records that fail to be imported to, as one JSON document per line with the line number, the raw record and the reason it was rejected; the raw records can be extracted to import them again. JSON documents that can't be parsed are rejected instead of stopping the import, unless --stopOnError or --jsonArray is set"`
+
 	// Modify the import process.
 	// Always insert the documents if they are new (do NOT match --upsertFields).
 	// For existing documents (match --upsertFields) in the database:
 	// "insert": Insert only, skip exisiting documents.
 	// "upsert": Insert new documents or replace existing ones.
 	// "merge": Insert new documents or modify existing ones; Preserve values in the database that are not overwritten.
-	Mode string `long:"mode" choice:"insert" choice:"upsert" choice:"merge" description:"insert: insert only. upsert: insert or replace existing documents. merge: insert or modify existing documents. defaults to insert"`
+	// "changes": Apply each input document as a change event that inserts, updates, replaces or deletes a document.
+	Mode string `long:"mode" choice:"insert" choice:"upsert" choice:"merge" choice:"changes" description:"insert: insert only. upsert: insert or replace existing documents. merge: insert or modify existing documents. changes: apply each input document as a change event, in the --changeFormat, in order and stopping at the first change that fails. defaults to insert"`
+
+	// Specifies the format of the change events applied with --mode=changes.
+	ChangeFormat string `long:"changeFormat" choice:"op" choice:"changeStream" choice:"oplog" description:"format of the change events applied with --mode=changes. op: {op: <i|u|r|d>, key: <selector>, doc: <document or update>}, where key defaults to the --upsertFields of doc. changeStream: change stream events. oplog: oplog entries. defaults to op"`
 
 	Upsert bool `long:"upsert" hidden:"true" description:"(deprecated; same as --mode=upsert) insert or update objects that already exist"`
 
 	// Specifies a list of fields for the query portion of the upsert; defaults to _id field.
-	UpsertFields string `long:"upsertFields" value-name:"<field>[,<field>]*" description:"comma-separated fields for the query part when --mode is set to upsert or merge"`
+	UpsertFields string `long:"upsertFields" value-name:"<field>[,<field>]*" description:"comma-separated fields for the query part when --mode is set to upsert or merge, or of the change events without a key when --mode is set to changes"`
 
 	// Sets write concern level for write operations.
 	WriteConcern string `long:"writeConcern" default:"majority" value-name:"<write-concern-specifier>" default-mask:"-" description:"write concern options e.g. --writeConcern majority, --writeConcern '{w: 3, wtimeout: 500, fsync: true, j: true}' (defaults to 'majority')"`
@@ -0,0 +1,226 @@
+package mongoimport
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/mongodb/mongo-tools/common/bsonutil"
+	"github.com/mongodb/mongo-tools/common/json"
+	"github.com/mongodb/mongo-tools/common/log"
+	"github.com/mongodb/mongo-tools/common/parquet"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// ParquetInputReader is an implementation of InputReader that reads documents
+// from the rows of a Parquet file.
+type ParquetInputReader struct {
+	// reader is used to read the rows of the input source
+	reader *parquet.Reader
+
+	// size of the input source in bytes
+	size int64
+
+	// numProcessed indicates the number of rows processed
+	numProcessed uint64
+
+	// numDecoders is the number of concurrent goroutines to use for decoding
+	numDecoders int
+}
+
+// ParquetConverter implements the Converter interface for Parquet input.
+type ParquetConverter struct {
+	row   parquet.Group
+	index uint64
+}
+
+// parquetSource returns the input source as an io.ReaderAt along with its
+// size. Parquet files are read from their footer first, so inputs that can
+// only be streamed, like stdin, are read into memory.
+func parquetSource(in io.Reader) (io.ReaderAt, int64, error) {
+	if file, ok := in.(*os.File); ok {
+		if info, err := file.Stat(); err == nil && info.Mode().IsRegular() {
+			return file, info.Size(), nil
+		}
+	}
+	if sized, ok := in.(interface {
+		io.ReaderAt
+		Size() int64
+	}); ok {
+		return sized, sized.Size(), nil
+	}
+	log.Logvf(log.Info, "reading parquet input into memory")
+	data, err := ioutil.ReadAll(in)
+	if err != nil {
+		return nil, 0, err
+	}
+	return bytes.NewReader(data), int64(len(data)), nil
+}
+
+// NewParquetInputReader creates a new ParquetInputReader that reads the rows
+// of the Parquet file read from in.
+func NewParquetInputReader(in io.Reader, numDecoders int) (*ParquetInputReader, error) {
+	source, size, err := parquetSource(in)
+	if err != nil {
+		return nil, fmt.Errorf("error reading parquet input: %v", err)
+	}
+	reader, err := parquet.NewReader(source, size)
+	if err != nil {
+		return nil, err
+	}
+	log.Logvf(log.DebugLow, "parquet schema:\n%v", reader.Schema())
+	return &ParquetInputReader{
+		reader:      reader,
+		size:        size,
+		numDecoders: numDecoders,
+	}, nil
+}
+
+// ReadAndValidateHeader is a no-op for Parquet imports; always returns nil.
+func (r *ParquetInputReader) ReadAndValidateHeader() error {
+	return nil
+}
+
+// ReadAndValidateTypedHeader is a no-op for Parquet imports; always returns nil.
+func (r *ParquetInputReader) ReadAndValidateTypedHeader(parseGrace ParseGrace) error {
+	return nil
+}
+
+// InferColumnTypes is a no-op for Parquet imports; always returns nil.
+func (r *ParquetInputReader) InferColumnTypes(sampleSize int, parseGrace ParseGrace) ([]string, error) {
+	return nil, nil
+}
+
+// StreamDocument takes a boolean indicating if the documents should be streamed
+// in read order and a channel on which to stream the documents processed from
+// the underlying reader. Returns a non-nil error if encountered
+func (r *ParquetInputReader) StreamDocument(ordered bool, readChan chan importDocument) (retErr error) {
+	rawChan := make(chan Converter, r.numDecoders)
+	parquetErrChan := make(chan error)
+
+	// begin reading from source
+	go func() {
+		for {
+			row, err := r.reader.Read()
+			if err != nil {
+				close(rawChan)
+				if err == io.EOF {
+					parquetErrChan <- nil
+				} else {
+					r.numProcessed++
+					parquetErrChan <- fmt.Errorf("read error on row #%v: %v", r.numProcessed, err)
+				}
+				return
+			}
+			rawChan <- ParquetConverter{
+				row:   row,
+				index: r.numProcessed,
+			}
+			r.numProcessed++
+		}
+	}()
+
+	// begin processing read rows
+	go func() {
+		parquetErrChan <- streamDocuments(ordered, r.numDecoders, rawChan, readChan)
+	}()
+
+	return channelQuorumError(parquetErrChan, 2)
+}
+
+// Size returns the part of the size of the input source that the rows
+// processed so far make up, since the rows of a Parquet file are read from
+// its columns rather than in the order its bytes are in.
+func (r *ParquetInputReader) Size() int64 {
+	numRows := r.reader.NumRows()
+	if numRows == 0 {
+		return r.size
+	}
+	return int64(float64(r.size) * float64(r.numProcessed) / float64(numRows))
+}
+
+// Convert implements the Converter interface for Parquet input. It converts a
+// ParquetConverter struct to a BSON document.
+func (c ParquetConverter) Convert() (bson.D, error) {
+	document, err := parquetGroupToBSON(c.row)
+	if err != nil {
+		return nil, fmt.Errorf("error converting row #%v to BSON: %v", c.index+1, err)
+	}
+	log.Logvf(log.DebugHigh, "got row: %v", document)
+	return document, nil
+}
+
+// Record implements the Converter interface for Parquet input. Rows have no
+// line, so their row number is used instead, and their raw text is the
+// document they convert to in canonical Extended JSON.
+func (c ParquetConverter) Record() (uint64, string) {
+	document, err := parquetGroupToBSON(c.row)
+	if err != nil {
+		return c.index + 1, fmt.Sprint(c.row)
+	}
+	extendedDoc, err := bsonutil.ConvertBSONValueToExtendedJSON(document, json.CanonicalFormat)
+	if err != nil {
+		return c.index + 1, fmt.Sprint(document)
+	}
+	data, err := json.Marshal(extendedDoc)
+	if err != nil {
+		return c.index + 1, fmt.Sprint(document)
+	}
+	return c.index + 1, string(data)
+}
+
+func parquetGroupToBSON(group parquet.Group) (bson.D, error) {
+	document := make(bson.D, 0, len(group))
+	for _, field := range group {
+		value, err := parquetValueToBSON(field.Value)
+		if err != nil {
+			return nil, fmt.Errorf("field '%v': %v", field.Name, err)
+		}
+		document = append(document, bson.DocElem{Name: field.Name, Value: value})
+	}
+	return document, nil
+}
+
+// parquetValueToBSON converts the value of a Parquet field to the BSON value
+// it is imported as.
+func parquetValueToBSON(value interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case parquet.Group:
+		return parquetGroupToBSON(v)
+	case []interface{}:
+		array := make([]interface{}, len(v))
+		for i, element := range v {
+			converted, err := parquetValueToBSON(element)
+			if err != nil {
+				return nil, err
+			}
+			array[i] = converted
+		}
+		return array, nil
+	case float32:
+		return float64(v), nil
+	case uint64:
+		if v <= math.MaxInt64 {
+			return int64(v), nil
+		}
+		// unsigned integers that don't fit in a long keep their value as a
+		// decimal
+		return bson.ParseDecimal128(strconv.FormatUint(v, 10))
+	case parquet.Decimal:
+		decimal, err := bson.ParseDecimal128(v.String())
+		if err != nil {
+			return nil, fmt.Errorf("decimal %v doesn't fit in a BSON decimal: %v", v, err)
+		}
+		return decimal, nil
+	case parquet.UUID:
+		return bson.Binary{Kind: 0x04, Data: v[:]}, nil
+	case time.Time, nil, bool, int32, int64, float64, string, []byte:
+		return v, nil
+	}
+	return nil, fmt.Errorf("unsupported value of type %T", value)
+}
@@ -0,0 +1,138 @@
+package mongoimport
+
+import (
+	"bytes"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/mongodb/mongo-tools/common/parquet"
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const testParquetSchema = `message document {
+  required int32 _id;
+  optional binary name (STRING);
+  optional int64 created (TIMESTAMP(MILLIS,true));
+  optional int64 balance (DECIMAL(18,2));
+  optional int64 views (INTEGER(64,false));
+  optional float score;
+  optional fixed_len_byte_array(16) token (UUID);
+  optional group tags (LIST) {
+    repeated group list {
+      optional binary element (STRING);
+    }
+  }
+  optional group address {
+    optional binary city (STRING);
+  }
+}
+`
+
+// writeParquet returns a Parquet file with the given rows.
+func writeParquet(rows ...parquet.Group) []byte {
+	schema, err := parquet.ParseSchema(testParquetSchema)
+	So(err, ShouldBeNil)
+	buf := &bytes.Buffer{}
+	w, err := parquet.NewWriter(buf, schema, parquet.WriterOptions{Codec: parquet.Snappy})
+	So(err, ShouldBeNil)
+	for _, row := range rows {
+		So(w.Write(row), ShouldBeNil)
+	}
+	So(w.Close(), ShouldBeNil)
+	return buf.Bytes()
+}
+
+func TestParquetStreamDocument(t *testing.T) {
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+	Convey("With a parquet input reader", t, func() {
+		created := time.Date(2018, 6, 1, 8, 0, 0, 0, time.UTC)
+		token := parquet.UUID{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16}
+		data := writeParquet(
+			parquet.Group{
+				{"_id", int32(1)},
+				{"name", "first"},
+				{"created", created},
+				{"balance", parquet.Decimal{Unscaled: big.NewInt(-1050), Scale: 2}},
+				{"views", uint64(1) << 63},
+				{"score", float32(0.5)},
+				{"token", token},
+				{"tags", []interface{}{"a", "b"}},
+				{"address", parquet.Group{{"city", "Dublin"}}},
+			},
+			parquet.Group{{"_id", int32(2)}},
+		)
+
+		Convey("rows should be converted to documents in schema order", func() {
+			r, err := NewParquetInputReader(bytes.NewReader(data), 1)
+			So(err, ShouldBeNil)
+			docChan := make(chan importDocument, 2)
+			So(r.StreamDocument(true, docChan), ShouldBeNil)
+			balance, err := bson.ParseDecimal128("-10.50")
+			So(err, ShouldBeNil)
+			views, err := bson.ParseDecimal128("9223372036854775808")
+			So(err, ShouldBeNil)
+			So((<-docChan).document, ShouldResemble, bson.D{
+				{"_id", int32(1)},
+				{"name", "first"},
+				{"created", created},
+				{"balance", balance},
+				{"views", views},
+				{"score", 0.5},
+				{"token", bson.Binary{Kind: 0x04, Data: token[:]}},
+				{"tags", []interface{}{"a", "b"}},
+				{"address", bson.D{{"city", "Dublin"}}},
+			})
+			So((<-docChan).document, ShouldResemble, bson.D{
+				{"_id", int32(2)},
+				{"name", nil},
+				{"created", nil},
+				{"balance", nil},
+				{"views", nil},
+				{"score", nil},
+				{"token", nil},
+				{"tags", nil},
+				{"address", nil},
+			})
+			So(r.Size(), ShouldEqual, len(data))
+		})
+
+		Convey("rows should be identified by their row number", func() {
+			r, err := NewParquetInputReader(bytes.NewReader(data), 1)
+			So(err, ShouldBeNil)
+			docChan := make(chan importDocument, 2)
+			So(r.StreamDocument(true, docChan), ShouldBeNil)
+			<-docChan
+			line, raw := (<-docChan).source.Record()
+			So(line, ShouldEqual, 2)
+			So(raw, ShouldStartWith, `{"_id":{"$numberInt":"2"},"name":null`)
+		})
+
+		Convey("parquet files should be read from disk and from streams", func() {
+			file, err := ioutil.TempFile("", "mongoimport")
+			So(err, ShouldBeNil)
+			defer os.Remove(file.Name())
+			_, err = file.Write(data)
+			So(err, ShouldBeNil)
+			So(file.Close(), ShouldBeNil)
+			file, err = os.Open(file.Name())
+			So(err, ShouldBeNil)
+			defer file.Close()
+			_, size, err := parquetSource(file)
+			So(err, ShouldBeNil)
+			So(size, ShouldEqual, len(data))
+			r, err := NewParquetInputReader(ioutil.NopCloser(bytes.NewReader(data)), 1)
+			So(err, ShouldBeNil)
+			So(r.reader.NumRows(), ShouldEqual, 2)
+		})
+
+		Convey("input that isn't a parquet file should be rejected", func() {
+			_, err := NewParquetInputReader(bytes.NewReader([]byte(`{"a": 1}`)), 1)
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
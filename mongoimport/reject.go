@@ -0,0 +1,107 @@
+package mongoimport
+
+import (
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/mongodb/mongo-tools/common/db"
+	"github.com/mongodb/mongo-tools/common/json"
+	"gopkg.in/mgo.v2"
+)
+
+// rejectedRecord is written to the reject file for every input record that
+// fails to be imported. Record holds the raw text of the input record as it was
+// read. The reject file can't be in the format of the input, since CSV, TSV and
+// JSON have no place for the line and reason of each record, so to import the
+// records again once the reason they were rejected for has been addressed,
+// their raw text has to be extracted first, e.g. with jq -r .record.
+type rejectedRecord struct {
+	File   string `json:"file,omitempty"`
+	Line   uint64 `json:"line"`
+	Record string `json:"record"`
+	Reason string `json:"reason"`
+}
+
+// rejectWriter writes the input records that fail to be imported to the reject
+// file, as one JSON document per line. It is safe for concurrent use by the
+// decoding and insertion workers. Rejecting records with a nil rejectWriter
+// is a no-op.
+type rejectWriter struct {
+	mu  *sync.Mutex
+	out io.Writer
+
+	// file is the input file that the records are rejected from, when
+	// several --files are imported
+	file string
+}
+
+// newRejectWriter returns a rejectWriter that writes rejected records to out.
+func newRejectWriter(out io.Writer) *rejectWriter {
+	return &rejectWriter{mu: &sync.Mutex{}, out: out}
+}
+
+// forFile returns a rejectWriter that writes to the same reject file, and
+// names the input file that the records are rejected from.
+func (rw *rejectWriter) forFile(file string) *rejectWriter {
+	if rw == nil {
+		return nil
+	}
+	return &rejectWriter{mu: rw.mu, out: rw.out, file: file}
+}
+
+// Reject writes the record converted by source to the reject file, along
+// with the reason it was rejected.
+func (rw *rejectWriter) Reject(source Converter, reason error) error {
+	if rw == nil {
+		return nil
+	}
+	line, raw := source.Record()
+	data, err := json.Marshal(rejectedRecord{
+		File:   rw.file,
+		Line:   line,
+		Record: raw,
+		Reason: reason.Error(),
+	})
+	if err != nil {
+		return fmt.Errorf("error encoding rejected record on line %v: %v", line, err)
+	}
+	rw.mu.Lock()
+	defer rw.mu.Unlock()
+	if _, err = rw.out.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("error writing to reject file: %v", err)
+	}
+	return nil
+}
+
+// RejectWriteError writes the records of the documents that failed to be
+// written because of err to the reject file. The sources of the documents
+// written by the failed operation are given in the order they were written
+// in, which is what the indexes of the cases of a bulk error refer to.
+// Errors that aren't caused by the documents, like connection errors, don't
+// reject anything.
+func (rw *rejectWriter) RejectWriteError(err error, sources []Converter) error {
+	if rw == nil || err == nil || db.IsConnectionError(err) {
+		return nil
+	}
+	bulkError, ok := err.(*mgo.BulkError)
+	if !ok {
+		for _, source := range sources {
+			if rejectErr := rw.Reject(source, err); rejectErr != nil {
+				return rejectErr
+			}
+		}
+		return nil
+	}
+	for _, failure := range bulkError.Cases() {
+		// errors that aren't tied to a document, like write concern errors,
+		// have no valid index
+		if failure.Index < 0 || failure.Index >= len(sources) {
+			continue
+		}
+		if rejectErr := rw.Reject(sources[failure.Index], failure.Err); rejectErr != nil {
+			return rejectErr
+		}
+	}
+	return nil
+}
@@ -0,0 +1,174 @@
+package mongoimport
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/mongodb/mongo-tools/common/db"
+	"github.com/mongodb/mongo-tools/common/json"
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// readRejects returns the records written to a reject file.
+func readRejects(rejectFile *bytes.Buffer) []rejectedRecord {
+	var records []rejectedRecord
+	for _, line := range strings.Split(strings.TrimSuffix(rejectFile.String(), "\n"), "\n") {
+		if line == "" {
+			continue
+		}
+		record := rejectedRecord{}
+		So(json.Unmarshal([]byte(line), &record), ShouldBeNil)
+		records = append(records, record)
+	}
+	return records
+}
+
+func TestRejectWriter(t *testing.T) {
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+	Convey("With a reject writer", t, func() {
+		rejectFile := &bytes.Buffer{}
+		rejects := newRejectWriter(rejectFile)
+		first := JSONConverter{data: []byte("\n  {\"a\": 1}\n"), line: 2}
+		second := JSONConverter{data: []byte(`{"a": 2}`), line: 3}
+
+		Convey("rejected records should be written with their line, raw text "+
+			"and reason, one per line", func() {
+			So(rejects.Reject(first, fmt.Errorf("first reason")), ShouldBeNil)
+			So(rejects.Reject(second, fmt.Errorf("second reason")), ShouldBeNil)
+			So(readRejects(rejectFile), ShouldResemble, []rejectedRecord{
+				{Line: 2, Record: `{"a": 1}`, Reason: "first reason"},
+				{Line: 3, Record: `{"a": 2}`, Reason: "second reason"},
+			})
+		})
+
+		Convey("a write error should reject all the written documents", func() {
+			err := fmt.Errorf("document failed validation")
+			So(rejects.RejectWriteError(err, []Converter{first, second}), ShouldBeNil)
+			So(len(readRejects(rejectFile)), ShouldEqual, 2)
+		})
+
+		Convey("connection errors and successful writes should not reject "+
+			"anything", func() {
+			So(rejects.RejectWriteError(fmt.Errorf(db.ErrNoReachableServers), []Converter{first}), ShouldBeNil)
+			So(rejects.RejectWriteError(nil, []Converter{first}), ShouldBeNil)
+			So(rejectFile.Len(), ShouldEqual, 0)
+		})
+
+		Convey("records rejected from one of several files should name it", func() {
+			So(rejects.forFile("a.json").Reject(first, fmt.Errorf("reason")), ShouldBeNil)
+			So(readRejects(rejectFile), ShouldResemble, []rejectedRecord{
+				{File: "a.json", Line: 2, Record: `{"a": 1}`, Reason: "reason"},
+			})
+		})
+
+		Convey("a nil reject writer should discard rejected records", func() {
+			var noRejects *rejectWriter
+			So(noRejects.Reject(first, fmt.Errorf("reason")), ShouldBeNil)
+			So(noRejects.RejectWriteError(fmt.Errorf("reason"), []Converter{first}), ShouldBeNil)
+		})
+	})
+}
+
+func TestRejectSkippedRows(t *testing.T) {
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+	Convey("With a reject file and a parse grace of skipRow", t, func() {
+		rejectFile := &bytes.Buffer{}
+		colSpecs := []ColumnSpec{
+			{"a", new(FieldInt32Parser), pgSkipRow, "int32"},
+			{"b", new(FieldStringParser), pgSkipRow, "string"},
+		}
+
+		Convey("CSV rows that fail type coercion should be written to the "+
+			"reject file and not imported", func() {
+			contents := "a,b\n1,\"multi\nline\"\nfoo, \"b\"\"ar\"\n3,baz\n"
+			r := NewCSVInputReader(nil, bytes.NewReader([]byte(contents)), os.Stdout, 1, false)
+			r.rejects = newRejectWriter(rejectFile)
+			// the header line counts towards the line numbers of the rows
+			So(r.ReadAndValidateHeader(), ShouldBeNil)
+			r.colSpecs = colSpecs
+			docChan := make(chan importDocument, 4)
+			So(r.StreamDocument(true, docChan), ShouldBeNil)
+			So((<-docChan).document, ShouldResemble, bson.D{{"a", int32(1)}, {"b", "multi\nline"}})
+			So((<-docChan).document, ShouldResemble, bson.D{{"a", int32(3)}, {"b", "baz"}})
+			So(readRejects(rejectFile), ShouldResemble, []rejectedRecord{{
+				Line:   4,
+				Record: `foo, "b""ar"`,
+				Reason: "type coercion failure for column 'a', could not parse token 'foo' to type int32",
+			}})
+		})
+
+		Convey("TSV rows that fail type coercion should be written to the "+
+			"reject file and not imported", func() {
+			contents := "a\tb\n1\tfoo\r\nbar\tbaz\n"
+			r := NewTSVInputReader(nil, bytes.NewReader([]byte(contents)), os.Stdout, 1, false)
+			r.rejects = newRejectWriter(rejectFile)
+			// the header line counts towards the line numbers of the rows
+			So(r.ReadAndValidateHeader(), ShouldBeNil)
+			r.colSpecs = colSpecs
+			docChan := make(chan importDocument, 2)
+			So(r.StreamDocument(true, docChan), ShouldBeNil)
+			So((<-docChan).document, ShouldResemble, bson.D{{"a", int32(1)}, {"b", "foo"}})
+			So(readRejects(rejectFile), ShouldResemble, []rejectedRecord{{
+				Line:   3,
+				Record: "bar\tbaz",
+				Reason: "type coercion failure for column 'a', could not parse token 'bar' to type int32",
+			}})
+		})
+	})
+
+	Convey("With a reject file, JSON documents that can't be parsed should "+
+		"be written to it and not imported", t, func() {
+		rejectFile := &bytes.Buffer{}
+		contents := "{\"a\": 1}\n{\"b\": }\n{\"c\": {\"$date\": \"soon\"}}\n{\"d\": 4}\n{\"e\":"
+		r := NewJSONInputReader(false, json.LegacyFormat, bytes.NewReader([]byte(contents)), 1)
+		r.rejects = newRejectWriter(rejectFile)
+		docChan := make(chan importDocument, 5)
+		So(r.StreamDocument(true, docChan), ShouldBeNil)
+		So((<-docChan).document, ShouldResemble, bson.D{{"a", 1}})
+		So((<-docChan).document, ShouldResemble, bson.D{{"d", 4}})
+		_, open := <-docChan
+		So(open, ShouldBeFalse)
+		// documents that can't be read are rejected before the ones that
+		// can't be converted, so the rejects are looked up by line
+		rejects := map[uint64]rejectedRecord{}
+		for _, record := range readRejects(rejectFile) {
+			rejects[record.Line] = record
+		}
+		So(len(rejects), ShouldEqual, 3)
+		for line, raw := range map[uint64]string{
+			2: `{"b": }`,
+			3: `{"c": {"$date": "soon"}}`,
+			5: `{"e":`,
+		} {
+			So(rejects[line].Record, ShouldEqual, raw)
+			So(rejects[line].Reason, ShouldNotEqual, "")
+		}
+
+		Convey("but without one they should stop the import", func() {
+			r := NewJSONInputReader(false, json.LegacyFormat, bytes.NewReader([]byte(contents)), 1)
+			docChan := make(chan importDocument, 5)
+			So(r.StreamDocument(true, docChan), ShouldNotBeNil)
+		})
+	})
+
+	Convey("JSON documents should know the line they start on", t, func() {
+		contents := "{\"a\": 1}\n\n{\"b\":\n 2}  {\"c\": 3}\n"
+		r := NewJSONInputReader(false, json.LegacyFormat, bytes.NewReader([]byte(contents)), 1)
+		docChan := make(chan importDocument, 3)
+		So(r.StreamDocument(true, docChan), ShouldBeNil)
+		for _, expected := range []rejectedRecord{
+			{Line: 1, Record: `{"a": 1}`},
+			{Line: 3, Record: "{\"b\":\n 2}"},
+			{Line: 4, Record: `{"c": 3}`},
+		} {
+			line, raw := (<-docChan).source.Record()
+			So(line, ShouldEqual, expected.Line)
+			So(raw, ShouldEqual, expected.Record)
+		}
+	})
+}
@@ -0,0 +1,204 @@
+package mongoimport
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/mongodb/mongo-tools/common/log"
+	"github.com/mongodb/mongo-tools/common/util"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// router sends each document to the collection named after the value of its
+// --routeBy field, and counts the documents imported into each collection.
+type router struct {
+	field string
+	// template is the --routeTemplate, split around the placeholder of the
+	// field
+	prefix, suffix string
+
+	mu sync.Mutex
+	// collections are the collections documents have been routed to, with
+	// the number of documents imported into each of them
+	collections map[string]uint64
+}
+
+// newRouter returns a router for a --routeBy field and --routeTemplate.
+func newRouter(field, template string) (*router, error) {
+	placeholder := "{{" + field + "}}"
+	if strings.Count(template, placeholder) != 1 {
+		return nil, fmt.Errorf("--routeTemplate must contain '%v' once", placeholder)
+	}
+	i := strings.Index(template, placeholder)
+	return &router{
+		field:       field,
+		prefix:      template[:i],
+		suffix:      template[i+len(placeholder):],
+		collections: map[string]uint64{},
+	}, nil
+}
+
+// collectionFor returns the collection that a document is routed to.
+func (r *router) collectionFor(document bson.D) (string, error) {
+	var value string
+	switch v := getUpsertValue(r.field, document).(type) {
+	case nil:
+		return "", fmt.Errorf("no value for the --routeBy field '%v'", r.field)
+	case string:
+		value = v
+	case int, int32, int64, float64, bool:
+		value = fmt.Sprint(v)
+	default:
+		return "", fmt.Errorf("the --routeBy field '%v' must be a string, number or boolean, not %v", r.field, v)
+	}
+	collection := r.prefix + value + r.suffix
+	if err := util.ValidateCollectionName(collection); err != nil {
+		return "", fmt.Errorf("invalid collection name routed to: %v", err)
+	}
+	return collection, nil
+}
+
+// prepare is called before the first document is written to a collection by
+// any insertion worker, and drops the collection the first time it is
+// called for it, if --drop is set.
+func (r *router) prepare(imp *MongoImport, session *mgo.Session, collection string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.collections[collection]; ok {
+		return nil
+	}
+	if imp.IngestOptions.Drop {
+		if err := imp.dropCollection(session, collection); err != nil {
+			return err
+		}
+	}
+	r.collections[collection] = 0
+	return nil
+}
+
+// add counts the documents imported into a collection.
+func (r *router) add(collection string, count uint64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.collections[collection] += count
+}
+
+// logCounts logs the number of documents imported into each collection.
+func (r *router) logCounts(dbName string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var collections []string
+	for collection := range r.collections {
+		collections = append(collections, collection)
+	}
+	sort.Strings(collections)
+	for _, collection := range collections {
+		log.Logvf(log.Always, "imported %v documents into %v.%v",
+			r.collections[collection], dbName, collection)
+	}
+}
+
+// validateRoute validates the options for routing documents to collections
+// by the value of a field.
+func (imp *MongoImport) validateRoute() (err error) {
+	imp.routes = nil
+	if imp.IngestOptions.RouteBy == "" {
+		if imp.IngestOptions.RouteTemplate != "" {
+			return fmt.Errorf("can not use --routeTemplate without --routeBy")
+		}
+		return nil
+	}
+	if imp.ToolOptions.Collection != "" {
+		return fmt.Errorf("incompatible options: --collection and --routeBy")
+	}
+	if imp.InputOptions.Files != "" {
+		return fmt.Errorf("incompatible options: --files and --routeBy")
+	}
+	if err = validateFields([]string{imp.IngestOptions.RouteBy}); err != nil {
+		return fmt.Errorf("invalid --routeBy argument: %v", err)
+	}
+	if imp.IngestOptions.RouteTemplate == "" {
+		imp.IngestOptions.RouteTemplate = "{{" + imp.IngestOptions.RouteBy + "}}"
+	}
+	imp.routes, err = newRouter(imp.IngestOptions.RouteBy, imp.IngestOptions.RouteTemplate)
+	return err
+}
+
+// runRoutingWorker is the runInsertionWorker of imports with --routeBy. It
+// writes to a target for each collection, and keeps at most
+// --batchSize documents buffered for all of them, by flushing the target with
+// the most documents buffered when there are more.
+func (imp *MongoImport) runRoutingWorker(session *mgo.Session, readDocs chan importDocument) (err error) {
+	targets := map[string]*insertTarget{}
+	defer func() {
+		for collection, target := range targets {
+			imp.routes.add(collection, target.count)
+		}
+	}()
+	numBuffered := 0
+
+readLoop:
+	for {
+		select {
+		case document, alive := <-readDocs:
+			if !alive {
+				break readLoop
+			}
+			collection, err := imp.routes.collectionFor(document.document)
+			if err != nil {
+				if err = imp.rejectDocument(document, err); err != nil {
+					return err
+				}
+				continue
+			}
+			if imp.transform != nil {
+				var ok bool
+				if ok, err = imp.transformDocument(collection, &document); err != nil {
+					return err
+				}
+				if !ok {
+					continue
+				}
+			}
+
+			target, ok := targets[collection]
+			if !ok {
+				if err = imp.routes.prepare(imp, session, collection); err != nil {
+					return err
+				}
+				target = imp.newInsertTarget(session, collection)
+				targets[collection] = target
+			}
+			numBuffered -= len(target.buffered)
+			if err = imp.insert(target, document); err != nil {
+				return err
+			}
+			numBuffered += len(target.buffered)
+
+			if numBuffered > imp.IngestOptions.BulkBufferSize {
+				var fullest *insertTarget
+				for _, target := range targets {
+					if fullest == nil || len(target.buffered) > len(fullest.buffered) {
+						fullest = target
+					}
+				}
+				numBuffered -= len(fullest.buffered)
+				if err = imp.flush(fullest); err != nil {
+					return err
+				}
+			}
+		case <-imp.Dying():
+			return nil
+		}
+	}
+
+	for _, target := range targets {
+		if flushErr := imp.flush(target); flushErr != nil && err == nil {
+			err = flushErr
+		}
+	}
+	return err
+}
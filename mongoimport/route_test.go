@@ -0,0 +1,136 @@
+package mongoimport
+
+import (
+	"testing"
+
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func TestValidateRoute(t *testing.T) {
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With a mongoimport instance", t, func() {
+		imp, err := NewMongoImport()
+		So(err, ShouldBeNil)
+		imp.ToolOptions.Namespace.Collection = ""
+
+		Convey("--routeBy should default the template to the value of the field", func() {
+			imp.IngestOptions.RouteBy = "type"
+			So(imp.ValidateSettings([]string{}), ShouldBeNil)
+			So(imp.routes, ShouldNotBeNil)
+			So(imp.IngestOptions.RouteTemplate, ShouldEqual, "{{type}}")
+			So(imp.ToolOptions.Collection, ShouldEqual, "")
+		})
+
+		Convey("invalid --routeBy options should be rejected", func() {
+			imp.IngestOptions.RouteTemplate = "raw_{{type}}"
+			So(imp.ValidateSettings([]string{}), ShouldNotBeNil)
+
+			imp.IngestOptions.RouteBy = "kind"
+			So(imp.ValidateSettings([]string{}), ShouldNotBeNil)
+
+			imp.IngestOptions.RouteBy = "type"
+			imp.IngestOptions.RouteTemplate = "{{type}}_{{type}}"
+			So(imp.ValidateSettings([]string{}), ShouldNotBeNil)
+
+			imp.IngestOptions.RouteTemplate = ""
+			imp.ToolOptions.Namespace.Collection = "c"
+			So(imp.ValidateSettings([]string{}), ShouldNotBeNil)
+
+			imp.ToolOptions.Namespace.Collection = ""
+			imp.InputOptions.Files = "testdata/*.json"
+			So(imp.ValidateSettings([]string{}), ShouldNotBeNil)
+		})
+	})
+}
+
+func TestRouter(t *testing.T) {
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With a router", t, func() {
+		r, err := newRouter("meta.type", "raw_{{meta.type}}s")
+		So(err, ShouldBeNil)
+
+		Convey("documents should be routed by the value of the field", func() {
+			collection, err := r.collectionFor(bson.D{{"meta", bson.D{{"type", "click"}}}})
+			So(err, ShouldBeNil)
+			So(collection, ShouldEqual, "raw_clicks")
+
+			collection, err = r.collectionFor(bson.D{{"meta", bson.D{{"type", 2}}}})
+			So(err, ShouldBeNil)
+			So(collection, ShouldEqual, "raw_2s")
+		})
+
+		Convey("documents imported from JSON should be routed", func() {
+			for json, expected := range map[string]string{
+				`{"meta": {"type": "click"}}`:         "raw_clicks",
+				`{"meta": {"type": 2}}`:               "raw_2s",
+				`{"meta": {"type": NumberLong(3)}}`:   "raw_3s",
+				`{"_id": 1, "meta": {"type": false}}`: "raw_falses",
+			} {
+				document, err := JSONConverter{data: []byte(json)}.Convert()
+				So(err, ShouldBeNil)
+				collection, err := r.collectionFor(document)
+				So(err, ShouldBeNil)
+				So(collection, ShouldEqual, expected)
+			}
+		})
+
+		Convey("documents without a valid value should not be routed", func() {
+			_, err := r.collectionFor(bson.D{{"type", "click"}})
+			So(err, ShouldNotBeNil)
+			_, err = r.collectionFor(bson.D{{"meta", bson.D{{"type", bson.D{}}}}})
+			So(err, ShouldNotBeNil)
+			_, err = r.collectionFor(bson.D{{"meta", bson.D{{"type", "a$b"}}}})
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("counts should be kept per collection", func() {
+			r.add("b", 2)
+			r.add("a", 1)
+			r.add("b", 3)
+			So(r.collections, ShouldResemble, map[string]uint64{"a": 1, "b": 5})
+		})
+	})
+}
+
+func TestImportRouted(t *testing.T) {
+	testutil.VerifyTestType(t, testutil.IntegrationTestType)
+
+	Convey("With a mongoimport instance", t, func() {
+		imp, err := NewMongoImport()
+		So(err, ShouldBeNil)
+		session, err := imp.SessionProvider.GetSession()
+		So(err, ShouldBeNil)
+		defer session.Close()
+		Reset(func() {
+			session.DB(testDb).C("raw_click").DropCollection()
+			session.DB(testDb).C("raw_view").DropCollection()
+		})
+
+		Convey("documents should be imported into the collections they are routed to", func() {
+			imp.ToolOptions.Namespace.Collection = ""
+			imp.InputOptions.File = "testdata/test_route.json"
+			imp.IngestOptions.RouteBy = "type"
+			imp.IngestOptions.RouteTemplate = "raw_{{type}}"
+			imp.IngestOptions.Drop = true
+			So(imp.ValidateSettings([]string{}), ShouldBeNil)
+
+			numImported, err := imp.ImportDocuments()
+			So(err, ShouldBeNil)
+			So(numImported, ShouldEqual, 4)
+			So(imp.routes.collections, ShouldResemble, map[string]uint64{"raw_click": 2, "raw_view": 2})
+
+			for collection, expected := range map[string][]bson.M{
+				"raw_click": {{"_id": 1, "type": "click", "x": 1}, {"_id": 3, "type": "click", "x": 2}},
+				"raw_view":  {{"_id": 2, "type": "view"}, {"_id": 5, "type": "view"}},
+			} {
+				docs := []bson.M{}
+				So(session.DB(testDb).C(collection).Find(nil).Sort("_id").All(&docs), ShouldBeNil)
+				So(docs, ShouldResemble, expected)
+			}
+		})
+	})
+}
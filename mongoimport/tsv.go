@@ -27,12 +27,24 @@ type TSVInputReader struct {
 	// tsvRejectWriter is where coercion-failed rows are written, if applicable
 	tsvRejectWriter io.Writer
 
+	// rejects is where coercion-failed rows are written along with their line
+	// number and the reason, if a reject file is used
+	rejects *rejectWriter
+
 	// tsvRecord stores each line of input we read from the underlying reader
 	tsvRecord string
 
+	// sample holds the records read to infer the column types from, until
+	// they are streamed
+	sample []TSVConverter
+
 	// numProcessed tracks the number of TSV records processed by the underlying reader
 	numProcessed uint64
 
+	// numLines tracks the number of lines read from the underlying reader,
+	// including the header line
+	numLines uint64
+
 	// numDecoders is the number of concurrent goroutines to use for decoding
 	numDecoders int
 
@@ -41,6 +53,9 @@ type TSVInputReader struct {
 
 	// ignoreBlanks is whether empty fields should be ignored
 	ignoreBlanks bool
+
+	// comment, if not 0, starts the lines that are skipped
+	comment rune
 }
 
 // TSVConverter implements the Converter interface for TSV input.
@@ -48,8 +63,10 @@ type TSVConverter struct {
 	colSpecs     []ColumnSpec
 	data         string
 	index        uint64
+	line         uint64
 	ignoreBlanks bool
 	rejectWriter io.Writer
+	rejects      *rejectWriter
 }
 
 // NewTSVInputReader returns a TSVInputReader configured to read input from the
@@ -67,10 +84,25 @@ func NewTSVInputReader(colSpecs []ColumnSpec, in io.Reader, rejects io.Writer, n
 	}
 }
 
+// readLine reads the next line from the underlying reader that isn't a
+// comment. Skipped comment lines are still counted in the line numbers.
+func (r *TSVInputReader) readLine() (string, error) {
+	for {
+		line, err := r.tsvReader.ReadString(entryDelimiter)
+		if err != nil {
+			return line, err
+		}
+		r.numLines++
+		if r.comment == 0 || !strings.HasPrefix(line, string(r.comment)) {
+			return line, nil
+		}
+	}
+}
+
 // ReadAndValidateHeader reads the header from the underlying reader and validates
 // the header fields. It sets err if the read/validation fails.
 func (r *TSVInputReader) ReadAndValidateHeader() (err error) {
-	header, err := r.tsvReader.ReadString(entryDelimiter)
+	header, err := r.readLine()
 	if err != nil {
 		return err
 	}
@@ -86,7 +118,7 @@ func (r *TSVInputReader) ReadAndValidateHeader() (err error) {
 // ReadAndValidateTypedHeader reads the header from the underlying reader and validates
 // the header fields. It sets err if the read/validation fails.
 func (r *TSVInputReader) ReadAndValidateTypedHeader(parseGrace ParseGrace) (err error) {
-	header, err := r.tsvReader.ReadString(entryDelimiter)
+	header, err := r.readLine()
 	if err != nil {
 		return err
 	}
@@ -101,18 +133,56 @@ func (r *TSVInputReader) ReadAndValidateTypedHeader(parseGrace ParseGrace) (err
 	return validateReaderFields(ColumnNames(r.colSpecs))
 }
 
+// InferColumnTypes reads up to sampleSize records from the underlying reader
+// and gives each column the narrowest type that parses all of its values.
+// Returns the typed field list. The records read are still imported.
+func (r *TSVInputReader) InferColumnTypes(sampleSize int, parseGrace ParseGrace) ([]string, error) {
+	var records [][]string
+	for len(records) < sampleSize {
+		record, err := r.readLine()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("read error on entry #%v: %v", r.numProcessed+1, err)
+		}
+		records = append(records, strings.Split(strings.TrimRight(record, "\r\n"), tokenSeparator))
+		r.sample = append(r.sample, TSVConverter{
+			data:         record,
+			index:        r.numProcessed,
+			line:         r.numLines,
+			ignoreBlanks: r.ignoreBlanks,
+			rejectWriter: r.tsvRejectWriter,
+			rejects:      r.rejects,
+		})
+		r.numProcessed++
+	}
+	typedFields := inferTypedHeaders(ColumnNames(r.colSpecs), records, r.ignoreBlanks)
+	colSpecs, err := ParseTypedHeaders(typedFields, parseGrace)
+	if err != nil {
+		return nil, err
+	}
+	r.colSpecs = colSpecs
+	return typedFields, nil
+}
+
 // StreamDocument takes a boolean indicating if the documents should be streamed
 // in read order and a channel on which to stream the documents processed from
 // the underlying reader. Returns a non-nil error if streaming fails.
-func (r *TSVInputReader) StreamDocument(ordered bool, readDocs chan bson.D) (retErr error) {
+func (r *TSVInputReader) StreamDocument(ordered bool, readDocs chan importDocument) (retErr error) {
 	tsvRecordChan := make(chan Converter, r.numDecoders)
 	tsvErrChan := make(chan error)
 
 	// begin reading from source
 	go func() {
 		var err error
+		for _, converter := range r.sample {
+			converter.colSpecs = r.colSpecs
+			tsvRecordChan <- converter
+		}
+		r.sample = nil
 		for {
-			r.tsvRecord, err = r.tsvReader.ReadString(entryDelimiter)
+			r.tsvRecord, err = r.readLine()
 			if err != nil {
 				close(tsvRecordChan)
 				if err == io.EOF {
@@ -127,8 +197,10 @@ func (r *TSVInputReader) StreamDocument(ordered bool, readDocs chan bson.D) (ret
 				colSpecs:     r.colSpecs,
 				data:         r.tsvRecord,
 				index:        r.numProcessed,
+				line:         r.numLines,
 				ignoreBlanks: r.ignoreBlanks,
 				rejectWriter: r.tsvRejectWriter,
+				rejects:      r.rejects,
 			}
 			r.numProcessed++
 		}
@@ -151,13 +223,18 @@ func (c TSVConverter) Convert() (b bson.D, err error) {
 		c.index,
 		c.ignoreBlanks,
 	)
-	if _, ok := err.(coercionError); ok {
+	if coercionErr, ok := err.(coercionError); ok {
 		c.Print()
-		err = nil
+		err = c.rejects.Reject(c, coercionErr)
 	}
 	return
 }
 
+// Record implements the Converter interface for TSV input.
+func (c TSVConverter) Record() (uint64, string) {
+	return c.line, strings.TrimRight(c.data, "\r\n")
+}
+
 func (c TSVConverter) Print() {
 	c.rejectWriter.Write([]byte(c.data + "\n"))
 }
@@ -26,9 +26,9 @@ func TestTSVStreamDocument(t *testing.T) {
 				{"c", "3e"},
 			}
 			r := NewTSVInputReader(colSpecs, bytes.NewReader([]byte(contents)), os.Stdout, 1, false)
-			docChan := make(chan bson.D, 1)
+			docChan := make(chan importDocument, 1)
 			So(r.StreamDocument(true, docChan), ShouldBeNil)
-			So(<-docChan, ShouldResemble, expectedRead)
+			So((<-docChan).document, ShouldResemble, expectedRead)
 		})
 
 		Convey("valid TSV input file that starts with the UTF-8 BOM should "+
@@ -46,9 +46,9 @@ func TestTSVStreamDocument(t *testing.T) {
 			fileHandle, err := os.Open("testdata/test_bom.tsv")
 			So(err, ShouldBeNil)
 			r := NewTSVInputReader(colSpecs, fileHandle, os.Stdout, 1, false)
-			docChan := make(chan bson.D, 2)
+			docChan := make(chan importDocument, 2)
 			So(r.StreamDocument(true, docChan), ShouldBeNil)
-			So(<-docChan, ShouldResemble, expectedRead)
+			So((<-docChan).document, ShouldResemble, expectedRead)
 		})
 
 		Convey("integer valued strings should be converted tsv2", func() {
@@ -65,9 +65,9 @@ func TestTSVStreamDocument(t *testing.T) {
 				{"field3", "d"},
 			}
 			r := NewTSVInputReader(colSpecs, bytes.NewReader([]byte(contents)), os.Stdout, 1, false)
-			docChan := make(chan bson.D, 1)
+			docChan := make(chan importDocument, 1)
 			So(r.StreamDocument(true, docChan), ShouldBeNil)
-			So(<-docChan, ShouldResemble, expectedRead)
+			So((<-docChan).document, ShouldResemble, expectedRead)
 		})
 
 		Convey("extra columns should be prefixed with 'field'", func() {
@@ -84,9 +84,9 @@ func TestTSVStreamDocument(t *testing.T) {
 				{"field3", " may"},
 			}
 			r := NewTSVInputReader(colSpecs, bytes.NewReader([]byte(contents)), os.Stdout, 1, false)
-			docChan := make(chan bson.D, 1)
+			docChan := make(chan importDocument, 1)
 			So(r.StreamDocument(true, docChan), ShouldBeNil)
-			So(<-docChan, ShouldResemble, expectedRead)
+			So((<-docChan).document, ShouldResemble, expectedRead)
 		})
 
 		Convey("mixed values should be parsed correctly", func() {
@@ -104,9 +104,9 @@ func TestTSVStreamDocument(t *testing.T) {
 				{"d", int32(14)},
 			}
 			r := NewTSVInputReader(colSpecs, bytes.NewReader([]byte(contents)), os.Stdout, 1, false)
-			docChan := make(chan bson.D, 1)
+			docChan := make(chan importDocument, 1)
 			So(r.StreamDocument(true, docChan), ShouldBeNil)
-			So(<-docChan, ShouldResemble, expectedRead)
+			So((<-docChan).document, ShouldResemble, expectedRead)
 		})
 
 		Convey("calling StreamDocument() in succession for TSVs should "+
@@ -129,10 +129,10 @@ func TestTSVStreamDocument(t *testing.T) {
 				},
 			}
 			r := NewTSVInputReader(colSpecs, bytes.NewReader([]byte(contents)), os.Stdout, 1, false)
-			docChan := make(chan bson.D, len(expectedReads))
+			docChan := make(chan importDocument, len(expectedReads))
 			So(r.StreamDocument(true, docChan), ShouldBeNil)
 			for i := 0; i < len(expectedReads); i++ {
-				for j, readDocument := range <-docChan {
+				for j, readDocument := range (<-docChan).document {
 					So(readDocument.Name, ShouldEqual, expectedReads[i][j].Name)
 					So(readDocument.Value, ShouldEqual, expectedReads[i][j].Value)
 				}
@@ -158,10 +158,10 @@ func TestTSVStreamDocument(t *testing.T) {
 				{"c", int32(6)},
 			}
 			r := NewTSVInputReader(colSpecs, bytes.NewReader([]byte(contents)), os.Stdout, 1, false)
-			docChan := make(chan bson.D, 2)
+			docChan := make(chan importDocument, 2)
 			So(r.StreamDocument(true, docChan), ShouldBeNil)
-			So(<-docChan, ShouldResemble, expectedReadOne)
-			So(<-docChan, ShouldResemble, expectedReadTwo)
+			So((<-docChan).document, ShouldResemble, expectedReadOne)
+			So((<-docChan).document, ShouldResemble, expectedReadTwo)
 		})
 
 		Convey("plain TSV input file sources should be parsed correctly and "+
@@ -185,14 +185,35 @@ func TestTSVStreamDocument(t *testing.T) {
 				fileHandle, err := os.Open("testdata/test.tsv")
 				So(err, ShouldBeNil)
 				r := NewTSVInputReader(colSpecs, fileHandle, os.Stdout, 1, false)
-				docChan := make(chan bson.D, 50)
+				docChan := make(chan importDocument, 50)
 				So(r.StreamDocument(true, docChan), ShouldBeNil)
-				So(<-docChan, ShouldResemble, expectedReadOne)
-				So(<-docChan, ShouldResemble, expectedReadTwo)
+				So((<-docChan).document, ShouldResemble, expectedReadOne)
+				So((<-docChan).document, ShouldResemble, expectedReadTwo)
 			})
 	})
 }
 
+func TestTSVComment(t *testing.T) {
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+	Convey("With a TSV input reader with a comment character", t, func() {
+		contents := "#header comment\na\tb\n1\t2\n# record comment\n3\t4\n"
+		r := NewTSVInputReader(nil, bytes.NewReader([]byte(contents)), os.Stdout, 1, false)
+		r.comment = '#'
+
+		Convey("comment lines should be skipped but still counted", func() {
+			So(r.ReadAndValidateHeader(), ShouldBeNil)
+			So(ColumnNames(r.colSpecs), ShouldResemble, []string{"a", "b"})
+			docChan := make(chan importDocument, 2)
+			So(r.StreamDocument(true, docChan), ShouldBeNil)
+			So((<-docChan).document, ShouldResemble, bson.D{{"a", int32(1)}, {"b", int32(2)}})
+			second := <-docChan
+			So(second.document, ShouldResemble, bson.D{{"a", int32(3)}, {"b", int32(4)}})
+			line, _ := second.source.Record()
+			So(line, ShouldEqual, 5)
+		})
+	})
+}
+
 func TestTSVReadAndValidateHeader(t *testing.T) {
 	testutil.VerifyTestType(t, testutil.UnitTestType)
 	Convey("With a TSV input reader", t, func() {
@@ -0,0 +1,22 @@
+// +build zstd
+
+package mongoimport
+
+import (
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// zstdSupported is whether zstd input can be decompressed, which requires
+// building with the zstd tag.
+const zstdSupported = true
+
+// newZstdReader returns a reader that decompresses zstd input while streaming.
+func newZstdReader(source io.Reader) (io.ReadCloser, error) {
+	zstdReader, err := zstd.NewReader(source)
+	if err != nil {
+		return nil, err
+	}
+	return zstdReader.IOReadCloser(), nil
+}
@@ -0,0 +1,18 @@
+// +build !zstd
+
+package mongoimport
+
+import (
+	"fmt"
+	"io"
+)
+
+// zstdSupported is whether zstd input can be decompressed, which requires
+// building with the zstd tag.
+const zstdSupported = false
+
+// newZstdReader fails, as zstd input can only be decompressed by builds with
+// the zstd tag.
+func newZstdReader(source io.Reader) (io.ReadCloser, error) {
+	return nil, fmt.Errorf("this build of mongoimport does not support zstd, which requires building with -tags zstd")
+}
@@ -0,0 +1,501 @@
+package mongorestore
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/mongodb/mongo-tools/common/archive"
+	"github.com/mongodb/mongo-tools/common/db"
+	"github.com/mongodb/mongo-tools/common/intents"
+	"github.com/mongodb/mongo-tools/common/log"
+	"github.com/mongodb/mongo-tools/common/util"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// converting returns true if the input is to be converted to another dump
+// format rather than restored, in which case no server is needed.
+func (restore *MongoRestore) converting() bool {
+	return restore.ConvertOptions != nil &&
+		(restore.ConvertOptions.ToArchive != "" || restore.ConvertOptions.ToDir != "")
+}
+
+// validateConvertOptions checks the options that don't make sense when converting.
+func (restore *MongoRestore) validateConvertOptions() error {
+	if restore.ConvertOptions.ToArchive != "" && restore.ConvertOptions.ToDir != "" {
+		return fmt.Errorf("cannot use both --convertToArchive and --convertToDir")
+	}
+	if restore.InputOptions.OplogReplay {
+		return fmt.Errorf("cannot use --oplogReplay when converting")
+	}
+	if restore.OutputOptions.TransformFile != "" {
+		return fmt.Errorf("cannot use --transformFile when converting")
+	}
+	if restore.TargetDirectory == "-" {
+		return fmt.Errorf("cannot convert a collection read from standard input")
+	}
+	if restore.ConvertOptions.ToArchive == "-" && restore.InputOptions.Archive == "-" {
+		return fmt.Errorf("cannot convert an archive read from standard input to an archive written to standard output")
+	}
+	// the oplog only makes sense next to every collection it applies to
+	restore.convertOplog = len(restore.NSOptions.NSInclude) == 0 && len(restore.NSOptions.NSExclude) == 0 &&
+		len(restore.NSOptions.NSFrom) == 0 && len(restore.NSOptions.ExcludedCollections) == 0 &&
+		len(restore.NSOptions.ExcludedCollectionPrefixes) == 0 && restore.NSOptions.DB == ""
+	return nil
+}
+
+// convertOutput is where Convert writes the collections it reads.
+type convertOutput interface {
+	// WriteIntent writes the documents of source as the collection of the intent.
+	// source is nil for collections without any documents to convert.
+	WriteIntent(intent *intents.Intent, source db.RawDocSource) error
+	// MarkIncomplete records that the input was written by an interrupted dump.
+	MarkIncomplete()
+	Close() error
+}
+
+// Convert reads a dump directory or an archive like Restore does, applying
+// the namespace options, and writes the resulting collections to an archive
+// or a dump directory instead of restoring them to a server.
+func (restore *MongoRestore) Convert() error {
+	err := restore.ParseAndValidateOptions()
+	if err != nil {
+		log.Logvf(log.DebugLow, "got error from options parsing: %v", err)
+		return err
+	}
+
+	if err = restore.prepareIntents(); err != nil {
+		return err
+	}
+
+	// the intents must be gathered before the manager gets finalized. Archives
+	// always yield an oplog intent, which is only converted when it is wanted.
+	allIntents := []*intents.Intent{}
+	for _, intent := range restore.manager.Intents() {
+		if intent.IsOplog() && !restore.convertOplog {
+			continue
+		}
+		allIntents = append(allIntents, intent)
+	}
+	sort.Sort(intentsByNamespace(allIntents))
+	metadata := map[*intents.Intent][]byte{}
+	for _, intent := range allIntents {
+		if intent.MetadataFile == nil {
+			continue
+		}
+		if metadata[intent], err = readMetadataFile(intent); err != nil {
+			return err
+		}
+	}
+
+	if restore.OutputOptions.DryRun {
+		log.Logvf(log.Always, "dry run completed")
+		return nil
+	}
+
+	var output convertOutput
+	if restore.ConvertOptions.ToArchive != "" {
+		output, err = restore.newArchiveConvertOutput(allIntents, metadata)
+	} else {
+		output, err = restore.newDirConvertOutput(allIntents, metadata)
+	}
+	if err != nil {
+		return err
+	}
+
+	demuxFinished, err := restore.startDemux()
+	if err == nil {
+		err = restore.convertIntents(output, allIntents, demuxFinished)
+	}
+	closeErr := output.Close()
+	if err != nil {
+		return err
+	}
+	if closeErr != nil {
+		return fmt.Errorf("error finishing converted output: %v", closeErr)
+	}
+
+	log.Logv(log.Always, "done")
+	return nil
+}
+
+// convertIntents writes every intent to output, in the order the input provides them.
+func (restore *MongoRestore) convertIntents(output convertOutput, allIntents []*intents.Intent, demuxFinished chan error) error {
+	if restore.InputOptions.Archive != "" {
+		restore.manager.UsePrioritizer(restore.archive.Demux.NewPrioritizer(restore.manager))
+	} else {
+		restore.manager.Finalize(intents.Legacy)
+	}
+
+	var writtenMutex sync.Mutex
+	written := map[*intents.Intent]bool{}
+	convertIntent := func(intent *intents.Intent, ioBuf []byte) error {
+		writtenMutex.Lock()
+		written[intent] = true
+		writtenMutex.Unlock()
+		if err := restore.convertIntent(output, intent, ioBuf); err != nil {
+			return fmt.Errorf("%v: %v", intent.Namespace(), err)
+		}
+		return nil
+	}
+
+	// the namespaces of an archive are interleaved, so they have to be read in parallel
+	workers := restore.OutputOptions.NumParallelCollections
+	if workers < 1 {
+		workers = 1
+	}
+	resultChan := make(chan error)
+	for i := 0; i < workers; i++ {
+		go func() {
+			ioBuf := make([]byte, db.MaxBSONSize)
+			for {
+				intent := restore.manager.Pop()
+				if intent == nil {
+					resultChan <- nil
+					return
+				}
+				if err := convertIntent(intent, ioBuf); err != nil {
+					resultChan <- err
+					return
+				}
+				restore.manager.Finish(intent)
+			}
+		}()
+	}
+	for i := 0; i < workers; i++ {
+		if err := <-resultChan; err != nil {
+			return err
+		}
+	}
+
+	// special collections are cached, except for the oplog, which comes last in archives
+	special := []*intents.Intent{restore.manager.Users(), restore.manager.Roles(), restore.manager.AuthVersion()}
+	systemIndexDBs := restore.manager.SystemIndexDBs()
+	sort.Strings(systemIndexDBs)
+	for _, dbName := range systemIndexDBs {
+		special = append(special, restore.manager.SystemIndexes(dbName))
+	}
+	if restore.convertOplog {
+		special = append(special, restore.manager.Oplog())
+	}
+	ioBuf := make([]byte, db.MaxBSONSize)
+	for _, intent := range special {
+		if intent == nil {
+			continue
+		}
+		if err := convertIntent(intent, ioBuf); err != nil {
+			return err
+		}
+	}
+
+	if restore.InputOptions.Archive != "" {
+		if err := restore.finishDemux(demuxFinished); err != nil {
+			return err
+		}
+		if restore.archive.Demux.IncompleteDump() {
+			// the collections that never appeared in the archive weren't dumped
+			output.MarkIncomplete()
+			return nil
+		}
+	}
+
+	// collections that only have metadata, or whose documents never appeared in the archive
+	for _, intent := range allIntents {
+		if written[intent] {
+			continue
+		}
+		if err := output.WriteIntent(intent, nil); err != nil {
+			return fmt.Errorf("%v: %v", intent.Namespace(), err)
+		}
+	}
+	return nil
+}
+
+// convertIntent reads the documents of the intent and writes them to output.
+func (restore *MongoRestore) convertIntent(output convertOutput, intent *intents.Intent, ioBuf []byte) error {
+	if intent.BSONFile == nil {
+		return output.WriteIntent(intent, nil)
+	}
+	if err := intent.BSONFile.Open(); err != nil {
+		return err
+	}
+	defer intent.BSONFile.Close()
+	if fileNeedsIOBuffer, ok := intent.BSONFile.(intents.FileNeedsIOBuffer); ok {
+		fileNeedsIOBuffer.TakeIOBuffer(ioBuf)
+		defer fileNeedsIOBuffer.ReleaseIOBuffer()
+	}
+
+	var source db.RawDocSource = db.NewBSONSource(intent.BSONFile)
+	if len(restore.NSOptions.NSFrom) > 0 {
+		switch {
+		case intent.IsUsers() || intent.IsRoles():
+			source = &authzRenamingSource{RawDocSource: source, restore: restore}
+		case intent.IsSystemIndexes():
+			source = &indexNamespaceRenamingSource{RawDocSource: source, restore: restore}
+		}
+	}
+	log.Logvf(log.Info, "converting %v from %v", intent.Namespace(), intent.Location)
+	if err := output.WriteIntent(intent, source); err != nil {
+		return err
+	}
+	return source.Err()
+}
+
+// indexNamespaceRenamingSource wraps the RawDocSource of a system.indexes
+// collection, renaming the namespace that each index belongs to.
+type indexNamespaceRenamingSource struct {
+	db.RawDocSource
+	restore *MongoRestore
+	err     error
+}
+
+// LoadNext returns the next index document with its namespace renamed.
+func (src *indexNamespaceRenamingSource) LoadNext() []byte {
+	raw := src.RawDocSource.LoadNext()
+	if raw == nil {
+		return nil
+	}
+	doc := bson.D{}
+	if err := bson.Unmarshal(raw, &doc); err != nil {
+		src.err = fmt.Errorf("error reading index document: %v", err)
+		return nil
+	}
+	for i, elem := range doc {
+		if ns, ok := elem.Value.(string); ok && elem.Name == "ns" {
+			doc[i].Value = src.restore.renamer.Get(ns)
+		}
+	}
+	renamed, err := bson.Marshal(doc)
+	if err != nil {
+		src.err = fmt.Errorf("error writing renamed index document: %v", err)
+		return nil
+	}
+	return renamed
+}
+
+// Err returns any error in the indexNamespaceRenamingSource or its RawDocSource.
+func (src *indexNamespaceRenamingSource) Err() error {
+	if src.err != nil {
+		return src.err
+	}
+	return src.RawDocSource.Err()
+}
+
+// readMetadataFile returns the contents of the metadata file of the intent.
+func readMetadataFile(intent *intents.Intent) ([]byte, error) {
+	if err := intent.MetadataFile.Open(); err != nil {
+		return nil, fmt.Errorf("error reading metadata for %v: %v", intent.Namespace(), err)
+	}
+	defer intent.MetadataFile.Close()
+	contents, err := ioutil.ReadAll(intent.MetadataFile)
+	if err != nil {
+		return nil, fmt.Errorf("error reading metadata for %v: %v", intent.Namespace(), err)
+	}
+	return contents, nil
+}
+
+// intentsByNamespace attaches the methods of sort.Interface to a slice of intents,
+// sorting them by namespace.
+type intentsByNamespace []*intents.Intent
+
+func (s intentsByNamespace) Len() int           { return len(s) }
+func (s intentsByNamespace) Less(i, j int) bool { return s[i].Namespace() < s[j].Namespace() }
+func (s intentsByNamespace) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+
+//===== Archive output =====
+
+// archiveConvertOutput writes converted collections to an archive.
+type archiveConvertOutput struct {
+	mux *archive.Multiplexer
+}
+
+// convertNotifier implements archive.Notifier. Conversion isn't interruptible,
+// so there is nothing to notify.
+type convertNotifier struct{}
+
+func (convertNotifier) Notify() {}
+
+// newArchiveConvertOutput creates the archive and writes its prelude, which
+// lists every collection along with its metadata.
+func (restore *MongoRestore) newArchiveConvertOutput(allIntents []*intents.Intent, metadata map[*intents.Intent][]byte) (*archiveConvertOutput, error) {
+	serverVersion := ""
+	if restore.archive != nil {
+		serverVersion = restore.archive.Prelude.Header.ServerVersion
+	}
+	prelude, err := archive.NewPrelude(intents.NewIntentManager(), restore.OutputOptions.NumParallelCollections, serverVersion)
+	if err != nil {
+		return nil, err
+	}
+	for _, intent := range allIntents {
+		prelude.AddMetadata(&archive.CollectionMetadata{
+			Database:   intent.DB,
+			Collection: intent.C,
+			Metadata:   string(metadata[intent]),
+		})
+	}
+
+	var out io.WriteCloser
+	if restore.ConvertOptions.ToArchive == "-" {
+		out = &nopCloseWriter{os.Stdout}
+	} else {
+		file, err := os.Create(restore.ConvertOptions.ToArchive)
+		if err != nil {
+			return nil, err
+		}
+		out = file
+	}
+	if restore.ConvertOptions.Gzip {
+		out = &util.WrappedWriteCloser{gzip.NewWriter(out), out}
+	}
+	if err = prelude.Write(out); err != nil {
+		out.Close()
+		return nil, fmt.Errorf("error writing archive prelude: %v", err)
+	}
+	output := &archiveConvertOutput{
+		mux: archive.NewMultiplexer(out, convertNotifier{}),
+	}
+	go output.mux.Run()
+	return output, nil
+}
+
+// WriteIntent is part of the convertOutput interface.
+func (output *archiveConvertOutput) WriteIntent(intent *intents.Intent, source db.RawDocSource) error {
+	muxIn := &archive.MuxIn{Intent: intent, Mux: output.mux}
+	if err := muxIn.Open(); err != nil {
+		return err
+	}
+	if source != nil {
+		for doc := source.LoadNext(); doc != nil; doc = source.LoadNext() {
+			if _, err := muxIn.Write(doc); err != nil {
+				muxIn.Close()
+				return err
+			}
+		}
+	}
+	if receiver, ok := intent.BSONFile.(*archive.RegularCollectionReceiver); ok {
+		// keep track of collections that were only partially dumped
+		muxIn.Incomplete = receiver.Incomplete()
+	}
+	return muxIn.Close()
+}
+
+// MarkIncomplete is part of the convertOutput interface.
+func (output *archiveConvertOutput) MarkIncomplete() {
+	output.mux.MarkIncomplete()
+}
+
+// Close is part of the convertOutput interface. It finishes the archive, and
+// the multiplexer closes the output.
+func (output *archiveConvertOutput) Close() error {
+	close(output.mux.Control)
+	return <-output.mux.Completed
+}
+
+// nopCloseWriter implements io.WriteCloser. It wraps up a io.Writer, and adds a no-op Close
+type nopCloseWriter struct {
+	io.Writer
+}
+
+// Close does nothing on nopCloseWriters
+func (*nopCloseWriter) Close() error {
+	return nil
+}
+
+//===== Directory output =====
+
+// dirConvertOutput writes converted collections to a dump directory.
+type dirConvertOutput struct {
+	root string
+	gzip bool
+}
+
+// newDirConvertOutput creates the dump directory and writes the metadata
+// files of every collection.
+func (restore *MongoRestore) newDirConvertOutput(allIntents []*intents.Intent, metadata map[*intents.Intent][]byte) (*dirConvertOutput, error) {
+	output := &dirConvertOutput{
+		root: restore.ConvertOptions.ToDir,
+		gzip: restore.ConvertOptions.Gzip,
+	}
+	for _, intent := range allIntents {
+		contents, ok := metadata[intent]
+		if !ok {
+			continue
+		}
+		file, err := output.create(intent, ".metadata.json")
+		if err != nil {
+			return nil, err
+		}
+		_, err = file.Write(contents)
+		if closeErr := file.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error writing metadata for %v: %v", intent.Namespace(), err)
+		}
+	}
+	return output, nil
+}
+
+// create creates the file for the intent with the given suffix, creating
+// any directories needed.
+func (output *dirConvertOutput) create(intent *intents.Intent, suffix string) (io.WriteCloser, error) {
+	for _, name := range []string{intent.DB, intent.C} {
+		for _, c := range name {
+			if os.IsPathSeparator(uint8(c)) {
+				return nil, fmt.Errorf(`"%v" contains a path separator '%c' `+
+					`and can't be written to the filesystem`, intent.Namespace(), c)
+			}
+		}
+	}
+	path := filepath.Join(output.root, intent.DB, intent.C+suffix)
+	if output.gzip {
+		path += ".gz"
+	}
+	err := os.MkdirAll(filepath.Dir(path), os.ModeDir|os.ModePerm)
+	if err != nil {
+		return nil, fmt.Errorf("error creating directory %v: %v", filepath.Dir(path), err)
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("error creating file %v: %v", path, err)
+	}
+	if output.gzip {
+		return &util.WrappedWriteCloser{gzip.NewWriter(file), file}, nil
+	}
+	return file, nil
+}
+
+// WriteIntent is part of the convertOutput interface. Collections without
+// documents to convert only get a BSON file if they weren't metadata-only.
+func (output *dirConvertOutput) WriteIntent(intent *intents.Intent, source db.RawDocSource) error {
+	if source == nil && intent.BSONFile == nil {
+		return nil
+	}
+	file, err := output.create(intent, ".bson")
+	if err != nil {
+		return err
+	}
+	if source != nil {
+		for doc := source.LoadNext(); doc != nil; doc = source.LoadNext() {
+			if _, err = file.Write(doc); err != nil {
+				file.Close()
+				return err
+			}
+		}
+	}
+	return file.Close()
+}
+
+// MarkIncomplete is part of the convertOutput interface. Dump directories
+// have no way of recording it, so the report of Convert is all there is.
+func (output *dirConvertOutput) MarkIncomplete() {}
+
+// Close is part of the convertOutput interface.
+func (output *dirConvertOutput) Close() error {
+	return nil
+}
@@ -0,0 +1,124 @@
+package mongorestore
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mongodb/mongo-tools/common/archive"
+	commonOpts "github.com/mongodb/mongo-tools/common/options"
+	"github.com/mongodb/mongo-tools/common/testutil"
+	"github.com/mongodb/mongo-tools/common/transform"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func newConvertingMongoRestore(target string, convertOpts *ConvertOptions) *MongoRestore {
+	return &MongoRestore{
+		ToolOptions:     &commonOpts.ToolOptions{},
+		InputOptions:    &InputOptions{},
+		OutputOptions:   &OutputOptions{NumParallelCollections: 1},
+		NSOptions:       &NSOptions{},
+		ConvertOptions:  convertOpts,
+		TargetDirectory: target,
+	}
+}
+
+func TestConvert(t *testing.T) {
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With a temporary directory", t, func() {
+		tmp, err := ioutil.TempDir("", "mongorestore_convert")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(tmp)
+
+		Convey("converting a dump directory to an archive keeps every collection", func() {
+			archivePath := filepath.Join(tmp, "dump.archive")
+			restore := newConvertingMongoRestore("testdata/testdirs", &ConvertOptions{ToArchive: archivePath})
+			So(restore.Convert(), ShouldBeNil)
+
+			in, err := os.Open(archivePath)
+			So(err, ShouldBeNil)
+			defer in.Close()
+			prelude := &archive.Prelude{}
+			So(prelude.Read(in), ShouldBeNil)
+			So(len(prelude.NamespaceMetadatas), ShouldEqual, 5)
+
+			verifier := archive.NewVerifier()
+			So((&archive.Parser{In: in}).ReadAllBlocks(verifier), ShouldBeNil)
+			for _, namespace := range []string{"db1.c1", "db1.c2", "db1.c3", "db2.c1", ".oplog"} {
+				stats := verifier.Stats(namespace)
+				So(stats, ShouldNotBeNil)
+				So(stats.Verified(), ShouldBeTrue)
+			}
+			So(verifier.Stats("db1.c1").Bytes, ShouldEqual, 3300)
+
+			Convey("and converting it back to a renamed subset keeps the documents", func() {
+				dir := filepath.Join(tmp, "dump")
+				restore := newConvertingMongoRestore("", &ConvertOptions{ToDir: dir})
+				restore.InputOptions.Archive = archivePath
+				restore.NSOptions.NSInclude = []string{"db1.c1"}
+				restore.NSOptions.NSFrom = []string{"db1.c1"}
+				restore.NSOptions.NSTo = []string{"db3.c4"}
+				So(restore.Convert(), ShouldBeNil)
+
+				original, err := ioutil.ReadFile("testdata/testdirs/db1/c1.bson")
+				So(err, ShouldBeNil)
+				converted, err := ioutil.ReadFile(filepath.Join(dir, "db3", "c4.bson"))
+				So(err, ShouldBeNil)
+				So(converted, ShouldResemble, original)
+				_, err = os.Stat(filepath.Join(dir, "db3", "c4.metadata.json"))
+				So(err, ShouldBeNil)
+
+				// the oplog is left out of subsets
+				entries, err := ioutil.ReadDir(dir)
+				So(err, ShouldBeNil)
+				So(len(entries), ShouldEqual, 1)
+			})
+		})
+
+		Convey("converting to both an archive and a directory fails", func() {
+			restore := newConvertingMongoRestore("testdata/testdirs", &ConvertOptions{
+				ToArchive: filepath.Join(tmp, "dump.archive"),
+				ToDir:     filepath.Join(tmp, "dump"),
+			})
+			So(restore.Convert(), ShouldNotBeNil)
+		})
+
+		Convey("converting with --transformFile fails", func() {
+			restore := newConvertingMongoRestore("testdata/testdirs", &ConvertOptions{
+				ToArchive: filepath.Join(tmp, "dump.archive"),
+			})
+			restore.OutputOptions.TransformFile = "testdata/transform.yaml"
+			So(restore.Convert(), ShouldNotBeNil)
+		})
+	})
+}
+
+func TestTransformDocument(t *testing.T) {
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With a --transformFile", t, func() {
+		var err error
+		restore := &MongoRestore{}
+		restore.transform, err = transform.ReadFile("testdata/transform.yaml")
+		So(err, ShouldBeNil)
+
+		Convey("documents of the matching namespaces should be transformed", func() {
+			So(restore.transform.AppliesTo("db1.c1"), ShouldBeTrue)
+			So(restore.transform.AppliesTo("db2.c1"), ShouldBeFalse)
+
+			data, err := bson.Marshal(bson.D{{"_id", 1}, {"name", "a"}, {"tmp", true}})
+			So(err, ShouldBeNil)
+			doc, err := restore.transformDocument("db1.c1", bson.Raw{Kind: 3, Data: data})
+			So(err, ShouldBeNil)
+			So(doc, ShouldResemble, bson.D{{"_id", 1}, {"title", "a"}})
+		})
+
+		Convey("invalid documents should fail to be transformed", func() {
+			_, err := restore.transformDocument("db1.c1", bson.Raw{Kind: 3, Data: []byte{1, 2}})
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
@@ -257,7 +257,7 @@ func (restore *MongoRestore) CreateAllIntents(dir archive.DirLike) error {
 					Size:     entry.Size(),
 					Location: entry.Path(),
 				}
-				if !restore.InputOptions.OplogReplay {
+				if !restore.InputOptions.OplogReplay && !restore.convertOplog {
 					if restore.InputOptions.Archive != "" {
 						mutedOut := &archive.MutedCollection{
 							Intent: oplogIntent,
@@ -0,0 +1,186 @@
+package mongorestore
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/mongodb/mongo-tools/common/archive"
+	"github.com/mongodb/mongo-tools/common/bsonutil"
+	"github.com/mongodb/mongo-tools/common/json"
+	"github.com/mongodb/mongo-tools/common/log"
+	"github.com/mongodb/mongo-tools/common/text"
+)
+
+// ListArchive writes a summary of the contents of the archive to out, without
+// connecting to a server. The summary is read from the archive's prelude, and the
+// number of documents of every namespace from its table of contents, if it has
+// one. With --verify, the whole archive is read instead, the documents of every
+// namespace are counted and their CRCs are checked. With --salvage, damaged
+// parts of the archive are skipped and reported instead of stopping verification.
+func (restore *MongoRestore) ListArchive(out io.Writer) error {
+	if restore.InputOptions.Archive == "" {
+		return fmt.Errorf("--list and --verify can only be used with --archive")
+	}
+	if restore.InputReader == nil {
+		restore.InputReader = os.Stdin
+	}
+	in, err := restore.getArchiveReader()
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	prelude := &archive.Prelude{}
+	preludeReader := &countingReader{Reader: in}
+	if err = prelude.Read(preludeReader); err != nil {
+		return fmt.Errorf("error reading archive prelude: %v", err)
+	}
+
+	var verifier *archive.Verifier
+	var salvageReport *archive.SalvageReport
+	var toc *archive.TableOfContents
+	if seeker, ok := in.(io.ReadSeeker); ok && !restore.InputOptions.Verify {
+		toc, err = archive.ReadTableOfContents(seeker)
+		if err != nil {
+			log.Logvf(log.Always, "error reading archive table of contents: %v", err)
+			toc = nil
+		}
+	}
+	if restore.InputOptions.Verify {
+		verifier = archive.NewVerifier()
+		parser := archive.Parser{In: in}
+		if restore.InputOptions.Salvage {
+			salvageReport = &archive.SalvageReport{Offset: preludeReader.n}
+			err = parser.SalvageAllBlocks(verifier, salvageReport)
+		} else {
+			err = parser.ReadAllBlocks(verifier)
+		}
+		if err != nil {
+			return fmt.Errorf("error reading archive: %v", err)
+		}
+	}
+
+	fmt.Fprintf(out, "archive format version: %v\n", prelude.Header.FormatVersion)
+	fmt.Fprintf(out, "server version: %v\n", prelude.Header.ServerVersion)
+	fmt.Fprintf(out, "tool version: %v\n", prelude.Header.ToolVersion)
+	fmt.Fprintf(out, "concurrent collections: %v\n\n", prelude.Header.ConcurrentCollections)
+
+	grid := &text.GridWriter{ColumnPadding: 2}
+	grid.WriteCells("namespace", "size", "indexes", "options")
+	if verifier != nil {
+		grid.WriteCells("documents", "bytes", "crc")
+	} else if toc != nil {
+		grid.WriteCells("documents")
+	}
+	grid.EndRow()
+
+	failures := 0
+	listed := map[string]bool{}
+	for _, cm := range prelude.NamespaceMetadatas {
+		namespace := cm.Database + "." + cm.Collection
+		listed[namespace] = true
+		indexes, options, err := restore.summarizeMetadata(cm.Metadata)
+		if err != nil {
+			log.Logvf(log.Always, "error reading metadata for %v: %v", displayNamespace(namespace), err)
+		}
+		grid.WriteCells(displayNamespace(namespace), fmt.Sprintf("%v", cm.Size), indexes, options)
+		if verifier != nil {
+			stats := verifier.Stats(namespace)
+			if stats == nil {
+				// mongodump writes an EOF block for every namespace in the prelude,
+				// unless it was interrupted before getting to the namespace
+				if verifier.IncompleteDump() {
+					grid.WriteCells("-", "-", "not dumped")
+				} else {
+					grid.WriteCells("-", "-", "missing")
+				}
+				failures++
+			} else {
+				grid.WriteCells(fmt.Sprintf("%v", stats.Documents), fmt.Sprintf("%v", stats.Bytes), crcStatus(stats))
+				if !stats.Verified() {
+					failures++
+				}
+			}
+		} else if toc != nil {
+			if documents, ok := toc.Documents(namespace); ok {
+				grid.WriteCells(fmt.Sprintf("%v", documents))
+			} else {
+				grid.WriteCells("-")
+			}
+		}
+		grid.EndRow()
+	}
+	if verifier != nil {
+		for _, namespace := range verifier.Namespaces() {
+			if listed[namespace] {
+				continue
+			}
+			stats := verifier.Stats(namespace)
+			grid.WriteCells(displayNamespace(namespace), "-", "-", "-",
+				fmt.Sprintf("%v", stats.Documents), fmt.Sprintf("%v", stats.Bytes), "not in prelude")
+			grid.EndRow()
+			failures++
+		}
+	}
+	grid.Flush(out)
+	if verifier == nil && toc == nil {
+		fmt.Fprintf(out, "\nthe archive has no table of contents, use --verify to count its documents\n")
+	}
+	if verifier != nil && verifier.IncompleteDump() {
+		fmt.Fprintf(out, "\nthe dump that wrote this archive was interrupted, so it is incomplete\n")
+	}
+	if salvageReport != nil {
+		fmt.Fprintf(out, "\n%v", salvageReport)
+	}
+
+	if failures > 0 {
+		return fmt.Errorf("archive verification failed for %v namespace(s)", failures)
+	}
+	return nil
+}
+
+// summarizeMetadata returns the number of indexes and the collection options
+// found in the JSON metadata of a collection, formatted for ListArchive.
+func (restore *MongoRestore) summarizeMetadata(metadata string) (string, string, error) {
+	if metadata == "" {
+		return "-", "-", nil
+	}
+	options, indexes, err := restore.MetadataFromJSON([]byte(metadata))
+	if err != nil {
+		return "?", "?", err
+	}
+	if len(options) == 0 {
+		return fmt.Sprintf("%v", len(indexes)), "{}", nil
+	}
+	jsonOptions, err := bsonutil.ConvertBSONValueToJSON(options)
+	if err != nil {
+		return fmt.Sprintf("%v", len(indexes)), "?", err
+	}
+	optionsBytes, err := json.Marshal(jsonOptions)
+	if err != nil {
+		return fmt.Sprintf("%v", len(indexes)), "?", err
+	}
+	return fmt.Sprintf("%v", len(indexes)), string(optionsBytes), nil
+}
+
+// crcStatus describes the outcome of checking the CRC of a namespace.
+func crcStatus(stats *archive.NamespaceStats) string {
+	switch {
+	case !stats.EOF:
+		return "missing EOF"
+	case stats.Incomplete:
+		return "incomplete"
+	case stats.Verified():
+		return "ok"
+	default:
+		return fmt.Sprintf("mismatch (%v!=%v)", stats.CRC, stats.ExpectedCRC)
+	}
+}
+
+// displayNamespace strips the leading dot of namespaces that are not bound to
+// a database, such as the oplog.
+func displayNamespace(namespace string) string {
+	return strings.TrimPrefix(namespace, ".")
+}
@@ -30,6 +30,8 @@ func main() {
 	opts.AddOptions(inputOpts)
 	outputOpts := &mongorestore.OutputOptions{}
 	opts.AddOptions(outputOpts)
+	convertOpts := &mongorestore.ConvertOptions{}
+	opts.AddOptions(convertOpts)
 
 	extraArgs, err := opts.Parse()
 	if err != nil {
@@ -61,6 +63,39 @@ func main() {
 	}
 	targetDir = util.ToUniversalPath(targetDir)
 
+	// listing an archive doesn't need a server
+	if inputOpts.List || inputOpts.Verify {
+		restore := mongorestore.MongoRestore{
+			ToolOptions:     opts,
+			OutputOptions:   outputOpts,
+			InputOptions:    inputOpts,
+			NSOptions:       nsOpts,
+			TargetDirectory: targetDir,
+		}
+		if err = restore.ListArchive(os.Stdout); err != nil {
+			log.Logvf(log.Always, "Failed: %v", err)
+			os.Exit(util.ExitError)
+		}
+		return
+	}
+
+	// converting doesn't need a server either
+	if convertOpts.ToArchive != "" || convertOpts.ToDir != "" {
+		restore := mongorestore.MongoRestore{
+			ToolOptions:     opts,
+			OutputOptions:   outputOpts,
+			InputOptions:    inputOpts,
+			NSOptions:       nsOpts,
+			ConvertOptions:  convertOpts,
+			TargetDirectory: targetDir,
+		}
+		if err = restore.Convert(); err != nil {
+			log.Logvf(log.Always, "Failed: %v", err)
+			os.Exit(util.ExitError)
+		}
+		return
+	}
+
 	// connect directly, unless a replica set name is explicitly specified
 	_, setName := util.ParseConnectionString(opts.Host)
 	opts.Direct = (setName == "")
@@ -87,6 +122,7 @@ func main() {
 		OutputOptions:   outputOpts,
 		InputOptions:    inputOpts,
 		NSOptions:       nsOpts,
+		ConvertOptions:  convertOpts,
 		TargetDirectory: targetDir,
 		SessionProvider: provider,
 		ProgressManager: progressManager,
@@ -2,6 +2,7 @@ package mongorestore
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/mongodb/mongo-tools/common"
 	"github.com/mongodb/mongo-tools/common/bsonutil"
@@ -34,6 +35,19 @@ type Metadata struct {
 	Indexes []IndexDocument `json:"indexes"`
 }
 
+// ShardingMetadata holds the shard key and chunk split points of a collection
+// that was dumped through a mongos.
+type ShardingMetadata struct {
+	Key         bson.D   `json:"key"`
+	Unique      bool     `json:"unique"`
+	SplitPoints []bson.D `json:"splitPoints"`
+}
+
+// this struct is used to read in the sharding configuration of a collection
+type metadataSharding struct {
+	Sharding *ShardingMetadata `json:"sharding"`
+}
+
 // this struct is used to read in the options of a set of indexes
 type metaDataMapIndex struct {
 	Indexes []bson.M `json:"indexes"`
@@ -95,6 +109,38 @@ func (restore *MongoRestore) MetadataFromJSON(jsonBytes []byte) (bson.D, []Index
 	return meta.Options, meta.Indexes, nil
 }
 
+// ShardingMetadataFromJSON takes a slice of JSON bytes and unmarshals the
+// sharding configuration they contain, if any. It returns nil if the collection
+// was not sharded when it was dumped.
+func (restore *MongoRestore) ShardingMetadataFromJSON(jsonBytes []byte) (*ShardingMetadata, error) {
+	if len(jsonBytes) == 0 {
+		return nil, nil
+	}
+
+	meta := &metadataSharding{}
+	err := json.Unmarshal(jsonBytes, meta)
+	if err != nil {
+		return nil, err
+	}
+	sharding := meta.Sharding
+	if sharding == nil {
+		return nil, nil
+	}
+
+	// parse the shard key and split points, to support extended json
+	sharding.Key, err = bsonutil.GetExtendedBsonD(sharding.Key)
+	if err != nil {
+		return nil, fmt.Errorf("extended json in sharding 'key': %v", err)
+	}
+	for i := range sharding.SplitPoints {
+		sharding.SplitPoints[i], err = bsonutil.GetExtendedBsonD(sharding.SplitPoints[i])
+		if err != nil {
+			return nil, fmt.Errorf("extended json in sharding 'splitPoints': %v", err)
+		}
+	}
+	return sharding, nil
+}
+
 // LoadIndexesFromBSON reads indexes from the index BSON files and
 // caches them in the MongoRestore object.
 func (restore *MongoRestore) LoadIndexesFromBSON() error {
@@ -283,6 +329,15 @@ func (restore *MongoRestore) RestoreUsersOrRoles(users, roles *intents.Intent) e
 		return fmt.Errorf("can't restore users and roles to different databases, %v and %v", users.DB, roles.DB)
 	}
 
+	// users and roles dumped with --dumpDbUsersAndRoles belong to a single database;
+	// renaming them into admin would make _mergeAuthzCollections treat them as
+	// the users and roles for every database
+	for _, intent := range []*intents.Intent{users, roles} {
+		if intent != nil && intent.DB == "admin" && strings.HasPrefix(intent.C, "$admin.") {
+			return fmt.Errorf("can't restore users and roles of a single database to the admin database")
+		}
+	}
+
 	args := []loopArg{}
 	mergeArgs := bson.D{}
 	userTargetDB := ""
@@ -321,7 +376,13 @@ func (restore *MongoRestore) RestoreUsersOrRoles(users, roles *intents.Intent) e
 			return err
 		}
 		defer arg.intent.BSONFile.Close()
-		bsonSource := db.NewDecodedBSONSource(db.NewBSONSource(arg.intent.BSONFile))
+		var rawSource db.RawDocSource = db.NewBSONSource(arg.intent.BSONFile)
+		if restore.renamer != nil && len(restore.NSOptions.NSFrom) > 0 {
+			// rewrite the databases referenced by each user or role so that
+			// they follow any namespace renames
+			rawSource = &authzRenamingSource{RawDocSource: rawSource, restore: restore}
+		}
+		bsonSource := db.NewDecodedBSONSource(rawSource)
 		defer bsonSource.Close()
 
 		tempCollectionNameExists, err := restore.CollectionExists(&intents.Intent{DB: "admin", C: arg.tempCollectionName})
@@ -398,6 +459,147 @@ func (restore *MongoRestore) RestoreUsersOrRoles(users, roles *intents.Intent) e
 	return nil
 }
 
+// authzRenamingSource wraps a RawDocSource of user or role documents and
+// rewrites the database names they reference through the restore's renamer.
+type authzRenamingSource struct {
+	db.RawDocSource
+	restore *MongoRestore
+	err     error
+}
+
+// LoadNext returns the next user or role document with its database
+// references renamed.
+func (src *authzRenamingSource) LoadNext() []byte {
+	raw := src.RawDocSource.LoadNext()
+	if raw == nil {
+		return nil
+	}
+	doc := bson.D{}
+	if err := bson.Unmarshal(raw, &doc); err != nil {
+		src.err = fmt.Errorf("error reading user or role document: %v", err)
+		return nil
+	}
+	renamed, err := bson.Marshal(src.restore.renameAuthzDocument(doc))
+	if err != nil {
+		src.err = fmt.Errorf("error writing renamed user or role document: %v", err)
+		return nil
+	}
+	return renamed
+}
+
+// Err returns any error in the authzRenamingSource or its RawDocSource.
+func (src *authzRenamingSource) Err() error {
+	if src.err != nil {
+		return src.err
+	}
+	return src.RawDocSource.Err()
+}
+
+// renameAuthzDB returns the database that the users and roles of the
+// given database are restored to. It follows the rename applied to the
+// database's $admin.system.users collection, which is how users and roles
+// dumped with --dumpDbUsersAndRoles are stored.
+func (restore *MongoRestore) renameAuthzDB(dbName string) string {
+	if dbName == "" {
+		// an empty database in a privilege resource matches every database
+		return dbName
+	}
+	destDB, _ := common.SplitNamespace(restore.renamer.Get(dbName + ".$admin.system.users"))
+	return destDB
+}
+
+// renameAuthzDocument rewrites the "_id" and "db" fields of a user or role
+// document, along with the databases of its granted roles and privilege
+// resources, through the restore's renamer.
+func (restore *MongoRestore) renameAuthzDocument(doc bson.D) bson.D {
+	sourceDB, _ := bsonutil.FindValueByKey("db", &doc)
+	sourceDBName, ok := sourceDB.(string)
+	if !ok {
+		// documents from before auth version 3 are stored in their own
+		// database and have no "db" field to rewrite
+		return doc
+	}
+	destDB := restore.renameAuthzDB(sourceDBName)
+	for i, elem := range doc {
+		switch elem.Name {
+		case "_id":
+			// ids are of the form "<db>.<user or role name>"
+			if id, ok := elem.Value.(string); ok && strings.HasPrefix(id, sourceDBName+".") {
+				doc[i].Value = destDB + strings.TrimPrefix(id, sourceDBName)
+			}
+		case "db":
+			doc[i].Value = destDB
+		case "roles", "inheritedRoles":
+			if roles, ok := elem.Value.([]interface{}); ok {
+				for _, role := range roles {
+					if roleDoc, ok := role.(bson.D); ok {
+						restore.renameAuthzRoleGrant(roleDoc)
+					}
+				}
+			}
+		case "privileges":
+			if privileges, ok := elem.Value.([]interface{}); ok {
+				for _, privilege := range privileges {
+					if privilegeDoc, ok := privilege.(bson.D); ok {
+						restore.renameAuthzPrivilege(privilegeDoc)
+					}
+				}
+			}
+		}
+	}
+	return doc
+}
+
+// renameAuthzRoleGrant rewrites the "db" field of a {role: ..., db: ...}
+// role grant in place.
+func (restore *MongoRestore) renameAuthzRoleGrant(grant bson.D) {
+	for i, elem := range grant {
+		if elem.Name == "db" {
+			if dbName, ok := elem.Value.(string); ok {
+				grant[i].Value = restore.renameAuthzDB(dbName)
+			}
+		}
+	}
+}
+
+// renameAuthzPrivilege rewrites the database and collection of a privilege's
+// resource in place. Cluster-wide and any-resource privileges are left alone.
+func (restore *MongoRestore) renameAuthzPrivilege(privilege bson.D) {
+	value, _ := bsonutil.FindValueByKey("resource", &privilege)
+	resource, ok := value.(bson.D)
+	if !ok {
+		return
+	}
+	dbIndex, collectionIndex := -1, -1
+	for i, elem := range resource {
+		switch elem.Name {
+		case "db":
+			dbIndex = i
+		case "collection":
+			collectionIndex = i
+		}
+	}
+	if dbIndex < 0 {
+		return
+	}
+	dbName, ok := resource[dbIndex].Value.(string)
+	if !ok || dbName == "" {
+		return
+	}
+	collection := ""
+	if collectionIndex >= 0 {
+		collection, _ = resource[collectionIndex].Value.(string)
+	}
+	if collection == "" {
+		// the privilege applies to every collection in the database
+		resource[dbIndex].Value = restore.renameAuthzDB(dbName)
+		return
+	}
+	destDB, destC := common.SplitNamespace(restore.renamer.Get(dbName + "." + collection))
+	resource[dbIndex].Value = destDB
+	resource[collectionIndex].Value = destC
+}
+
 // GetDumpAuthVersion reads the admin.system.version collection in the dump directory
 // to determine the authentication version of the files in the dump. If that collection is not
 // present in the dump, we try to infer the authentication version based on its absence.
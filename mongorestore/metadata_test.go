@@ -7,6 +7,7 @@ import (
 	"github.com/mongodb/mongo-tools/common/intents"
 	commonOpts "github.com/mongodb/mongo-tools/common/options"
 	"github.com/mongodb/mongo-tools/common/testutil"
+	"github.com/mongodb/mongo-tools/mongorestore/ns"
 	. "github.com/smartystreets/goconvey/convey"
 	"gopkg.in/mgo.v2/bson"
 )
@@ -176,3 +177,106 @@ func TestGetDumpAuthVersion(t *testing.T) {
 	})
 
 }
+
+func TestRenameAuthzDocument(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With a test mongorestore renaming a.* to b.*", t, func() {
+		renamer, err := ns.NewRenamer([]string{"a.*"}, []string{"b.*"})
+		So(err, ShouldBeNil)
+		restore := &MongoRestore{renamer: renamer}
+
+		Convey("a user document should have its db, _id and role grants renamed", func() {
+			user := bson.D{
+				{"_id", "a.alice"},
+				{"user", "alice"},
+				{"db", "a"},
+				{"roles", []interface{}{
+					bson.D{{"role", "readWrite"}, {"db", "a"}},
+					bson.D{{"role", "read"}, {"db", "other"}},
+				}},
+			}
+			renamed := restore.renameAuthzDocument(user)
+			So(renamed[0].Value, ShouldEqual, "b.alice")
+			So(renamed[1].Value, ShouldEqual, "alice")
+			So(renamed[2].Value, ShouldEqual, "b")
+			roles := renamed[3].Value.([]interface{})
+			So(roles[0].(bson.D)[1].Value, ShouldEqual, "b")
+			So(roles[1].(bson.D)[1].Value, ShouldEqual, "other")
+		})
+
+		Convey("a role document should have its privilege resources renamed", func() {
+			role := bson.D{
+				{"_id", "a.reporter"},
+				{"role", "reporter"},
+				{"db", "a"},
+				{"privileges", []interface{}{
+					bson.D{
+						{"resource", bson.D{{"db", "a"}, {"collection", "logs"}}},
+						{"actions", []interface{}{"find"}},
+					},
+					bson.D{
+						{"resource", bson.D{{"db", "a"}, {"collection", ""}}},
+						{"actions", []interface{}{"listCollections"}},
+					},
+					bson.D{
+						{"resource", bson.D{{"cluster", true}}},
+						{"actions", []interface{}{"serverStatus"}},
+					},
+				}},
+				{"roles", []interface{}{}},
+			}
+			renamed := restore.renameAuthzDocument(role)
+			So(renamed[0].Value, ShouldEqual, "b.reporter")
+			So(renamed[2].Value, ShouldEqual, "b")
+			privileges := renamed[3].Value.([]interface{})
+			So(privileges[0].(bson.D)[0].Value, ShouldResemble, bson.D{{"db", "b"}, {"collection", "logs"}})
+			So(privileges[1].(bson.D)[0].Value, ShouldResemble, bson.D{{"db", "b"}, {"collection", ""}})
+			So(privileges[2].(bson.D)[0].Value, ShouldResemble, bson.D{{"cluster", true}})
+		})
+
+		Convey("a document without a db field should be left alone", func() {
+			user := bson.D{{"user", "alice"}, {"pwd", "hash"}}
+			So(restore.renameAuthzDocument(user), ShouldResemble, bson.D{{"user", "alice"}, {"pwd", "hash"}})
+		})
+	})
+}
+
+func TestShardingMetadataFromJSON(t *testing.T) {
+
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With a test mongorestore", t, func() {
+		restore := &MongoRestore{}
+
+		Convey("metadata without sharding information should return nil", func() {
+			sharding, err := restore.ShardingMetadataFromJSON([]byte(`{"options":{},"indexes":[]}`))
+			So(err, ShouldBeNil)
+			So(sharding, ShouldBeNil)
+		})
+
+		Convey("empty metadata should return nil", func() {
+			sharding, err := restore.ShardingMetadataFromJSON([]byte{})
+			So(err, ShouldBeNil)
+			So(sharding, ShouldBeNil)
+		})
+
+		Convey("sharding information should be parsed with extended json", func() {
+			sharding, err := restore.ShardingMetadataFromJSON([]byte(`{"options":{},"indexes":[],` +
+				`"sharding":{"key":{"a":1,"b":1},"unique":true,"splitPoints":[` +
+				`{"a":{"$numberLong":"5"},"b":{"$minKey":1}},` +
+				`{"a":{"$numberLong":"10"},"b":{"$oid":"57fd71e2c62c6b1e04a1a4a6"}}]}}`))
+			So(err, ShouldBeNil)
+			So(sharding, ShouldNotBeNil)
+			So(sharding.Unique, ShouldBeTrue)
+			So(len(sharding.Key), ShouldEqual, 2)
+			So(sharding.Key[0].Name, ShouldEqual, "a")
+			So(sharding.Key[1].Name, ShouldEqual, "b")
+			So(sharding.SplitPoints, ShouldResemble, []bson.D{
+				{{"a", int64(5)}, {"b", bson.MinKey}},
+				{{"a", int64(10)}, {"b", bson.ObjectIdHex("57fd71e2c62c6b1e04a1a4a6")}},
+			})
+		})
+	})
+}
@@ -2,12 +2,14 @@
 package mongorestore
 
 import (
+	"bufio"
 	"compress/gzip"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strings"
 	"sync"
 
 	"github.com/mongodb/mongo-tools/common/archive"
@@ -17,6 +19,7 @@ import (
 	"github.com/mongodb/mongo-tools/common/log"
 	"github.com/mongodb/mongo-tools/common/options"
 	"github.com/mongodb/mongo-tools/common/progress"
+	"github.com/mongodb/mongo-tools/common/transform"
 	"github.com/mongodb/mongo-tools/common/util"
 	"github.com/mongodb/mongo-tools/mongorestore/ns"
 	"gopkg.in/mgo.v2"
@@ -26,10 +29,11 @@ import (
 // MongoRestore is a container for the user-specified options and
 // internal state used for running mongorestore.
 type MongoRestore struct {
-	ToolOptions   *options.ToolOptions
-	InputOptions  *InputOptions
-	OutputOptions *OutputOptions
-	NSOptions     *NSOptions
+	ToolOptions    *options.ToolOptions
+	InputOptions   *InputOptions
+	OutputOptions  *OutputOptions
+	NSOptions      *NSOptions
+	ConvertOptions *ConvertOptions
 
 	SessionProvider *db.SessionProvider
 	ProgressManager progress.Manager
@@ -61,6 +65,12 @@ type MongoRestore struct {
 	dbCollectionIndexes map[string]collectionIndexes
 
 	archive *archive.Reader
+	// what was skipped while salvaging a damaged archive, if --salvage is specified
+	salvageReport *archive.SalvageReport
+	// whether the oplog is copied along when converting
+	convertOplog bool
+	// reshapes the documents before they are restored, if --transformFile is specified
+	transform *transform.Transform
 
 	// channel on which to notify if/when a termination signal is received
 	termChan chan struct{}
@@ -107,12 +117,14 @@ func (restore *MongoRestore) ParseAndValidateOptions() error {
 	}
 
 	var err error
-	restore.isMongos, err = restore.SessionProvider.IsMongos()
-	if err != nil {
-		return err
-	}
-	if restore.isMongos {
-		log.Logv(log.DebugLow, "restoring to a sharded system")
+	if !restore.converting() {
+		restore.isMongos, err = restore.SessionProvider.IsMongos()
+		if err != nil {
+			return err
+		}
+		if restore.isMongos {
+			log.Logv(log.DebugLow, "restoring to a sharded system")
+		}
 	}
 
 	if restore.InputOptions.OplogLimit != "" {
@@ -133,16 +145,32 @@ func (restore *MongoRestore) ParseAndValidateOptions() error {
 		}
 	}
 
-	// check if we are using a replica set and fall back to w=1 if we aren't (for <= 2.4)
-	nodeType, err := restore.SessionProvider.GetNodeType()
-	if err != nil {
-		return fmt.Errorf("error determining type of connected node: %v", err)
+	if restore.OutputOptions.TransformFile != "" {
+		if restore.InputOptions.OplogReplay {
+			return fmt.Errorf("cannot use --oplogReplay with --transformFile")
+		}
+		restore.transform, err = transform.ReadFile(restore.OutputOptions.TransformFile)
+		if err != nil {
+			return err
+		}
 	}
 
-	log.Logvf(log.DebugLow, "connected to node type: %v", nodeType)
-	restore.safety, err = db.BuildWriteConcern(restore.OutputOptions.WriteConcern, nodeType)
-	if err != nil {
-		return fmt.Errorf("error parsing write concern: %v", err)
+	if restore.converting() {
+		if err = restore.validateConvertOptions(); err != nil {
+			return err
+		}
+	} else {
+		// check if we are using a replica set and fall back to w=1 if we aren't (for <= 2.4)
+		nodeType, err := restore.SessionProvider.GetNodeType()
+		if err != nil {
+			return fmt.Errorf("error determining type of connected node: %v", err)
+		}
+
+		log.Logvf(log.DebugLow, "connected to node type: %v", nodeType)
+		restore.safety, err = db.BuildWriteConcern(restore.OutputOptions.WriteConcern, nodeType)
+		if err != nil {
+			return fmt.Errorf("error parsing write concern: %v", err)
+		}
 	}
 
 	// deprecations with --nsInclude --nsExclude
@@ -238,13 +266,142 @@ func (restore *MongoRestore) ParseAndValidateOptions() error {
 
 // Restore runs the mongorestore program.
 func (restore *MongoRestore) Restore() error {
-	var target archive.DirLike
 	err := restore.ParseAndValidateOptions()
 	if err != nil {
 		log.Logvf(log.DebugLow, "got error from options parsing: %v", err)
 		return err
 	}
 
+	if err = restore.prepareIntents(); err != nil {
+		return err
+	}
+
+	if restore.OutputOptions.DryRun {
+		log.Logvf(log.Always, "dry run completed")
+		return nil
+	}
+
+	demuxFinished, err := restore.startDemux()
+	if err != nil {
+		return err
+	}
+
+	// If restoring users and roles, make sure we validate auth versions
+	if restore.ShouldRestoreUsersAndRoles() {
+		log.Logv(log.Info, "comparing auth version of the dump directory and target server")
+		restore.authVersions.Dump, err = restore.GetDumpAuthVersion()
+		if err != nil {
+			return fmt.Errorf("error getting auth version from dump: %v", err)
+		}
+		restore.authVersions.Server, err = auth.GetAuthVersion(restore.SessionProvider)
+		if err != nil {
+			return fmt.Errorf("error getting auth version of server: %v", err)
+		}
+		err = restore.ValidateAuthVersions()
+		if err != nil {
+			return fmt.Errorf(
+				"the users and roles collections in the dump have an incompatible auth version with target server: %v",
+				err)
+		}
+	}
+
+	err = restore.LoadIndexesFromBSON()
+	if err != nil {
+		return fmt.Errorf("restore error: %v", err)
+	}
+
+	// Restore the regular collections
+	if restore.InputOptions.Archive != "" {
+		restore.manager.UsePrioritizer(restore.archive.Demux.NewPrioritizer(restore.manager))
+	} else if restore.OutputOptions.NumParallelCollections > 1 {
+		restore.manager.Finalize(intents.MultiDatabaseLTF)
+	} else {
+		// use legacy restoration order if we are single-threaded
+		restore.manager.Finalize(intents.Legacy)
+	}
+
+	restore.termChan = make(chan struct{})
+
+	if err := restore.RestoreIntents(); err != nil {
+		return err
+	}
+
+	// Restore users/roles
+	if restore.ShouldRestoreUsersAndRoles() {
+		err = restore.RestoreUsersOrRoles(restore.manager.Users(), restore.manager.Roles())
+		if err != nil {
+			return fmt.Errorf("restore error: %v", err)
+		}
+	}
+
+	// Restore oplog
+	if restore.InputOptions.OplogReplay {
+		err = restore.RestoreOplog()
+		if err != nil {
+			return fmt.Errorf("restore error: %v", err)
+		}
+	}
+
+	if restore.InputOptions.Archive != "" {
+		if err = restore.finishDemux(demuxFinished); err != nil {
+			return err
+		}
+	}
+
+	log.Logv(log.Always, "done")
+
+	return nil
+}
+
+// finishDemux waits for the demultiplexer to reach the end of the archive, and
+// reports what was salvaged from a damaged archive or left out of an archive
+// written by an interrupted dump.
+func (restore *MongoRestore) finishDemux(demuxFinished chan error) error {
+	err := <-demuxFinished
+	if restore.salvageReport != nil {
+		if err != nil {
+			return fmt.Errorf("error salvaging archive: %v", err)
+		}
+		log.Logvf(log.Always, "salvage report:\n%v", restore.salvageReport)
+	} else if err != nil {
+		log.Logvf(log.Always, "error reading the end of the archive: %v", err)
+	}
+
+	demux := restore.archive.Demux
+	if !demux.IncompleteDump() {
+		return nil
+	}
+	log.Logv(log.Always, "the dump that wrote this archive was interrupted")
+	partial := []string{}
+	for _, namespace := range demux.PartialNamespaces() {
+		partial = append(partial, displayNamespace(namespace))
+	}
+	if len(partial) > 0 {
+		log.Logvf(log.Always, "%v %v only partially dumped: %v",
+			len(partial), util.Pluralize(len(partial), "collection was", "collections were"),
+			strings.Join(partial, ", "))
+	}
+	notDumped := []string{}
+	for _, cm := range restore.archive.Prelude.NamespaceMetadatas {
+		namespace := cm.Database + "." + cm.Collection
+		if restore.manager.IntentForNamespace(namespace) != nil && !demux.Finished(namespace) {
+			notDumped = append(notDumped, displayNamespace(namespace))
+		}
+	}
+	if len(notDumped) > 0 {
+		log.Logvf(log.Always, "%v %v not dumped: %v",
+			len(notDumped), util.Pluralize(len(notDumped), "collection was", "collections were"),
+			strings.Join(notDumped, ", "))
+	}
+	return nil
+}
+
+// prepareIntents reads the prelude of the archive or scans the dump directory,
+// and builds up all intents to be restored.
+func (restore *MongoRestore) prepareIntents() error {
+	var target archive.DirLike
+	var err error
+
 	// Build up all intents to be restored
 	restore.manager = intents.NewIntentManager()
 	if restore.InputOptions.Archive == "" && restore.InputOptions.OplogReplay {
@@ -260,10 +417,14 @@ func (restore *MongoRestore) Restore() error {
 			In:      archiveReader,
 			Prelude: &archive.Prelude{},
 		}
-		err = restore.archive.Prelude.Read(restore.archive.In)
+		preludeReader := &countingReader{Reader: restore.archive.In}
+		err = restore.archive.Prelude.Read(preludeReader)
 		if err != nil {
 			return err
 		}
+		if restore.InputOptions.Salvage {
+			restore.salvageReport = &archive.SalvageReport{Offset: preludeReader.n}
+		}
 		log.Logvf(log.DebugLow, `archive format version "%v"`, restore.archive.Prelude.Header.FormatVersion)
 		log.Logvf(log.DebugLow, `archive server version "%v"`, restore.archive.Prelude.Header.ServerVersion)
 		log.Logvf(log.DebugLow, `archive tool version "%v"`, restore.archive.Prelude.Header.ToolVersion)
@@ -321,7 +482,22 @@ func (restore *MongoRestore) Restore() error {
 	// to register themselves with the demux directly
 	if restore.InputOptions.Archive != "" {
 		restore.archive.Demux = &archive.Demultiplexer{
-			In: restore.archive.In,
+			In:      restore.archive.In,
+			Salvage: restore.salvageReport,
+		}
+		// archives written to a file with --archiveTableOfContents have a
+		// table of contents that lets the demux skip the namespaces we
+		// aren't restoring, but it can't be trusted when salvaging a damaged
+		// archive
+		seeker, ok := restore.archive.In.(io.ReadSeeker)
+		if ok && restore.salvageReport == nil {
+			toc, err := archive.ReadTableOfContents(seeker)
+			if err != nil {
+				log.Logvf(log.DebugLow, "not using archive table of contents: %v", err)
+			} else if toc != nil {
+				log.Logvf(log.DebugLow, "archive has a table of contents for %v namespaces", len(toc.Namespaces()))
+				restore.archive.Demux.TableOfContents = toc
+			}
 		}
 	}
 
@@ -384,19 +560,23 @@ func (restore *MongoRestore) Restore() error {
 		}
 		return fmt.Errorf("cannot restore with conflicting namespace destinations")
 	}
+	return nil
+}
 
-	if restore.OutputOptions.DryRun {
-		log.Logvf(log.Always, "dry run completed")
-		return nil
-	}
-
+// startDemux starts demultiplexing the archive, if restoring from one, and
+// consumes the announcements of the special collections found at its start,
+// which get cached. The returned channel receives the result of the demux.
+func (restore *MongoRestore) startDemux() (chan error, error) {
+	demuxFinished := make(chan error, 1)
 	if restore.InputOptions.Archive != "" {
 		namespaceChan := make(chan string, 1)
 		namespaceErrorChan := make(chan error)
 		restore.archive.Demux.NamespaceChan = namespaceChan
 		restore.archive.Demux.NamespaceErrorChan = namespaceErrorChan
 
-		go restore.archive.Demux.Run()
+		go func() {
+			demuxFinished <- restore.archive.Demux.Run()
+		}()
 		// consume the new namespace announcement from the demux for all of the special collections
 		// that get cached when being read out of the archive.
 		// The first regular collection found gets pushed back on to the namespaceChan
@@ -410,7 +590,7 @@ func (restore *MongoRestore) Restore() error {
 			}
 			intent := restore.manager.IntentForNamespace(ns)
 			if intent == nil {
-				return fmt.Errorf("no intent for collection in archive: %v", ns)
+				return nil, fmt.Errorf("no intent for collection in archive: %v", ns)
 			}
 			if intent.IsSystemIndexes() ||
 				intent.IsUsers() ||
@@ -429,86 +609,31 @@ func (restore *MongoRestore) Restore() error {
 		}
 	}
 
-	// If restoring users and roles, make sure we validate auth versions
-	if restore.ShouldRestoreUsersAndRoles() {
-		log.Logv(log.Info, "comparing auth version of the dump directory and target server")
-		restore.authVersions.Dump, err = restore.GetDumpAuthVersion()
-		if err != nil {
-			return fmt.Errorf("error getting auth version from dump: %v", err)
-		}
-		restore.authVersions.Server, err = auth.GetAuthVersion(restore.SessionProvider)
-		if err != nil {
-			return fmt.Errorf("error getting auth version of server: %v", err)
-		}
-		err = restore.ValidateAuthVersions()
-		if err != nil {
-			return fmt.Errorf(
-				"the users and roles collections in the dump have an incompatible auth version with target server: %v",
-				err)
-		}
-	}
-
-	err = restore.LoadIndexesFromBSON()
-	if err != nil {
-		return fmt.Errorf("restore error: %v", err)
-	}
-
-	// Restore the regular collections
-	if restore.InputOptions.Archive != "" {
-		restore.manager.UsePrioritizer(restore.archive.Demux.NewPrioritizer(restore.manager))
-	} else if restore.OutputOptions.NumParallelCollections > 1 {
-		restore.manager.Finalize(intents.MultiDatabaseLTF)
-	} else {
-		// use legacy restoration order if we are single-threaded
-		restore.manager.Finalize(intents.Legacy)
-	}
-
-	restore.termChan = make(chan struct{})
-
-	if err := restore.RestoreIntents(); err != nil {
-		return err
-	}
-
-	// Restore users/roles
-	if restore.ShouldRestoreUsersAndRoles() {
-		err = restore.RestoreUsersOrRoles(restore.manager.Users(), restore.manager.Roles())
-		if err != nil {
-			return fmt.Errorf("restore error: %v", err)
-		}
-	}
-
-	// Restore oplog
-	if restore.InputOptions.OplogReplay {
-		err = restore.RestoreOplog()
-		if err != nil {
-			return fmt.Errorf("restore error: %v", err)
-		}
-	}
-
-	log.Logv(log.Always, "done")
-
-	return nil
+	return demuxFinished, nil
 }
 
 func (restore *MongoRestore) getArchiveReader() (rc io.ReadCloser, err error) {
 	if restore.InputOptions.Archive == "-" {
-		rc = ioutil.NopCloser(restore.InputReader)
+		// the volumes of a multi-volume archive can be piped in one after another
+		in := bufio.NewReader(restore.InputReader)
+		if magic, _ := in.Peek(4); archive.IsVolume(magic) {
+			rc = archive.NewVolumeReader(ioutil.NopCloser(in))
+		} else {
+			rc = ioutil.NopCloser(in)
+		}
 	} else {
 		targetStat, err := os.Stat(restore.InputOptions.Archive)
-		if err != nil {
-			return nil, err
-		}
-		if targetStat.IsDir() {
+		if err == nil && targetStat.IsDir() {
 			defaultArchiveFilePath := filepath.Join(restore.InputOptions.Archive, "archive")
 			if restore.InputOptions.Gzip {
 				defaultArchiveFilePath = defaultArchiveFilePath + ".gz"
 			}
-			rc, err = os.Open(defaultArchiveFilePath)
+			rc, err = openArchiveFile(defaultArchiveFilePath)
 			if err != nil {
 				return nil, err
 			}
 		} else {
-			rc, err = os.Open(restore.InputOptions.Archive)
+			rc, err = openArchiveFile(restore.InputOptions.Archive)
 			if err != nil {
 				return nil, err
 			}
@@ -524,6 +649,45 @@ func (restore *MongoRestore) getArchiveReader() (rc io.ReadCloser, err error) {
 	return rc, nil
 }
 
+// openArchiveFile opens the archive at path. If the archive was split into
+// volumes, path can either be the path it was dumped to, or its first volume.
+func openArchiveFile(path string) (io.ReadCloser, error) {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		if _, volumeErr := os.Stat(archive.VolumePath(path, 1)); volumeErr == nil {
+			return archive.OpenVolumes(path)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	firstVolumeSuffix := archive.VolumePath("", 1)
+	if strings.HasSuffix(path, firstVolumeSuffix) {
+		magic := make([]byte, 4)
+		if _, err = io.ReadFull(file, magic); err == nil && archive.IsVolume(magic) {
+			file.Close()
+			return archive.OpenVolumes(strings.TrimSuffix(path, firstVolumeSuffix))
+		}
+		if _, err = file.Seek(0, io.SeekStart); err != nil {
+			file.Close()
+			return nil, err
+		}
+	}
+	return file, nil
+}
+
+// countingReader counts the bytes read through it.
+type countingReader struct {
+	io.Reader
+	n int64
+}
+
+func (cr *countingReader) Read(p []byte) (int, error) {
+	n, err := cr.Reader.Read(p)
+	cr.n += int64(n)
+	return n, err
+}
+
 func (restore *MongoRestore) HandleInterrupt() {
 	if restore.termChan != nil {
 		close(restore.termChan)
@@ -20,6 +20,9 @@ type InputOptions struct {
 	RestoreDBUsersAndRoles bool   `long:"restoreDbUsersAndRoles" description:"restore user and role definitions for the given database"`
 	Directory              string `long:"dir" value-name:"<directory-name>" description:"input directory, use '-' for stdin"`
 	Gzip                   bool   `long:"gzip" description:"decompress gzipped input"`
+	List                   bool   `long:"list" description:"list the contents of the archive without connecting to a server or restoring anything; document counts are listed for archives written with mongodump --archiveTableOfContents, and need --verify otherwise"`
+	Verify                 bool   `long:"verify" description:"read the whole archive and check the CRC of every collection without connecting to a server (implies --list)"`
+	Salvage                bool   `long:"salvage" description:"skip over corrupted parts of the archive instead of failing, restoring every intact document, and report the damaged ranges"`
 }
 
 // Name returns a human-readable group name for input options.
@@ -34,6 +37,7 @@ type OutputOptions struct {
 	WriteConcern             string `long:"writeConcern" value-name:"<write-concern>" default:"majority" default-mask:"-" description:"write concern options e.g. --writeConcern majority, --writeConcern '{w: 3, wtimeout: 500, fsync: true, j: true}' (defaults to 'majority')"`
 	NoIndexRestore           bool   `long:"noIndexRestore" description:"don't restore indexes"`
 	NoOptionsRestore         bool   `long:"noOptionsRestore" description:"don't restore collection options"`
+	NoShardingRestore        bool   `long:"noShardingRestore" description:"don't shard and pre-split collections that were sharded when dumped, when restoring through a mongos"`
 	KeepIndexVersion         bool   `long:"keepIndexVersion" description:"don't update index version"`
 	MaintainInsertionOrder   bool   `long:"maintainInsertionOrder" description:"preserve order of documents during restoration"`
 	NumParallelCollections   int    `long:"numParallelCollections" short:"j" description:"number of collections to restore in parallel (4 by default)" default:"4" default-mask:"-"`
@@ -43,6 +47,7 @@ type OutputOptions struct {
 	TempUsersColl            string `long:"tempUsersColl" default:"tempusers" hidden:"true"`
 	TempRolesColl            string `long:"tempRolesColl" default:"temproles" hidden:"true"`
 	BulkBufferSize           int    `long:"batchSize" default:"1000" hidden:"true"`
+	TransformFile            string `long:"transformFile" value-name:"<filename>" description:"YAML or JSON file of rules applied in order to each document before it is restored; rules with a 'namespace' pattern only apply to the matching namespaces they are restored to"`
 }
 
 // Name returns a human-readable group name for output options.
@@ -66,3 +71,15 @@ type NSOptions struct {
 func (*NSOptions) Name() string {
 	return "namespace"
 }
+
+// ConvertOptions defines the set of options for converting dumps without a server.
+type ConvertOptions struct {
+	ToArchive string `long:"convertToArchive" value-name:"<filename>" optional:"true" optional-value:"-" description:"write the input to an archive file instead of restoring it, without connecting to a server. If flag is specified without a value, archive is written to stdout"`
+	ToDir     string `long:"convertToDir" value-name:"<directory-name>" description:"write the input to a dump directory instead of restoring it, without connecting to a server"`
+	Gzip      bool   `long:"convertGzip" description:"compress the converted archive or collection files with gzip"`
+}
+
+// Name returns a human-readable group name for convert options.
+func (*ConvertOptions) Name() string {
+	return "convert"
+}
@@ -111,6 +111,7 @@ func (restore *MongoRestore) RestoreIntent(intent *intents.Intent) error {
 
 	var options bson.D
 	var indexes []IndexDocument
+	var sharding *ShardingMetadata
 
 	// get indexes from system.indexes dump if we have it but don't have metadata files
 	if intent.MetadataFile == nil {
@@ -140,6 +141,12 @@ func (restore *MongoRestore) RestoreIntent(intent *intents.Intent) error {
 		if err != nil {
 			return fmt.Errorf("error parsing metadata from %v: %v", intent.MetadataLocation, err)
 		}
+		if restore.isMongos && !restore.OutputOptions.NoShardingRestore {
+			sharding, err = restore.ShardingMetadataFromJSON(metadata)
+			if err != nil {
+				return fmt.Errorf("error parsing sharding metadata from %v: %v", intent.MetadataLocation, err)
+			}
+		}
 
 		// The only way to specify options on the idIndex is at collection creation time.
 		// This loop pulls out the idIndex from `indexes` and sets it in `options`.
@@ -178,6 +185,14 @@ func (restore *MongoRestore) RestoreIntent(intent *intents.Intent) error {
 		if err != nil {
 			return fmt.Errorf("error creating collection %v: %v", intent.Namespace(), err)
 		}
+		// shard the collection before loading any data, so that the data is
+		// spread across the shards as it is inserted
+		if sharding != nil {
+			err = restore.ShardCollection(intent, sharding)
+			if err != nil {
+				return fmt.Errorf("error sharding collection %v: %v", intent.Namespace(), err)
+			}
+		}
 	} else {
 		log.Logvf(log.Info, "collection %v already exists - skipping collection create", intent.Namespace())
 	}
@@ -217,6 +232,16 @@ func (restore *MongoRestore) RestoreIntent(intent *intents.Intent) error {
 	return nil
 }
 
+// transformDocument applies the --transformFile rules for a namespace to a
+// document being restored to it.
+func (restore *MongoRestore) transformDocument(namespace string, rawDoc bson.Raw) (bson.D, error) {
+	doc := bson.D{}
+	if err := bson.Unmarshal(rawDoc.Data, &doc); err != nil {
+		return nil, fmt.Errorf("invalid object: %v", err)
+	}
+	return restore.transform.Apply(namespace, doc)
+}
+
 // RestoreCollectionToDB pipes the given BSON data into the database.
 // Returns the number of documents restored and any errors that occured.
 func (restore *MongoRestore) RestoreCollectionToDB(dbName, colName string,
@@ -268,6 +293,11 @@ func (restore *MongoRestore) RestoreCollectionToDB(dbName, colName string,
 		close(docChan)
 	}()
 
+	// the --transformFile rules are applied to the namespace the collection
+	// is restored to
+	namespace := dbName + "." + colName
+	transforming := restore.transform != nil && restore.transform.AppliesTo(namespace)
+
 	log.Logvf(log.DebugLow, "using %v insertion workers", maxInsertWorkers)
 
 	for i := 0; i < maxInsertWorkers; i++ {
@@ -287,7 +317,21 @@ func (restore *MongoRestore) RestoreCollectionToDB(dbName, colName string,
 						return
 					}
 				}
-				if err := bulk.Insert(rawDoc); err != nil {
+				var doc interface{} = rawDoc
+				if transforming {
+					transformed, err := restore.transformDocument(namespace, rawDoc)
+					if err != nil {
+						if restore.OutputOptions.StopOnError {
+							resultChan <- err
+							return
+						}
+						log.Logvf(log.Always, "error: %v", err)
+						watchProgressor.Set(file.Pos())
+						continue
+					}
+					doc = transformed
+				}
+				if err := bulk.Insert(doc); err != nil {
 					if db.IsConnectionError(err) || restore.OutputOptions.StopOnError {
 						// Propagate this error, since it's either a fatal connection error
 						// or the user has turned on --stopOnError
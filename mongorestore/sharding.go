@@ -0,0 +1,184 @@
+package mongorestore
+
+import (
+	"fmt"
+
+	"github.com/mongodb/mongo-tools/common/db"
+	"github.com/mongodb/mongo-tools/common/intents"
+	"github.com/mongodb/mongo-tools/common/log"
+	"github.com/mongodb/mongo-tools/common/util"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// error code returned by enableSharding on servers that consider enabling
+// sharding twice to be an error
+const alreadyInitializedErrorCode = 23
+
+// ShardCollection recreates the sharding configuration of the intent's
+// collection on the connected mongos. It enables sharding on the database,
+// shards the (empty) collection on its original shard key, splits it at the
+// original split points and distributes the resulting chunks round-robin
+// across the cluster's shards.
+func (restore *MongoRestore) ShardCollection(intent *intents.Intent, sharding *ShardingMetadata) error {
+	session, err := restore.SessionProvider.GetSession()
+	if err != nil {
+		return fmt.Errorf("error establishing connection: %v", err)
+	}
+	defer session.Close()
+	session.SetSocketTimeout(0)
+
+	existing, err := db.GetShardedCollection(session, intent.Namespace())
+	if err != nil {
+		return fmt.Errorf("error reading sharding configuration: %v", err)
+	}
+	if existing != nil {
+		log.Logvf(log.Info, "collection %v is already sharded, skipping shard key restore", intent.Namespace())
+		return nil
+	}
+
+	log.Logvf(log.Info, "enabling sharding for database %v", intent.DB)
+	res := bson.M{}
+	err = session.Run(bson.D{{"enableSharding", intent.DB}}, &res)
+	if qerr, ok := err.(*mgo.QueryError); ok && qerr.Code == alreadyInitializedErrorCode {
+		err = nil
+	}
+	if err != nil {
+		return fmt.Errorf("error enabling sharding for database %v: %v", intent.DB, err)
+	}
+
+	log.Logvf(log.Always, "sharding collection %v on %v", intent.Namespace(), sharding.Key)
+	command := bson.D{
+		{"shardCollection", intent.Namespace()},
+		{"key", sharding.Key},
+		{"unique", sharding.Unique},
+	}
+	if isHashedShardKey(sharding.Key) && len(sharding.SplitPoints) > 0 {
+		// the split points recreate the chunks, so don't let the server
+		// create its own initial chunks for the hashed key
+		command = append(command, bson.DocElem{"numInitialChunks", 1})
+	}
+	res = bson.M{}
+	if err = session.Run(command, &res); err != nil {
+		return fmt.Errorf("error running shardCollection command: %v", err)
+	}
+	if util.IsFalsy(res["ok"]) {
+		return fmt.Errorf("shardCollection command: %v", res["errmsg"])
+	}
+
+	if len(sharding.SplitPoints) == 0 {
+		return nil
+	}
+	if err = restore.splitChunks(session, intent, sharding.SplitPoints); err != nil {
+		return err
+	}
+	return restore.distributeChunks(session, intent)
+}
+
+// splitChunks splits the intent's newly sharded collection at each of the
+// given split points that is not already a chunk boundary.
+func (restore *MongoRestore) splitChunks(session *mgo.Session, intent *intents.Intent, splitPoints []bson.D) error {
+	chunks, err := readChunks(session, intent.Namespace())
+	if err != nil {
+		return err
+	}
+	boundaries := map[string]bool{}
+	for _, chunk := range chunks {
+		key, err := bson.Marshal(chunk.Min)
+		if err != nil {
+			return fmt.Errorf("error reading chunk bounds: %v", err)
+		}
+		boundaries[string(key)] = true
+	}
+
+	log.Logvf(log.Info, "pre-splitting collection %v into %v chunks", intent.Namespace(), len(splitPoints)+1)
+	for _, splitPoint := range splitPoints {
+		key, err := bson.Marshal(splitPoint)
+		if err != nil {
+			return fmt.Errorf("error reading split point %v: %v", splitPoint, err)
+		}
+		if boundaries[string(key)] {
+			continue
+		}
+		res := bson.M{}
+		err = session.DB("admin").Run(bson.D{{"split", intent.Namespace()}, {"middle", splitPoint}}, &res)
+		if err != nil {
+			return fmt.Errorf("error splitting collection %v at %v: %v", intent.Namespace(), splitPoint, err)
+		}
+		if util.IsFalsy(res["ok"]) {
+			return fmt.Errorf("split command: %v", res["errmsg"])
+		}
+	}
+	return nil
+}
+
+// distributeChunks moves the chunks of the intent's collection so that they
+// are spread round-robin across the shards of the cluster, in key order.
+func (restore *MongoRestore) distributeChunks(session *mgo.Session, intent *intents.Intent) error {
+	shardList := struct {
+		Shards []struct {
+			ID string `bson:"_id"`
+		} `bson:"shards"`
+	}{}
+	err := session.DB("admin").Run("listShards", &shardList)
+	if err != nil {
+		return fmt.Errorf("error listing shards: %v", err)
+	}
+	if len(shardList.Shards) < 2 {
+		return nil
+	}
+
+	chunks, err := readChunks(session, intent.Namespace())
+	if err != nil {
+		return err
+	}
+	log.Logvf(log.Info, "distributing %v chunks of collection %v across %v shards",
+		len(chunks), intent.Namespace(), len(shardList.Shards))
+	for i, chunk := range chunks {
+		target := shardList.Shards[i%len(shardList.Shards)].ID
+		if chunk.Shard == target {
+			continue
+		}
+		log.Logvf(log.DebugLow, "moving chunk %v of collection %v to shard %v", chunk.Min, intent.Namespace(), target)
+		res := bson.M{}
+		err = session.DB("admin").Run(bson.D{
+			{"moveChunk", intent.Namespace()},
+			{"bounds", []bson.D{chunk.Min, chunk.Max}},
+			{"to", target},
+		}, &res)
+		if err != nil {
+			return fmt.Errorf("error moving chunk %v of collection %v to shard %v: %v",
+				chunk.Min, intent.Namespace(), target, err)
+		}
+		if util.IsFalsy(res["ok"]) {
+			return fmt.Errorf("moveChunk command: %v", res["errmsg"])
+		}
+	}
+	return nil
+}
+
+// readChunks returns all chunks of the given sharded namespace in key order.
+func readChunks(session *mgo.Session, namespace string) ([]db.Chunk, error) {
+	coll, err := db.GetShardedCollection(session, namespace)
+	if err != nil {
+		return nil, fmt.Errorf("error reading sharding configuration: %v", err)
+	}
+	if coll == nil {
+		return nil, fmt.Errorf("collection %v is not sharded", namespace)
+	}
+	chunks := []db.Chunk{}
+	if err = db.GetChunks(session, namespace, coll).All(&chunks); err != nil {
+		return nil, fmt.Errorf("error reading chunks: %v", err)
+	}
+	return chunks, nil
+}
+
+// isHashedShardKey returns true if any field of the shard key is hashed.
+func isHashedShardKey(key bson.D) bool {
+	for _, elem := range key {
+		if elem.Value == "hashed" {
+			return true
+		}
+	}
+	return false
+}